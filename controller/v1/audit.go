@@ -0,0 +1,136 @@
+package v1
+
+import (
+	"pdf_service_api/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// auditChange is a change of one resource made by a request, before is nil for created and
+// after is nil for deleted resources.
+type auditChange struct {
+	action       models.AuditAction
+	resourceType models.AuditResourceType
+	resourceUid  uuid.UUID
+	documentUid  *uuid.UUID
+	before       any
+	after        any
+}
+
+// recordAudit stores the changes of a request in the audit log, attributed to the actor. The
+// owner is taken from the document of each change when it is nil, and so is the actor of
+// requests that do not name their caller, which act on behalf of the owner. The changes are
+// already made, so failing to record them only logs an error.
+func recordAudit(c *gin.Context, repository models.AuditRepository, actorUid, ownerUid *uuid.UUID, changes ...auditChange) {
+	if repository == nil || len(changes) == 0 {
+		return
+	}
+
+	var requestId, ip *string
+	if value := requestID(c); value != "" {
+		requestId = &value
+	}
+	if value := c.ClientIP(); value != "" {
+		ip = &value
+	}
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	entries := make([]models.AuditEntry, 0, len(changes))
+	for _, change := range changes {
+		diff, err := models.AuditChanges(change.before, change.after)
+		if err != nil {
+			requestLogger(c).Error("comparing audited changes failed", "error", err)
+		}
+
+		entries = append(entries, models.AuditEntry{
+			Uuid:         uuid.New(),
+			ActorUUID:    actorUid,
+			OwnerUUID:    ownerUid,
+			Action:       change.action,
+			ResourceType: change.resourceType,
+			ResourceUUID: change.resourceUid,
+			DocumentUUID: change.documentUid,
+			RequestID:    requestId,
+			IP:           ip,
+			Timestamp:    now,
+			Changes:      diff,
+		})
+	}
+
+	if err := scoped(c, repository).AddEntries(entries); err != nil {
+		requestLogger(c).Error("writing audit log failed", "error", err)
+	}
+}
+
+// selectionChange is the audited change of a selection, before or after may be nil.
+func selectionChange(action models.AuditAction, before, after *models.Selection) auditChange {
+	change := auditChange{action: action, resourceType: models.AuditResourceSelection}
+	for _, selection := range []*models.Selection{before, after} {
+		if selection != nil {
+			change.resourceUid, change.documentUid = selection.Uuid, selection.DocumentUUID
+		}
+	}
+
+	if before != nil {
+		change.before = before
+	}
+	if after != nil {
+		change.after = after
+	}
+
+	return change
+}
+
+// templateChange is the audited change of a selection template, before or after may be nil.
+func templateChange(action models.AuditAction, before, after *models.SelectionTemplate) auditChange {
+	change := auditChange{action: action, resourceType: models.AuditResourceSelectionTemplate}
+	for _, template := range []*models.SelectionTemplate{before, after} {
+		if template != nil {
+			change.resourceUid, change.documentUid = template.Uuid, template.SourceDocumentUUID
+		}
+	}
+
+	if before != nil {
+		change.before = before
+	}
+	if after != nil {
+		change.after = after
+	}
+
+	return change
+}
+
+// createdSelections are the audited changes of newly stored selections.
+func createdSelections(selections []models.Selection) []auditChange {
+	changes := make([]auditChange, 0, len(selections))
+	for i := range selections {
+		changes = append(changes, selectionChange(models.AuditActionCreate, nil, &selections[i]))
+	}
+
+	return changes
+}
+
+// auditedDocument leaves the content out of a document, only its attributes are audited.
+func auditedDocument(document models.Document) *models.Document {
+	document.PdfBase64 = nil
+	document.SelectionData = nil
+	return &document
+}
+
+// auditedMeta leaves the page images out of meta data, only the page geometry is audited.
+func auditedMeta(meta models.Meta) *models.Meta {
+	meta.Images = nil
+	return &meta
+}
+
+// optionalOwnerUUID reads the "ownerUUID" query parameter of requests that do not require it.
+func optionalOwnerUUID(c *gin.Context) *uuid.UUID {
+	ownerUid, err := uuid.Parse(c.Query("ownerUUID"))
+	if err != nil {
+		return nil
+	}
+
+	return &ownerUid
+}
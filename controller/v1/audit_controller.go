@@ -0,0 +1,125 @@
+package v1
+
+import (
+	"fmt"
+	"net/http"
+	"pdf_service_api/models"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// defaultAuditLimit and maxAuditLimit bound the number of audit entries returned at once.
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+type AuditController struct {
+	AuditRepository models.AuditRepository
+}
+
+// GetAuditEntries handles the HTTP GET request to read the audit log. It expects the query
+// parameter "ownerUUID", see requireOwnerUUID, and returns the changes the caller made together
+// with the changes anyone made to the caller's documents, newest first.
+//
+// The entries can be narrowed to a time range with "from" (inclusive) and "to" (exclusive),
+// both RFC 3339 timestamps, and to an action, a resource or a document.
+//
+// @Summary Read the audit log
+// @Description Lists who changed which document, meta data, selection or template, with a before/after diff, newest first.
+// @Tags audit
+// @Produce  json
+// @Param   ownerUUID query string true "The UUID of the caller, who sees their own changes and the changes to their documents"
+// @Param   from query string false "Only entries at or after this RFC 3339 time"
+// @Param   to query string false "Only entries before this RFC 3339 time"
+// @Param   action query string false "Only entries of this action" Enums(create,update,delete)
+// @Param   resourceType query string false "Only entries of this type of resource" Enums(document,meta,selection,selectionTemplate,share)
+// @Param   resourceUUID query string false "Only entries of this resource"
+// @Param   documentUUID query string false "Only entries of resources of this document"
+// @Param   limit query int false "Maximum number of entries, 100 by default and at most 1000"
+// @Success 200 {object} object{entries=[]models.AuditEntry} "The audit entries"
+// @Failure 400 {object} object{error=string} "Bad request, typically due to missing/invalid parameters"
+// @Failure 500 {object} object{error=string} "Internal server error, typically due to database issues"
+// @Router /audit [get]
+func (t AuditController) GetAuditEntries(c *gin.Context) {
+	ownerUid, isValid := requireOwnerUUID(c)
+	if !isValid {
+		return
+	}
+
+	filter, err := auditFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	entries, err := scoped(c, t.AuditRepository).GetEntries(ownerUid, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"entries": entries})
+}
+
+// auditFilter reads the filters of GetAuditEntries from the query.
+func auditFilter(c *gin.Context) (models.AuditFilter, error) {
+	filter := models.AuditFilter{Limit: defaultAuditLimit}
+
+	for name, target := range map[string]**time.Time{"from": &filter.From, "to": &filter.To} {
+		if value, isPresent := c.GetQuery(name); isPresent {
+			timestamp, err := time.Parse(time.RFC3339Nano, value)
+			if err != nil {
+				return filter, fmt.Errorf("%s must be an RFC 3339 time", name)
+			}
+			*target = &timestamp
+		}
+	}
+
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		return filter, fmt.Errorf("from must be before to")
+	}
+
+	if value, isPresent := c.GetQuery("action"); isPresent {
+		action := models.AuditAction(value)
+		if !action.IsValid() {
+			return filter, fmt.Errorf("unknown action %q, expected create, update or delete", value)
+		}
+		filter.Action = &action
+	}
+
+	if value, isPresent := c.GetQuery("resourceType"); isPresent {
+		resourceType := models.AuditResourceType(value)
+		if !resourceType.IsValid() {
+			return filter, fmt.Errorf("unknown resource type %q", value)
+		}
+		filter.ResourceType = &resourceType
+	}
+
+	for name, target := range map[string]**uuid.UUID{"resourceUUID": &filter.ResourceUUID, "documentUUID": &filter.DocumentUUID} {
+		if value, isPresent := c.GetQuery(name); isPresent {
+			uid, err := uuid.Parse(value)
+			if err != nil {
+				return filter, fmt.Errorf("%s is invalid: %w", name, err)
+			}
+			*target = &uid
+		}
+	}
+
+	if value, isPresent := c.GetQuery("limit"); isPresent {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxAuditLimit {
+			return filter, fmt.Errorf("limit must be a number between 1 and %d", maxAuditLimit)
+		}
+		filter.Limit = limit
+	}
+
+	return filter, nil
+}
+
+func (t AuditController) SetupRouter(c *gin.RouterGroup) {
+	c.GET("/", t.GetAuditEntries)
+}
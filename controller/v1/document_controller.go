@@ -3,11 +3,14 @@ package v1
 import (
 	"database/sql"
 	"errors"
-	"fmt"
+	"io"
 	"net/http"
 	"pdf_service_api/models"
+	"pdf_service_api/service/pdf"
 	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -15,7 +18,11 @@ import (
 
 // DocumentController injects the dependencies required for the controller implementations to operate.
 type DocumentController struct {
-	DocumentRepository models.DocumentRepository
+	DocumentRepository   models.DocumentRepository
+	MetaExtractionQueue  models.MetaExtractionQueue
+	ExtractMetaByDefault bool
+	Events               models.EventBus
+	AuditRepository      models.AuditRepository
 }
 
 // GetDocumentHandler
@@ -27,10 +34,13 @@ type DocumentController struct {
 // @Produce json
 // @Param documentUUID query string false "The unique identifier of the document to retrieve. If provided"
 // @Param ownerUUID query string true "The unique identifier of the owner whose documents are to be retrieved."
-// @Param exclude query []string false "Fields to exclude from the response. Allowed values: `documentTitle`, `timeCreated`, `ownerUUID`, `ownerType`, `pdfBase64`." collectionFormat(multi)
+// @Param exclude query []string false "Fields to exclude from the response. Allowed values: `documentTitle`, `timeCreated`, `ownerUUID`, `ownerType`, `pdfBase64`, `metaStatus`, `derivedFromUUID`." collectionFormat(multi)
 // @Param offset query int false "What should the offset be"
 // @Param limit query int false "How many should be returned"
+// @Param If-None-Match header string false "The ETag of a cached response, answered with 304 Not Modified while it is current"
 // @Success 200 {object} object{documents=[]models.Document} "Successfully retrieved document(s)."
+// @Header 200 {string} ETag "The version of the document, or a tag of the versions of the listed documents"
+// @Success 304 "The cached document(s) are still current"
 // @Failure 400 {object} object{error=string} "Bad Request: Invalid UUID format or no valid parameters specified."
 // @Failure 404 {object} object{error=string} "Not Found: No document(s) found for the given UUID."
 // @Failure 500 {object} object{error=string} "Internal Server Error: An unexpected error occurred on the server."
@@ -57,6 +67,14 @@ func (t DocumentController) GetDocumentHandler(c *gin.Context) {
 		if slices.Contains(values, "pdfBase64") {
 			exclude.PdfBase64(true)
 		}
+
+		if slices.Contains(values, "metaStatus") {
+			exclude.MetaStatus(true)
+		}
+
+		if slices.Contains(values, "derivedFromUUID") {
+			exclude.DerivedFromUUID(true)
+		}
 	}
 
 	var limit uint32 = 100
@@ -100,7 +118,7 @@ func (t DocumentController) GetDocumentHandler(c *gin.Context) {
 			return
 		}
 
-		document, err := t.DocumentRepository.GetDocumentByDocumentUUID(documentUid, ownerUid, exclude)
+		document, err := scoped(c, t.DocumentRepository).GetDocumentByDocumentUUID(documentUid, ownerUid, exclude)
 		if err != nil {
 			switch {
 			case errors.Is(err, sql.ErrNoRows):
@@ -108,16 +126,20 @@ func (t DocumentController) GetDocumentHandler(c *gin.Context) {
 				return
 			default:
 				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				fmt.Println("ERROR WHILE EXECUTING SQL QUERY: " + err.Error())
+				requestLogger(c).Error("sql query failed", "error", err)
 				return
 			}
 		}
 
+		if notModified(c, versionETag(document.Version)) {
+			return
+		}
+
 		c.JSON(200, gin.H{"documents": []models.Document{document}})
 		return
 	}
 
-	documents, err := t.DocumentRepository.GetDocumentByOwnerUUID(ownerUid, limit, offset, exclude)
+	documents, err := scoped(c, t.DocumentRepository).GetDocumentByOwnerUUID(ownerUid, limit, offset, exclude)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -125,11 +147,17 @@ func (t DocumentController) GetDocumentHandler(c *gin.Context) {
 			return
 		default:
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			fmt.Println("ERROR WHILE EXECUTING SQL QUERY: " + err.Error())
+			requestLogger(c).Error("sql query failed", "error", err)
 			return
 		}
 	}
 
+	if notModified(c, listETag(documents, func(document models.Document) (uuid.UUID, int) {
+		return document.Uuid, document.Version
+	})) {
+		return
+	}
+
 	c.JSON(200, gin.H{"documents": documents})
 	return
 }
@@ -142,14 +170,25 @@ func (t DocumentController) GetDocumentHandler(c *gin.Context) {
 // newly created document. If there's an error during request binding or
 // document upload, it returns a 400 Bad Request status with an error message.
 //
+// When meta extraction is requested, either through the extractMeta flag or the
+// server default, the extraction is queued and the returned metaStatus can be
+// followed on the document.
+//
 // @Summary Upload a new document
 // @Description Uploads a document by receiving its base64 encoded string in the request body.
+// @Description Meta extraction is queued automatically when extractMeta is true, or when it is omitted and the server enables it by default.
 // @Tags documents
 // @Accept  json
 // @Produce  json
 // @Param   request body v1.CreateRequest true "Document upload request"
-// @Success 200 {object} map[string]string "Successful upload, returns the document UUID"
+// @Param Idempotency-Key header string false "A key that makes the request safe to retry, a retry with it is answered with the first response"
+// @Success 200 {object} map[string]string "Successful upload, returns the document UUID and the meta status when an extraction was queued"
 // @Failure 400 "Bad request, typically due to invalid input or upload failure"
+// @Failure 409 "A request with the same Idempotency-Key is still being processed"
+// @Failure 412 "The request carried an If-Match header, which it does not support"
+// @Failure 413 "The body of a request with an Idempotency-Key is too large"
+// @Failure 422 "The Idempotency-Key was already used for a different request"
+// @Failure 503 "Meta extraction was requested, but is not configured on this server"
 // @Router /documents [post]
 func (t DocumentController) UploadDocumentHandler(c *gin.Context) {
 	body := &CreateRequest{}
@@ -160,6 +199,26 @@ func (t DocumentController) UploadDocumentHandler(c *gin.Context) {
 		return
 	}
 
+	if body.OwnerUUID != nil {
+		setRequestOwner(c, *body.OwnerUUID)
+	}
+
+	if body.ExtractMeta != nil && *body.ExtractMeta {
+		if body.OwnerUUID == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "ownerUUID is required to extract meta"})
+			return
+		}
+
+		if t.MetaExtractionQueue == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "meta extraction is not configured on this server"})
+			return
+		}
+	}
+
+	if body.DocumentTitle == nil || *body.DocumentTitle == "" {
+		body.DocumentTitle = documentTitleFromPdf(body.DocumentBase64String)
+	}
+
 	newModel := models.Document{
 		Uuid:          uuid.New(),
 		PdfBase64:     &body.DocumentBase64String,
@@ -169,13 +228,82 @@ func (t DocumentController) UploadDocumentHandler(c *gin.Context) {
 		SelectionData: nil,
 	}
 
-	err = t.DocumentRepository.UploadDocument(newModel)
+	extractMeta := t.shouldExtractMeta(body)
+	if extractMeta {
+		status := models.MetaStatusPending
+		newModel.MetaStatus = &status
+	}
+
+	err = scoped(c, t.DocumentRepository).UploadDocument(newModel)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(200, gin.H{"documentUUID": newModel.Uuid})
+	recordAudit(c, t.AuditRepository, body.OwnerUUID, body.OwnerUUID, auditChange{
+		action:       models.AuditActionCreate,
+		resourceType: models.AuditResourceDocument,
+		resourceUid:  newModel.Uuid,
+		documentUid:  &newModel.Uuid,
+		after:        auditedDocument(newModel),
+	})
+
+	if !extractMeta {
+		c.JSON(200, gin.H{"documentUUID": newModel.Uuid})
+		return
+	}
+
+	job := models.MetaExtractionJob{
+		DocumentUUID: newModel.Uuid,
+		OwnerUUID:    *body.OwnerUUID,
+		PdfBase64:    newModel.PdfBase64,
+		RequestID:    requestID(c),
+	}
+	if body.OwnerType != nil {
+		job.OwnerType = *body.OwnerType
+	}
+
+	status := models.MetaStatusPending
+	if err := t.MetaExtractionQueue.Enqueue(job); err != nil {
+		requestLogger(c).Error("queueing meta extraction failed", "documentUUID", newModel.Uuid, "error", err)
+		status = models.MetaStatusFailed
+		if err := scoped(c, t.DocumentRepository).SetMetaStatus(newModel.Uuid, status); err != nil {
+			requestLogger(c).Error("sql query failed", "error", err)
+		}
+	}
+
+	c.JSON(200, gin.H{"documentUUID": newModel.Uuid, "metaStatus": status})
+}
+
+// documentTitleFromPdf reads the title from the information dictionary of a pdf document.
+// Documents that can not be parsed or have no title return nil.
+func documentTitleFromPdf(base64 string) *string {
+	document, err := pdf.OpenBase64(strings.NewReader(base64))
+	if err != nil {
+		return nil
+	}
+
+	title := document.Info().Title
+	if title == "" {
+		return nil
+	}
+
+	return &title
+}
+
+// shouldExtractMeta decides if an upload should queue a meta extraction. The request flag takes
+// precedence over the server default, and extraction is only possible with a queue and an owner.
+// Uploads explicitly asking for an extraction that is not possible are rejected before.
+func (t DocumentController) shouldExtractMeta(body *CreateRequest) bool {
+	if t.MetaExtractionQueue == nil || body.OwnerUUID == nil {
+		return false
+	}
+
+	if body.ExtractMeta != nil {
+		return *body.ExtractMeta
+	}
+
+	return t.ExtractMetaByDefault
 }
 
 // DeleteDocumentHandler handles the HTTP DELETE request to delete a document by its UUID.
@@ -186,6 +314,9 @@ func (t DocumentController) UploadDocumentHandler(c *gin.Context) {
 // If the UUID is missing, invalid, or if an error occurs during deletion, it returns
 // a 400 Bad Request status with an appropriate error message.
 //
+// With an If-Match header the document is only deleted while it is at the version of the ETag
+// the caller read, otherwise a 412 Precondition Failed is returned.
+//
 // @Summary Delete a document
 // @Description Deletes a document based on the provided document UUID.
 // @Tags documents
@@ -193,8 +324,11 @@ func (t DocumentController) UploadDocumentHandler(c *gin.Context) {
 // @Produce  json
 // @Param   documentUUID query string true "The UUID of the document to delete"
 // @Param   ownerUUID query string true "The UUID of the owner of the document that is getting deleted"
+// @Param   If-Match header string false "The ETag of the document, which is only deleted while it is still at that version"
 // @Success 200 {object} map[string]bool "Successful deletion"
 // @Failure 400 "Bad request, typically due to missing/invalid UUID or deletion failure"
+// @Failure 404 {object} object{error=string} "The document of an If-Match request was not found"
+// @Failure 412 {object} object{error=string} "The document was changed since the If-Match ETag was read"
 // @Router /documents [delete]
 func (t DocumentController) DeleteDocumentHandler(c *gin.Context) {
 	ownerUuidStr, isPresent := c.GetQuery("ownerUUID")
@@ -221,19 +355,144 @@ func (t DocumentController) DeleteDocumentHandler(c *gin.Context) {
 		return
 	}
 
-	err = t.DocumentRepository.DeleteDocumentById(documentUuid, ownerUuid)
+	ifVersion, isValid := ifMatchVersion(c)
+	if !isValid {
+		return
+	}
+
+	// The document is only known before it is deleted, deleting a missing document is not audited.
+	var before *models.Document
+	audited := t.AuditRepository != nil
+	if audited {
+		exclude := make(models.Exclude)
+		document, err := scoped(c, t.DocumentRepository).GetDocumentByDocumentUUID(documentUuid, ownerUuid, exclude.PdfBase64(true))
+		if err == nil {
+			before = auditedDocument(document)
+		}
+		audited = !errors.Is(err, sql.ErrNoRows)
+	}
+
+	err = scoped(c, t.DocumentRepository).DeleteDocumentById(documentUuid, ownerUuid, ifVersion)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		switch {
+		case errors.Is(err, models.ErrVersionConflict):
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+		case errors.Is(err, sql.ErrNoRows):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Document with documentUUID " + documentUuid.String() + " was not found."})
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
 		return
 	}
 
+	if audited {
+		recordAudit(c, t.AuditRepository, &ownerUuid, &ownerUuid, auditChange{
+			action:       models.AuditActionDelete,
+			resourceType: models.AuditResourceDocument,
+			resourceUid:  documentUuid,
+			documentUid:  &documentUuid,
+			before:       before,
+		})
+	}
+
 	c.JSON(200, gin.H{"success": true})
 	return
 }
 
+// DocumentEventsHandler handles the HTTP GET request to follow the processing of a document.
+// It expects the document's UUID and the owner's UUID as query parameters.
+//
+// The response is a Server-Sent Events stream. The first event always carries the current
+// meta status of the document, after which every extraction and selection event published
+// for the document is forwarded until the client disconnects.
+//
+// @Summary Stream processing events of a document
+// @Description Opens a Server-Sent Events stream emitting meta extraction progress and selection changes for a document.
+// @Tags documents
+// @Produce text/event-stream
+// @Param   documentUUID query string true "The UUID of the document to follow"
+// @Param   ownerUUID query string true "The UUID of the owner of the document"
+// @Success 200 {object} models.Event "Stream of events, the event name matches the event type"
+// @Failure 400 {object} object{error=string} "Bad request, typically due to missing/invalid UUID"
+// @Failure 404 {object} object{error=string} "Not Found: No document found for the given UUID."
+// @Failure 500 {object} object{error=string} "Internal Server Error: An unexpected error occurred on the server."
+// @Router /documents/events [get]
+func (t DocumentController) DocumentEventsHandler(c *gin.Context) {
+	if t.Events == nil {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "Events are not enabled on this server"})
+		return
+	}
+
+	documentUid, err := uuid.Parse(c.Query("documentUUID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ownerUid, err := uuid.Parse(c.Query("ownerUUID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Subscribe before reading the status, so no event published in between is lost.
+	events, unsubscribe := t.Events.Subscribe(documentUid)
+	defer unsubscribe()
+
+	exclude := make(models.Exclude)
+	exclude.DocumentTitle(true).PdfBase64(true).TimeCreated(true).OwnerUUID(true).OwnerType(true)
+	document, err := scoped(c, t.DocumentRepository).GetDocumentByDocumentUUID(documentUid, ownerUid, exclude)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Document with documentUUID " + documentUid.String() + " was not found."})
+			return
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			requestLogger(c).Error("sql query failed", "error", err)
+			return
+		}
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.SSEvent(string(models.EventMetaStatus), models.Event{
+		Type:         models.EventMetaStatus,
+		DocumentUUID: documentUid,
+		Time:         time.Now().UTC(),
+		MetaStatus:   document.MetaStatus,
+	})
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(15 * time.Second)
+	defer keepAlive.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event, open := <-events:
+			if !open {
+				return false
+			}
+
+			c.SSEvent(string(event.Type), event)
+			return true
+		case <-keepAlive.C:
+			c.SSEvent("ping", gin.H{"time": time.Now().UTC()})
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
 func (t DocumentController) SetupRouter(c *gin.RouterGroup) {
-	c.POST("/", t.UploadDocumentHandler)
-	c.PUT("/", t.UploadDocumentHandler)
+	c.POST("/", rejectIfMatch, t.UploadDocumentHandler)
+	c.PUT("/", rejectIfMatch, t.UploadDocumentHandler)
 	c.GET("/", t.GetDocumentHandler)
 	c.DELETE("/", t.DeleteDocumentHandler)
+	c.GET("/events", t.DocumentEventsHandler)
+	c.GET("/shares", t.GetDocumentSharesHandler)
+	c.PUT("/shares", rejectIfMatch, t.ShareDocumentHandler)
+	c.DELETE("/shares", rejectIfMatch, t.UnshareDocumentHandler)
 }
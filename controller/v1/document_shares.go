@@ -0,0 +1,194 @@
+package v1
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"pdf_service_api/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// GetDocumentSharesHandler handles the HTTP GET request to list who a document is shared with.
+// It expects the query parameters "documentUUID" and "ownerUUID", only the owner of a document
+// sees its shares.
+//
+// @Summary List the shares of a document
+// @Description Lists the users the owner granted access to the selections of a document.
+// @Tags documents
+// @Produce  json
+// @Param   documentUUID query string true "The UUID of the document"
+// @Param   ownerUUID query string true "The UUID of the owner of the document"
+// @Success 200 {object} object{shares=[]models.DocumentShare} "The shares of the document"
+// @Failure 400 {object} object{error=string} "Bad request, typically due to missing/invalid UUID"
+// @Failure 404 {object} object{error=string} "The owner has no document with the UUID"
+// @Failure 500 {object} object{error=string} "Internal server error, typically due to database issues"
+// @Router /documents/shares [get]
+func (t DocumentController) GetDocumentSharesHandler(c *gin.Context) {
+	documentUid, ownerUid, isValid := sharedDocument(c)
+	if !isValid {
+		return
+	}
+
+	shares, err := scoped(c, t.DocumentRepository).GetDocumentShares(documentUid, ownerUid)
+	if err != nil {
+		shareErrorResponse(c, err, "document not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"shares": shares})
+}
+
+// ShareDocumentHandler handles the HTTP PUT request to share a document with another user. It
+// expects the query parameters "documentUUID" and "ownerUUID" and a JSON body conforming to
+// models.DocumentShare. Sharing with a user again replaces the access granted before.
+//
+// A read share lets the grantee read the selections of the document, a write share also lets
+// them create, change and delete selections. Only the owner manages the shares of a document.
+//
+// @Summary Share a document
+// @Description Grants another user read or write access to the selections of a document.
+// @Tags documents
+// @Accept  json
+// @Produce  json
+// @Param   documentUUID query string true "The UUID of the document to share"
+// @Param   ownerUUID query string true "The UUID of the owner of the document"
+// @Param   request body models.DocumentShare true "The user to share the document with"
+// @Success 200 {object} map[string]bool "The document is shared"
+// @Failure 400 {object} object{error=string} "Bad request, typically due to missing/invalid UUID"
+// @Failure 404 {object} object{error=string} "The owner has no document with the UUID"
+// @Failure 412 {object} object{error=string} "The request carried an If-Match header, which it does not support"
+// @Failure 500 {object} object{error=string} "Internal server error, typically due to database issues"
+// @Router /documents/shares [put]
+func (t DocumentController) ShareDocumentHandler(c *gin.Context) {
+	documentUid, ownerUid, isValid := sharedDocument(c)
+	if !isValid {
+		return
+	}
+
+	share := models.DocumentShare{}
+	if err := c.ShouldBindJSON(&share); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if share.GranteeUUID == ownerUid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "the owner can not share a document with themselves"})
+		return
+	}
+
+	before := t.auditedShare(c, documentUid, ownerUid, share.GranteeUUID)
+	if err := scoped(c, t.DocumentRepository).ShareDocument(documentUid, ownerUid, share); err != nil {
+		shareErrorResponse(c, err, "document not found")
+		return
+	}
+
+	action := models.AuditActionUpdate
+	if before == nil {
+		action = models.AuditActionCreate
+	}
+	recordAudit(c, t.AuditRepository, &ownerUid, &ownerUid, auditChange{
+		action:       action,
+		resourceType: models.AuditResourceShare,
+		resourceUid:  share.GranteeUUID,
+		documentUid:  &documentUid,
+		before:       before,
+		after:        &share,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// UnshareDocumentHandler handles the HTTP DELETE request to revoke a share. It expects the
+// query parameters "documentUUID", "ownerUUID" and "granteeUUID".
+//
+// @Summary Revoke the share of a document
+// @Description Revokes the access of a user to the selections of a document.
+// @Tags documents
+// @Produce  json
+// @Param   documentUUID query string true "The UUID of the shared document"
+// @Param   ownerUUID query string true "The UUID of the owner of the document"
+// @Param   granteeUUID query string true "The UUID of the user whose access is revoked"
+// @Success 200 {object} map[string]bool "The share is revoked"
+// @Failure 400 {object} object{error=string} "Bad request, typically due to missing/invalid UUID"
+// @Failure 404 {object} object{error=string} "The document of the owner is not shared with the user"
+// @Failure 412 {object} object{error=string} "The request carried an If-Match header, which it does not support"
+// @Failure 500 {object} object{error=string} "Internal server error, typically due to database issues"
+// @Router /documents/shares [delete]
+func (t DocumentController) UnshareDocumentHandler(c *gin.Context) {
+	documentUid, ownerUid, isValid := sharedDocument(c)
+	if !isValid {
+		return
+	}
+
+	granteeUid, err := uuid.Parse(c.Query("granteeUUID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	before := t.auditedShare(c, documentUid, ownerUid, granteeUid)
+	if err := scoped(c, t.DocumentRepository).UnshareDocument(documentUid, ownerUid, granteeUid); err != nil {
+		shareErrorResponse(c, err, "share not found")
+		return
+	}
+
+	recordAudit(c, t.AuditRepository, &ownerUid, &ownerUid, auditChange{
+		action:       models.AuditActionDelete,
+		resourceType: models.AuditResourceShare,
+		resourceUid:  granteeUid,
+		documentUid:  &documentUid,
+		before:       before,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// auditedShare returns the share of the document with the grantee before it is changed, or nil
+// when there is none or nothing is audited. Shares are audited with the grantee as resource.
+func (t DocumentController) auditedShare(c *gin.Context, documentUid, ownerUid, granteeUid uuid.UUID) *models.DocumentShare {
+	if t.AuditRepository == nil {
+		return nil
+	}
+
+	shares, err := scoped(c, t.DocumentRepository).GetDocumentShares(documentUid, ownerUid)
+	if err != nil {
+		return nil
+	}
+
+	for _, share := range shares {
+		if share.GranteeUUID == granteeUid {
+			return &share
+		}
+	}
+
+	return nil
+}
+
+// sharedDocument reads the "documentUUID" and "ownerUUID" query parameters of the share
+// requests. It responds with a 400 Bad Request and returns false when one is missing or invalid.
+func sharedDocument(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	documentUid, err := uuid.Parse(c.Query("documentUUID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	ownerUid, isValid := requireOwnerUUID(c)
+	if !isValid {
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	return documentUid, ownerUid, true
+}
+
+func shareErrorResponse(c *gin.Context, err error, notFound string) {
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": notFound})
+		return
+	}
+
+	requestLogger(c).Error("sql query failed", "error", err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
@@ -0,0 +1,133 @@
+package v1
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// strongETag derives a quoted entity tag from the given content.
+func strongETag(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// versionETag is the entity tag of a versioned document, meta data or selection. If-Match
+// headers are expected to carry it, see ifMatchVersion.
+func versionETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// listETag is the entity tag of a list of versioned resources, it changes whenever a resource
+// of the list changes or the list itself does.
+func listETag[T any](items []T, identity func(item T) (uuid.UUID, int)) string {
+	var content strings.Builder
+	for _, item := range items {
+		uid, version := identity(item)
+		fmt.Fprintf(&content, "%s/%d;", uid, version)
+	}
+
+	return strongETag(content.String())
+}
+
+// etagMatches reports if an If-None-Match or If-Match header value lists the given entity tag.
+// Weak validators are compared by their opaque tag, as required for If-None-Match.
+func etagMatches(header string, etag string) bool {
+	if header == "" {
+		return false
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// notModified sets the ETag header of a read and answers it with 304 Not Modified when the
+// If-None-Match header lists the tag, in which case nothing else must be written.
+func notModified(c *gin.Context, etag string) bool {
+	c.Header("ETag", etag)
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return true
+	}
+
+	return false
+}
+
+// ifMatchVersion reads the version a change is conditional on from the If-Match header. Without
+// the header, or with "*", the change is unconditional and nil is returned. Otherwise the header
+// has to list an entity tag from versionETag, of which only the first is checked. A header that
+// lists none can never match, it is answered with 412 Precondition Failed and false is returned.
+func ifMatchVersion(c *gin.Context) (*int, bool) {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		return nil, true
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return nil, true
+		}
+
+		// Weak tags never match, If-Match uses the strong comparison.
+		if len(candidate) < 2 || candidate[0] != '"' || candidate[len(candidate)-1] != '"' {
+			continue
+		}
+
+		version, err := strconv.Atoi(candidate[1 : len(candidate)-1])
+		if err == nil {
+			return &version, true
+		}
+	}
+
+	c.JSON(http.StatusPreconditionFailed, gin.H{"error": "If-Match does not list a version of this resource"})
+	return nil, false
+}
+
+// ifMatchETags reads the entity tags a change of a list is conditional on from the If-Match
+// header. Without the header, or with "*", the change is unconditional and nil is returned.
+// Weak tags are left out as they never match, so a header of only weak tags matches nothing.
+func ifMatchETags(c *gin.Context) []string {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		return nil
+	}
+
+	etags := make([]string, 0)
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return nil
+		}
+
+		if strings.HasPrefix(candidate, `"`) {
+			etags = append(etags, candidate)
+		}
+	}
+
+	return etags
+}
+
+// rejectIfMatch answers requests with an If-Match header with 412 Precondition Failed. It guards
+// the routes of changes that do not evaluate the header, which must not be made unconditionally
+// when the client asked for a condition.
+func rejectIfMatch(c *gin.Context) {
+	if c.GetHeader("If-Match") != "" {
+		c.AbortWithStatusJSON(http.StatusPreconditionFailed, gin.H{"error": "If-Match is not supported by this request"})
+		return
+	}
+
+	c.Next()
+}
@@ -2,6 +2,7 @@ package v1
 
 import (
 	"pdf_service_api/models"
+	"pdf_service_api/service/annotations"
 
 	"github.com/google/uuid"
 )
@@ -16,12 +17,68 @@ type CreateRequest struct {
 	DocumentTitle        *string    `json:"documentTitle"`
 	OwnerUUID            *uuid.UUID `json:"ownerUUID"`
 	OwnerType            *int       `json:"ownerType"`
+	ExtractMeta          *bool      `json:"extractMeta"`
 }
 
 type AddNewSelectionRequest struct {
-	DocumentUUID *uuid.UUID          `json:"documentUUID,omitempty"`
-	Coordinates  *models.Coordinates `json:"coordinates,omitempty"`
-	PageKey      string              `json:"pageKey,omitempty"`
+	DocumentUUID *uuid.UUID            `json:"documentUUID,omitempty"`
+	Coordinates  *models.Coordinates   `json:"coordinates,omitempty"`
+	PageKey      string                `json:"pageKey,omitempty"`
+	Type         *models.SelectionType `json:"type,omitempty" enums:"highlight,note,redaction,field"`
+	Label        *string               `json:"label,omitempty" maxLength:"256"`
+	Note         *string               `json:"note,omitempty" maxLength:"10000"`
+	Color        *string               `json:"color,omitempty" example:"#ffd700"`
+	AuthorUUID   *uuid.UUID            `json:"authorUUID,omitempty"`
+}
+
+type UpdateSelectionRequest struct {
+	PageKey     *string               `json:"pageKey,omitempty"`
+	Coordinates *models.Coordinates   `json:"coordinates,omitempty"`
+	Type        *models.SelectionType `json:"type,omitempty" enums:"highlight,note,redaction,field"`
+	Label       *string               `json:"label,omitempty" maxLength:"256"`
+	Note        *string               `json:"note,omitempty" maxLength:"10000"`
+	Color       *string               `json:"color,omitempty" example:"#ffd700"`
+	AuthorUUID  *uuid.UUID            `json:"authorUUID,omitempty"`
+}
+
+type UpdateSelectionBulkRequest struct {
+	SelectionUUID uuid.UUID `json:"selectionUUID"`
+	UpdateSelectionRequest
+}
+
+type DeleteSelectionBulkRequest struct {
+	SelectionUUIDs []uuid.UUID `json:"selectionUUIDs"`
+}
+
+// BulkSelectionResult is the outcome of one item of a bulk request in per item mode.
+type BulkSelectionResult struct {
+	Index         int               `json:"index"`
+	SelectionUUID *uuid.UUID        `json:"selectionUUID,omitempty"`
+	Selection     *models.Selection `json:"selection,omitempty"`
+	Error         *string           `json:"error,omitempty"`
+}
+
+// ImportSelectionsResponse lists the selections created from imported annotations and the
+// annotations that were skipped, with the reason.
+type ImportSelectionsResponse struct {
+	Selections []models.Selection    `json:"selections"`
+	Skipped    []annotations.Skipped `json:"skipped"`
+}
+
+type AddSelectionTemplateRequest struct {
+	Name         string     `json:"name" example:"ACME invoice" maxLength:"256"`
+	DocumentUUID *uuid.UUID `json:"documentUUID"`
+	// PageKeys limits the template to the selections of these pages, all pages by default.
+	PageKeys []string               `json:"pageKeys,omitempty"`
+	Types    []models.SelectionType `json:"types,omitempty" enums:"highlight,note,redaction,field"`
+}
+
+type ApplySelectionTemplateRequest struct {
+	DocumentUUID *uuid.UUID `json:"documentUUID"`
+	// PageMapping maps page keys of the template to page keys of the document, pages mapped to
+	// null are left out. Pages that are not mapped keep their key.
+	PageMapping     map[string]*string `json:"pageMapping,omitempty"`
+	ScaleToPageSize bool               `json:"scaleToPageSize,omitempty"`
 }
 
 type AddMetaRequest struct {
@@ -37,8 +94,20 @@ type UpdateMetaRequest struct {
 	Height        *float32
 	Width         *float32
 	Images        *map[string]string
+	Pages         []models.PageGeometry
 }
 
 type DeleteMetaRequest struct {
 	UUID uuid.UUID
 }
+
+// SelectionCropEntry describes a selection in the manifest of a zip of crops. File names the
+// crop in the zip, selections that could not be cropped have a reason instead.
+type SelectionCropEntry struct {
+	SelectionUUID uuid.UUID             `json:"selectionUUID"`
+	PageKey       *string               `json:"pageKey,omitempty"`
+	Type          *models.SelectionType `json:"type,omitempty"`
+	Label         *string               `json:"label,omitempty"`
+	File          string                `json:"file,omitempty" example:"a5fdea38-0a86-4c19-ae4f-c87a01bc860d.png"`
+	Skipped       string                `json:"skipped,omitempty"`
+}
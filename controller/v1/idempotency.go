@@ -0,0 +1,183 @@
+package v1
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"pdf_service_api/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	// idempotentReplayHeader marks a response that is replayed for a retried request.
+	idempotentReplayHeader  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength = 255
+	// maxIdempotentBodySize bounds the bodies buffered to fingerprint a request, it is above the
+	// limits of the handlers, which still apply to the buffered body.
+	maxIdempotentBodySize = 64 << 20
+)
+
+// replayedHeaders are the response headers stored with a response and sent again when it is
+// replayed. Headers about the connection or the request, such as its id, are not replayed.
+var replayedHeaders = []string{"Content-Type", "Content-Disposition", "Cache-Control", "ETag", "Last-Modified", "Location"}
+
+// DefaultIdempotencyWindow is how long idempotency keys are remembered when no window is configured.
+const DefaultIdempotencyWindow = 24 * time.Hour
+
+// idempotencyLease is how long the first request with a key may take. A process dying while it
+// handles the request can not release the key, so a retry after the lease takes the key over.
+const idempotencyLease = 10 * time.Minute
+
+// Idempotency returns a middleware that makes POST requests with an Idempotency-Key header safe
+// to retry. The first request with a key is processed and its response stored for the window,
+// a retry of the same request with the key is answered with the stored response instead. The
+// key is bound to the method, target and body of the first request: reusing it for a different
+// request is answered with 422 Unprocessable Entity, and a retry arriving while the first request
+// is still processed with 409 Conflict, until the lease of the first request expires. Server
+// errors and panics are not stored, so those requests can be retried with the same key. Keys are
+// scoped to the route and the caller named by "ownerUUID", see idempotencyScope, and bodies
+// larger than maxIdempotentBodySize are answered with 413 Request Entity Too Large. Requests
+// without the header are passed on unchanged.
+func Idempotency(repository models.IdempotencyRepository, window time.Duration) gin.HandlerFunc {
+	if window <= 0 {
+		window = DefaultIdempotencyWindow
+	}
+
+	return func(c *gin.Context) {
+		key := c.GetHeader(idempotencyKeyHeader)
+		if c.Request.Method != http.MethodPost || key == "" {
+			c.Next()
+			return
+		}
+
+		if len(key) > maxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s must be at most %d characters", idempotencyKeyHeader, maxIdempotencyKeyLength)})
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxIdempotentBodySize))
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("requests with an %s must not be larger than %d bytes", idempotencyKeyHeader, maxIdempotentBodySize)})
+				return
+			}
+
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "request body could not be read: " + err.Error()})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		repository := scoped(c, repository)
+		now := time.Now().UTC()
+		scope := idempotencyScope(c)
+		record := models.IdempotencyRecord{Scope: scope, Key: key, Fingerprint: requestFingerprint(c.Request, body), CreatedAt: now, LeaseExpiresAt: now.Add(idempotencyLease)}
+		stored, reserved, err := repository.Reserve(record, now.Add(-window))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if !reserved {
+			replayIdempotentResponse(c, record, stored)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+
+		// A panicking handler has not answered the request, so the key is given back for a retry.
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				if err := repository.Release(scope, key); err != nil {
+					requestLogger(c).Error("releasing idempotency key failed", "error", err)
+				}
+				panic(recovered)
+			}
+		}()
+
+		c.Next()
+
+		if recorder.Status() >= http.StatusInternalServerError {
+			err = repository.Release(scope, key)
+		} else {
+			err = repository.Complete(scope, key, recorder.Status(), replayableHeader(recorder.Header()), recorder.body.Bytes())
+		}
+		if err != nil {
+			requestLogger(c).Error("storing idempotent response failed", "error", err)
+		}
+	}
+}
+
+// replayIdempotentResponse answers a request whose idempotency key is already stored.
+func replayIdempotentResponse(c *gin.Context, record, stored models.IdempotencyRecord) {
+	switch {
+	case stored.Fingerprint != record.Fingerprint:
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": idempotencyKeyHeader + " was already used for a different request"})
+	case stored.Status == nil:
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "a request with this " + idempotencyKeyHeader + " is still being processed"})
+	default:
+		for name, values := range stored.Header {
+			c.Writer.Header()[name] = values
+		}
+
+		c.Header(idempotentReplayHeader, "true")
+		c.Data(*stored.Status, stored.Header.Get("Content-Type"), stored.Body)
+		c.Abort()
+	}
+}
+
+// idempotencyScope keeps the keys of different callers and routes apart. Callers are told apart
+// by the "ownerUUID" query parameter, requests naming their owner in the body are bound to it by
+// their fingerprint instead.
+func idempotencyScope(c *gin.Context) string {
+	scope := c.Request.Method + " " + c.FullPath()
+	if ownerUid := optionalOwnerUUID(c); ownerUid != nil {
+		scope += " " + ownerUid.String()
+	}
+
+	return scope
+}
+
+// replayableHeader keeps the replayedHeaders of a response.
+func replayableHeader(header http.Header) http.Header {
+	replayed := http.Header{}
+	for _, name := range replayedHeaders {
+		if values := header.Values(name); len(values) > 0 {
+			replayed[http.CanonicalHeaderKey(name)] = values
+		}
+	}
+
+	return replayed
+}
+
+// requestFingerprint identifies a request by its method, target and body.
+func requestFingerprint(request *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(request.Method + " " + request.URL.RequestURI() + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// responseRecorder keeps a copy of the body written to the response.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
+
+func (r *responseRecorder) WriteString(data string) (int, error) {
+	r.body.WriteString(data)
+	return r.ResponseWriter.WriteString(data)
+}
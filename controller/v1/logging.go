@@ -0,0 +1,134 @@
+package v1
+
+import (
+	"log/slog"
+	"net/http"
+	"pdf_service_api/service/logging"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	// requestIDHeader carries the id a request is logged under, audit entries keep it.
+	requestIDHeader = "X-Request-ID"
+	// maxRequestIDLength bounds the request ids taken from clients, longer ones are replaced.
+	maxRequestIDLength = 128
+	// requestOwnerKey holds the owner a handler resolved in the gin context, see setRequestOwner.
+	requestOwnerKey = "requestOwner"
+)
+
+// RequestLogLevels are the levels requests are logged at, by the class of their response status.
+type RequestLogLevels struct {
+	Success     slog.Level
+	ClientError slog.Level
+	ServerError slog.Level
+}
+
+// DefaultRequestLogLevels logs successful requests as info, client errors as warnings and
+// server errors as errors.
+var DefaultRequestLogLevels = RequestLogLevels{Success: slog.LevelInfo, ClientError: slog.LevelWarn, ServerError: slog.LevelError}
+
+// RequestLogging returns a middleware that gives every request an id and a logger. The id is
+// taken from the X-Request-ID header, or generated when the header is missing or malformed, and
+// is sent back in the same header. The logger carries the id and is passed on in the context of
+// the request, down to the repositories and the data service. Once the request is answered it
+// is logged with its route, status, latency and owner, at the level levels gives its status. The
+// owner is the one the handler resolved, see setRequestOwner, or else the "ownerUUID" parameter.
+func RequestLogging(logger *slog.Logger, levels RequestLogLevels) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		started := time.Now()
+
+		requestId := c.GetHeader(requestIDHeader)
+		if !validRequestID(requestId) {
+			requestId = uuid.NewString()
+		}
+		c.Header(requestIDHeader, requestId)
+
+		requestLogger := logger.With("requestId", requestId)
+		ctx := logging.WithRequestID(logging.NewContext(c.Request.Context(), requestLogger), requestId)
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		level := levels.Success
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = levels.ServerError
+		case status >= http.StatusBadRequest:
+			level = levels.ClientError
+		}
+
+		attributes := []any{
+			"method", c.Request.Method,
+			"route", c.FullPath(),
+			"path", c.Request.URL.Path,
+			"status", status,
+			"latency", time.Since(started),
+			"clientIp", c.ClientIP(),
+		}
+		if ownerUid := requestOwner(c); ownerUid != nil {
+			attributes = append(attributes, "ownerUUID", ownerUid.String())
+		}
+		if len(c.Errors) > 0 {
+			attributes = append(attributes, "errors", c.Errors.String())
+		}
+
+		requestLogger.Log(ctx, level, "request handled", attributes...)
+	}
+}
+
+// validRequestID accepts printable ascii ids of a sensible length from clients.
+func validRequestID(requestId string) bool {
+	if requestId == "" || len(requestId) > maxRequestIDLength {
+		return false
+	}
+
+	for _, r := range requestId {
+		if r < '!' || r > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// setRequestOwner records the owner a handler resolved for the request, so that requests naming
+// their owner in the body are logged with it as well.
+func setRequestOwner(c *gin.Context, ownerUid uuid.UUID) {
+	c.Set(requestOwnerKey, ownerUid)
+}
+
+// requestOwner returns the owner recorded by setRequestOwner, falling back to the "ownerUUID"
+// query parameter for requests whose handler recorded none.
+func requestOwner(c *gin.Context) *uuid.UUID {
+	if ownerUid, isSet := c.Get(requestOwnerKey); isSet {
+		if ownerUid, isValid := ownerUid.(uuid.UUID); isValid {
+			return &ownerUid
+		}
+	}
+
+	return optionalOwnerUUID(c)
+}
+
+// requestLogger returns the logger of the request, which carries its id.
+func requestLogger(c *gin.Context) *slog.Logger {
+	return logging.FromContext(c.Request.Context())
+}
+
+// requestID returns the id of the request, falling back to the header when the request was not
+// given one by RequestLogging.
+func requestID(c *gin.Context) string {
+	if requestId := logging.RequestID(c.Request.Context()); requestId != "" {
+		return requestId
+	}
+
+	return c.GetHeader(requestIDHeader)
+}
+
+// scoped returns the repository logging with the logger of the request.
+func scoped[T any](c *gin.Context, repository T) T {
+	return logging.Scoped(repository, requestLogger(c))
+}
@@ -7,16 +7,26 @@ import (
 	"net/http"
 	"pdf_service_api/models"
 	"pdf_service_api/service/dataapi"
+	"pdf_service_api/service/imaging"
+	"pdf_service_api/service/pdf"
+	"slices"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
+// DefaultThumbnailSizes are the thumbnail widths and heights accepted when none are configured.
+var DefaultThumbnailSizes = []uint32{100, 200, 400, 800}
+
 type MetaController struct {
-	DocumentRepository models.DocumentRepository
-	MetaRepository     models.MetaRepository
-	DataService        dataapi.DataService
+	DocumentRepository  models.DocumentRepository
+	MetaRepository      models.MetaRepository
+	MetaExtractor       models.MetaExtractor
+	ThumbnailRepository models.ThumbnailRepository
+	ThumbnailSizes      []uint32
+	AuditRepository     models.AuditRepository
 }
 
 // AddMeta handles the HTTP POST request to add new metadata.
@@ -35,21 +45,34 @@ type MetaController struct {
 // @Accept  json
 // @Produce  json
 // @Param   request body v1.AddMetaRequest true "Metadata creation request"
+// @Param Idempotency-Key header string false "A key that makes the request safe to retry, a retry with it is answered with the first response"
 // @Success 200 {object} map[string]uuid.UUID "Successful creation, returns the metadata UUID"
 // @Failure 400 "Bad request, typically due to invalid input"
+// @Failure 409 "A request with the same Idempotency-Key is still being processed"
+// @Failure 412 "The request carried an If-Match header, which it does not support"
+// @Failure 413 "The body of a request with an Idempotency-Key is too large"
+// @Failure 422 "The Idempotency-Key was already used for a different request"
 // @Failure 500 "Internal server error, typically due to database issues"
+// @Failure 502 "Bad gateway, the data service rejected the document"
+// @Failure 503 "Service unavailable, the data service is not configured or currently failing"
 // @Router /meta [post]
 func (t MetaController) AddMeta(c *gin.Context) {
+	if t.MetaExtractor == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Meta extraction is not configured on this server"})
+		return
+	}
+
 	body := &AddMetaRequest{}
 	if err := c.ShouldBindJSON(body); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	setRequestOwner(c, body.OwnerUUID)
 
 	if body.DocumentBase64String == nil {
 		exclude := make(models.Exclude)
 		exclude.TimeCreated(true).OwnerUUID(true).OwnerType(true).DocumentTitle(true)
-		document, err := t.DocumentRepository.GetDocumentByDocumentUUID(body.DocumentUUID, body.OwnerUUID, exclude)
+		document, err := scoped(c, t.DocumentRepository).GetDocumentByDocumentUUID(body.DocumentUUID, body.OwnerUUID, exclude)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
@@ -58,9 +81,21 @@ func (t MetaController) AddMeta(c *gin.Context) {
 		body.DocumentBase64String = document.PdfBase64
 	}
 
-	request, err := t.DataService.SendMetaRequest(*body.DocumentBase64String)
+	request, err := t.MetaExtractor.SendMetaRequest(c.Request.Context(), strings.NewReader(*body.DocumentBase64String), nil)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Errorf("error sending SendMetaRequest: %w", err)})
+		var statusErr *dataapi.StatusError
+		switch {
+		case errors.Is(err, dataapi.ErrCircuitOpen):
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": fmt.Errorf("error sending SendMetaRequest: %w", err).Error()})
+		case errors.Is(err, dataapi.ErrInvalidBase64), errors.Is(err, pdf.ErrInvalidBase64):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.As(err, &statusErr):
+			c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Errorf("error sending SendMetaRequest: %w", err).Error()})
+		case errors.Is(err, pdf.ErrNotPdf), errors.Is(err, pdf.ErrMalformed):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Errorf("error sending SendMetaRequest: %w", err).Error()})
+		}
 		return
 	}
 
@@ -68,24 +103,41 @@ func (t MetaController) AddMeta(c *gin.Context) {
 	request.OwnerUUID = &body.OwnerUUID
 	request.OwnerType = &body.OwnerType
 
-	err = t.MetaRepository.AddMeta(request)
+	err = scoped(c, t.MetaRepository).AddMeta(request)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	recordAudit(c, t.AuditRepository, &body.OwnerUUID, &body.OwnerUUID, auditChange{
+		action:       models.AuditActionCreate,
+		resourceType: models.AuditResourceMeta,
+		resourceUid:  body.DocumentUUID,
+		documentUid:  &body.DocumentUUID,
+		after:        auditedMeta(request),
+	})
+
+	if t.DocumentRepository != nil {
+		if err := scoped(c, t.DocumentRepository).SetMetaStatus(body.DocumentUUID, models.MetaStatusComplete); err != nil {
+			requestLogger(c).Error("sql query failed", "error", err)
+		}
+	}
+
 	c.Status(http.StatusOK)
 }
 
 // UpdateMeta handles the HTTP PUT request to update existing metadata.
 // It expects a JSON request body conforming to the UpdateMetaRequest struct,
 // which should contain the UUID of the metadata to be updated, and the fields
-// to be modified (NumberOfPages, Height, Width, Images). Note that these fields
-// are pointers in the `models.Meta` struct, allowing for partial updates.
+// to be modified (NumberOfPages, Height, Width, Images, Pages). Note that these fields
+// are pointers in the `models.Meta` struct, allowing for partial updates. Pages replaces
+// the geometry of the listed pages only.
 //
 // Upon successful update, it returns a 200 OK status with an empty JSON object.
 // If there's an error during request binding or metadata update, it returns
 // a 400 Bad Request or 500 Internal Server Error status with an error message.
+// With an If-Match header the metadata is only updated while it is at the version of the ETag
+// the caller read, otherwise a 412 Precondition Failed is returned.
 //
 // @Summary Update existing metadata
 // @Description Updates specific fields of an existing metadata entry.
@@ -93,8 +145,12 @@ func (t MetaController) AddMeta(c *gin.Context) {
 // @Accept  json
 // @Produce  json
 // @Param   request body UpdateMetaRequest true "Metadata update request"
+// @Param   ownerUUID query string false "The UUID of the caller, recorded in the audit log, which records the owner of the document otherwise"
+// @Param   If-Match header string false "The ETag of the metadata, which is only updated while it is still at that version"
 // @Success 200 "Successful update"
 // @Failure 400 "Bad request, typically due to invalid input"
+// @Failure 404 "The metadata of an If-Match request was not found"
+// @Failure 412 "The metadata was changed since the If-Match ETag was read"
 // @Failure 500 "Internal server error, typically due to database issues"
 // @Router /meta [put]
 func (t MetaController) UpdateMeta(c *gin.Context) {
@@ -110,19 +166,50 @@ func (t MetaController) UpdateMeta(c *gin.Context) {
 			return
 		}
 
+		ifVersion, isValid := ifMatchVersion(c)
+		if !isValid {
+			return
+		}
+
+		for i, page := range body.Pages {
+			if page.Rotation == nil {
+				continue
+			}
+
+			rotation, ok := models.NormalizeRotation(*page.Rotation)
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("rotation of page %d must be a multiple of 90", page.PageNumber)})
+				return
+			}
+			body.Pages[i].Rotation = &rotation
+		}
+
 		model := models.Meta{
 			DocumentUUID:  body.UUID,
 			NumberOfPages: body.NumberOfPages,
 			Height:        body.Height,
 			Width:         body.Width,
 			Images:        body.Images,
+			Pages:         body.Pages,
 		}
 
-		if err := t.MetaRepository.UpdateMeta(uid, model); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		before := t.auditedPageGeometry(c, uid)
+		if err := scoped(c, t.MetaRepository).UpdateMeta(uid, model, ifVersion); err != nil {
+			c.JSON(metaWriteErrorStatus(err), gin.H{"error": err.Error()})
 			return
 		}
 
+		if t.AuditRepository != nil {
+			recordAudit(c, t.AuditRepository, optionalOwnerUUID(c), nil, auditChange{
+				action:       models.AuditActionUpdate,
+				resourceType: models.AuditResourceMeta,
+				resourceUid:  uid,
+				documentUid:  &uid,
+				before:       before,
+				after:        t.auditedPageGeometry(c, uid),
+			})
+		}
+
 		c.JSON(http.StatusOK, gin.H{})
 
 		return
@@ -138,6 +225,8 @@ func (t MetaController) UpdateMeta(c *gin.Context) {
 // Upon successful deletion, it returns a 200 OK status with an empty JSON object.
 // If there's an error during request binding or metadata deletion, it returns
 // a 400 Bad Request or 500 Internal Server Error status with an error message.
+// With an If-Match header the metadata is only deleted while it is at the version of the ETag
+// the caller read, otherwise a 412 Precondition Failed is returned.
 //
 // @Summary Delete metadata by UUID
 // @Description Deletes metadata based on the provided UUID in the request body.
@@ -145,8 +234,12 @@ func (t MetaController) UpdateMeta(c *gin.Context) {
 // @Accept  json
 // @Produce  json
 // @Param   request body v1.DeleteMetaRequest true "Metadata deletion request"
+// @Param   ownerUUID query string false "The UUID of the caller, recorded in the audit log, which records the owner of the document otherwise"
+// @Param   If-Match header string false "The ETag of the metadata, which is only deleted while it is still at that version"
 // @Success 200 {object} map[string]bool "Successful deletion"
 // @Failure 400 "Bad request, typically due to invalid input"
+// @Failure 404 "The metadata of an If-Match request was not found"
+// @Failure 412 "The metadata was changed since the If-Match ETag was read"
 // @Failure 500 "Internal server error, typically due to database issues"
 // @Router /meta [delete]
 func (t MetaController) DeleteMeta(c *gin.Context) {
@@ -156,22 +249,42 @@ func (t MetaController) DeleteMeta(c *gin.Context) {
 		return
 	}
 
+	ifVersion, isValid := ifMatchVersion(c)
+	if !isValid {
+		return
+	}
+
 	model := models.Meta{
 		DocumentUUID: body.UUID,
 	}
 
-	if err := t.MetaRepository.DeleteMeta(model); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	before := t.auditedPageGeometry(c, body.UUID)
+	if err := scoped(c, t.MetaRepository).DeleteMeta(model, ifVersion); err != nil {
+		c.JSON(metaWriteErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
+	// Deleting meta data that does not exist succeeds, but there is nothing to audit.
+	if before != nil && (before.Version > 0 || len(before.Pages) > 0) {
+		recordAudit(c, t.AuditRepository, optionalOwnerUUID(c), nil, auditChange{
+			action:       models.AuditActionDelete,
+			resourceType: models.AuditResourceMeta,
+			resourceUid:  body.UUID,
+			documentUid:  &body.UUID,
+			before:       before,
+		})
+	}
+
 	c.JSON(http.StatusOK, gin.H{})
 }
 
 // GetMeta handles the HTTP GET request to retrieve metadata by its UUID.
 // It expects the metadata's UUID as a query parameter named "id".
 //
-// Upon successful retrieval, it returns a 200 OK status with the metadata object.
+// Upon successful retrieval, it returns a 200 OK status with the metadata object and its
+// version as ETag, which requests for a page of the images given by "offset" and "limit" extend
+// by the page. A request whose If-None-Match header matches the ETag is answered with
+// 304 Not Modified.
 // If the UUID is missing, invalid, or if an error occurs during retrieval, it returns
 // a 400 Bad Request or 500 Internal Server Error status with an appropriate error message.
 //
@@ -181,10 +294,13 @@ func (t MetaController) DeleteMeta(c *gin.Context) {
 // @Accept  json
 // @Produce  json
 // @Param   documentUUID query string true "The UUID of the metadata to retrieve"
-// @Param   ownerUUID query string true "The UUID of the owner of the metadata to retrieve"
+// @Param   ownerUUID query string true "The UUID of the caller, who has to own the document or have it shared"
 // @Param offset query int false "What should the offset be"
 // @Param limit query int false "How many should be returned"
+// @Param   If-None-Match header string false "The ETag of a cached response, answered with 304 Not Modified while it is current"
 // @Success 200 {object} models.Meta "Successful retrieval of metadata"
+// @Header 200 {string} ETag "The version of the metadata, for If-Match on updates when neither offset nor limit is given"
+// @Success 304 "The cached metadata is still current"
 // @Success 404 data not found
 // @Failure 400 "Bad request, typically due to missing/invalid UUID"
 // @Failure 500 "Internal server error, typically due to database issues"
@@ -239,7 +355,7 @@ func (t MetaController) GetMeta(c *gin.Context) {
 		return
 	}
 
-	data, err := t.MetaRepository.GetMetaPagination(documentUUID, ownerUUID, pageoffset, pageLimit)
+	data, err := scoped(c, t.MetaRepository).GetMetaPagination(documentUUID, ownerUUID, pageoffset, pageLimit)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "data not found"})
@@ -247,7 +363,17 @@ func (t MetaController) GetMeta(c *gin.Context) {
 		}
 
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		fmt.Println("ERROR WHILE EXECUTING SQL QUERY: " + err.Error())
+		requestLogger(c).Error("sql query failed", "error", err)
+		return
+	}
+
+	// A page of the meta data has its own tag, its version alone would match other pages too.
+	etag := versionETag(data.Version)
+	if startPresent || endPresent {
+		etag = strongETag(fmt.Sprintf("%d/%d/%d", data.Version, pageoffset, pageLimit))
+	}
+
+	if notModified(c, etag) {
 		return
 	}
 
@@ -255,9 +381,272 @@ func (t MetaController) GetMeta(c *gin.Context) {
 	return
 }
 
+// GetPageImage handles the HTTP GET request to retrieve the rendered image of a single page.
+// It expects the document's UUID and the page key as path parameters and the owner's UUID as a
+// query parameter, only the owner of the document can retrieve its pages.
+//
+// Upon successful retrieval, it returns the decoded image bytes with their Content-Type, together
+// with caching headers and an ETag. A request whose If-None-Match header matches the ETag is
+// answered with 304 Not Modified.
+//
+// @Summary Get the image of a page
+// @Description Returns the rendered image of a single page as binary data.
+// @Tags meta
+// @Produce  image/png
+// @Produce  image/jpeg
+// @Param   documentUUID path string true "The UUID of the document"
+// @Param   pageKey path string true "The key of the page, as used in the images of the meta data"
+// @Param   ownerUUID query string true "The UUID of the caller, who has to own the document or have it shared"
+// @Success 200 {file} binary "The page image"
+// @Success 304 "The cached page image is still valid"
+// @Failure 400 {object} object{error=string} "Bad request, typically due to missing/invalid UUID"
+// @Failure 404 {object} object{error=string} "Page not found"
+// @Failure 500 {object} object{error=string} "Internal server error, typically due to database issues"
+// @Router /meta/{documentUUID}/pages/{pageKey}/image [get]
+func (t MetaController) GetPageImage(c *gin.Context) {
+	page, ok := t.requestedPage(c)
+	if !ok {
+		return
+	}
+
+	etag := strongETag(*page.Image)
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "private, max-age=86400")
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	data, mimeType, err := imaging.Decode(*page.Image)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "page image could not be decoded: " + err.Error()})
+		return
+	}
+
+	if page.MimeType != nil {
+		mimeType = *page.MimeType
+	}
+
+	c.Data(http.StatusOK, mimeType, data)
+}
+
+// GetPageThumbnail handles the HTTP GET request to retrieve a resized variant of a page image.
+// It expects the same parameters as GetPageImage, together with the size of the thumbnail.
+//
+// Only the sizes configured on the server are accepted, either dimension may be omitted in which
+// case it is derived from the aspect ratio of the page. Generated variants are cached in the
+// database and served from there until the page is extracted again.
+//
+// @Summary Get a thumbnail of a page
+// @Description Returns a resized variant of a page image as binary data.
+// @Tags meta
+// @Produce  image/jpeg
+// @Produce  image/png
+// @Param   documentUUID path string true "The UUID of the document"
+// @Param   pageKey path string true "The key of the page, as used in the images of the meta data"
+// @Param   ownerUUID query string true "The UUID of the caller, who has to own the document or have it shared"
+// @Param   w query int false "Width of the thumbnail, one of the configured sizes"
+// @Param   h query int false "Height of the thumbnail, one of the configured sizes"
+// @Param   fit query string false "How the page is fitted into the size: contain (default), cover or fill"
+// @Param   format query string false "Format of the thumbnail: jpeg (default) or png"
+// @Success 200 {file} binary "The thumbnail"
+// @Success 304 "The cached thumbnail is still valid"
+// @Failure 400 {object} object{error=string} "Bad request, typically due to an invalid size, fit or format"
+// @Failure 404 {object} object{error=string} "Page not found"
+// @Failure 500 {object} object{error=string} "Internal server error, typically due to database issues"
+// @Router /meta/{documentUUID}/pages/{pageKey}/thumbnail [get]
+func (t MetaController) GetPageThumbnail(c *gin.Context) {
+	variant, ok := t.requestedThumbnail(c)
+	if !ok {
+		return
+	}
+
+	page, ok := t.requestedPage(c)
+	if !ok {
+		return
+	}
+
+	variant.DocumentUUID = page.DocumentUUID
+	variant.PageKey = page.PageKey
+	variant.SourceETag = strongETag(*page.Image)
+
+	etag := strongETag(fmt.Sprintf("%s/%dx%d/%s/%s", variant.SourceETag, variant.Width, variant.Height, variant.Fit, variant.MimeType))
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "private, max-age=86400")
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	if t.ThumbnailRepository != nil {
+		stored, err := scoped(c, t.ThumbnailRepository).GetThumbnail(variant)
+		switch {
+		case err == nil && stored.SourceETag == variant.SourceETag:
+			c.Data(http.StatusOK, stored.MimeType, stored.Data)
+			return
+		case err != nil && !errors.Is(err, sql.ErrNoRows):
+			requestLogger(c).Error("sql query failed", "error", err)
+		}
+	}
+
+	src, _, err := imaging.DecodeImage(*page.Image)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "page image could not be decoded: " + err.Error()})
+		return
+	}
+
+	resized, err := imaging.Resize(src, int(variant.Width), int(variant.Height), imaging.Fit(variant.Fit))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	variant.Data, err = imaging.Encode(resized, variant.MimeType)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if t.ThumbnailRepository != nil {
+		if err := scoped(c, t.ThumbnailRepository).SaveThumbnail(variant); err != nil {
+			requestLogger(c).Error("sql query failed", "error", err)
+		}
+	}
+
+	c.Data(http.StatusOK, variant.MimeType, variant.Data)
+}
+
+// requestedThumbnail reads the size, fit and format of a thumbnail request, writing a
+// 400 Bad Request response when they are invalid.
+func (t MetaController) requestedThumbnail(c *gin.Context) (models.Thumbnail, bool) {
+	sizes := t.ThumbnailSizes
+	if len(sizes) == 0 {
+		sizes = DefaultThumbnailSizes
+	}
+
+	parseSize := func(param string) (uint32, bool) {
+		value, isPresent := c.GetQuery(param)
+		if !isPresent || value == "" {
+			return 0, true
+		}
+
+		size, err := strconv.ParseUint(value, 10, 32)
+		if err != nil || !slices.Contains(sizes, uint32(size)) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid value for the query param %s, allowed sizes are %v", param, sizes)})
+			return 0, false
+		}
+
+		return uint32(size), true
+	}
+
+	width, ok := parseSize("w")
+	if !ok {
+		return models.Thumbnail{}, false
+	}
+
+	height, ok := parseSize("h")
+	if !ok {
+		return models.Thumbnail{}, false
+	}
+
+	if width == 0 && height == 0 {
+		height = slices.Min(sizes)
+	}
+
+	fit, ok := imaging.ParseFit(c.Query("fit"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid value for the query param fit, allowed values are contain, cover and fill"})
+		return models.Thumbnail{}, false
+	}
+
+	mimeType := ""
+	switch c.DefaultQuery("format", "jpeg") {
+	case "jpeg", "jpg":
+		mimeType = "image/jpeg"
+	case "png":
+		mimeType = "image/png"
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid value for the query param format, allowed values are jpeg and png"})
+		return models.Thumbnail{}, false
+	}
+
+	return models.Thumbnail{Width: width, Height: height, Fit: string(fit), MimeType: mimeType}, true
+}
+
+// requestedPage loads the page addressed by the documentUUID and pageKey path parameters for the
+// owner in the ownerUUID query parameter, writing an error response when that is not possible.
+func (t MetaController) requestedPage(c *gin.Context) (models.Page, bool) {
+	documentUUID, err := uuid.Parse(c.Param("documentUUID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return models.Page{}, false
+	}
+
+	ownerUid, isPresent := c.GetQuery("ownerUUID")
+	if !isPresent {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Required param ownerUUID missing!"})
+		return models.Page{}, false
+	}
+
+	ownerUUID, err := uuid.Parse(ownerUid)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return models.Page{}, false
+	}
+
+	page, err := scoped(c, t.MetaRepository).GetPageByKey(documentUUID, ownerUUID, c.Param("pageKey"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "page not found"})
+			return models.Page{}, false
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		requestLogger(c).Error("sql query failed", "error", err)
+		return models.Page{}, false
+	}
+
+	if page.Image == nil || *page.Image == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "page has no image"})
+		return models.Page{}, false
+	}
+
+	return page, true
+}
+
+// metaWriteErrorStatus maps the errors of updating and deleting meta data to a status code.
+func metaWriteErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, models.ErrVersionConflict):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, sql.ErrNoRows):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// auditedPageGeometry loads the meta data of a document without its images for the audit log,
+// nil when nothing is audited or the meta data cannot be loaded.
+func (t MetaController) auditedPageGeometry(c *gin.Context, documentUid uuid.UUID) *models.Meta {
+	if t.AuditRepository == nil {
+		return nil
+	}
+
+	meta, err := scoped(c, t.MetaRepository).GetPageGeometry(documentUid)
+	if err != nil {
+		requestLogger(c).Error("sql query failed", "error", err)
+		return nil
+	}
+
+	return &meta
+}
+
 func (t MetaController) SetupRouter(c *gin.RouterGroup) {
+	c.GET("/:documentUUID/pages/:pageKey/image", t.GetPageImage)
+	c.GET("/:documentUUID/pages/:pageKey/thumbnail", t.GetPageThumbnail)
 	c.GET("/", t.GetMeta)
-	c.POST("/", t.AddMeta)
+	c.POST("/", rejectIfMatch, t.AddMeta)
 	c.PUT("/", t.UpdateMeta)
 	c.DELETE("/", t.DeleteMeta)
 }
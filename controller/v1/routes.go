@@ -4,10 +4,42 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func SetupRouter(documentController *DocumentController, selectionController *SelectionController, metaController *MetaController) *gin.Engine {
-	router := gin.Default()
+// RouterOption adds optional controllers and middleware to the router of SetupRouter.
+type RouterOption func(config *routerConfig)
+
+type routerConfig struct {
+	auditController *AuditController
+	middleware      []gin.HandlerFunc
+}
+
+// WithAuditController registers the routes of the audit log.
+func WithAuditController(auditController *AuditController) RouterOption {
+	return func(config *routerConfig) {
+		config.auditController = auditController
+	}
+}
+
+// WithMiddleware runs the middleware for every route of the api, in the given order and after
+// the middleware of earlier options.
+func WithMiddleware(middleware ...gin.HandlerFunc) RouterOption {
+	return func(config *routerConfig) {
+		config.middleware = append(config.middleware, middleware...)
+	}
+}
+
+// SetupRouter registers the routes of the given controllers, nil controllers are left out.
+// Requests are not logged by the router itself, RequestLogging is passed as middleware for that.
+func SetupRouter(documentController *DocumentController, selectionController *SelectionController, metaController *MetaController, options ...RouterOption) *gin.Engine {
+	config := routerConfig{}
+	for _, option := range options {
+		option(&config)
+	}
+
+	router := gin.New()
+	router.Use(gin.Recovery())
 	router.GET("/ping", OnPing)
 	apiV1Group := router.Group("/api/v1/")
+	apiV1Group.Use(config.middleware...)
 
 	if documentController != nil {
 		documentGroup := apiV1Group.Group("/documents")
@@ -24,5 +56,10 @@ func SetupRouter(documentController *DocumentController, selectionController *Se
 		metaController.SetupRouter(metaGroup)
 	}
 
+	if config.auditController != nil {
+		auditGroup := apiV1Group.Group("/audit")
+		config.auditController.SetupRouter(auditGroup)
+	}
+
 	return router
 }
@@ -1,27 +1,63 @@
 package v1
 
 import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
 	"pdf_service_api/models"
+	"pdf_service_api/service/dataapi"
+	"pdf_service_api/service/pdf"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
+const (
+	maxSelectionLabelLength = 256
+	maxSelectionNoteLength  = 10000
+)
+
+var colorPattern = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+
 type SelectionController struct {
 	SelectionRepository models.SelectionRepository
+	DocumentRepository  models.DocumentRepository
+	MetaRepository      models.MetaRepository
+	TemplateRepository  models.SelectionTemplateRepository
+	TextExtractor       models.TextExtractor
+	Redactor            models.Redactor
+	Events              models.EventBus
+	AuditRepository     models.AuditRepository
 }
 
 // GetSelection handles the HTTP GET request to retrieve selections based on either
 // a document UUID or a selection UUID.
 //
-// It expects either "documentUUID" or "selectionUUID" as a query parameter.
-// If "documentUUID" is provided, it fetches all selections associated with that document.
+// It expects either "documentUUID" or "selectionUUID" as a query parameter, and the caller as
+// "ownerUUID", see requireOwnerUUID.
+// If "documentUUID" is provided, it fetches all selections associated with that document,
+// optionally only those of the types given by the "type" query parameter and of the page given
+// by "pageKey". The spatial parameters "intersects" and "within" keep the selections overlapping
+// or inside a rectangle, "near" orders them by distance to a point and "limit" caps their
+// number, see selectionFilter. Hit-testing a click is "intersects=x,y,x,y". Without "near" the
+// selections are ordered by page, top to bottom and left to right.
 // If "selectionUUID" is provided, it fetches selections matching that specific selection UUID.
+// Coordinates are returned in the space given by "coordinateSpace", see coordinateSystem.
 //
-// Upon successful retrieval, it returns a 200 OK status with a JSON array of selections.
+// Upon successful retrieval, it returns a 200 OK status with a JSON array of selections. The
+// ETag is the version of a single selection, or a tag of the versions of the listed selections,
+// and a request whose If-None-Match header matches it is answered with 304 Not Modified.
 // If no parameter is specified, the UUID is invalid, or an error occurs during retrieval,
 // it returns a 400 Bad Request or 500 Internal Server Error status with an error message.
+// Documents and selections the caller cannot access return a 404 Not Found.
 //
 // @Summary Get selections by document or selection UUID
 // @Description Retrieves selections based on either a document's UUID or a specific selection's UUID.
@@ -30,12 +66,38 @@ type SelectionController struct {
 // @Produce  json
 // @Param   documentUUID query string false "The UUID of the document to retrieve selections for"
 // @Param   selectionUUID query string false "The UUID of the specific selection to retrieve"
+// @Param   ownerUUID query string true "The UUID of the caller, who has to own the document or have it shared"
+// @Param   type query []string false "Only return selections of these types, with documentUUID" collectionFormat(multi) Enums(highlight,note,redaction,field)
+// @Param   pageKey query string false "Only return selections of this page, with documentUUID"
+// @Param   intersects query string false "Only return selections overlapping the rectangle x1,y1,x2,y2, with documentUUID"
+// @Param   within query string false "Only return selections inside the rectangle x1,y1,x2,y2, with documentUUID"
+// @Param   near query string false "Order the selections by their distance to the point x,y, with documentUUID"
+// @Param   limit query int false "The maximum number of selections returned, with documentUUID"
+// @Param   coordinateSpace query string false "The space of the returned coordinates, pdf by default" Enums(pdf,px,relative)
+// @Param   dpi query number false "The resolution of pixel coordinates"
+// @Param   If-None-Match header string false "The ETag of a cached response, answered with 304 Not Modified while it is current"
 // @Success 200 {object} map[string][]models.Selection "Successful retrieval of selections"
+// @Header 200 {string} ETag "The version of the selection, or a tag of the versions of the listed selections"
+// @Success 304 "The cached selections are still current"
 // @Failure 400 "Bad request, typically due to missing/invalid UUID parameter"
+// @Failure 404 "Document or selection not found"
+// @Failure 422 "The page geometry needed to convert the coordinates is unknown"
 // @Failure 500 "Internal server error, typically due to database issues"
 // @Router /selections [get]
 func (t SelectionController) GetSelection(c *gin.Context) {
-	getSelection := func(id string, passedServiceGetFunction func(uid uuid.UUID) ([]models.Selection, error)) {
+	system, err := coordinateSystem(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ownerUid, isValid := requireOwnerUUID(c)
+	if !isValid {
+		return
+	}
+
+	geometries := t.pageGeometries(c, ownerUid)
+	getSelection := func(id string, notFound string, etag func(results []models.Selection) string, passedServiceGetFunction func(uid uuid.UUID) ([]models.Selection, error)) {
 		uid, err := uuid.Parse(id)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -44,7 +106,24 @@ func (t SelectionController) GetSelection(c *gin.Context) {
 
 		results, err := passedServiceGetFunction(uid)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			if errors.Is(err, sql.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": notFound})
+				return
+			}
+
+			c.JSON(coordinateErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		for i := range results {
+			results[i].Coordinates, err = geometries.displayed(results[i], system)
+			if err != nil {
+				c.JSON(coordinateErrorStatus(err), gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		if notModified(c, etag(results)) {
 			return
 		}
 
@@ -52,12 +131,36 @@ func (t SelectionController) GetSelection(c *gin.Context) {
 	}
 
 	if id, isPresent := c.GetQuery("documentUUID"); isPresent && id != "" {
-		getSelection(id, t.SelectionRepository.GetSelectionListByDocumentUUID)
+		filter, err := selectionFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		getSelection(id, "document not found", selectionListETag, func(uid uuid.UUID) ([]models.Selection, error) {
+			filter, err := geometries.storedFilter(uid, filter, system)
+			if err != nil {
+				return nil, err
+			}
+
+			return scoped(c, t.SelectionRepository).GetSelectionListByDocumentUUID(uid, ownerUid, filter)
+		})
 		return
 	}
 
 	if id, isPresent := c.GetQuery("selectionUUID"); isPresent && id != "" {
-		getSelection(id, t.SelectionRepository.GetSelectionBySelectionUUID)
+		etag := func(results []models.Selection) string {
+			return versionETag(results[0].Version)
+		}
+
+		getSelection(id, "selection not found", etag, func(uid uuid.UUID) ([]models.Selection, error) {
+			selections, err := scoped(c, t.SelectionRepository).GetSelectionBySelectionUUID(uid, ownerUid)
+			if err == nil && len(selections) == 0 {
+				return nil, sql.ErrNoRows
+			}
+
+			return selections, err
+		})
 		return
 	}
 
@@ -68,13 +171,20 @@ func (t SelectionController) GetSelection(c *gin.Context) {
 // It allows deletion by either a specific selection UUID or by a document UUID,
 // which will delete all selections associated with that document.
 //
-// It expects either "selectionUUID" or "documentUUID" as a query parameter.
-// If "selectionUUID" is provided, it deletes the specific selection.
+// It expects either "selectionUUID" or "documentUUID" as a query parameter, and the caller as
+// "ownerUUID", see requireOwnerUUID.
+// If "selectionUUID" is provided, it deletes the specific selection, unless the caller may not
+// change its document.
 // If "documentUUID" is provided, it deletes all selections belonging to that document.
+// An If-Match header with the ETag of a single selection makes its deletion conditional on the
+// selection still being at that version, otherwise a 412 Precondition Failed is returned. When
+// deleting all selections of a document it has to carry the ETag of their list instead.
 //
 // Upon successful deletion, it returns a 200 OK status with a success message.
 // If no parameter is specified, the UUID is invalid, or an error occurs during deletion,
 // it returns a 400 Bad Request or 500 Internal Server Error status with an error message.
+// A selection that does not exist, or a document the caller cannot change, returns a 404 Not
+// Found.
 //
 // @Summary Delete selections by selection or document UUID
 // @Description Deletes selections based on a specific selection UUID or all selections associated with a document UUID.
@@ -83,11 +193,20 @@ func (t SelectionController) GetSelection(c *gin.Context) {
 // @Produce  json
 // @Param   selectionUUID query string false "The UUID of the specific selection to delete"
 // @Param   documentUUID query string false "The UUID of the document whose selections are to be deleted"
+// @Param   ownerUUID query string true "The UUID of the caller, who has to own the document or have it shared"
+// @Param   If-Match header string false "The ETag of the selection, or of the selections of the document, which are only deleted while they are still at that version"
 // @Success 200 {object} map[string]bool "Successful deletion"
 // @Failure 400 "Bad request, typically due to missing/invalid UUID parameter"
+// @Failure 404 "Selection or document not found"
+// @Failure 412 "The selections were changed since the If-Match ETag was read"
 // @Failure 500 "Internal server error, typically due to database issues"
 // @Router /selections [delete]
 func (t SelectionController) DeleteSelection(c *gin.Context) {
+	ownerUid, isValid := requireOwnerUUID(c)
+	if !isValid {
+		return
+	}
+
 	handleDeletion := func(id string, serviceFunction func(uid uuid.UUID) error) {
 		uid, err := uuid.Parse(id)
 		if err != nil {
@@ -97,6 +216,16 @@ func (t SelectionController) DeleteSelection(c *gin.Context) {
 
 		err = serviceFunction(uid)
 		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+				return
+			}
+
+			if errors.Is(err, models.ErrVersionConflict) {
+				c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+				return
+			}
+
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
@@ -105,12 +234,57 @@ func (t SelectionController) DeleteSelection(c *gin.Context) {
 	}
 
 	if id, isPresent := c.GetQuery("selectionUUID"); isPresent {
-		handleDeletion(id, t.SelectionRepository.DeleteSelectionBySelectionUUID)
+		ifVersion, isValid := ifMatchVersion(c)
+		if !isValid {
+			return
+		}
+
+		handleDeletion(id, func(uid uuid.UUID) error {
+			var deleted []models.Selection
+			if t.Events != nil || t.AuditRepository != nil {
+				selections, err := scoped(c, t.SelectionRepository).GetSelectionBySelectionUUID(uid, ownerUid)
+				if err != nil {
+					return err
+				}
+				deleted = selections
+			}
+
+			if err := scoped(c, t.SelectionRepository).DeleteSelectionBySelectionUUID(uid, ownerUid, ifVersion); err != nil {
+				return err
+			}
+
+			for _, selection := range deleted {
+				t.publishSelectionsChanged(selection.DocumentUUID, &selection.Uuid)
+				recordAudit(c, t.AuditRepository, &ownerUid, nil, selectionChange(models.AuditActionDelete, &selection, nil))
+			}
+			return nil
+		})
 		return
 	}
 
 	if id, isPresent := c.GetQuery("documentUUID"); isPresent {
-		handleDeletion(id, t.SelectionRepository.DeleteSelectionByDocumentUUID)
+		handleDeletion(id, func(uid uuid.UUID) error {
+			var deleted []models.Selection
+			if t.AuditRepository != nil {
+				selections, err := scoped(c, t.SelectionRepository).GetSelectionListByDocumentUUID(uid, ownerUid, models.SelectionFilter{})
+				if err != nil {
+					return err
+				}
+				deleted = selections
+			}
+
+			if err := scoped(c, t.SelectionRepository).DeleteSelectionByDocumentUUID(uid, ownerUid, selectionListPrecondition(c)); err != nil {
+				return err
+			}
+
+			t.publishSelectionsChanged(&uid, nil)
+			changes := make([]auditChange, 0, len(deleted))
+			for i := range deleted {
+				changes = append(changes, selectionChange(models.AuditActionDelete, &deleted[i], nil))
+			}
+			recordAudit(c, t.AuditRepository, &ownerUid, nil, changes...)
+			return nil
+		})
 		return
 	}
 
@@ -122,7 +296,13 @@ func (t SelectionController) DeleteSelection(c *gin.Context) {
 // which should include the DocumentUUID, IsComplete status, Settings, and Coordinates
 // for the new selection.
 //
-// A new UUID will be generated for the selection.
+// A new UUID will be generated for the selection, and its creation time is recorded.
+// The optional type, label, note, color and author UUID are validated before anything is stored.
+// Coordinates are given in the space of "coordinateSpace", see coordinateSystem, and stored in
+// pdf user space with their corners normalized. When the page geometry of the document is known,
+// the page has to exist and the rectangle has to lie on it.
+// The caller is given by "ownerUUID", see requireOwnerUUID, and has to be allowed to change the
+// document, otherwise a 404 Not Found is returned.
 // Upon successful creation, it returns a 200 OK status with the UUID of the
 // newly created selection. If there's an error during request binding or
 // selection creation, it returns a 400 Bad Request or 500 Internal Server Error
@@ -134,11 +314,26 @@ func (t SelectionController) DeleteSelection(c *gin.Context) {
 // @Accept  json
 // @Produce  json
 // @Param   request body v1.AddNewSelectionRequest true "Selection creation request"
+// @Param   ownerUUID query string true "The UUID of the caller, who has to own the document or have it shared"
+// @Param   coordinateSpace query string false "The space of the given coordinates, pdf by default" Enums(pdf,px,relative)
+// @Param   dpi query number false "The resolution of pixel coordinates"
+// @Param Idempotency-Key header string false "A key that makes the request safe to retry, a retry with it is answered with the first response"
 // @Success 200 {object} map[string]uuid.UUID "Successful creation, returns the selection UUID"
 // @Failure 400 "Bad request, typically due to invalid input"
+// @Failure 404 "Document not found"
+// @Failure 409 "A request with the same Idempotency-Key is still being processed"
+// @Failure 412 "The request carried an If-Match header, which it does not support"
+// @Failure 413 "The body of a request with an Idempotency-Key is too large"
+// @Failure 422 "The page geometry needed to convert the coordinates is unknown"
+// @Failure 422 "The Idempotency-Key was already used for a different request"
 // @Failure 500 "Internal server error, typically due to database issues"
 // @Router /selections [post]
 func (t SelectionController) AddSelection(c *gin.Context) {
+	ownerUid, isValid := requireOwnerUUID(c)
+	if !isValid {
+		return
+	}
+
 	reqBody := &AddNewSelectionRequest{}
 
 	if err := c.ShouldBindJSON(reqBody); err != nil {
@@ -146,19 +341,37 @@ func (t SelectionController) AddSelection(c *gin.Context) {
 		return
 	}
 
-	toCreate := models.Selection{
-		Uuid:         uuid.New(),
-		DocumentUUID: reqBody.DocumentUUID,
-		Coordinates:  reqBody.Coordinates,
-		PageKey:      &reqBody.PageKey,
+	system, err := coordinateSystem(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	toCreate, err := reqBody.toSelection(uuid.New(), time.Now().UTC())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	toCreate.Coordinates, err = t.pageGeometries(c, ownerUid).stored(toCreate.DocumentUUID, toCreate.PageKey, toCreate.Coordinates, system)
+	if err != nil {
+		c.JSON(coordinateErrorStatus(err), gin.H{"error": err.Error()})
+		return
 	}
 
-	err := t.SelectionRepository.AddNewSelection(toCreate)
+	err = scoped(c, t.SelectionRepository).AddNewSelection(toCreate, ownerUid)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+			return
+		}
+
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	t.publishSelectionsChanged(toCreate.DocumentUUID, &toCreate.Uuid)
+	recordAudit(c, t.AuditRepository, &ownerUid, nil, selectionChange(models.AuditActionCreate, nil, &toCreate))
 	c.JSON(200, gin.H{"selectionUUID": toCreate.Uuid.String()})
 }
 
@@ -167,57 +380,985 @@ func (t SelectionController) AddSelection(c *gin.Context) {
 // which should include the DocumentUUID, IsComplete status, Settings, and Coordinates
 // for the new selection.
 //
-// A new UUID will be generated for the selection.
-// Upon successful creation, it returns a 200 OK. If there's an error during request binding or
-// selection creation, it returns a 400 Bad Request or 500 Internal Server Error
-// status with an error message.
+// A new UUID will be generated for each selection and all of them are stored in one transaction.
+// By default nothing is stored if any selection is invalid or fails, and the request returns a
+// 400 Bad Request or 500 Internal Server Error status with an error message. With the query
+// parameter "mode=perItem" every valid selection is stored and the result of each item is
+// returned, with a 207 Multi-Status status if any of them failed. Selections of documents the
+// caller given by "ownerUUID" cannot change fail with a 404 Not Found.
 //
-// @Summary Add a new selection
-// @Description Creates a new selection associated with a document.
+// @Summary Add new selections in bulk
+// @Description Creates several selections in one transaction, all-or-nothing unless mode is perItem.
 // @Tags selections
 // @Accept  json
 // @Produce  json
 // @Param request body []AddNewSelectionRequest true "Selections in a json array, that need to be saved"
-// @Success 201 {object} []uuid.UUID "Successful creation, returns the selection UUIDs"
+// @Param mode query string false "atomic (default) or perItem" Enums(atomic,perItem)
+// @Param ownerUUID query string true "The UUID of the caller, who has to own the documents or have them shared"
+// @Param Idempotency-Key header string false "A key that makes the request safe to retry, a retry with it is answered with the first response"
+// @Success 201 {object} object{uids=[]string} "Successful creation, returns the selection UUIDs"
+// @Success 207 {object} object{results=[]v1.BulkSelectionResult} "Per item results, some items failed"
 // @Failure 400 "Bad request, typically due to invalid input"
+// @Failure 404 "A document was not found"
+// @Failure 409 "A request with the same Idempotency-Key is still being processed"
+// @Failure 412 "The request carried an If-Match header, which it does not support"
+// @Failure 413 "The body of a request with an Idempotency-Key is too large"
+// @Failure 422 "The Idempotency-Key was already used for a different request"
 // @Failure 500 "Internal server error, typically due to database issues"
 // @Router /selections/bulk [post]
 func (t SelectionController) AddSelectionBulk(c *gin.Context) {
-	reqBody := &[]AddNewSelectionRequest{} //TODO: maybe switch to a map.
+	mode, err := bulkMode(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ownerUid, isValid := requireOwnerUUID(c)
+	if !isValid {
+		return
+	}
+
+	reqBody := &[]AddNewSelectionRequest{}
+	if err := c.ShouldBindJSON(reqBody); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	system, err := coordinateSystem(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now().UTC()
+	geometries := t.pageGeometries(c, ownerUid)
+	results := make([]BulkSelectionResult, len(*reqBody))
+	selectionsToProcess := make([]models.Selection, 0, len(*reqBody))
+	indexes := make([]int, 0, len(*reqBody))
+	for i, selection := range *reqBody {
+		results[i].Index = i
+
+		status := http.StatusBadRequest
+		toCreate, err := selection.toSelection(uuid.New(), now)
+		if err == nil {
+			toCreate.Coordinates, err = geometries.stored(toCreate.DocumentUUID, toCreate.PageKey, toCreate.Coordinates, system)
+			status = coordinateErrorStatus(err)
+		}
+		if err != nil {
+			if mode == models.BulkModeAtomic {
+				c.JSON(status, gin.H{"error": fmt.Sprintf("selection %d: %s", i, err.Error())})
+				return
+			}
+
+			results[i].Error = errorMessage(err)
+			continue
+		}
+
+		selectionsToProcess = append(selectionsToProcess, toCreate)
+		indexes = append(indexes, i)
+	}
+
+	errs, err := scoped(c, t.SelectionRepository).AddSelections(selectionsToProcess, ownerUid, mode)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	uids := make([]string, 0, len(selectionsToProcess))
+	created := make([]models.Selection, 0, len(selectionsToProcess))
+	for j, toCreate := range selectionsToProcess {
+		i := indexes[j]
+		if errs != nil && errs[j] != nil {
+			if errors.Is(errs[j], sql.ErrNoRows) {
+				results[i].Error = errorMessage(errors.New("document not found"))
+			} else {
+				results[i].Error = errorMessage(errs[j])
+			}
+			continue
+		}
+
+		selectionUid := toCreate.Uuid
+		results[i].SelectionUUID = &selectionUid
+		uids = append(uids, selectionUid.String())
+		created = append(created, toCreate)
+		t.publishSelectionsChanged(toCreate.DocumentUUID, &selectionUid)
+	}
+	recordAudit(c, t.AuditRepository, &ownerUid, nil, createdSelections(created)...)
+
+	if mode == models.BulkModePerItem {
+		c.JSON(bulkStatus(results, http.StatusCreated), gin.H{"results": results})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"uids": uids})
+}
+
+// DeleteSelectionBulk handles the HTTP DELETE request to remove several selections in one
+// transaction. It expects a JSON body conforming to the DeleteSelectionBulkRequest struct.
+//
+// By default nothing is deleted if any selection does not exist, or belongs to a document the
+// caller given by "ownerUUID" cannot change, which returns a 404 Not Found.
+// With the query parameter "mode=perItem" every existing selection is deleted and the result of
+// each item is returned, with a 207 Multi-Status status if any of them failed.
+//
+// @Summary Delete selections in bulk
+// @Description Deletes several selections in one transaction, all-or-nothing unless mode is perItem.
+// @Tags selections
+// @Accept  json
+// @Produce  json
+// @Param request body v1.DeleteSelectionBulkRequest true "The UUIDs of the selections to delete"
+// @Param mode query string false "atomic (default) or perItem" Enums(atomic,perItem)
+// @Param ownerUUID query string true "The UUID of the caller, who has to own the documents or have them shared"
+// @Success 200 {object} object{success=bool} "Successful deletion"
+// @Success 207 {object} object{results=[]v1.BulkSelectionResult} "Per item results, some items failed"
+// @Failure 400 {object} object{error=string} "Bad request, typically due to invalid input"
+// @Failure 404 {object} object{error=string} "A selection was not found"
+// @Failure 412 {object} object{error=string} "The request carried an If-Match header, which it does not support"
+// @Failure 500 {object} object{error=string} "Internal server error, typically due to database issues"
+// @Router /selections/bulk [delete]
+func (t SelectionController) DeleteSelectionBulk(c *gin.Context) {
+	mode, err := bulkMode(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ownerUid, isValid := requireOwnerUUID(c)
+	if !isValid {
+		return
+	}
 
+	reqBody := &DeleteSelectionBulkRequest{}
 	if err := c.ShouldBindJSON(reqBody); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	// The selections and their documents are only known before they are deleted.
+	deleted := make([]*models.Selection, len(reqBody.SelectionUUIDs))
+	if t.Events != nil || t.AuditRepository != nil {
+		for i, selectionUid := range reqBody.SelectionUUIDs {
+			selections, err := scoped(c, t.SelectionRepository).GetSelectionBySelectionUUID(selectionUid, ownerUid)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			if len(selections) > 0 {
+				deleted[i] = &selections[0]
+			}
+		}
+	}
+
+	errs, err := scoped(c, t.SelectionRepository).DeleteSelections(reqBody.SelectionUUIDs, ownerUid, mode)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	results := make([]BulkSelectionResult, len(reqBody.SelectionUUIDs))
+	changes := make([]auditChange, 0, len(reqBody.SelectionUUIDs))
+	for i := range reqBody.SelectionUUIDs {
+		selectionUid := reqBody.SelectionUUIDs[i]
+		results[i] = BulkSelectionResult{Index: i, SelectionUUID: &selectionUid}
+		if errs != nil && errs[i] != nil {
+			results[i].Error = errorMessage(errs[i])
+			continue
+		}
+
+		if deleted[i] != nil {
+			t.publishSelectionsChanged(deleted[i].DocumentUUID, &selectionUid)
+			changes = append(changes, selectionChange(models.AuditActionDelete, deleted[i], nil))
+		}
+	}
+	recordAudit(c, t.AuditRepository, &ownerUid, nil, changes...)
+
+	if mode == models.BulkModePerItem {
+		c.JSON(bulkStatus(results, http.StatusOK), gin.H{"results": results})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// ReplaceSelections handles the HTTP PUT request to replace all selections of a document, or of
+// one page of it, with the selections in the body. It expects the query parameters "documentUUID"
+// and "ownerUUID", see requireOwnerUUID, optionally "pageKey", and a JSON array conforming to
+// AddNewSelectionRequest. A document the caller cannot change returns a 404 Not Found.
+//
+// Items may leave out the document UUID and, when a page key is given, the page key, which are
+// then taken from the query. The existing selections are deleted and the new ones stored in one
+// transaction, so either all selections are replaced or none are. Upon success, it returns a
+// 200 OK status with the UUIDs of the new selections.
+//
+// With an If-Match header the selections are only replaced while they are at the ETag of their
+// list, read with the same "documentUUID" and "pageKey", otherwise a 412 Precondition Failed is
+// returned.
+//
+// @Summary Replace the selections of a document or page
+// @Description Deletes the selections of a document or page and stores the given ones in one transaction.
+// @Tags selections
+// @Accept  json
+// @Produce  json
+// @Param documentUUID query string true "The UUID of the document"
+// @Param ownerUUID query string true "The UUID of the caller, who has to own the document or have it shared"
+// @Param pageKey query string false "Only replace the selections of this page"
+// @Param If-Match header string false "The ETag of the replaced selections, which are only replaced while they are still at that version"
+// @Param request body []AddNewSelectionRequest true "The new selections"
+// @Success 200 {object} object{uids=[]string} "The UUIDs of the new selections"
+// @Failure 400 {object} object{error=string} "Bad request, typically due to invalid input"
+// @Failure 404 {object} object{error=string} "Document not found"
+// @Failure 412 {object} object{error=string} "The selections were changed since the If-Match ETag was read"
+// @Failure 500 {object} object{error=string} "Internal server error, typically due to database issues"
+// @Router /selections/replace [put]
+func (t SelectionController) ReplaceSelections(c *gin.Context) {
+	documentUid, err := uuid.Parse(c.Query("documentUUID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Required param documentUUID missing or invalid: " + err.Error()})
+		return
+	}
+
+	ownerUid, isValid := requireOwnerUUID(c)
+	if !isValid {
+		return
+	}
+
+	var pageKey *string
+	if key, isPresent := c.GetQuery("pageKey"); isPresent {
+		pageKey = &key
+	}
+
+	reqBody := &[]AddNewSelectionRequest{}
+	if err := c.ShouldBindJSON(reqBody); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	system, err := coordinateSystem(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now().UTC()
+	geometries := t.pageGeometries(c, ownerUid)
+	selections := make([]models.Selection, len(*reqBody))
 	uids := make([]string, len(*reqBody))
-	selectionsToProcess := *reqBody
-	for i := 0; i < len(selectionsToProcess); i++ {
-		selection := selectionsToProcess[i]
+	for i, selection := range *reqBody {
+		if selection.DocumentUUID == nil {
+			selection.DocumentUUID = &documentUid
+		} else if *selection.DocumentUUID != documentUid {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("selection %d belongs to another document", i)})
+			return
+		}
 
-		selectionUid := uuid.New()
-		toCreate := models.Selection{
-			Uuid:         selectionUid,
-			DocumentUUID: selection.DocumentUUID,
-			Coordinates:  selection.Coordinates,
-			PageKey:      &selection.PageKey,
+		if pageKey != nil {
+			if selection.PageKey == "" {
+				selection.PageKey = *pageKey
+			} else if selection.PageKey != *pageKey {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("selection %d belongs to another page", i)})
+				return
+			}
+		}
+
+		toCreate, err := selection.toSelection(uuid.New(), now)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("selection %d: %s", i, err.Error())})
+			return
 		}
 
-		err := t.SelectionRepository.AddNewSelection(toCreate)
+		toCreate.Coordinates, err = geometries.stored(toCreate.DocumentUUID, toCreate.PageKey, toCreate.Coordinates, system)
 		if err != nil {
-			uids[i] = "StatusInternalServerError. Failed to upload selection."
+			c.JSON(coordinateErrorStatus(err), gin.H{"error": fmt.Sprintf("selection %d: %s", i, err.Error())})
+			return
+		}
+
+		selections[i] = toCreate
+		uids[i] = toCreate.Uuid.String()
+	}
+
+	var replaced []models.Selection
+	if t.AuditRepository != nil {
+		replaced, err = scoped(c, t.SelectionRepository).GetSelectionListByDocumentUUID(documentUid, ownerUid, models.SelectionFilter{PageKey: pageKey})
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+				return
+			}
+
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		uids[i] = selectionUid.String()
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"uids": uids})
+	if err := scoped(c, t.SelectionRepository).ReplaceSelections(documentUid, ownerUid, pageKey, selections, selectionListPrecondition(c)); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+			return
+		}
+
+		if errors.Is(err, models.ErrVersionConflict) {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	t.publishSelectionsChanged(&documentUid, nil)
+	changes := createdSelections(selections)
+	for i := range replaced {
+		changes = append(changes, selectionChange(models.AuditActionDelete, &replaced[i], nil))
+	}
+	recordAudit(c, t.AuditRepository, &ownerUid, nil, changes...)
+	c.JSON(http.StatusOK, gin.H{"uids": uids})
+}
+
+// UpdateSelection handles the HTTP PUT and PATCH requests to change an existing selection,
+// keeping its UUID. It expects the selection's UUID as a path parameter and a JSON body
+// conforming to the UpdateSelectionRequest struct.
+//
+// PUT replaces all editable fields, so fields missing from the body are cleared. PATCH only
+// changes the fields present in the body. The document of a selection cannot be changed.
+// Selections of documents the caller given by "ownerUUID" cannot change are not found.
+// With an If-Match header the selection is only changed while it is at the version of the ETag
+// the caller read, otherwise a 412 Precondition Failed is returned.
+// Upon success, it returns a 200 OK status with the updated selection and its new ETag.
+//
+// @Summary Update a selection
+// @Description Moves, resizes or relabels a selection without changing its UUID.
+// @Tags selections
+// @Accept  json
+// @Produce  json
+// @Param   selectionUUID path string true "The UUID of the selection"
+// @Param   ownerUUID query string true "The UUID of the caller, who has to own the document or have it shared"
+// @Param   request body v1.UpdateSelectionRequest true "The new values of the selection"
+// @Param   If-Match header string false "The ETag of the selection, which is only changed while it is still at that version"
+// @Success 200 {object} object{selection=models.Selection} "The updated selection"
+// @Header 200 {string} ETag "The new version of the selection"
+// @Failure 400 {object} object{error=string} "Bad request, typically due to invalid input"
+// @Failure 404 {object} object{error=string} "Selection not found"
+// @Failure 412 {object} object{error=string} "The selection was changed since the If-Match ETag was read"
+// @Failure 500 {object} object{error=string} "Internal server error, typically due to database issues"
+// @Router /selections/{selectionUUID} [put]
+// @Router /selections/{selectionUUID} [patch]
+func (t SelectionController) UpdateSelection(c *gin.Context) {
+	selectionUid, err := uuid.Parse(c.Param("selectionUUID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ownerUid, isValid := requireOwnerUUID(c)
+	if !isValid {
+		return
+	}
+
+	reqBody := &UpdateSelectionRequest{}
+	if err := c.ShouldBindJSON(reqBody); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	system, err := coordinateSystem(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	update, err := reqBody.toUpdate(c.Request.Method == http.MethodPut)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ifVersion, isValid := ifMatchVersion(c)
+	if !isValid {
+		return
+	}
+	update.IfVersion = ifVersion
+
+	update, err = t.storedUpdate(c, selectionUid, ownerUid, update, system, t.pageGeometries(c, ownerUid))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "selection not found"})
+			return
+		}
+
+		c.JSON(coordinateErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	before, err := t.auditedSelection(c, selectionUid, ownerUid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	selection, err := scoped(c, t.SelectionRepository).UpdateSelection(selectionUid, ownerUid, update, time.Now().UTC())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "selection not found"})
+			return
+		}
+
+		if errors.Is(err, models.ErrVersionConflict) {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	t.publishSelectionsChanged(selection.DocumentUUID, &selection.Uuid)
+	recordAudit(c, t.AuditRepository, &ownerUid, nil, selectionChange(models.AuditActionUpdate, before, &selection))
+	c.Header("ETag", versionETag(selection.Version))
+	c.JSON(http.StatusOK, gin.H{"selection": selection})
+}
+
+// UpdateSelectionBulk handles the HTTP PUT and PATCH requests to change several selections.
+// It expects a JSON array of UpdateSelectionBulkRequest, each naming the selection to change.
+// PUT and PATCH behave as for UpdateSelection, and all updates run in one transaction.
+//
+// By default nothing is changed if any item is invalid or names a missing selection, and the
+// updated selections are returned in request order with a 200 OK status. With the query
+// parameter "mode=perItem" every valid item is applied and the result of each item is returned,
+// with a 207 Multi-Status status if any of them failed. Selections of documents the caller given
+// by "ownerUUID" cannot change are not found.
+//
+// @Summary Update selections in bulk
+// @Description Moves, resizes or relabels several selections without changing their UUIDs.
+// @Tags selections
+// @Accept  json
+// @Produce  json
+// @Param   request body []v1.UpdateSelectionBulkRequest true "The selections to update with their new values"
+// @Param   mode query string false "atomic (default) or perItem" Enums(atomic,perItem)
+// @Param   ownerUUID query string true "The UUID of the caller, who has to own the documents or have them shared"
+// @Success 200 {object} object{selections=[]models.Selection} "The updated selections"
+// @Success 207 {object} object{results=[]v1.BulkSelectionResult} "Per item results, some items failed"
+// @Failure 400 {object} object{error=string} "Bad request, typically due to invalid input"
+// @Failure 404 {object} object{error=string} "A selection was not found"
+// @Failure 412 {object} object{error=string} "The request carried an If-Match header, which it does not support"
+// @Failure 500 {object} object{error=string} "Internal server error, typically due to database issues"
+// @Router /selections/bulk [put]
+// @Router /selections/bulk [patch]
+func (t SelectionController) UpdateSelectionBulk(c *gin.Context) {
+	mode, err := bulkMode(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ownerUid, isValid := requireOwnerUUID(c)
+	if !isValid {
+		return
+	}
+
+	reqBody := &[]UpdateSelectionBulkRequest{}
+	if err := c.ShouldBindJSON(reqBody); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	system, err := coordinateSystem(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	replace := c.Request.Method == http.MethodPut
+	geometries := t.pageGeometries(c, ownerUid)
+	results := make([]BulkSelectionResult, len(*reqBody))
+	updates := make([]models.BulkSelectionUpdate, 0, len(*reqBody))
+	indexes := make([]int, 0, len(*reqBody))
+	for i, item := range *reqBody {
+		selectionUid := item.SelectionUUID
+		results[i] = BulkSelectionResult{Index: i, SelectionUUID: &selectionUid}
+
+		status := http.StatusBadRequest
+		update, err := item.toUpdate(replace)
+		if err == nil && item.SelectionUUID == uuid.Nil {
+			err = errors.New("selectionUUID is required")
+		}
+		if err == nil {
+			update, err = t.storedUpdate(c, item.SelectionUUID, ownerUid, update, system, geometries)
+			status = coordinateErrorStatus(err)
+			if errors.Is(err, sql.ErrNoRows) {
+				err, status = errors.New("selection not found"), http.StatusNotFound
+			}
+		}
+		if err != nil {
+			if mode == models.BulkModeAtomic {
+				c.JSON(status, gin.H{"error": fmt.Sprintf("selection %d: %s", i, err.Error())})
+				return
+			}
+
+			results[i].Error = errorMessage(err)
+			continue
+		}
+
+		updates = append(updates, models.BulkSelectionUpdate{SelectionUUID: item.SelectionUUID, Update: update})
+		indexes = append(indexes, i)
+	}
+
+	befores := make([]*models.Selection, len(updates))
+	for j, update := range updates {
+		befores[j], err = t.auditedSelection(c, update.SelectionUUID, ownerUid)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	updated, errs, err := scoped(c, t.SelectionRepository).UpdateSelections(updates, ownerUid, time.Now().UTC(), mode)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	selections := make([]models.Selection, 0, len(updated))
+	changes := make([]auditChange, 0, len(updated))
+	for j, selection := range updated {
+		i := indexes[j]
+		if errs != nil && errs[j] != nil {
+			if errors.Is(errs[j], sql.ErrNoRows) {
+				results[i].Error = errorMessage(errors.New("selection not found"))
+			} else {
+				results[i].Error = errorMessage(errs[j])
+			}
+			continue
+		}
+
+		results[i].Selection = &updated[j]
+		selections = append(selections, selection)
+		changes = append(changes, selectionChange(models.AuditActionUpdate, befores[j], &updated[j]))
+		t.publishSelectionsChanged(selection.DocumentUUID, &selection.Uuid)
+	}
+	recordAudit(c, t.AuditRepository, &ownerUid, nil, changes...)
+
+	if mode == models.BulkModePerItem {
+		c.JSON(bulkStatus(results, http.StatusOK), gin.H{"results": results})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"selections": selections})
+}
+
+// ExtractSelectionText handles the HTTP POST request to extract the text inside a selection.
+// It expects the selection's UUID as a path parameter and the UUID of the document owner as the
+// query parameter "ownerUUID", see requireOwnerUUID. Only the owner can load the document, so
+// extraction is not available on shared documents.
+//
+// The page of the selection is looked up by its page key in the page geometry of the document,
+// falling back to the key as page number for documents without one, and its coordinates are read
+// in pdf user space. The extracted text is stored on the selection together
+// with the time of the extraction, and returned by later requests for the selection.
+//
+// @Summary Extract the text of a selection
+// @Description Extracts the text inside the rectangle of a selection and stores it on the selection.
+// @Tags selections
+// @Produce  json
+// @Param   selectionUUID path string true "The UUID of the selection"
+// @Param   ownerUUID query string true "The UUID of the owner of the document"
+// @Param Idempotency-Key header string false "A key that makes the request safe to retry, a retry with it is answered with the first response"
+// @Success 200 {object} object{selectionUUID=string,extractedText=string,textExtractedAt=string} "The extracted text"
+// @Failure 400 {object} object{error=string} "Bad request, typically due to an invalid UUID or a selection without coordinates"
+// @Failure 404 {object} object{error=string} "Selection or document not found"
+// @Failure 409 "A request with the same Idempotency-Key is still being processed"
+// @Failure 412 {object} object{error=string} "The request carried an If-Match header, which it does not support"
+// @Failure 413 "The body of a request with an Idempotency-Key is too large"
+// @Failure 422 {object} object{error=string} "The document could not be read or has no such page"
+// @Failure 422 "The Idempotency-Key was already used for a different request"
+// @Failure 500 {object} object{error=string} "Internal server error, typically due to database issues"
+// @Failure 502 {object} object{error=string} "The data service failed to extract the text"
+// @Failure 503 {object} object{error=string} "Text extraction is not available"
+// @Router /selections/{selectionUUID}/text [post]
+func (t SelectionController) ExtractSelectionText(c *gin.Context) {
+	if t.TextExtractor == nil || t.DocumentRepository == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Text extraction is not configured on this server"})
+		return
+	}
+
+	selectionUid, err := uuid.Parse(c.Param("selectionUUID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ownerUid, isValid := requireOwnerUUID(c)
+	if !isValid {
+		return
+	}
+
+	selections, err := scoped(c, t.SelectionRepository).GetSelectionBySelectionUUID(selectionUid, ownerUid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(selections) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "selection not found"})
+		return
+	}
+
+	selection := selections[0]
+	if selection.DocumentUUID == nil || selection.Coordinates == nil || selection.PageKey == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "selection needs a document, page key and coordinates to extract text"})
+		return
+	}
+
+	pageNumber, err := t.pageGeometries(c, ownerUid).pageNumber(*selection.DocumentUUID, *selection.PageKey)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	exclude := make(models.Exclude)
+	exclude.TimeCreated(true).OwnerUUID(true).OwnerType(true).DocumentTitle(true).MetaStatus(true)
+	document, err := scoped(c, t.DocumentRepository).GetDocumentByDocumentUUID(*selection.DocumentUUID, ownerUid, exclude)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if document.PdfBase64 == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+		return
+	}
+
+	text, err := t.TextExtractor.ExtractText(c.Request.Context(), strings.NewReader(*document.PdfBase64), pageNumber, *selection.Coordinates)
+	if err != nil {
+		c.JSON(documentProcessingErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	extractedAt := time.Now().UTC().Truncate(time.Microsecond)
+	if err := scoped(c, t.SelectionRepository).SetExtractedText(selectionUid, ownerUid, text, extractedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "selection not found"})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	t.publishSelectionsChanged(selection.DocumentUUID, &selectionUid)
+	extracted := selection
+	extracted.ExtractedText, extracted.TextExtractedAt = &text, &extractedAt
+	recordAudit(c, t.AuditRepository, &ownerUid, nil, selectionChange(models.AuditActionUpdate, &selection, &extracted))
+	c.JSON(http.StatusOK, gin.H{"selectionUUID": selectionUid, "extractedText": text, "textExtractedAt": extractedAt})
+}
+
+// documentProcessingErrorStatus maps the errors of processing a stored document, either by the
+// data service or locally, to a status.
+func documentProcessingErrorStatus(err error) int {
+	var statusErr *dataapi.StatusError
+	switch {
+	case errors.Is(err, dataapi.ErrCircuitOpen):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, pdf.ErrPageNotFound), errors.Is(err, pdf.ErrNotPdf), errors.Is(err, pdf.ErrMalformed),
+		errors.Is(err, pdf.ErrInvalidBase64), errors.Is(err, dataapi.ErrInvalidBase64):
+		return http.StatusUnprocessableEntity
+	case errors.As(err, &statusErr):
+		return http.StatusBadGateway
+	}
+
+	return http.StatusInternalServerError
+}
+
+// toSelection validates the request and turns it into a new selection created at the given time.
+func (r AddNewSelectionRequest) toSelection(uid uuid.UUID, now time.Time) (models.Selection, error) {
+	if r.DocumentUUID == nil || *r.DocumentUUID == uuid.Nil {
+		return models.Selection{}, errors.New("documentUUID is required")
+	}
+
+	if err := validateSelectionAttributes(r.Type, r.Label, r.Note, r.Color, r.AuthorUUID); err != nil {
+		return models.Selection{}, err
+	}
+
+	pageKey := r.PageKey
+	return models.Selection{
+		Uuid:         uid,
+		DocumentUUID: r.DocumentUUID,
+		Coordinates:  r.Coordinates,
+		PageKey:      &pageKey,
+		Type:         r.Type,
+		Label:        r.Label,
+		Note:         r.Note,
+		Color:        r.Color,
+		AuthorUUID:   r.AuthorUUID,
+		CreatedAt:    &now,
+		UpdatedAt:    &now,
+	}, nil
+}
+
+// toUpdate validates the request and turns it into an update, which replaces every field for PUT.
+func (r UpdateSelectionRequest) toUpdate(replace bool) (models.SelectionUpdate, error) {
+	if err := validateSelectionAttributes(r.Type, r.Label, r.Note, r.Color, r.AuthorUUID); err != nil {
+		return models.SelectionUpdate{}, err
+	}
+
+	return models.SelectionUpdate{
+		PageKey:     r.PageKey,
+		Coordinates: r.Coordinates,
+		Type:        r.Type,
+		Label:       r.Label,
+		Note:        r.Note,
+		Color:       r.Color,
+		AuthorUUID:  r.AuthorUUID,
+		Replace:     replace,
+	}, nil
+}
+
+// validateSelectionAttributes checks the optional descriptive fields shared by new and updated selections.
+func validateSelectionAttributes(selectionType *models.SelectionType, label, note, color *string, author *uuid.UUID) error {
+	if selectionType != nil && !selectionType.IsValid() {
+		return fmt.Errorf("unknown selection type %q", *selectionType)
+	}
+
+	if label != nil && utf8.RuneCountInString(*label) > maxSelectionLabelLength {
+		return fmt.Errorf("label must not be longer than %d characters", maxSelectionLabelLength)
+	}
+
+	if note != nil && utf8.RuneCountInString(*note) > maxSelectionNoteLength {
+		return fmt.Errorf("note must not be longer than %d characters", maxSelectionNoteLength)
+	}
+
+	if color != nil && !colorPattern.MatchString(*color) {
+		return fmt.Errorf("color %q is not a hex color like #ffd700", *color)
+	}
+
+	if author != nil && *author == uuid.Nil {
+		return errors.New("authorUUID cannot be nil")
+	}
+
+	return nil
+}
+
+// requireOwnerUUID reads the required "ownerUUID" query parameter, the caller whose documents,
+// and the documents shared with them, the request is limited to. It responds with a 400 Bad
+// Request and returns false when the parameter is missing or invalid.
+func requireOwnerUUID(c *gin.Context) (uuid.UUID, bool) {
+	ownerUidStr, isPresent := c.GetQuery("ownerUUID")
+	if !isPresent {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Required param ownerUUID missing!"})
+		return uuid.Nil, false
+	}
+
+	ownerUid, err := uuid.Parse(ownerUidStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return uuid.Nil, false
+	}
+
+	setRequestOwner(c, ownerUid)
+	return ownerUid, true
+}
+
+// selectionFilter reads the "type" query parameter, which may be repeated or comma separated,
+// and the spatial parameters: "pageKey", the rectangles "intersects" and "within" as
+// "x1,y1,x2,y2", the point "near" as "x,y" and "limit". The rectangles and the point are in the
+// coordinate system of the request, see storedFilter.
+func selectionFilter(c *gin.Context) (models.SelectionFilter, error) {
+	filter := models.SelectionFilter{}
+	for _, value := range c.QueryArray("type") {
+		for _, name := range strings.Split(value, ",") {
+			selectionType := models.SelectionType(strings.TrimSpace(name))
+			if !selectionType.IsValid() {
+				return filter, fmt.Errorf("unknown selection type %q", name)
+			}
+			filter.Types = append(filter.Types, selectionType)
+		}
+	}
+
+	if pageKey, isPresent := c.GetQuery("pageKey"); isPresent {
+		filter.PageKey = &pageKey
+	}
+
+	rectangle := func(name string) (*models.Coordinates, error) {
+		value, isPresent := c.GetQuery(name)
+		if !isPresent {
+			return nil, nil
+		}
+
+		numbers, err := queryNumbers(name, value, 4)
+		if err != nil {
+			return nil, err
+		}
+
+		return &models.Coordinates{X1: numbers[0], Y1: numbers[1], X2: numbers[2], Y2: numbers[3]}, nil
+	}
+
+	var err error
+	if filter.Intersects, err = rectangle("intersects"); err != nil {
+		return filter, err
+	}
+
+	if filter.Within, err = rectangle("within"); err != nil {
+		return filter, err
+	}
+
+	if value, isPresent := c.GetQuery("near"); isPresent {
+		numbers, err := queryNumbers("near", value, 2)
+		if err != nil {
+			return filter, err
+		}
+		filter.Near = &models.Point{X: numbers[0], Y: numbers[1]}
+	}
+
+	if value, isPresent := c.GetQuery("limit"); isPresent {
+		filter.Limit, err = strconv.Atoi(value)
+		if err != nil || filter.Limit < 1 {
+			return filter, fmt.Errorf("limit %q is not a positive number", value)
+		}
+	}
+
+	return filter, nil
+}
+
+// queryNumbers parses a query parameter of count comma separated finite numbers.
+func queryNumbers(name, value string, count int) ([]float64, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != count {
+		return nil, fmt.Errorf("%s must be %d comma separated numbers", name, count)
+	}
+
+	numbers := make([]float64, count)
+	for i, part := range parts {
+		number, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || math.IsNaN(number) || math.IsInf(number, 0) {
+			return nil, fmt.Errorf("%s must be %d comma separated numbers", name, count)
+		}
+		numbers[i] = number
+	}
+
+	return numbers, nil
+}
+
+// bulkMode reads the "mode" query parameter of bulk requests, which defaults to atomic.
+func bulkMode(c *gin.Context) (models.BulkMode, error) {
+	mode := models.BulkMode(c.DefaultQuery("mode", string(models.BulkModeAtomic)))
+	if !mode.IsValid() {
+		return mode, fmt.Errorf("unknown mode %q, expected atomic or perItem", mode)
+	}
+
+	return mode, nil
+}
+
+// bulkStatus is the given status when every item succeeded and 207 Multi-Status otherwise.
+func bulkStatus(results []BulkSelectionResult, status int) int {
+	for _, result := range results {
+		if result.Error != nil {
+			return http.StatusMultiStatus
+		}
+	}
+
+	return status
+}
+
+func errorMessage(err error) *string {
+	message := err.Error()
+	return &message
+}
+
+// selectionListETag is the entity tag of a list of selections, If-Match headers of changes to all
+// selections of a document or page are expected to carry it, see selectionListPrecondition.
+func selectionListETag(selections []models.Selection) string {
+	return listETag(selections, func(selection models.Selection) (uuid.UUID, int) {
+		return selection.Uuid, selection.Version
+	})
+}
+
+// selectionListPrecondition makes a change to all selections of a document or page conditional
+// on the If-Match header listing the selectionListETag of the selections it changes. Without the
+// header, or with "*", the change is unconditional and nil is returned.
+func selectionListPrecondition(c *gin.Context) models.ListPrecondition {
+	etags := ifMatchETags(c)
+	if etags == nil {
+		return nil
+	}
+
+	return func(current []models.Selection) error {
+		if etag := selectionListETag(current); !slices.Contains(etags, etag) {
+			return fmt.Errorf("%w: the current selections are at %s", models.ErrVersionConflict, etag)
+		}
+
+		return nil
+	}
+}
+
+// auditedSelection loads a selection before it is changed, nil when nothing is audited or the
+// selection does not exist.
+func (t SelectionController) auditedSelection(c *gin.Context, selectionUid, ownerUid uuid.UUID) (*models.Selection, error) {
+	if t.AuditRepository == nil {
+		return nil, nil
+	}
+
+	selections, err := scoped(c, t.SelectionRepository).GetSelectionBySelectionUUID(selectionUid, ownerUid)
+	if err != nil || len(selections) == 0 {
+		return nil, err
+	}
+
+	return &selections[0], nil
+}
+
+// publishSelectionsChanged notifies the document's event subscribers, selectionUid is nil when
+// every selection of the document was affected.
+func (t SelectionController) publishSelectionsChanged(documentUid *uuid.UUID, selectionUid *uuid.UUID) {
+	if t.Events == nil || documentUid == nil {
+		return
+	}
+
+	t.Events.Publish(models.Event{
+		Type:          models.EventSelectionsChanged,
+		DocumentUUID:  *documentUid,
+		SelectionUUID: selectionUid,
+	})
 }
 
 func (t SelectionController) SetupRouter(c *gin.RouterGroup) {
 	c.DELETE("/", t.DeleteSelection)
-	c.POST("/", t.AddSelection)
-	c.POST("/bulk", t.AddSelectionBulk)
+	c.POST("/", rejectIfMatch, t.AddSelection)
+	c.POST("/bulk", rejectIfMatch, t.AddSelectionBulk)
+	c.PUT("/bulk", rejectIfMatch, t.UpdateSelectionBulk)
+	c.PATCH("/bulk", rejectIfMatch, t.UpdateSelectionBulk)
+	c.DELETE("/bulk", rejectIfMatch, t.DeleteSelectionBulk)
+	c.PUT("/replace", t.ReplaceSelections)
+	c.PUT("/:selectionUUID", t.UpdateSelection)
+	c.PATCH("/:selectionUUID", t.UpdateSelection)
 	c.GET("/", t.GetSelection)
+	c.GET("/export", t.ExportSelections)
+	c.GET("/images", t.GetSelectionImages)
+	c.POST("/import", rejectIfMatch, t.ImportSelections)
+	c.POST("/redact", rejectIfMatch, t.RedactDocument)
+	c.POST("/templates", rejectIfMatch, t.AddSelectionTemplate)
+	c.GET("/templates", t.GetSelectionTemplates)
+	c.GET("/templates/:templateUUID", t.GetSelectionTemplate)
+	c.DELETE("/templates/:templateUUID", rejectIfMatch, t.DeleteSelectionTemplate)
+	c.POST("/templates/:templateUUID/apply", rejectIfMatch, t.ApplySelectionTemplate)
+	c.POST("/:selectionUUID/text", rejectIfMatch, t.ExtractSelectionText)
+	c.GET("/:selectionUUID/image", t.GetSelectionImage)
 }
@@ -0,0 +1,234 @@
+package v1
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"pdf_service_api/models"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// coordinateSystem reads the "coordinateSpace" and "dpi" query parameters, which default to pdf
+// user space. Selections are always stored in pdf user space and converted on read and write.
+func coordinateSystem(c *gin.Context) (models.CoordinateSystem, error) {
+	system := models.CoordinateSystem{
+		Space: models.CoordinateSpace(c.DefaultQuery("coordinateSpace", string(models.CoordinateSpacePdf))),
+	}
+
+	if dpi, isPresent := c.GetQuery("dpi"); isPresent {
+		value, err := strconv.ParseFloat(dpi, 64)
+		if err != nil {
+			return system, fmt.Errorf("%w: dpi is not a number", models.ErrInvalidCoordinateSystem)
+		}
+		system.DPI = value
+	}
+
+	return system, system.Validate()
+}
+
+// coordinateErrorStatus maps the errors of validating and converting coordinates to a status.
+func coordinateErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, models.ErrInvalidCoordinateSystem), errors.Is(err, models.ErrInvalidCoordinates),
+		errors.Is(err, models.ErrPageOutOfRange):
+		return http.StatusBadRequest
+	case errors.Is(err, models.ErrNoPageGeometry):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, sql.ErrNoRows):
+		return http.StatusNotFound
+	}
+
+	return http.StatusInternalServerError
+}
+
+// pageGeometries loads the page geometry of the documents touched by a request, each only once
+// and only if the caller may read the document.
+type pageGeometries struct {
+	repository models.MetaRepository
+	ownerUid   uuid.UUID
+	documents  map[uuid.UUID]models.Meta
+}
+
+func (t SelectionController) pageGeometries(c *gin.Context, ownerUid uuid.UUID) *pageGeometries {
+	return &pageGeometries{repository: scoped(c, t.MetaRepository), ownerUid: ownerUid, documents: make(map[uuid.UUID]models.Meta)}
+}
+
+func (g *pageGeometries) page(documentUid *uuid.UUID, pageKey *string) (models.PageGeometry, error) {
+	if g.repository == nil || documentUid == nil || pageKey == nil || *pageKey == "" {
+		return models.PageGeometry{}, models.ErrNoPageGeometry
+	}
+
+	meta, err := g.meta(*documentUid)
+	if err != nil {
+		return models.PageGeometry{}, err
+	}
+
+	return meta.PageGeometry(*pageKey)
+}
+
+func (g *pageGeometries) meta(documentUid uuid.UUID) (models.Meta, error) {
+	meta, isLoaded := g.documents[documentUid]
+	if !isLoaded {
+		var err error
+		meta, err = g.repository.GetPageGeometryForOwner(documentUid, g.ownerUid)
+		if err != nil {
+			return models.Meta{}, err
+		}
+		g.documents[documentUid] = meta
+	}
+
+	return meta, nil
+}
+
+// pageKey returns the key of the page with the given number, which is the number itself unless
+// the stored page geometry names the page differently.
+func (g *pageGeometries) pageKey(documentUid uuid.UUID, pageNumber uint32) (string, error) {
+	key := strconv.FormatUint(uint64(pageNumber), 10)
+	if g.repository == nil {
+		return key, nil
+	}
+
+	meta, err := g.meta(documentUid)
+	if err != nil {
+		return "", err
+	}
+
+	for _, page := range meta.Pages {
+		if page.PageNumber == pageNumber && page.PageKey != "" {
+			return page.PageKey, nil
+		}
+	}
+
+	return key, nil
+}
+
+// stored checks that the page of a selection exists and converts its coordinates into pdf user
+// space, normalized and on the page. Without known page geometry only pdf coordinates are
+// accepted, which are then normalized but not checked against the page.
+func (g *pageGeometries) stored(documentUid *uuid.UUID, pageKey *string, coordinates *models.Coordinates, system models.CoordinateSystem) (*models.Coordinates, error) {
+	geometry, err := g.page(documentUid, pageKey)
+	if err != nil && !errors.Is(err, models.ErrNoPageGeometry) {
+		return nil, err
+	}
+
+	if coordinates == nil {
+		return nil, nil
+	}
+
+	if err == nil {
+		converted, err := geometry.ToPdf(*coordinates, system)
+		if !errors.Is(err, models.ErrNoPageGeometry) {
+			if err != nil {
+				return nil, err
+			}
+			return &converted, nil
+		}
+	}
+
+	if system.Space != models.CoordinateSpacePdf {
+		return nil, models.ErrNoPageGeometry
+	}
+
+	if err := coordinates.Validate(); err != nil {
+		return nil, err
+	}
+
+	normalized := coordinates.Normalized()
+	return &normalized, nil
+}
+
+// displayed converts the stored coordinates of a selection into the coordinate system.
+func (g *pageGeometries) displayed(selection models.Selection, system models.CoordinateSystem) (*models.Coordinates, error) {
+	if selection.Coordinates == nil || system.Space == models.CoordinateSpacePdf {
+		return selection.Coordinates, nil
+	}
+
+	geometry, err := g.page(selection.DocumentUUID, selection.PageKey)
+	if err != nil {
+		return nil, err
+	}
+
+	converted, err := geometry.FromPdf(*selection.Coordinates, system)
+	if err != nil {
+		return nil, err
+	}
+
+	return &converted, nil
+}
+
+// storedUpdate converts the coordinates of an update into pdf user space. The page of the
+// selection is loaded when the update does not move it to another page.
+func (t SelectionController) storedUpdate(c *gin.Context, selectionUid, ownerUid uuid.UUID, update models.SelectionUpdate, system models.CoordinateSystem, geometries *pageGeometries) (models.SelectionUpdate, error) {
+	if update.Coordinates == nil && update.PageKey == nil {
+		return update, nil
+	}
+
+	selections, err := scoped(c, t.SelectionRepository).GetSelectionBySelectionUUID(selectionUid, ownerUid)
+	if err != nil {
+		return update, err
+	}
+
+	if len(selections) == 0 {
+		return update, sql.ErrNoRows
+	}
+
+	pageKey := update.PageKey
+	if pageKey == nil && !update.Replace {
+		pageKey = selections[0].PageKey
+	}
+
+	update.Coordinates, err = geometries.stored(selections[0].DocumentUUID, pageKey, update.Coordinates, system)
+	return update, err
+}
+
+// storedFilter converts the rectangles and the point of a filter into pdf user space. Other
+// coordinate spaces need the geometry of the page given by the filter's page key. Unlike stored
+// selections they may reach past the page, as rectangles hit-testing near its edges do.
+func (g *pageGeometries) storedFilter(documentUid uuid.UUID, filter models.SelectionFilter, system models.CoordinateSystem) (models.SelectionFilter, error) {
+	if filter.Intersects == nil && filter.Within == nil && filter.Near == nil {
+		return filter, nil
+	}
+
+	convert := func(c models.Coordinates) (models.Coordinates, error) {
+		if system.Space == models.CoordinateSpacePdf {
+			return c.Normalized(), c.Validate()
+		}
+
+		geometry, err := g.page(&documentUid, filter.PageKey)
+		if err != nil {
+			return models.Coordinates{}, err
+		}
+
+		return geometry.ToPdfUnbounded(c, system)
+	}
+
+	if system.Space != models.CoordinateSpacePdf && filter.PageKey == nil {
+		return filter, fmt.Errorf("%w: spatial parameters in %s space need a pageKey", models.ErrInvalidCoordinateSystem, system.Space)
+	}
+
+	for _, rectangle := range []**models.Coordinates{&filter.Intersects, &filter.Within} {
+		if *rectangle == nil {
+			continue
+		}
+
+		converted, err := convert(**rectangle)
+		if err != nil {
+			return filter, err
+		}
+		*rectangle = &converted
+	}
+
+	if filter.Near != nil {
+		converted, err := convert(models.Coordinates{X1: filter.Near.X, Y1: filter.Near.Y, X2: filter.Near.X, Y2: filter.Near.Y})
+		if err != nil {
+			return filter, err
+		}
+		filter.Near = &models.Point{X: converted.X1, Y: converted.Y1}
+	}
+
+	return filter, nil
+}
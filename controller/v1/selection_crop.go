@@ -0,0 +1,355 @@
+package v1
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"net/http"
+	"pdf_service_api/models"
+	"pdf_service_api/service/imaging"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// maxCropScale limits how far crops are enlarged, every crop is decoded into memory.
+const maxCropScale = 4
+
+var (
+	errNoPageImage        = errors.New("page has no image")
+	errSelectionNotOnPage = errors.New("selection needs a page key and coordinates to be cropped")
+)
+
+// GetSelectionImage handles the HTTP GET request to retrieve the region of a selection cut out of
+// the image of its page. It expects the selection's UUID as a path parameter and the query
+// parameter "ownerUUID", see requireOwnerUUID.
+//
+// The region is located on the image through the page geometry of the meta data, so it matches
+// the selection whatever resolution the page was rendered at. The crop keeps the resolution of
+// the page image unless it is scaled with the query parameter "scale".
+//
+// @Summary Get the image of a selection
+// @Description Returns the region of a selection cropped from the image of its page as binary data.
+// @Tags selections
+// @Produce  image/png
+// @Produce  image/jpeg
+// @Param   selectionUUID path string true "The UUID of the selection"
+// @Param   ownerUUID query string true "The UUID of the caller, who has to own the document or have it shared"
+// @Param   format query string false "Format of the image: png (default) or jpeg" Enums(png,jpeg)
+// @Param   scale query number false "Factor the crop is resized by, up to 4, 1 by default"
+// @Success 200 {file} binary "The cropped region"
+// @Failure 400 {object} object{error=string} "Bad request, typically due to invalid parameters or a selection without page or coordinates"
+// @Failure 404 {object} object{error=string} "Selection, page or page image not found"
+// @Failure 422 {object} object{error=string} "The page geometry is unknown or the selection lies outside of the page image"
+// @Failure 500 {object} object{error=string} "Internal server error, typically due to database issues"
+// @Router /selections/{selectionUUID}/image [get]
+func (t SelectionController) GetSelectionImage(c *gin.Context) {
+	selectionUid, err := uuid.Parse(c.Param("selectionUUID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ownerUid, isValid := requireOwnerUUID(c)
+	if !isValid {
+		return
+	}
+
+	options, err := requestedCropOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	selections, err := scoped(c, t.SelectionRepository).GetSelectionBySelectionUUID(selectionUid, ownerUid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(selections) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "selection not found"})
+		return
+	}
+
+	data, err := t.selectionCrops(c, ownerUid, options).crop(selections[0])
+	if err != nil {
+		c.JSON(cropErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Data(http.StatusOK, options.mimeType, data)
+}
+
+// GetSelectionImages handles the HTTP GET request to retrieve the crops of every selection of a
+// document as a zip. It expects the query parameters "documentUUID" and "ownerUUID", optionally
+// the filters of GetSelection and the options of GetSelectionImage.
+//
+// Every crop is named after its selection. The zip also holds a manifest.json listing the page,
+// type and label of each selection, selections that could not be cropped are listed there with
+// the reason instead of failing the request.
+//
+// @Summary Get the images of the selections of a document
+// @Description Returns a zip with the region of every selection of a document cropped from its page image, together with a manifest.json.
+// @Tags selections
+// @Produce  application/zip
+// @Param   documentUUID query string true "The UUID of the document"
+// @Param   ownerUUID query string true "The UUID of the caller, who has to own the document or have it shared"
+// @Param   format query string false "Format of the images: png (default) or jpeg" Enums(png,jpeg)
+// @Param   scale query number false "Factor the crops are resized by, up to 4, 1 by default"
+// @Param   type query []string false "Only crop selections of these types" collectionFormat(multi) Enums(highlight,note,redaction,field)
+// @Param   pageKey query string false "Only crop selections of this page"
+// @Param   intersects query string false "Only crop selections overlapping the rectangle x1,y1,x2,y2"
+// @Param   within query string false "Only crop selections inside the rectangle x1,y1,x2,y2"
+// @Param   coordinateSpace query string false "The space of the rectangles, pdf by default" Enums(pdf,px,relative)
+// @Param   dpi query number false "The resolution of pixel coordinates"
+// @Success 200 {file} binary "The zip of crops, see v1.SelectionCropEntry for the manifest"
+// @Failure 400 {object} object{error=string} "Bad request, typically due to missing/invalid parameters"
+// @Failure 404 {object} object{error=string} "Document not found"
+// @Failure 422 {object} object{error=string} "The page geometry needed to convert the rectangles is unknown"
+// @Failure 500 {object} object{error=string} "Internal server error, typically due to database issues"
+// @Router /selections/images [get]
+func (t SelectionController) GetSelectionImages(c *gin.Context) {
+	documentUid, err := uuid.Parse(c.Query("documentUUID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Required param documentUUID missing or invalid: " + err.Error()})
+		return
+	}
+
+	ownerUid, isValid := requireOwnerUUID(c)
+	if !isValid {
+		return
+	}
+
+	options, err := requestedCropOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	system, err := coordinateSystem(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filter, err := selectionFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	crops := t.selectionCrops(c, ownerUid, options)
+	filter, err = crops.geometries.storedFilter(documentUid, filter, system)
+	if err != nil {
+		c.JSON(coordinateErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	selections, err := scoped(c, t.SelectionRepository).GetSelectionListByDocumentUUID(documentUid, ownerUid, filter)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The zip is streamed, so a failure after the first crop can only be reported by ending the
+	// response early, which leaves the client with an incomplete archive.
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-selections.zip"`, documentUid))
+	c.Header("Content-Type", "application/zip")
+	c.Status(http.StatusOK)
+
+	archive := zip.NewWriter(c.Writer)
+	manifest := make([]SelectionCropEntry, 0, len(selections))
+	for _, selection := range selections {
+		entry := SelectionCropEntry{SelectionUUID: selection.Uuid, PageKey: selection.PageKey, Type: selection.Type, Label: selection.Label}
+
+		data, err := crops.crop(selection)
+		if err != nil {
+			if cropErrorStatus(err) == http.StatusInternalServerError {
+				abortStream(c, err)
+				return
+			}
+
+			entry.Skipped = err.Error()
+			manifest = append(manifest, entry)
+			continue
+		}
+
+		entry.File = selection.Uuid.String() + "." + options.extension
+		if err := writeZipFile(archive, entry.File, data); err != nil {
+			abortStream(c, err)
+			return
+		}
+		manifest = append(manifest, entry)
+	}
+
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err == nil {
+		err = writeZipFile(archive, "manifest.json", manifestJSON)
+	}
+	if err == nil {
+		err = archive.Close()
+	}
+	if err != nil {
+		abortStream(c, err)
+	}
+}
+
+// abortStream ends a response whose body is already being written, logging the error that
+// could not be sent anymore.
+func abortStream(c *gin.Context, err error) {
+	requestLogger(c).Error("response aborted", "error", err)
+	_ = c.Error(err)
+	c.Abort()
+}
+
+func writeZipFile(archive *zip.Writer, name string, data []byte) error {
+	writer, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+
+	_, err = writer.Write(data)
+	return err
+}
+
+// cropOptions are the format and size crops are returned in.
+type cropOptions struct {
+	mimeType  string
+	extension string
+	scale     float64
+}
+
+// requestedCropOptions reads the "format" and "scale" query parameters.
+func requestedCropOptions(c *gin.Context) (cropOptions, error) {
+	options := cropOptions{scale: 1}
+	switch c.DefaultQuery("format", "png") {
+	case "png":
+		options.mimeType, options.extension = "image/png", "png"
+	case "jpeg", "jpg":
+		options.mimeType, options.extension = "image/jpeg", "jpg"
+	default:
+		return options, errors.New("invalid value for the query param format, allowed values are png and jpeg")
+	}
+
+	if value, isPresent := c.GetQuery("scale"); isPresent {
+		scale, err := strconv.ParseFloat(value, 64)
+		if err != nil || !(scale > 0 && scale <= maxCropScale) {
+			return options, fmt.Errorf("invalid value for the query param scale, expected a number above 0 and up to %d", maxCropScale)
+		}
+		options.scale = scale
+	}
+
+	return options, nil
+}
+
+// cropErrorStatus maps the errors of cropping a selection to a status.
+func cropErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, sql.ErrNoRows), errors.Is(err, errNoPageImage):
+		return http.StatusNotFound
+	case errors.Is(err, errSelectionNotOnPage):
+		return http.StatusBadRequest
+	case errors.Is(err, imaging.ErrEmptyCrop):
+		return http.StatusUnprocessableEntity
+	}
+
+	return coordinateErrorStatus(err)
+}
+
+// selectionCrops cuts selections out of their page images. Only the image of the last page is
+// kept decoded, selections are listed and so cropped in the order of their pages.
+type selectionCrops struct {
+	metaRepository models.MetaRepository
+	ownerUid       uuid.UUID
+	options        cropOptions
+	geometries     *pageGeometries
+	pageUid        uuid.UUID
+	pageKey        string
+	pageImage      image.Image
+}
+
+func (t SelectionController) selectionCrops(c *gin.Context, ownerUid uuid.UUID, options cropOptions) *selectionCrops {
+	return &selectionCrops{
+		metaRepository: scoped(c, t.MetaRepository),
+		ownerUid:       ownerUid,
+		options:        options,
+		geometries:     t.pageGeometries(c, ownerUid),
+	}
+}
+
+// crop returns the encoded image of the region of the selection.
+func (s *selectionCrops) crop(selection models.Selection) ([]byte, error) {
+	if selection.DocumentUUID == nil || selection.PageKey == nil || selection.Coordinates == nil {
+		return nil, errSelectionNotOnPage
+	}
+
+	// The page image shows the displayed page, which relative coordinates describe whatever
+	// the resolution of the image is.
+	region, err := s.geometries.displayed(selection, models.CoordinateSystem{Space: models.CoordinateSpaceRelative})
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := s.page(*selection.DocumentUUID, *selection.PageKey)
+	if err != nil {
+		return nil, err
+	}
+
+	cropped, err := imaging.Crop(page, *region)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.options.scale != 1 {
+		bounds := cropped.Bounds()
+		width := max(1, int(math.Round(float64(bounds.Dx())*s.options.scale)))
+		height := max(1, int(math.Round(float64(bounds.Dy())*s.options.scale)))
+		cropped, err = imaging.Resize(cropped, width, height, imaging.FitFill)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return imaging.Encode(cropped, s.options.mimeType)
+}
+
+func (s *selectionCrops) page(documentUid uuid.UUID, pageKey string) (image.Image, error) {
+	if s.pageImage != nil && s.pageUid == documentUid && s.pageKey == pageKey {
+		return s.pageImage, nil
+	}
+
+	if s.metaRepository == nil {
+		return nil, models.ErrNoPageGeometry
+	}
+
+	page, err := s.metaRepository.GetPageByKey(documentUid, s.ownerUid, pageKey)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("page %q not found: %w", pageKey, err)
+		}
+		return nil, err
+	}
+
+	if page.Image == nil || *page.Image == "" {
+		return nil, fmt.Errorf("%w: page %q", errNoPageImage, pageKey)
+	}
+
+	decoded, _, err := imaging.DecodeImage(*page.Image)
+	if err != nil {
+		return nil, fmt.Errorf("page image could not be decoded: %w", err)
+	}
+
+	s.pageUid, s.pageKey, s.pageImage = documentUid, pageKey, decoded
+	return decoded, nil
+}
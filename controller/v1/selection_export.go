@@ -0,0 +1,149 @@
+package v1
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"pdf_service_api/models"
+	"pdf_service_api/service/export"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ExportSelections handles the HTTP GET request to export the selections of a document as a file.
+// It expects the query parameters "documentUUID" and "ownerUUID", see requireOwnerUUID, and
+// optionally the filters of GetSelection.
+//
+// The format is given by the query parameter "format" or, without it, negotiated with the Accept
+// header: XFDF annotations to import into pdf viewers, CSV rows for spreadsheets, or JSON with
+// the selections grouped by page as GeoJSON feature collections. CSV and JSON coordinates are in
+// the space given by "coordinateSpace", see coordinateSystem, XFDF is always in pdf user space.
+//
+// @Summary Export the selections of a document
+// @Description Exports the selections of a document as XFDF annotations, CSV rows or JSON grouped by page.
+// @Tags selections
+// @Produce json
+// @Produce application/vnd.adobe.xfdf
+// @Produce text/csv
+// @Param   documentUUID query string true "The UUID of the document"
+// @Param   ownerUUID query string true "The UUID of the caller, who has to own the document or have it shared"
+// @Param   format query string false "The format of the export, taken from the Accept header by default" Enums(xfdf,csv,json)
+// @Param   type query []string false "Only export selections of these types" collectionFormat(multi) Enums(highlight,note,redaction,field)
+// @Param   pageKey query string false "Only export selections of this page"
+// @Param   intersects query string false "Only export selections overlapping the rectangle x1,y1,x2,y2"
+// @Param   within query string false "Only export selections inside the rectangle x1,y1,x2,y2"
+// @Param   coordinateSpace query string false "The space of CSV and JSON coordinates, pdf by default" Enums(pdf,px,relative)
+// @Param   dpi query number false "The resolution of pixel coordinates"
+// @Success 200 {object} export.JSONDocument "The exported selections"
+// @Failure 400 {object} object{error=string} "Bad request, typically due to missing/invalid parameters"
+// @Failure 404 {object} object{error=string} "Document not found"
+// @Failure 406 {object} object{error=string} "None of the accepted media types can be exported"
+// @Failure 422 {object} object{error=string} "The page geometry needed to convert the coordinates is unknown"
+// @Failure 500 {object} object{error=string} "Internal server error, typically due to database issues"
+// @Router /selections/export [get]
+func (t SelectionController) ExportSelections(c *gin.Context) {
+	documentUid, err := uuid.Parse(c.Query("documentUUID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Required param documentUUID missing or invalid: " + err.Error()})
+		return
+	}
+
+	ownerUid, isValid := requireOwnerUUID(c)
+	if !isValid {
+		return
+	}
+
+	format, status, err := exportFormat(c)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	system, err := coordinateSystem(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filter, err := selectionFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	geometries := t.pageGeometries(c, ownerUid)
+	filter, err = geometries.storedFilter(documentUid, filter, system)
+	if err != nil {
+		c.JSON(coordinateErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	selections, err := scoped(c, t.SelectionRepository).GetSelectionListByDocumentUUID(documentUid, ownerUid, filter)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if format == export.FormatXFDF {
+		system = models.CoordinateSystem{Space: models.CoordinateSpacePdf}
+	}
+
+	for i := range selections {
+		selections[i].Coordinates, err = geometries.displayed(selections[i], system)
+		if err != nil {
+			c.JSON(coordinateErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	document := export.Document{
+		DocumentUUID: documentUid,
+		Selections:   selections,
+		Space:        system.Space,
+		PageNumber: func(pageKey string) (uint32, bool) {
+			geometry, err := geometries.page(&documentUid, &pageKey)
+			if err != nil {
+				return 0, false
+			}
+
+			return geometry.PageNumber, true
+		},
+	}
+
+	buffer := &bytes.Buffer{}
+	if err := export.Write(buffer, format, document); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-selections.%s"`, documentUid, format))
+	c.Data(http.StatusOK, format.ContentType(), buffer.Bytes())
+}
+
+// exportFormat reads the "format" query parameter, or negotiates the format with the Accept
+// header when it is missing. The status tells if the request was invalid or not acceptable.
+func exportFormat(c *gin.Context) (export.Format, int, error) {
+	if value, isPresent := c.GetQuery("format"); isPresent {
+		format := export.Format(value)
+		if !format.IsValid() {
+			return format, http.StatusBadRequest, fmt.Errorf("unknown format %q, expected xfdf, csv or json", value)
+		}
+
+		return format, http.StatusOK, nil
+	}
+
+	format, isKnown := export.FormatOfMediaType(c.NegotiateFormat(export.MediaTypes...))
+	if !isKnown {
+		return format, http.StatusNotAcceptable, errors.New("the export can be returned as XFDF, CSV or JSON only")
+	}
+
+	return format, http.StatusOK, nil
+}
@@ -0,0 +1,197 @@
+package v1
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"pdf_service_api/models"
+	"pdf_service_api/service/annotations"
+	"pdf_service_api/service/pdf"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const maxXFDFSize = 10 << 20
+
+// ImportSelections handles the HTTP POST request to create selections from existing annotations.
+// It expects the query parameters "documentUUID" and "ownerUUID", see requireOwnerUUID.
+//
+// With "source=xfdf", the default, the request body is an XFDF file as exported by pdf viewers.
+// With "source=pdf" the annotations stored in the pages of the document itself are read.
+// Highlight, underline, strikeout and squiggly annotations become highlights, text annotations
+// notes, redact annotations redactions and squares selections without a type. The subject is
+// used as label, the contents as note. Coordinates are always read in pdf user space.
+//
+// Annotations of other types, or without a valid page and rectangle, are skipped and returned
+// with the reason. All other annotations are stored in one transaction with new UUIDs.
+//
+// @Summary Import selections from annotations
+// @Description Converts the annotations of an XFDF file or of the stored pdf into selections, reporting skipped annotations.
+// @Tags selections
+// @Accept  application/vnd.adobe.xfdf
+// @Accept  xml
+// @Produce  json
+// @Param   documentUUID query string true "The UUID of the document"
+// @Param   ownerUUID query string true "The UUID of the caller, who has to own the document or have it shared"
+// @Param   source query string false "Where to read the annotations, xfdf (default) or pdf" Enums(xfdf,pdf)
+// @Param   request body string false "The XFDF file when the source is xfdf"
+// @Param Idempotency-Key header string false "A key that makes the request safe to retry, a retry with it is answered with the first response"
+// @Success 201 {object} v1.ImportSelectionsResponse "The created selections and the skipped annotations"
+// @Failure 400 {object} object{error=string} "Bad request, typically due to missing/invalid parameters or a malformed XFDF file"
+// @Failure 404 {object} object{error=string} "Document not found"
+// @Failure 409 "A request with the same Idempotency-Key is still being processed"
+// @Failure 412 {object} object{error=string} "The request carried an If-Match header, which it does not support"
+// @Failure 413 {object} object{error=string} "The XFDF file is too large"
+// @Failure 422 {object} object{error=string} "The stored document could not be read"
+// @Failure 422 "The Idempotency-Key was already used for a different request"
+// @Failure 500 {object} object{error=string} "Internal server error, typically due to database issues"
+// @Failure 503 {object} object{error=string} "Reading stored documents is not available"
+// @Router /selections/import [post]
+func (t SelectionController) ImportSelections(c *gin.Context) {
+	documentUid, err := uuid.Parse(c.Query("documentUUID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Required param documentUUID missing or invalid: " + err.Error()})
+		return
+	}
+
+	ownerUid, isValid := requireOwnerUUID(c)
+	if !isValid {
+		return
+	}
+
+	var result annotations.Result
+	switch source := c.DefaultQuery("source", "xfdf"); source {
+	case "xfdf":
+		result, err = annotations.FromXFDF(http.MaxBytesReader(c.Writer, c.Request.Body, maxXFDFSize))
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("XFDF file must not be larger than %d bytes", maxXFDFSize)})
+				return
+			}
+
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	case "pdf":
+		var status int
+		result, status, err = t.storedAnnotations(c, documentUid, ownerUid)
+		if err != nil {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown source %q, expected xfdf or pdf", source)})
+		return
+	}
+
+	now := time.Now().UTC()
+	geometries := t.pageGeometries(c, ownerUid)
+	system := models.CoordinateSystem{Space: models.CoordinateSpacePdf}
+	skipped := result.Skipped
+	selections := make([]models.Selection, 0, len(result.Imported))
+	for _, imported := range result.Imported {
+		selection := imported.Selection
+		selection.Uuid = uuid.New()
+		selection.DocumentUUID = &documentUid
+		if selection.CreatedAt == nil {
+			selection.CreatedAt = &now
+		}
+		if selection.UpdatedAt == nil {
+			selection.UpdatedAt = selection.CreatedAt
+		}
+
+		if err := validateSelectionAttributes(selection.Type, selection.Label, selection.Note, selection.Color, selection.AuthorUUID); err != nil {
+			skipped = append(skipped, imported.Skip(err.Error()))
+			continue
+		}
+
+		pageKey, err := geometries.pageKey(documentUid, imported.PageNumber)
+		if err == nil {
+			selection.PageKey = &pageKey
+			selection.Coordinates, err = geometries.stored(&documentUid, &pageKey, selection.Coordinates, system)
+		}
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+				return
+			}
+
+			if coordinateErrorStatus(err) == http.StatusInternalServerError {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			skipped = append(skipped, imported.Skip(err.Error()))
+			continue
+		}
+
+		selections = append(selections, selection)
+	}
+
+	// Without anything to store the access to the document is still checked, as storing would.
+	if len(selections) == 0 {
+		_, err = scoped(c, t.SelectionRepository).GetSelectionListByDocumentUUID(documentUid, ownerUid, models.SelectionFilter{})
+	} else {
+		_, err = scoped(c, t.SelectionRepository).AddSelections(selections, ownerUid, models.BulkModeAtomic)
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(selections) > 0 {
+		t.publishSelectionsChanged(&documentUid, nil)
+	}
+	recordAudit(c, t.AuditRepository, &ownerUid, nil, createdSelections(selections)...)
+
+	if skipped == nil {
+		skipped = make([]annotations.Skipped, 0)
+	}
+
+	c.JSON(http.StatusCreated, ImportSelectionsResponse{Selections: selections, Skipped: skipped})
+}
+
+// storedAnnotations reads the annotations of the stored document. The status tells why the
+// document could not be read.
+func (t SelectionController) storedAnnotations(c *gin.Context, documentUid, ownerUid uuid.UUID) (annotations.Result, int, error) {
+	if t.DocumentRepository == nil {
+		return annotations.Result{}, http.StatusServiceUnavailable, errors.New("reading stored documents is not configured on this server")
+	}
+
+	exclude := make(models.Exclude)
+	exclude.TimeCreated(true).OwnerUUID(true).OwnerType(true).DocumentTitle(true).MetaStatus(true)
+	document, err := scoped(c, t.DocumentRepository).GetDocumentByDocumentUUID(documentUid, ownerUid, exclude)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return annotations.Result{}, http.StatusNotFound, errors.New("document not found")
+		}
+
+		return annotations.Result{}, http.StatusInternalServerError, err
+	}
+
+	if document.PdfBase64 == nil {
+		return annotations.Result{}, http.StatusNotFound, errors.New("document not found")
+	}
+
+	parsed, err := pdf.OpenBase64(strings.NewReader(*document.PdfBase64))
+	if err != nil {
+		return annotations.Result{}, http.StatusUnprocessableEntity, err
+	}
+
+	result, err := annotations.FromPDF(parsed)
+	if err != nil {
+		return annotations.Result{}, http.StatusUnprocessableEntity, err
+	}
+
+	return result, http.StatusOK, nil
+}
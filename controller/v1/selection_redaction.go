@@ -0,0 +1,168 @@
+package v1
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"pdf_service_api/models"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RedactDocument handles the HTTP POST request to produce a redacted copy of a document from its
+// redaction selections. It expects the query parameters "documentUUID" and "ownerUUID", the
+// owner of the document.
+//
+// The content inside every selection of type redaction is removed and covered by the data
+// service. The copy is stored as a new document of the same owner, whose derivedFromUUID links
+// it to the original. The original document and its selections are left unchanged. Every
+// redaction selection needs a page and coordinates, otherwise nothing is redacted.
+//
+// @Summary Produce a redacted copy of a document
+// @Description Removes the content inside the redaction selections of a document and stores the result as a new document derived from it.
+// @Tags selections
+// @Produce  json
+// @Param   documentUUID query string true "The UUID of the document to redact"
+// @Param   ownerUUID query string true "The UUID of the owner of the document"
+// @Param Idempotency-Key header string false "A key that makes the request safe to retry, a retry with it is answered with the first response"
+// @Success 201 {object} object{documentUUID=string,derivedFromUUID=string,redactions=int} "The redacted document"
+// @Failure 400 {object} object{error=string} "Bad request, typically due to missing/invalid parameters"
+// @Failure 404 {object} object{error=string} "Document not found"
+// @Failure 409 "A request with the same Idempotency-Key is still being processed"
+// @Failure 412 {object} object{error=string} "The request carried an If-Match header, which it does not support"
+// @Failure 413 "The body of a request with an Idempotency-Key is too large"
+// @Failure 422 {object} object{error=string} "The document has no redactions, a redaction has no page or coordinates, or the document could not be read"
+// @Failure 422 "The Idempotency-Key was already used for a different request"
+// @Failure 500 {object} object{error=string} "Internal server error, typically due to database issues"
+// @Failure 502 {object} object{error=string} "The data service failed to redact the document"
+// @Failure 503 {object} object{error=string} "Redaction is not available"
+// @Router /selections/redact [post]
+func (t SelectionController) RedactDocument(c *gin.Context) {
+	if t.Redactor == nil || t.DocumentRepository == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Redaction is not configured on this server"})
+		return
+	}
+
+	documentUid, err := uuid.Parse(c.Query("documentUUID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Required param documentUUID missing or invalid: " + err.Error()})
+		return
+	}
+
+	ownerUid, isValid := requireOwnerUUID(c)
+	if !isValid {
+		return
+	}
+
+	exclude := make(models.Exclude)
+	exclude.TimeCreated(true).MetaStatus(true).DerivedFromUUID(true)
+	document, err := scoped(c, t.DocumentRepository).GetDocumentByDocumentUUID(documentUid, ownerUid, exclude)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if document.PdfBase64 == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+		return
+	}
+
+	filter := models.SelectionFilter{Types: []models.SelectionType{models.SelectionTypeRedaction}}
+	selections, err := scoped(c, t.SelectionRepository).GetSelectionListByDocumentUUID(documentUid, ownerUid, filter)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(selections) == 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "document has no redaction selections"})
+		return
+	}
+
+	geometries := t.pageGeometries(c, ownerUid)
+	regions := make([]models.RedactionRegion, 0, len(selections))
+	for _, selection := range selections {
+		if selection.Coordinates == nil || selection.PageKey == nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": fmt.Sprintf("redaction %s has no page or coordinates", selection.Uuid)})
+			return
+		}
+
+		pageNumber, err := geometries.pageNumber(documentUid, *selection.PageKey)
+		if err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": fmt.Sprintf("redaction %s: %s", selection.Uuid, err.Error())})
+			return
+		}
+
+		regions = append(regions, models.RedactionRegion{PageNumber: pageNumber, Region: *selection.Coordinates})
+	}
+
+	redacted, err := t.Redactor.Redact(c.Request.Context(), strings.NewReader(*document.PdfBase64), regions)
+	if err != nil {
+		c.JSON(documentProcessingErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	var title *string
+	if document.DocumentTitle != nil {
+		redactedTitle := *document.DocumentTitle + " (redacted)"
+		title = &redactedTitle
+	}
+
+	derived := models.Document{
+		Uuid:            uuid.New(),
+		DocumentTitle:   title,
+		PdfBase64:       &redacted,
+		OwnerUUID:       &ownerUid,
+		OwnerType:       document.OwnerType,
+		DerivedFromUUID: &documentUid,
+	}
+
+	if err := scoped(c, t.DocumentRepository).UploadDocument(derived); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	recordAudit(c, t.AuditRepository, &ownerUid, &ownerUid, auditChange{
+		action:       models.AuditActionCreate,
+		resourceType: models.AuditResourceDocument,
+		resourceUid:  derived.Uuid,
+		documentUid:  &derived.Uuid,
+		after:        auditedDocument(derived),
+	})
+
+	c.JSON(http.StatusCreated, gin.H{"documentUUID": derived.Uuid, "derivedFromUUID": documentUid, "redactions": len(regions)})
+}
+
+// pageNumber returns the number of the page with the given key. Without stored page geometry
+// the key has to be the page number itself.
+func (g *pageGeometries) pageNumber(documentUid uuid.UUID, pageKey string) (uint32, error) {
+	geometry, err := g.page(&documentUid, &pageKey)
+	if err == nil {
+		return geometry.PageNumber, nil
+	}
+
+	if !errors.Is(err, models.ErrNoPageGeometry) {
+		return 0, err
+	}
+
+	pageNumber, parseErr := strconv.ParseUint(pageKey, 10, 32)
+	if parseErr != nil {
+		return 0, fmt.Errorf("page key %q is not a page number", pageKey)
+	}
+
+	return uint32(pageNumber), nil
+}
@@ -0,0 +1,424 @@
+package v1
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"pdf_service_api/models"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const maxTemplateNameLength = 256
+
+// AddSelectionTemplate handles the HTTP POST request to save the selections of a document as a
+// template. It expects the query parameter "ownerUUID", see requireOwnerUUID, and a JSON body
+// conforming to the AddSelectionTemplateRequest struct.
+//
+// Saving a template under a name the owner already used adds a new version of it. The template
+// keeps the geometry of the source pages, so that it can be scaled onto pages of another size.
+//
+// @Summary Save the selections of a document as a template
+// @Description Saves the selections of a document, optionally of some pages or types only, as the next version of a named template.
+// @Tags selections
+// @Accept  json
+// @Produce  json
+// @Param   ownerUUID query string true "The UUID of the owner of the template, who has to own the document or have it shared"
+// @Param   request body AddSelectionTemplateRequest true "The name of the template and the document to take the selections from"
+// @Param Idempotency-Key header string false "A key that makes the request safe to retry, a retry with it is answered with the first response"
+// @Success 201 {object} models.SelectionTemplate "The saved template"
+// @Failure 400 {object} object{error=string} "Bad request, typically due to invalid input or a document without selections"
+// @Failure 404 {object} object{error=string} "Document not found"
+// @Failure 409 "A request with the same Idempotency-Key is still being processed"
+// @Failure 412 {object} object{error=string} "The request carried an If-Match header, which it does not support"
+// @Failure 413 "The body of a request with an Idempotency-Key is too large"
+// @Failure 422 "The Idempotency-Key was already used for a different request"
+// @Failure 500 {object} object{error=string} "Internal server error, typically due to database issues"
+// @Failure 503 {object} object{error=string} "Selection templates are not available"
+// @Router /selections/templates [post]
+func (t SelectionController) AddSelectionTemplate(c *gin.Context) {
+	if !t.requireTemplates(c) {
+		return
+	}
+
+	ownerUid, isValid := requireOwnerUUID(c)
+	if !isValid {
+		return
+	}
+
+	reqBody := &AddSelectionTemplateRequest{}
+	if err := c.ShouldBindJSON(reqBody); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := strings.TrimSpace(reqBody.Name)
+	if name == "" || utf8.RuneCountInString(name) > maxTemplateNameLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("name is required and must not be longer than %d characters", maxTemplateNameLength)})
+		return
+	}
+
+	if reqBody.DocumentUUID == nil || *reqBody.DocumentUUID == uuid.Nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "documentUUID is required"})
+		return
+	}
+
+	for _, selectionType := range reqBody.Types {
+		if !selectionType.IsValid() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown selection type %q", selectionType)})
+			return
+		}
+	}
+
+	selections, err := scoped(c, t.SelectionRepository).GetSelectionListByDocumentUUID(*reqBody.DocumentUUID, ownerUid, models.SelectionFilter{Types: reqBody.Types})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	geometries := t.pageGeometries(c, ownerUid)
+	templateSelections := make([]models.TemplateSelection, 0, len(selections))
+	for _, selection := range selections {
+		if selection.PageKey == nil || *selection.PageKey == "" {
+			continue
+		}
+
+		if len(reqBody.PageKeys) > 0 && !slices.Contains(reqBody.PageKeys, *selection.PageKey) {
+			continue
+		}
+
+		templateSelection := models.TemplateSelection{
+			PageKey:     *selection.PageKey,
+			Coordinates: selection.Coordinates,
+			Type:        selection.Type,
+			Label:       selection.Label,
+			Note:        selection.Note,
+			Color:       selection.Color,
+		}
+
+		geometry, err := geometries.page(selection.DocumentUUID, selection.PageKey)
+		switch {
+		case err == nil:
+			templateSelection.PageGeometry = &geometry
+		case !errors.Is(err, models.ErrNoPageGeometry) && !errors.Is(err, models.ErrPageOutOfRange):
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		templateSelections = append(templateSelections, templateSelection)
+	}
+
+	if len(templateSelections) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "document has no selections on a page to save as template"})
+		return
+	}
+
+	template := models.SelectionTemplate{
+		Uuid:               uuid.New(),
+		OwnerUUID:          ownerUid,
+		Name:               name,
+		SourceDocumentUUID: reqBody.DocumentUUID,
+		CreatedAt:          time.Now().UTC().Truncate(time.Microsecond),
+		Selections:         templateSelections,
+	}
+
+	template.Version, err = scoped(c, t.TemplateRepository).AddTemplate(template)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	recordAudit(c, t.AuditRepository, &ownerUid, &ownerUid, templateChange(models.AuditActionCreate, nil, &template))
+	c.JSON(http.StatusCreated, template)
+}
+
+// GetSelectionTemplates handles the HTTP GET request to list the templates of an owner, without
+// their selections. With the query parameter "name" every version of that template is listed.
+//
+// @Summary List selection templates
+// @Description Lists the selection templates of an owner, newest version first.
+// @Tags selections
+// @Produce  json
+// @Param   ownerUUID query string true "The UUID of the owner of the templates"
+// @Param   name query string false "Only list the versions of the template with this name"
+// @Success 200 {object} object{templates=[]models.SelectionTemplate} "The templates"
+// @Failure 400 {object} object{error=string} "Bad request, typically due to a missing/invalid ownerUUID"
+// @Failure 503 {object} object{error=string} "Selection templates are not available"
+// @Failure 500 {object} object{error=string} "Internal server error, typically due to database issues"
+// @Router /selections/templates [get]
+func (t SelectionController) GetSelectionTemplates(c *gin.Context) {
+	if !t.requireTemplates(c) {
+		return
+	}
+
+	ownerUid, isValid := requireOwnerUUID(c)
+	if !isValid {
+		return
+	}
+
+	var name *string
+	if value, isPresent := c.GetQuery("name"); isPresent {
+		value = strings.TrimSpace(value)
+		name = &value
+	}
+
+	templates, err := scoped(c, t.TemplateRepository).GetTemplates(ownerUid, name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"templates": templates})
+}
+
+// GetSelectionTemplate handles the HTTP GET request to retrieve a template with its selections.
+//
+// @Summary Get a selection template
+// @Description Retrieves a version of a selection template with its selections.
+// @Tags selections
+// @Produce  json
+// @Param   templateUUID path string true "The UUID of the template version"
+// @Param   ownerUUID query string true "The UUID of the owner of the template"
+// @Success 200 {object} models.SelectionTemplate "The template"
+// @Failure 400 {object} object{error=string} "Bad request, typically due to an invalid UUID"
+// @Failure 404 {object} object{error=string} "Template not found"
+// @Failure 503 {object} object{error=string} "Selection templates are not available"
+// @Failure 500 {object} object{error=string} "Internal server error, typically due to database issues"
+// @Router /selections/templates/{templateUUID} [get]
+func (t SelectionController) GetSelectionTemplate(c *gin.Context) {
+	template, isFound := t.template(c)
+	if !isFound {
+		return
+	}
+
+	c.JSON(http.StatusOK, template)
+}
+
+// DeleteSelectionTemplate handles the HTTP DELETE request to remove a version of a template.
+// Selections created from it are kept.
+//
+// @Summary Delete a selection template
+// @Description Deletes a version of a selection template, selections created from it are kept.
+// @Tags selections
+// @Produce  json
+// @Param   templateUUID path string true "The UUID of the template version"
+// @Param   ownerUUID query string true "The UUID of the owner of the template"
+// @Success 200 "Template deleted"
+// @Failure 400 {object} object{error=string} "Bad request, typically due to an invalid UUID"
+// @Failure 404 {object} object{error=string} "Template not found"
+// @Failure 412 {object} object{error=string} "The request carried an If-Match header, which it does not support"
+// @Failure 503 {object} object{error=string} "Selection templates are not available"
+// @Failure 500 {object} object{error=string} "Internal server error, typically due to database issues"
+// @Router /selections/templates/{templateUUID} [delete]
+func (t SelectionController) DeleteSelectionTemplate(c *gin.Context) {
+	if !t.requireTemplates(c) {
+		return
+	}
+
+	templateUid, err := uuid.Parse(c.Param("templateUUID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ownerUid, isValid := requireOwnerUUID(c)
+	if !isValid {
+		return
+	}
+
+	var before *models.SelectionTemplate
+	if t.AuditRepository != nil {
+		template, err := scoped(c, t.TemplateRepository).GetTemplate(templateUid, ownerUid)
+		if err == nil {
+			before = &template
+		}
+	}
+
+	if err := scoped(c, t.TemplateRepository).DeleteTemplate(templateUid, ownerUid); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "template not found"})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	change := templateChange(models.AuditActionDelete, before, nil)
+	change.resourceUid = templateUid
+	recordAudit(c, t.AuditRepository, &ownerUid, &ownerUid, change)
+	c.Status(http.StatusOK)
+}
+
+// ApplySelectionTemplate handles the HTTP POST request to create the selections of a template
+// on a document. It expects the query parameter "ownerUUID", see requireOwnerUUID, and a JSON
+// body conforming to the ApplySelectionTemplateRequest struct.
+//
+// Selections keep their page key unless "pageMapping" maps it to another page, or to null to
+// leave the page out. With "scaleToPageSize" the selections keep their position relative to
+// the displayed page, otherwise their pdf coordinates are copied. All selections are created in
+// one transaction with new UUIDs, nothing is created if any of them does not fit the document.
+//
+// @Summary Apply a selection template to a document
+// @Description Creates the selections of a template on a document, with optional page mapping and scaling by page size.
+// @Tags selections
+// @Accept  json
+// @Produce  json
+// @Param   templateUUID path string true "The UUID of the template version"
+// @Param   ownerUUID query string true "The UUID of the owner of the template, who has to own the document or have it shared for writing"
+// @Param   request body ApplySelectionTemplateRequest true "The document to create the selections on"
+// @Param Idempotency-Key header string false "A key that makes the request safe to retry, a retry with it is answered with the first response"
+// @Success 201 {object} object{selections=[]models.Selection} "The created selections"
+// @Failure 400 {object} object{error=string} "Bad request, typically due to invalid input or pages the document does not have"
+// @Failure 404 {object} object{error=string} "Template or document not found"
+// @Failure 409 "A request with the same Idempotency-Key is still being processed"
+// @Failure 412 {object} object{error=string} "The request carried an If-Match header, which it does not support"
+// @Failure 413 "The body of a request with an Idempotency-Key is too large"
+// @Failure 422 {object} object{error=string} "The page geometry needed to scale the selections is unknown"
+// @Failure 422 "The Idempotency-Key was already used for a different request"
+// @Failure 500 {object} object{error=string} "Internal server error, typically due to database issues"
+// @Failure 503 {object} object{error=string} "Selection templates are not available"
+// @Router /selections/templates/{templateUUID}/apply [post]
+func (t SelectionController) ApplySelectionTemplate(c *gin.Context) {
+	template, isFound := t.template(c)
+	if !isFound {
+		return
+	}
+
+	reqBody := &ApplySelectionTemplateRequest{}
+	if err := c.ShouldBindJSON(reqBody); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if reqBody.DocumentUUID == nil || *reqBody.DocumentUUID == uuid.Nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "documentUUID is required"})
+		return
+	}
+
+	// Checked up front, the page mapping may leave nothing to store that would check it.
+	if err := scoped(c, t.SelectionRepository).CheckDocumentAccess(*reqBody.DocumentUUID, template.OwnerUUID, true); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now().UTC()
+	geometries := t.pageGeometries(c, template.OwnerUUID)
+	system := models.CoordinateSystem{Space: models.CoordinateSpacePdf}
+	selections := make([]models.Selection, 0, len(template.Selections))
+	for i, templateSelection := range template.Selections {
+		pageKey := templateSelection.PageKey
+		if target, isMapped := reqBody.PageMapping[pageKey]; isMapped {
+			if target == nil {
+				continue
+			}
+			pageKey = *target
+		}
+
+		coordinates := templateSelection.Coordinates
+		var err error
+		if reqBody.ScaleToPageSize {
+			var geometry models.PageGeometry
+			geometry, err = geometries.page(reqBody.DocumentUUID, &pageKey)
+			if err == nil {
+				coordinates, err = templateSelection.ScaledTo(geometry)
+			}
+		}
+		if err == nil {
+			coordinates, err = geometries.stored(reqBody.DocumentUUID, &pageKey, coordinates, system)
+		}
+		if err != nil {
+			c.JSON(coordinateErrorStatus(err), gin.H{"error": fmt.Sprintf("selection %d: %s", i, err.Error())})
+			return
+		}
+
+		selections = append(selections, models.Selection{
+			Uuid:         uuid.New(),
+			DocumentUUID: reqBody.DocumentUUID,
+			PageKey:      &pageKey,
+			Coordinates:  coordinates,
+			Type:         templateSelection.Type,
+			Label:        templateSelection.Label,
+			Note:         templateSelection.Note,
+			Color:        templateSelection.Color,
+			CreatedAt:    &now,
+			UpdatedAt:    &now,
+		})
+	}
+
+	if _, err := scoped(c, t.SelectionRepository).AddSelections(selections, template.OwnerUUID, models.BulkModeAtomic); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(selections) > 0 {
+		t.publishSelectionsChanged(reqBody.DocumentUUID, nil)
+	}
+
+	recordAudit(c, t.AuditRepository, &template.OwnerUUID, nil, createdSelections(selections)...)
+	c.JSON(http.StatusCreated, gin.H{"selections": selections})
+}
+
+// template loads the template of the "templateUUID" path parameter for the caller given by
+// "ownerUUID". It responds with an error and returns false when the template is not found.
+func (t SelectionController) template(c *gin.Context) (models.SelectionTemplate, bool) {
+	if !t.requireTemplates(c) {
+		return models.SelectionTemplate{}, false
+	}
+
+	templateUid, err := uuid.Parse(c.Param("templateUUID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return models.SelectionTemplate{}, false
+	}
+
+	ownerUid, isValid := requireOwnerUUID(c)
+	if !isValid {
+		return models.SelectionTemplate{}, false
+	}
+
+	template, err := scoped(c, t.TemplateRepository).GetTemplate(templateUid, ownerUid)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "template not found"})
+			return models.SelectionTemplate{}, false
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return models.SelectionTemplate{}, false
+	}
+
+	return template, true
+}
+
+// requireTemplates responds with a 503 Service Unavailable and returns false when no template
+// repository is configured.
+func (t SelectionController) requireTemplates(c *gin.Context) bool {
+	if t.TemplateRepository == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Selection templates are not configured on this server"})
+		return false
+	}
+
+	return true
+}
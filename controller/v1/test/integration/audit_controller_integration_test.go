@@ -0,0 +1,236 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	v1 "pdf_service_api/controller/v1"
+	"pdf_service_api/models"
+	postgres2 "pdf_service_api/service/postgres"
+	"pdf_service_api/testutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+func TestAuditIntegration(t *testing.T) {
+	t.Parallel()
+	t.Run("Audit changes to documents and shared selections", auditChangesAcrossOwners)
+	t.Run("Audit changes to meta data on behalf of the document owner", auditMetaChanges)
+	t.Run("Audit sharing and unsharing documents", auditShareChanges)
+}
+
+func auditChangesAcrossOwners(t *testing.T) {
+	t.Parallel()
+	actorUUID, foreignOwnerUUID := selectionOwnerUUID, "0c6f1a8e-5b0b-4a57-9d7e-3b1f0e2f6a11"
+	documentUUID, writableSelectionUUID := "b66fd223-515f-4503-80cc-2bdaa50ef474", "e6f0b3c8-4a9d-4217-bd5e-1c3a8f7e0b56"
+
+	ctx := context.Background()
+	ctr, err := testutil.CreateTestContainerPostgresWithInitFileName(ctx, dbUser, dbPassword, "TwoOwnersWithSharedSelections")
+	require.NoError(t, err)
+	defer testcontainers.TerminateContainer(ctr)
+
+	connectionString, err := ctr.ConnectionString(ctx, "sslmode=disable")
+	require.NoError(t, err)
+
+	dbHandle := postgres2.DatabaseHandler{DbConfig: postgres2.ConfigForDatabase{ConUrl: connectionString}}
+	auditRepository := postgres2.NewAuditRepository(dbHandle)
+	router := v1.SetupRouter(
+		&v1.DocumentController{DocumentRepository: postgres2.NewDocumentRepository(dbHandle), AuditRepository: auditRepository},
+		&v1.SelectionController{SelectionRepository: postgres2.NewSelectionRepository(dbHandle), AuditRepository: auditRepository},
+		nil,
+		v1.WithAuditController(&v1.AuditController{AuditRepository: auditRepository}),
+	)
+
+	request := func(method, target, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		r.Header.Set("X-Request-ID", "audit-test")
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	entries := func(ownerUUID, parameters string) []models.AuditEntry {
+		w := request("GET", "/api/v1/audit/?ownerUUID="+ownerUUID+parameters, "")
+		require.Equal(t, http.StatusOK, w.Result().StatusCode, w.Body.String())
+		response := struct {
+			Entries []models.AuditEntry `json:"entries"`
+		}{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response.Entries
+	}
+
+	started := time.Now().UTC().Add(-time.Second).Format(time.RFC3339)
+
+	w := request("PATCH", "/api/v1/selections/"+writableSelectionUUID+"?ownerUUID="+actorUUID, `{"label": "Reviewed"}`)
+	require.Equal(t, http.StatusOK, w.Result().StatusCode, w.Body.String())
+
+	w = request("DELETE", "/api/v1/documents/?documentUUID="+documentUUID+"&ownerUUID="+actorUUID, "")
+	require.Equal(t, http.StatusOK, w.Result().StatusCode, w.Body.String())
+
+	own := entries(actorUUID, "")
+	require.Len(t, own, 2, "the caller sees the changes they made")
+
+	deletions := entries(actorUUID, "&resourceType=document")
+	require.Len(t, deletions, 1)
+	deletion := deletions[0]
+	assert.Equal(t, models.AuditActionDelete, deletion.Action)
+	assert.Equal(t, documentUUID, deletion.ResourceUUID.String())
+	assert.Equal(t, actorUUID, deletion.ActorUUID.String())
+	assert.Equal(t, "audit-test", *deletion.RequestID)
+	assert.NotNil(t, deletion.IP)
+	assert.Equal(t, models.AuditChange{Before: actorUUID}, deletion.Changes["ownerUUID"])
+	assert.NotContains(t, deletion.Changes, "pdfBase64", "the content of documents is not audited")
+
+	foreign := entries(foreignOwnerUUID, "")
+	require.Len(t, foreign, 1, "the owner sees changes to their shared document, not the caller's own")
+	update := foreign[0]
+	assert.Equal(t, models.AuditActionUpdate, update.Action)
+	assert.Equal(t, models.AuditResourceSelection, update.ResourceType)
+	assert.Equal(t, actorUUID, update.ActorUUID.String())
+	assert.Equal(t, foreignOwnerUUID, update.OwnerUUID.String())
+	assert.Equal(t, models.AuditChange{After: "Reviewed"}, update.Changes["label"])
+	assert.NotContains(t, update.Changes, "pageKey", "unchanged fields are left out")
+
+	assert.Len(t, entries(actorUUID, "&from="+started), 2)
+	assert.Empty(t, entries(actorUUID, "&to="+started))
+	assert.Len(t, entries(actorUUID, "&action=update&limit=1"), 1)
+
+	assert.Empty(t, entries("34906041-2d68-45a2-9671-9f0ba89f31a9", ""), "other owners see nothing")
+	assert.Equal(t, http.StatusBadRequest, request("GET", "/api/v1/audit/?ownerUUID="+actorUUID+"&from=yesterday", "").Result().StatusCode)
+	assert.Equal(t, http.StatusBadRequest, request("GET", "/api/v1/audit/?ownerUUID="+actorUUID+"&action=read", "").Result().StatusCode)
+}
+
+func auditMetaChanges(t *testing.T) {
+	t.Parallel()
+	ownerUUID, documentUUID := "0c6f1a8e-5b0b-4a57-9d7e-3b1f0e2f6a11", "7e9a4c52-1f3d-4b8e-a6c2-9d5f0b3e1a27"
+
+	ctx := context.Background()
+	ctr, err := testutil.CreateTestContainerPostgresWithInitFileName(ctx, dbUser, dbPassword, "TwoOwnersWithSharedSelections")
+	require.NoError(t, err)
+	defer testcontainers.TerminateContainer(ctr)
+
+	connectionString, err := ctr.ConnectionString(ctx, "sslmode=disable")
+	require.NoError(t, err)
+
+	dbHandle := postgres2.DatabaseHandler{DbConfig: postgres2.ConfigForDatabase{ConUrl: connectionString}}
+	auditRepository := postgres2.NewAuditRepository(dbHandle)
+	metaRepository := postgres2.NewMetaRepository(dbHandle)
+	router := v1.SetupRouter(nil, nil,
+		&v1.MetaController{MetaRepository: metaRepository, AuditRepository: auditRepository},
+		v1.WithAuditController(&v1.AuditController{AuditRepository: auditRepository}),
+	)
+
+	request := func(method, target, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return w
+	}
+	metaEntries := func() []models.AuditEntry {
+		w := request("GET", "/api/v1/audit/?resourceType=meta&ownerUUID="+ownerUUID, "")
+		require.Equal(t, http.StatusOK, w.Result().StatusCode, w.Body.String())
+		response := struct {
+			Entries []models.AuditEntry `json:"entries"`
+		}{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response.Entries
+	}
+	deleteMeta := `{"UUID": "` + documentUUID + `"}`
+
+	w := request("DELETE", "/api/v1/meta/", deleteMeta)
+	require.Equal(t, http.StatusOK, w.Result().StatusCode, w.Body.String())
+	assert.Empty(t, metaEntries(), "deleting missing meta data is not audited")
+
+	numberOfPages := uint32(2)
+	require.NoError(t, metaRepository.AddMeta(models.Meta{DocumentUUID: uuid.MustParse(documentUUID), NumberOfPages: &numberOfPages}))
+
+	w = request("PUT", "/api/v1/meta/?documentUUID="+documentUUID, `{"UUID": "`+documentUUID+`", "NumberOfPages": 3}`)
+	require.Equal(t, http.StatusOK, w.Result().StatusCode, w.Body.String())
+	w = request("DELETE", "/api/v1/meta/", deleteMeta)
+	require.Equal(t, http.StatusOK, w.Result().StatusCode, w.Body.String())
+
+	entries := metaEntries()
+	require.Len(t, entries, 2)
+	for _, entry := range entries {
+		require.NotNil(t, entry.ActorUUID, "requests without a caller act for the owner")
+		assert.Equal(t, ownerUUID, entry.ActorUUID.String())
+	}
+	assert.Equal(t, models.AuditActionDelete, entries[0].Action)
+
+	actorUUID := uuid.NewString()
+	require.NoError(t, metaRepository.AddMeta(models.Meta{DocumentUUID: uuid.MustParse(documentUUID), NumberOfPages: &numberOfPages}))
+	w = request("DELETE", "/api/v1/meta/?ownerUUID="+actorUUID, deleteMeta)
+	require.Equal(t, http.StatusOK, w.Result().StatusCode, w.Body.String())
+	assert.Equal(t, actorUUID, metaEntries()[0].ActorUUID.String(), "a named caller is the actor")
+}
+
+func auditShareChanges(t *testing.T) {
+	t.Parallel()
+	ownerUUID, documentUUID := "0c6f1a8e-5b0b-4a57-9d7e-3b1f0e2f6a11", "7e9a4c52-1f3d-4b8e-a6c2-9d5f0b3e1a27"
+	granteeUUID := uuid.NewString()
+
+	ctx := context.Background()
+	ctr, err := testutil.CreateTestContainerPostgresWithInitFileName(ctx, dbUser, dbPassword, "TwoOwnersWithSharedSelections")
+	require.NoError(t, err)
+	defer testcontainers.TerminateContainer(ctr)
+
+	connectionString, err := ctr.ConnectionString(ctx, "sslmode=disable")
+	require.NoError(t, err)
+
+	dbHandle := postgres2.DatabaseHandler{DbConfig: postgres2.ConfigForDatabase{ConUrl: connectionString}}
+	auditRepository := postgres2.NewAuditRepository(dbHandle)
+	router := v1.SetupRouter(
+		&v1.DocumentController{DocumentRepository: postgres2.NewDocumentRepository(dbHandle), AuditRepository: auditRepository},
+		nil, nil,
+		v1.WithAuditController(&v1.AuditController{AuditRepository: auditRepository}),
+	)
+
+	request := func(method, target, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return w
+	}
+	shareEntries := func() []models.AuditEntry {
+		w := request("GET", "/api/v1/audit/?resourceType=share&ownerUUID="+ownerUUID, "")
+		require.Equal(t, http.StatusOK, w.Result().StatusCode, w.Body.String())
+		response := struct {
+			Entries []models.AuditEntry `json:"entries"`
+		}{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response.Entries
+	}
+	shares := "/api/v1/documents/shares?documentUUID=" + documentUUID + "&ownerUUID=" + ownerUUID
+
+	w := request("PUT", shares, `{"granteeUUID": "`+granteeUUID+`"}`)
+	require.Equal(t, http.StatusOK, w.Result().StatusCode, w.Body.String())
+	w = request("PUT", shares, `{"granteeUUID": "`+granteeUUID+`", "canWrite": true}`)
+	require.Equal(t, http.StatusOK, w.Result().StatusCode, w.Body.String())
+	w = request("DELETE", shares+"&granteeUUID="+granteeUUID, "")
+	require.Equal(t, http.StatusOK, w.Result().StatusCode, w.Body.String())
+	w = request("DELETE", shares+"&granteeUUID="+granteeUUID, "")
+	require.Equal(t, http.StatusNotFound, w.Result().StatusCode, "revoking a missing share is not audited")
+
+	entries := shareEntries()
+	require.Len(t, entries, 3)
+	for _, entry := range entries {
+		assert.Equal(t, granteeUUID, entry.ResourceUUID.String(), "shares are audited with the grantee as resource")
+		assert.Equal(t, documentUUID, entry.DocumentUUID.String())
+		assert.Equal(t, ownerUUID, entry.ActorUUID.String())
+		assert.Equal(t, ownerUUID, entry.OwnerUUID.String())
+	}
+
+	revoke, update, create := entries[0], entries[1], entries[2]
+	assert.Equal(t, models.AuditActionCreate, create.Action)
+	assert.Equal(t, models.AuditChange{After: granteeUUID}, create.Changes["granteeUUID"])
+	assert.Equal(t, models.AuditChange{After: false}, create.Changes["canWrite"])
+	assert.Equal(t, models.AuditActionUpdate, update.Action)
+	assert.Equal(t, map[string]models.AuditChange{"canWrite": {Before: false, After: true}}, update.Changes)
+	assert.Equal(t, models.AuditActionDelete, revoke.Action)
+	assert.Equal(t, models.AuditChange{Before: true}, revoke.Changes["canWrite"])
+}
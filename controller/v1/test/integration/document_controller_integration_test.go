@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	v1 "pdf_service_api/controller/v1"
+	"pdf_service_api/models"
 	postgres2 "pdf_service_api/service/postgres"
 	"pdf_service_api/testutil"
 	"strings"
@@ -40,7 +41,10 @@ func TestDocumentIntegration(t *testing.T) {
 	t.Run("Get document with nonexistent document uuid", getDocumentWithNonexistentDocumentUUID)
 	t.Run("Upload a new document", uploadDocument)
 	t.Run("Upload a new document with document title", uploadDocumentWithTitle)
+	t.Run("Upload a new document with meta extraction queued", uploadDocumentWithMetaExtraction)
 	t.Run("Delete existing document", deleteDocument)
+	t.Run("Delete a document only at the version given by If-Match", deleteDocumentWithIfMatch)
+	t.Run("Share a document for reading and writing and revoke the share", shareDocument)
 }
 
 func databaseConnection(t *testing.T) {
@@ -71,7 +75,7 @@ func getDocumentWithDocumentUUID(t *testing.T) {
 	t.Parallel()
 	documentTestUUID := uuid.MustParse("b66fd223-515f-4503-80cc-2bdaa50ef474")
 	ownerTestUUID := uuid.MustParse("ea167a48-c1b3-46c4-911b-090e807132fc")
-	expectedResponse := fmt.Sprintf(`{"documents":[{"documentUUID":"%s","documentTitle":"Fake Title","timeCreated":"2022-10-10T11:30:30Z","ownerUUID":"ea167a48-c1b3-46c4-911b-090e807132fc","ownerType":1,"pdfBase64":"Fake document for testing"}]}`, documentTestUUID)
+	expectedResponse := fmt.Sprintf(`{"documents":[{"documentUUID":"%s","documentTitle":"Fake Title","timeCreated":"2022-10-10T11:30:30Z","ownerUUID":"ea167a48-c1b3-46c4-911b-090e807132fc","ownerType":1,"pdfBase64":"Fake document for testing","version":1}]}`, documentTestUUID)
 
 	ctx := context.Background()
 	ctr, err := testutil.CreateTestContainerPostgresWithInitFileName(ctx, dbUser, dbPassword, "OneDocumentTableEntry")
@@ -100,7 +104,7 @@ func getDocumentWithDocumentUUIDExcludeBase64(t *testing.T) {
 	t.Parallel()
 	documentTestUUID := uuid.MustParse("b66fd223-515f-4503-80cc-2bdaa50ef474")
 	ownerTestUUID := uuid.MustParse("ea167a48-c1b3-46c4-911b-090e807132fc")
-	expectedResponse := fmt.Sprintf(`{"documents":[{"documentUUID":"%s","documentTitle":"Fake Title"}]}`, documentTestUUID)
+	expectedResponse := fmt.Sprintf(`{"documents":[{"documentUUID":"%s","documentTitle":"Fake Title","version":1}]}`, documentTestUUID)
 
 	ctx := context.Background()
 	ctr, err := testutil.CreateTestContainerPostgresWithInitFileName(ctx, dbUser, dbPassword, "OneDocumentTableEntry")
@@ -490,6 +494,77 @@ func uploadDocumentWithTitle(t *testing.T) {
 	assert.NotEqual(t, uuid.Nil, response.DocumentUUID)
 }
 
+type recordingQueue struct {
+	jobs []models.MetaExtractionJob
+}
+
+func (q *recordingQueue) Enqueue(job models.MetaExtractionJob) error {
+	q.jobs = append(q.jobs, job)
+	return nil
+}
+
+func uploadDocumentWithMetaExtraction(t *testing.T) {
+	t.Parallel()
+	ownerUUID := uuid.MustParse("ea167a48-c1b3-46c4-911b-090e807132fc")
+
+	ctx := context.Background()
+	ctr, err := testutil.CreateTestContainerPostgres(ctx, dbUser, dbPassword)
+	require.NoError(t, err)
+	defer testcontainers.TerminateContainer(ctr)
+
+	connectionString, err := ctr.ConnectionString(ctx, "sslmode=disable")
+	require.NoError(t, err)
+
+	queue := &recordingQueue{}
+	dbHandle := postgres2.DatabaseHandler{DbConfig: postgres2.ConfigForDatabase{ConUrl: connectionString}}
+	documentCtrl := &v1.DocumentController{DocumentRepository: postgres2.NewDocumentRepository(dbHandle), MetaExtractionQueue: queue}
+	router := v1.SetupRouter(documentCtrl, nil, nil)
+	request := &v1.CreateRequest{
+		DocumentBase64String: "THIS IS A TEST DOCUMENT",
+		OwnerUUID:            &ownerUUID,
+		ExtractMeta:          func() *bool { v := true; return &v }(),
+	}
+	requestJSON, _ := json.Marshal(request)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(
+		"POST",
+		"/api/v1/documents/",
+		strings.NewReader(string(requestJSON)),
+	))
+
+	response := struct {
+		DocumentUUID uuid.UUID         `json:"documentUUID"`
+		MetaStatus   models.MetaStatus `json:"metaStatus"`
+	}{}
+	err = json.NewDecoder(w.Body).Decode(&response)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, w.Code, "Response should be 200")
+	assert.Equal(t, models.MetaStatusPending, response.MetaStatus)
+	require.Len(t, queue.jobs, 1)
+	assert.Equal(t, response.DocumentUUID, queue.jobs[0].DocumentUUID)
+	assert.Equal(t, ownerUUID, queue.jobs[0].OwnerUUID)
+
+	err = dbHandle.WithConnection(func(db *sql.DB) error {
+		row := db.QueryRow(`SELECT "Meta_Status" FROM document_table WHERE "Document_UUID" = $1`, response.DocumentUUID)
+
+		var status string
+		if err := row.Scan(&status); err != nil {
+			return err
+		}
+
+		assert.Equal(t, string(models.MetaStatusPending), status)
+		return nil
+	})
+	require.NoError(t, err)
+
+	withoutQueue := v1.SetupRouter(&v1.DocumentController{DocumentRepository: postgres2.NewDocumentRepository(dbHandle)}, nil, nil)
+	w = httptest.NewRecorder()
+	withoutQueue.ServeHTTP(w, httptest.NewRequest("POST", "/api/v1/documents/", strings.NewReader(string(requestJSON))))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code, "an extraction that cannot be queued is not silently dropped")
+}
+
 type DeleteResponse struct {
 	Success bool `json:"success"`
 }
@@ -524,3 +599,103 @@ func deleteDocument(t *testing.T) {
 	assert.Equal(t, http.StatusOK, w.Code, "Response should be 200")
 	assert.True(t, response.Success)
 }
+
+func deleteDocumentWithIfMatch(t *testing.T) {
+	t.Parallel()
+	target := fmt.Sprintf("/api/v1/documents/?documentUUID=%s&ownerUUID=%s", "b66fd223-515f-4503-80cc-2bdaa50ef474", "ea167a48-c1b3-46c4-911b-090e807132fc")
+
+	ctx := context.Background()
+	ctr, err := testutil.CreateTestContainerPostgresWithInitFileName(ctx, dbUser, dbPassword, "OneDocumentTableEntry")
+	require.NoError(t, err)
+	defer testcontainers.TerminateContainer(ctr)
+
+	dbHandle, err := testutil.CreateDatabaseHandlerFromPostgresInfo(ctx, *ctr)
+	require.NoError(t, err)
+
+	documentRepository := postgres2.NewDocumentRepository(dbHandle)
+	router := v1.SetupRouter(&v1.DocumentController{DocumentRepository: documentRepository}, nil, nil)
+	request := func(method, header, value string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, target, nil)
+		if header != "" {
+			r.Header.Set(header, value)
+		}
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	read := request("GET", "", "").Header().Get("ETag")
+	assert.Equal(t, `"1"`, read)
+	assert.Equal(t, http.StatusNotModified, request("GET", "If-None-Match", read).Code)
+
+	require.NoError(t, documentRepository.SetMetaStatus(uuid.MustParse("b66fd223-515f-4503-80cc-2bdaa50ef474"), models.MetaStatusPending))
+	assert.Equal(t, http.StatusNotModified, request("GET", "If-None-Match", read).Code, "a new meta status is not a new version")
+
+	assert.Equal(t, http.StatusPreconditionFailed, request("PUT", "If-Match", read).Code, "uploads do not evaluate If-Match")
+	assert.Equal(t, http.StatusPreconditionFailed, request("DELETE", "If-Match", `"2"`).Code)
+	assert.Equal(t, http.StatusOK, request("DELETE", "If-Match", read).Code)
+	assert.Equal(t, http.StatusNotFound, request("DELETE", "If-Match", read).Code)
+}
+
+func shareDocument(t *testing.T) {
+	t.Parallel()
+	documentUUID := "7e9a4c52-1f3d-4b8e-a6c2-9d5f0b3e1a27"
+	ownerUUID := "0c6f1a8e-5b0b-4a57-9d7e-3b1f0e2f6a11"
+	granteeUUID := selectionOwnerUUID
+
+	ctx := context.Background()
+	ctr, err := testutil.CreateTestContainerPostgresWithInitFileName(ctx, dbUser, dbPassword, "TwoOwnersWithSharedSelections")
+	require.NoError(t, err)
+	defer testcontainers.TerminateContainer(ctr)
+
+	connectionString, err := ctr.ConnectionString(ctx, "sslmode=disable")
+	require.NoError(t, err)
+
+	dbHandle := postgres2.DatabaseHandler{DbConfig: postgres2.ConfigForDatabase{ConUrl: connectionString}}
+	documentCtrl := &v1.DocumentController{DocumentRepository: postgres2.NewDocumentRepository(dbHandle)}
+	selectionCtrl := &v1.SelectionController{SelectionRepository: postgres2.NewSelectionRepository(dbHandle)}
+	router := v1.SetupRouter(documentCtrl, selectionCtrl, nil)
+
+	request := func(method, target, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return w
+	}
+	shares := fmt.Sprintf("/api/v1/documents/shares?documentUUID=%s&ownerUUID=%s", documentUUID, ownerUUID)
+	share := func(canWrite bool) string {
+		return fmt.Sprintf(`{"granteeUUID": %q, "canWrite": %t}`, granteeUUID, canWrite)
+	}
+	asGrantee := func(method, target, body string) int {
+		return request(method, asOwner(target), body).Code
+	}
+	newSelection := fmt.Sprintf(`{"documentUUID": %q, "pageKey": "0"}`, documentUUID)
+
+	assert.Equal(t, http.StatusNotFound, asGrantee("GET", "/api/v1/selections/?documentUUID="+documentUUID, ""))
+
+	w := request("PUT", shares, share(false))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, http.StatusOK, asGrantee("GET", "/api/v1/selections/?documentUUID="+documentUUID, ""))
+	assert.Equal(t, http.StatusNotFound, asGrantee("POST", "/api/v1/selections/", newSelection))
+
+	require.Equal(t, http.StatusOK, request("PUT", shares, share(true)).Code)
+	assert.Equal(t, http.StatusOK, asGrantee("POST", "/api/v1/selections/", newSelection))
+
+	w = request("GET", shares, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	listed := struct {
+		Shares []models.DocumentShare `json:"shares"`
+	}{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listed))
+	assert.Equal(t, []models.DocumentShare{{GranteeUUID: uuid.MustParse(granteeUUID), CanWrite: true}}, listed.Shares)
+
+	// Only the owner manages the shares.
+	grantees := fmt.Sprintf("/api/v1/documents/shares?documentUUID=%s&ownerUUID=%s", documentUUID, granteeUUID)
+	assert.Equal(t, http.StatusNotFound, request("GET", grantees, "").Code)
+	assert.Equal(t, http.StatusNotFound, request("PUT", grantees, fmt.Sprintf(`{"granteeUUID": %q}`, uuid.NewString())).Code)
+	assert.Equal(t, http.StatusBadRequest, request("PUT", shares, fmt.Sprintf(`{"granteeUUID": %q}`, ownerUUID)).Code)
+
+	revoke := shares + "&granteeUUID=" + granteeUUID
+	assert.Equal(t, http.StatusOK, request("DELETE", revoke, "").Code)
+	assert.Equal(t, http.StatusNotFound, request("DELETE", revoke, "").Code)
+	assert.Equal(t, http.StatusNotFound, asGrantee("GET", "/api/v1/selections/?documentUUID="+documentUUID, ""))
+}
@@ -0,0 +1,241 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	v1 "pdf_service_api/controller/v1"
+	"pdf_service_api/models"
+	postgres2 "pdf_service_api/service/postgres"
+	"pdf_service_api/testutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+func TestIdempotencyIntegration(t *testing.T) {
+	t.Parallel()
+	t.Run("Replay an upload retried with the same Idempotency-Key", replayUploadWithIdempotencyKey)
+	t.Run("Keep the Idempotency-Keys of callers and routes apart", scopeIdempotencyKeys)
+	t.Run("Replay the headers of a response and bound the bodies read", replayIdempotentHeaders)
+	t.Run("Reclaim the Idempotency-Keys of requests that panicked or outlived their lease", reclaimIdempotencyKeys)
+}
+
+func replayUploadWithIdempotencyKey(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	ctr, err := testutil.CreateTestContainerPostgres(ctx, dbUser, dbPassword)
+	require.NoError(t, err)
+	defer testcontainers.TerminateContainer(ctr)
+
+	connectionString, err := ctr.ConnectionString(ctx, "sslmode=disable")
+	require.NoError(t, err)
+
+	dbHandle := postgres2.DatabaseHandler{DbConfig: postgres2.ConfigForDatabase{ConUrl: connectionString}}
+	documentCtrl := &v1.DocumentController{DocumentRepository: postgres2.NewDocumentRepository(dbHandle)}
+	router := v1.SetupRouter(documentCtrl, nil, nil, v1.WithMiddleware(v1.Idempotency(postgres2.NewIdempotencyRepository(dbHandle), 0)))
+
+	upload := func(key, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/api/v1/documents/", strings.NewReader(body))
+		if key != "" {
+			r.Header.Set("Idempotency-Key", key)
+		}
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	first := upload("upload-1", `{"documentBase64String": "THIS IS A TEST DOCUMENT"}`)
+	require.Equal(t, http.StatusOK, first.Code, first.Body.String())
+	assert.Empty(t, first.Header().Get("Idempotent-Replayed"))
+
+	retry := upload("upload-1", `{"documentBase64String": "THIS IS A TEST DOCUMENT"}`)
+	require.Equal(t, http.StatusOK, retry.Code, retry.Body.String())
+	assert.Equal(t, "true", retry.Header().Get("Idempotent-Replayed"))
+	assert.JSONEq(t, first.Body.String(), retry.Body.String(), "the retry is answered with the first response")
+
+	response := UploadResponse{}
+	require.NoError(t, json.Unmarshal(retry.Body.Bytes(), &response))
+	assert.NotEqual(t, uuid.Nil, response.DocumentUUID)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, upload("upload-1", `{"documentBase64String": "ANOTHER DOCUMENT"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, upload(strings.Repeat("k", 256), `{"documentBase64String": "ANOTHER DOCUMENT"}`).Code)
+
+	other := upload("", `{"documentBase64String": "THIS IS A TEST DOCUMENT"}`)
+	require.Equal(t, http.StatusOK, other.Code, other.Body.String())
+	assert.NotEqual(t, first.Body.String(), other.Body.String(), "requests without a key are not deduplicated")
+
+	var documents int
+	err = dbHandle.WithConnection(func(db *sql.DB) error {
+		return db.QueryRow(`SELECT count(*) FROM document_table`).Scan(&documents)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, documents, "the retried upload is stored once")
+}
+
+func scopeIdempotencyKeys(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	ctr, err := testutil.CreateTestContainerPostgres(ctx, dbUser, dbPassword)
+	require.NoError(t, err)
+	defer testcontainers.TerminateContainer(ctr)
+
+	connectionString, err := ctr.ConnectionString(ctx, "sslmode=disable")
+	require.NoError(t, err)
+
+	dbHandle := postgres2.DatabaseHandler{DbConfig: postgres2.ConfigForDatabase{ConUrl: connectionString}}
+	router := v1.SetupRouter(
+		&v1.DocumentController{DocumentRepository: postgres2.NewDocumentRepository(dbHandle)},
+		&v1.SelectionController{SelectionRepository: postgres2.NewSelectionRepository(dbHandle)},
+		nil,
+		v1.WithMiddleware(v1.Idempotency(postgres2.NewIdempotencyRepository(dbHandle), 0)),
+	)
+
+	post := func(target, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", target, strings.NewReader(body))
+		r.Header.Set("Idempotency-Key", "shared-key")
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	body := `{"documentBase64String": "THIS IS A TEST DOCUMENT"}`
+	first := post("/api/v1/documents/?ownerUUID="+uuid.NewString(), body)
+	require.Equal(t, http.StatusOK, first.Code, first.Body.String())
+
+	other := post("/api/v1/documents/?ownerUUID="+uuid.NewString(), body)
+	require.Equal(t, http.StatusOK, other.Code, other.Body.String())
+	assert.Empty(t, other.Header().Get("Idempotent-Replayed"), "another caller's key is not replayed")
+	assert.NotEqual(t, first.Body.String(), other.Body.String())
+
+	otherRoute := post("/api/v1/selections/?ownerUUID="+uuid.NewString(), `{}`)
+	assert.NotEqual(t, http.StatusUnprocessableEntity, otherRoute.Code, "the key of another route is no conflict")
+	assert.Empty(t, otherRoute.Header().Get("Idempotent-Replayed"))
+}
+
+func replayIdempotentHeaders(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	ctr, err := testutil.CreateTestContainerPostgres(ctx, dbUser, dbPassword)
+	require.NoError(t, err)
+	defer testcontainers.TerminateContainer(ctr)
+
+	connectionString, err := ctr.ConnectionString(ctx, "sslmode=disable")
+	require.NoError(t, err)
+
+	dbHandle := postgres2.DatabaseHandler{DbConfig: postgres2.ConfigForDatabase{ConUrl: connectionString}}
+	handled := 0
+	router := gin.New()
+	router.Use(v1.Idempotency(postgres2.NewIdempotencyRepository(dbHandle), 0))
+	router.POST("/items", func(c *gin.Context) {
+		handled++
+		c.Header("ETag", `"1"`)
+		c.Header("Location", "/items/1")
+		c.Header("X-Handled", "true")
+		c.JSON(http.StatusCreated, gin.H{"uuid": uuid.NewString()})
+	})
+
+	post := func(body io.Reader) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/items", body)
+		r.Header.Set("Idempotency-Key", "item-1")
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	first := post(strings.NewReader(`{}`))
+	require.Equal(t, http.StatusCreated, first.Code, first.Body.String())
+
+	retry := post(strings.NewReader(`{}`))
+	require.Equal(t, http.StatusCreated, retry.Code, retry.Body.String())
+	assert.Equal(t, 1, handled)
+	assert.Equal(t, "true", retry.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, `"1"`, retry.Header().Get("ETag"))
+	assert.Equal(t, "/items/1", retry.Header().Get("Location"))
+	assert.Equal(t, first.Header().Get("Content-Type"), retry.Header().Get("Content-Type"))
+	assert.Empty(t, retry.Header().Get("X-Handled"), "only headers describing the response are replayed")
+	assert.Equal(t, first.Body.String(), retry.Body.String())
+
+	tooLarge := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/items", bytes.NewReader(make([]byte, 64<<20+1)))
+	r.Header.Set("Idempotency-Key", "item-2")
+	router.ServeHTTP(tooLarge, r)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, tooLarge.Code)
+	assert.Equal(t, 1, handled, "bodies above the limit are not handled")
+}
+
+func reclaimIdempotencyKeys(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	ctr, err := testutil.CreateTestContainerPostgres(ctx, dbUser, dbPassword)
+	require.NoError(t, err)
+	defer testcontainers.TerminateContainer(ctr)
+
+	connectionString, err := ctr.ConnectionString(ctx, "sslmode=disable")
+	require.NoError(t, err)
+
+	dbHandle := postgres2.DatabaseHandler{DbConfig: postgres2.ConfigForDatabase{ConUrl: connectionString}}
+	repository := postgres2.NewIdempotencyRepository(dbHandle)
+
+	now := time.Now().UTC()
+	unanswered := models.IdempotencyRecord{Scope: "POST /items", Key: "item-1", Fingerprint: "first", CreatedAt: now.Add(-time.Hour), LeaseExpiresAt: now.Add(-time.Minute)}
+	_, reserved, err := repository.Reserve(unanswered, now.Add(-24*time.Hour))
+	require.NoError(t, err)
+	require.True(t, reserved)
+
+	retry := models.IdempotencyRecord{Scope: "POST /items", Key: "item-1", Fingerprint: "first", CreatedAt: now, LeaseExpiresAt: now.Add(time.Minute)}
+	_, reserved, err = repository.Reserve(retry, now.Add(-24*time.Hour))
+	require.NoError(t, err)
+	assert.True(t, reserved, "the key of a request that outlived its lease is taken over")
+
+	stored, reserved, err := repository.Reserve(retry, now.Add(-24*time.Hour))
+	require.NoError(t, err)
+	assert.False(t, reserved, "the lease of the retry is still running")
+	assert.Nil(t, stored.Status)
+	assert.WithinDuration(t, retry.LeaseExpiresAt, stored.LeaseExpiresAt, time.Millisecond)
+
+	require.NoError(t, repository.Complete(retry.Scope, retry.Key, http.StatusCreated, nil, []byte(`{}`)))
+	later := models.IdempotencyRecord{Scope: "POST /items", Key: "item-1", Fingerprint: "first", CreatedAt: now.Add(time.Hour), LeaseExpiresAt: now.Add(2 * time.Hour)}
+	stored, reserved, err = repository.Reserve(later, now.Add(-24*time.Hour))
+	require.NoError(t, err)
+	assert.False(t, reserved, "answered requests keep their key for the window")
+	require.NotNil(t, stored.Status)
+	assert.Equal(t, http.StatusCreated, *stored.Status)
+
+	handled := 0
+	router := gin.New()
+	router.Use(gin.Recovery(), v1.Idempotency(repository, 0))
+	router.POST("/panics", func(c *gin.Context) {
+		handled++
+		if handled == 1 {
+			panic("handler failed")
+		}
+		c.JSON(http.StatusCreated, gin.H{})
+	})
+
+	post := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/panics", strings.NewReader(`{}`))
+		r.Header.Set("Idempotency-Key", "panic-1")
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	assert.Equal(t, http.StatusInternalServerError, post().Code)
+	assert.Equal(t, http.StatusCreated, post().Code, "the key of a panicking request is released")
+	assert.Equal(t, 2, handled)
+}
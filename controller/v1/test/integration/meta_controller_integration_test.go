@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	_ "embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -27,8 +28,18 @@ func TestMetaIntegration(t *testing.T) {
 	t.Run("get meta using a present uuid", getMetaPresentUUID)
 	t.Run("get meta using a uuid not present in table", getMetaUUIDDoesNotExistInTable)
 	t.Run("get meta wth paginated values", getMetaPresentUUIDPagination)
+	t.Run("get meta of a document shared with the caller", getMetaSharedDocument)
 	t.Run("update meta using a present uuid", updateMetaPresentUUID)
 	t.Run("update meta using a present uuid with new images", updateImageMetaPresentUUID)
+	t.Run("reject stale meta updates with If-Match", updateMetaWithIfMatch)
+	t.Run("split legacy json images into the page table", splitLegacyImagesIntoPages)
+	t.Run("store an extraction with its pages in one transaction", storeExtractionAtomically)
+	t.Run("update the geometry of a page and read it back", updatePageGeometry)
+	t.Run("update the geometry of pages by their key", updatePageGeometryByKey)
+	t.Run("get the image of a page", getPageImage)
+	t.Run("get the image of a page owned by someone else", getPageImageOtherOwner)
+	t.Run("get a cached thumbnail of a page", getPageThumbnail)
+	t.Run("get a thumbnail of a page with a size that is not allowed", getPageThumbnailInvalidSize)
 	t.Run("add meta using the DataApi to generate the meta data with base64 included", addMetaBase64Included)
 	t.Run("add meta using the DataApi to generate the meta data with base64 excluded", addMetaBase64Excluded)
 }
@@ -42,6 +53,7 @@ func getMetaPresentUUID(t *testing.T) {
 		Height:        func() *float32 { v := float32(1920); return &v }(),
 		Width:         func() *float32 { v := float32(1080); return &v }(),
 		Images:        &mm,
+		Version:       1,
 	}
 	bytes, err := json.Marshal(expectedObj)
 	require.NoError(t, err)
@@ -69,6 +81,37 @@ func getMetaPresentUUID(t *testing.T) {
 	assert.Equal(t, string(bytes), w.Body.String())
 }
 
+func getMetaSharedDocument(t *testing.T) {
+	t.Parallel()
+	documentUUID := uuid.MustParse("b66fd223-515f-4503-80cc-2bdaa50ef474")
+	ownerUUID := uuid.MustParse("f701aa7e-10e9-48b9-83f1-6b035a5b7564")
+	granteeUUID := uuid.New()
+
+	ctx := context.Background()
+	ctr, err := testutil.CreateTestContainerPostgresWithInitFileName(ctx, dbUser, dbPassword, "OneDocumentTableEntryTwoSelectionsAndMetaData")
+	require.NoError(t, err)
+	defer testcontainers.TerminateContainer(ctr)
+
+	connectionString, err := ctr.ConnectionString(ctx, "sslmode=disable")
+	require.NoError(t, err)
+
+	dbHandle := pg.DatabaseHandler{DbConfig: pg.ConfigForDatabase{ConUrl: connectionString}}
+	metaCtrl := &v1.MetaController{MetaRepository: pg.NewMetaRepository(dbHandle)}
+	router := v1.SetupRouter(nil, nil, metaCtrl)
+
+	getMeta := func(callerUUID uuid.UUID) int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/meta/?documentUUID="+documentUUID.String()+"&ownerUUID="+callerUUID.String(), nil))
+		return w.Result().StatusCode
+	}
+
+	assert.Equal(t, http.StatusNotFound, getMeta(granteeUUID), "the document is not shared yet")
+
+	require.NoError(t, pg.NewDocumentRepository(dbHandle).ShareDocument(documentUUID, ownerUUID, models.DocumentShare{GranteeUUID: granteeUUID}))
+	assert.Equal(t, http.StatusOK, getMeta(granteeUUID), "a read share allows reading the meta data")
+	assert.Equal(t, http.StatusNotFound, getMeta(uuid.New()))
+}
+
 func getMetaPresentUUIDPagination(t *testing.T) {
 	t.Parallel()
 	mm := make(map[string]string)
@@ -80,6 +123,7 @@ func getMetaPresentUUIDPagination(t *testing.T) {
 		Height:        func() *float32 { v := float32(1920); return &v }(),
 		Width:         func() *float32 { v := float32(1080); return &v }(),
 		Images:        &mm,
+		Version:       1,
 	}
 	bytes, err := json.Marshal(expectedObj)
 	require.NoError(t, err)
@@ -105,6 +149,21 @@ func getMetaPresentUUIDPagination(t *testing.T) {
 
 	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
 	assert.Equal(t, string(bytes), w.Body.String())
+	etag := w.Header().Get("ETag")
+	assert.NotEqual(t, `"1"`, etag, "a page of the meta data is tagged apart from its version")
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/api/v1/meta/?documentUUID="+expectedObj.DocumentUUID.String()+"&ownerUUID=f701aa7e-10e9-48b9-83f1-6b035a5b7564&offset=2&limit=2", nil)
+	r.Header.Set("If-None-Match", etag)
+	router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode, "the tag of one page does not match another")
+	assert.NotEqual(t, etag, w.Header().Get("ETag"))
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/api/v1/meta/?documentUUID="+expectedObj.DocumentUUID.String()+"&ownerUUID=f701aa7e-10e9-48b9-83f1-6b035a5b7564&offset=0&limit=2", nil)
+	r.Header.Set("If-None-Match", etag)
+	router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusNotModified, w.Result().StatusCode)
 }
 
 func getMetaUUIDDoesNotExistInTable(t *testing.T) {
@@ -197,10 +256,70 @@ func updateMetaPresentUUID(t *testing.T) {
 	}
 }
 
+func updateMetaWithIfMatch(t *testing.T) {
+	t.Parallel()
+	testUUID := "b66fd223-515f-4503-80cc-2bdaa50ef474"
+	target := "/api/v1/meta/?documentUUID=" + testUUID + "&ownerUUID=f701aa7e-10e9-48b9-83f1-6b035a5b7564"
+
+	ctx := context.Background()
+	ctr, err := testutil.CreateTestContainerPostgresWithInitFileName(ctx, dbUser, dbPassword, "OneDocumentTableEntryTwoSelectionsAndMetaData")
+	require.NoError(t, err)
+	defer testcontainers.TerminateContainer(ctr)
+
+	connectionString, err := ctr.ConnectionString(ctx, "sslmode=disable")
+	require.NoError(t, err)
+
+	dbHandle := pg.DatabaseHandler{DbConfig: pg.ConfigForDatabase{ConUrl: connectionString}}
+	metaRepository := pg.NewMetaRepository(dbHandle)
+	metaCtrl := &v1.MetaController{MetaRepository: metaRepository}
+	router := v1.SetupRouter(nil, nil, metaCtrl)
+
+	request := func(method, target, body, header, value string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		if header != "" {
+			r.Header.Set(header, value)
+		}
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	w := request("GET", target, "", "", "")
+	require.Equal(t, http.StatusOK, w.Result().StatusCode, w.Body.String())
+	read := w.Header().Get("ETag")
+	assert.Equal(t, `"1"`, read)
+	assert.Equal(t, http.StatusNotModified, request("GET", target, "", "If-None-Match", read).Result().StatusCode)
+
+	w = request("PUT", target, `{"numberOfPages": 32}`, "If-Match", read)
+	require.Equal(t, http.StatusOK, w.Result().StatusCode, w.Body.String())
+
+	w = request("PUT", target, `{"numberOfPages": 33}`, "If-Match", read)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Result().StatusCode, "the second update was made against a stale version")
+
+	w = request("GET", target, "", "If-None-Match", read)
+	require.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+	meta := models.Meta{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &meta))
+	assert.EqualValues(t, 32, *meta.NumberOfPages)
+
+	assert.Equal(t, http.StatusPreconditionFailed, request("PUT", target, `{}`, "If-Match", "not a version").Result().StatusCode)
+	assert.Equal(t, http.StatusPreconditionFailed, request("DELETE", target, fmt.Sprintf(`{"uuid": %q}`, testUUID), "If-Match", read).Result().StatusCode)
+	assert.Equal(t, http.StatusOK, request("DELETE", target, fmt.Sprintf(`{"uuid": %q}`, testUUID), "If-Match", `"2"`).Result().StatusCode)
+	assert.Equal(t, http.StatusNotFound, request("DELETE", target, fmt.Sprintf(`{"uuid": %q}`, testUUID), "If-Match", `"2"`).Result().StatusCode)
+
+	numberOfPages := uint32(2)
+	require.NoError(t, metaRepository.AddMeta(models.Meta{DocumentUUID: uuid.MustParse(testUUID), NumberOfPages: &numberOfPages}))
+	w = request("GET", target, "", "", "")
+	require.Equal(t, http.StatusOK, w.Result().StatusCode, w.Body.String())
+	assert.Equal(t, `"3"`, w.Header().Get("ETag"), "recreated meta data continues the versions of the deleted one")
+	assert.Equal(t, http.StatusPreconditionFailed, request("PUT", target, `{}`, "If-Match", read).Result().StatusCode, "versions of deleted meta data stay stale")
+}
+
 func updateImageMetaPresentUUID(t *testing.T) {
 	t.Parallel()
 	testUUID := "b66fd223-515f-4503-80cc-2bdaa50ef474"
-	expectedStr := `{"0":"Image0","1":"Image1","2":"Image2"}`
+	expectedPages := []string{"0=Image0", "1=Image1", "2=Image2"}
 
 	ctx := context.Background()
 	ctr, err := testutil.CreateTestContainerPostgresWithInitFileName(ctx, dbUser, dbPassword, "OneDocumentTableEntryTwoSelectionsAndMetaData")
@@ -239,7 +358,7 @@ func updateImageMetaPresentUUID(t *testing.T) {
 
 	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
 	err = dbHandle.WithConnection(func(db *sql.DB) error {
-		sqlStatement := `SELECT "Document_UUID", "Number_Of_Pages", "Height", "Width", "Images" FROM documentmeta_table WHERE "Document_UUID" = $1`
+		sqlStatement := `SELECT "Document_UUID", "Number_Of_Pages", "Height", "Width" FROM documentmeta_table WHERE "Document_UUID" = $1`
 		row := db.QueryRow(sqlStatement, testUUID)
 
 		var (
@@ -247,13 +366,27 @@ func updateImageMetaPresentUUID(t *testing.T) {
 			noPages int32
 			height  float32
 			width   float32
-			images  string
 		)
 
-		err := row.Scan(&uid, &noPages, &height, &width, &images)
+		err := row.Scan(&uid, &noPages, &height, &width)
+		if err != nil {
+			return err
+		}
+
+		rows, err := db.Query(`SELECT "Page_Key", "Image" FROM documentpage_table WHERE "Document_UUID" = $1 ORDER BY "Page_Number"`, testUUID)
 		if err != nil {
 			return err
 		}
+		defer rows.Close()
+
+		images := make([]string, 0)
+		for rows.Next() {
+			var pageKey, image string
+			if err := rows.Scan(&pageKey, &image); err != nil {
+				return err
+			}
+			images = append(images, pageKey+"="+image)
+		}
 
 		assert.Equal(t, newData.DocumentUUID.String(), uid)
 		assert.EqualValues(t, noPages, 31)
@@ -262,7 +395,7 @@ func updateImageMetaPresentUUID(t *testing.T) {
 		assert.EqualValues(t, height, 1920)
 		assert.NotNil(t, width)
 		assert.EqualValues(t, width, 1080)
-		assert.Equal(t, images, expectedStr)
+		assert.Equal(t, expectedPages, images)
 
 		return nil
 	})
@@ -300,8 +433,9 @@ func addMetaBase64Included(t *testing.T) {
 	dbHandle, err := testutil.CreateDatabaseHandlerFromPostgresInfo(ctx, *pgCtr)
 	require.NoError(t, err)
 
-	srv := dataapi.DataService{BaseUrl: fmt.Sprintf("http://localhost:%d", p.Int())}
-	metaCtrl := &v1.MetaController{DataService: srv, MetaRepository: pg.NewMetaRepository(dbHandle)}
+	srv, err := dataapi.NewDataService(dataapi.Config{BaseUrl: fmt.Sprintf("http://localhost:%d", p.Int())})
+	require.NoError(t, err)
+	metaCtrl := &v1.MetaController{MetaExtractor: srv, MetaRepository: pg.NewMetaRepository(dbHandle)}
 	router := v1.SetupRouter(nil, nil, metaCtrl)
 
 	w := httptest.NewRecorder()
@@ -354,8 +488,9 @@ func addMetaBase64Excluded(t *testing.T) {
 	dbHandle, err := testutil.CreateDatabaseHandlerFromPostgresInfo(ctx, *pgCtr)
 	require.NoError(t, err)
 
-	srv := dataapi.DataService{BaseUrl: fmt.Sprintf("http://localhost:%d", p.Int())}
-	metaCtrl := &v1.MetaController{DataService: srv, MetaRepository: pg.NewMetaRepository(dbHandle), DocumentRepository: pg.NewDocumentRepository(dbHandle)}
+	srv, err := dataapi.NewDataService(dataapi.Config{BaseUrl: fmt.Sprintf("http://localhost:%d", p.Int())})
+	require.NoError(t, err)
+	metaCtrl := &v1.MetaController{MetaExtractor: srv, MetaRepository: pg.NewMetaRepository(dbHandle), DocumentRepository: pg.NewDocumentRepository(dbHandle)}
 	router := v1.SetupRouter(nil, nil, metaCtrl)
 
 	w := httptest.NewRecorder()
@@ -380,3 +515,320 @@ func addMetaBase64Excluded(t *testing.T) {
 		return nil
 	})
 }
+
+func splitLegacyImagesIntoPages(t *testing.T) {
+	t.Parallel()
+	testUUID := "b66fd223-515f-4503-80cc-2bdaa50ef474"
+
+	ctx := context.Background()
+	ctr, err := testutil.CreateTestContainerPostgresWithInitFileName(ctx, dbUser, dbPassword, "MetaTableWithLegacyImages")
+	require.NoError(t, err)
+	defer testcontainers.TerminateContainer(ctr)
+
+	dbHandle, err := testutil.CreateDatabaseHandlerFromPostgresInfo(ctx, *ctr)
+	require.NoError(t, err)
+	require.NoError(t, dbHandle.RunInitScript(), "the migration must be safe to run repeatedly")
+
+	pages, err := pg.NewMetaRepository(dbHandle).GetPages(uuid.MustParse(testUUID), uuid.MustParse("f701aa7e-10e9-48b9-83f1-6b035a5b7564"), 0, 100)
+	require.NoError(t, err)
+	require.Len(t, pages, 3)
+	assert.Equal(t, "0", pages[0].PageKey)
+	assert.EqualValues(t, 0, pages[0].PageNumber)
+	assert.Equal(t, "2", pages[1].PageKey)
+	assert.EqualValues(t, 1, pages[1].PageNumber)
+	assert.Equal(t, "10", pages[2].PageKey)
+	assert.Equal(t, "test10", *pages[2].Image)
+
+	_ = dbHandle.WithConnection(func(db *sql.DB) error {
+		var images sql.NullString
+		err := db.QueryRow(`SELECT "Images" FROM documentmeta_table WHERE "Document_UUID" = $1`, testUUID).Scan(&images)
+		require.NoError(t, err)
+		assert.True(t, images.Valid, "the legacy images are kept until the migration is verified")
+		return nil
+	})
+
+	metaRepository := pg.NewMetaRepository(dbHandle)
+	require.NoError(t, metaRepository.AddPages(uuid.MustParse(testUUID), []models.Page{{PageKey: "3"}, {PageKey: "cover"}}))
+	pages, err = metaRepository.GetPages(uuid.MustParse(testUUID), uuid.MustParse("f701aa7e-10e9-48b9-83f1-6b035a5b7564"), 0, 100)
+	require.NoError(t, err)
+	keys := make([]string, 0, len(pages))
+	for i, page := range pages {
+		assert.EqualValues(t, i, page.PageNumber, "added pages are numbered by key like migrated ones")
+		keys = append(keys, page.PageKey)
+	}
+	assert.Equal(t, []string{"0", "2", "3", "10", "cover"}, keys)
+}
+
+func storeExtractionAtomically(t *testing.T) {
+	t.Parallel()
+	documentUid := uuid.MustParse("b66fd223-515f-4503-80cc-2bdaa50ef474")
+	ownerUid := uuid.MustParse("f701aa7e-10e9-48b9-83f1-6b035a5b7564")
+
+	ctx := context.Background()
+	ctr, err := testutil.CreateTestContainerPostgresWithInitFileName(ctx, dbUser, dbPassword, "MetaTableWithLegacyImages")
+	require.NoError(t, err)
+	defer testcontainers.TerminateContainer(ctr)
+
+	dbHandle, err := testutil.CreateDatabaseHandlerFromPostgresInfo(ctx, *ctr)
+	require.NoError(t, err)
+	metaRepository := pg.NewMetaRepository(dbHandle)
+
+	extraction := func(keys ...string) func(addPages func([]models.Page) error) (models.Meta, error) {
+		return func(addPages func([]models.Page) error) (models.Meta, error) {
+			for _, key := range keys {
+				image := "image" + key
+				if err := addPages([]models.Page{{PageKey: key, Image: &image}}); err != nil {
+					return models.Meta{}, err
+				}
+			}
+
+			number := uint32(len(keys))
+			return models.Meta{NumberOfPages: &number}, nil
+		}
+	}
+
+	require.NoError(t, metaRepository.StoreExtraction(documentUid, extraction("1", "0")), "an extraction replaces existing meta data")
+	require.NoError(t, metaRepository.StoreExtraction(documentUid, extraction("0", "1", "1")), "a page sent twice is stored once")
+
+	failure := errors.New("data service failed")
+	err = metaRepository.StoreExtraction(documentUid, func(addPages func([]models.Page) error) (models.Meta, error) {
+		if err := addPages([]models.Page{{PageKey: "7"}}); err != nil {
+			return models.Meta{}, err
+		}
+
+		// The extraction runs outside of a transaction, readers see the stored pages meanwhile.
+		pages, err := metaRepository.GetPages(documentUid, ownerUid, 0, 100)
+		require.NoError(t, err)
+		assert.Len(t, pages, 2, "staged pages are not visible before the extraction succeeded")
+		return models.Meta{}, failure
+	})
+	require.ErrorIs(t, err, failure)
+
+	var staged int
+	require.NoError(t, dbHandle.WithConnection(func(db *sql.DB) error {
+		return db.QueryRow(`SELECT count(*) FROM documentpagestaging_table`).Scan(&staged)
+	}))
+	assert.Zero(t, staged, "the staged pages of a failed extraction are discarded")
+
+	meta, err := metaRepository.GetMeta(documentUid, ownerUid)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, *meta.NumberOfPages)
+	assert.Equal(t, map[string]string{"0": "image0", "1": "image1"}, *meta.Images, "a failed extraction leaves no pages behind")
+
+	empty, err := metaRepository.GetMetaPagination(documentUid, ownerUid, 0, 0)
+	require.NoError(t, err)
+	assert.Empty(t, *empty.Images, "a limit of 0 returns no pages")
+}
+
+func getPageImage(t *testing.T) {
+	t.Parallel()
+	testUUID := "b66fd223-515f-4503-80cc-2bdaa50ef474"
+
+	ctx := context.Background()
+	ctr, err := testutil.CreateTestContainerPostgresWithInitFileName(ctx, dbUser, dbPassword, "MetaTableWithPageImage")
+	require.NoError(t, err)
+	defer testcontainers.TerminateContainer(ctr)
+
+	connectionString, err := ctr.ConnectionString(ctx, "sslmode=disable")
+	require.NoError(t, err)
+
+	dbHandle := pg.DatabaseHandler{DbConfig: pg.ConfigForDatabase{ConUrl: connectionString}}
+	metaCtrl := &v1.MetaController{MetaRepository: pg.NewMetaRepository(dbHandle)}
+	router := v1.SetupRouter(nil, nil, metaCtrl)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(
+		"GET",
+		"/api/v1/meta/"+testUUID+"/pages/0/image?ownerUUID=f701aa7e-10e9-48b9-83f1-6b035a5b7564",
+		nil,
+	))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	assert.Equal(t, []byte("\x89PNG"), w.Body.Bytes()[:4])
+	etag := w.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	request := httptest.NewRequest(
+		"GET",
+		"/api/v1/meta/"+testUUID+"/pages/0/image?ownerUUID=f701aa7e-10e9-48b9-83f1-6b035a5b7564",
+		nil,
+	)
+	request.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, request)
+
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.Bytes())
+}
+
+func getPageImageOtherOwner(t *testing.T) {
+	t.Parallel()
+	testUUID := "b66fd223-515f-4503-80cc-2bdaa50ef474"
+
+	ctx := context.Background()
+	ctr, err := testutil.CreateTestContainerPostgresWithInitFileName(ctx, dbUser, dbPassword, "MetaTableWithPageImage")
+	require.NoError(t, err)
+	defer testcontainers.TerminateContainer(ctr)
+
+	connectionString, err := ctr.ConnectionString(ctx, "sslmode=disable")
+	require.NoError(t, err)
+
+	dbHandle := pg.DatabaseHandler{DbConfig: pg.ConfigForDatabase{ConUrl: connectionString}}
+	metaCtrl := &v1.MetaController{MetaRepository: pg.NewMetaRepository(dbHandle)}
+	router := v1.SetupRouter(nil, nil, metaCtrl)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(
+		"GET",
+		"/api/v1/meta/"+testUUID+"/pages/0/image?ownerUUID="+uuid.New().String(),
+		nil,
+	))
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func getPageThumbnail(t *testing.T) {
+	t.Parallel()
+	testUUID := "b66fd223-515f-4503-80cc-2bdaa50ef474"
+
+	ctx := context.Background()
+	ctr, err := testutil.CreateTestContainerPostgresWithInitFileName(ctx, dbUser, dbPassword, "MetaTableWithPageImage")
+	require.NoError(t, err)
+	defer testcontainers.TerminateContainer(ctr)
+
+	connectionString, err := ctr.ConnectionString(ctx, "sslmode=disable")
+	require.NoError(t, err)
+
+	dbHandle := pg.DatabaseHandler{DbConfig: pg.ConfigForDatabase{ConUrl: connectionString}}
+	metaCtrl := &v1.MetaController{
+		MetaRepository:      pg.NewMetaRepository(dbHandle),
+		ThumbnailRepository: pg.NewThumbnailRepository(dbHandle),
+		ThumbnailSizes:      []uint32{2, 4},
+	}
+	router := v1.SetupRouter(nil, nil, metaCtrl)
+
+	target := "/api/v1/meta/" + testUUID + "/pages/0/thumbnail?ownerUUID=f701aa7e-10e9-48b9-83f1-6b035a5b7564&w=2&format=png"
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	generated := w.Body.Bytes()
+	etag := w.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	thumbnail, err := pg.NewThumbnailRepository(dbHandle).GetThumbnail(models.Thumbnail{
+		DocumentUUID: uuid.MustParse(testUUID),
+		PageKey:      "0",
+		Width:        2,
+		Fit:          "contain",
+		MimeType:     "image/png",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, generated, thumbnail.Data)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, generated, w.Body.Bytes())
+
+	request := httptest.NewRequest("GET", target, nil)
+	request.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, request)
+
+	assert.Equal(t, http.StatusNotModified, w.Code)
+}
+
+func getPageThumbnailInvalidSize(t *testing.T) {
+	t.Parallel()
+
+	metaCtrl := &v1.MetaController{ThumbnailSizes: []uint32{100}}
+	router := v1.SetupRouter(nil, nil, metaCtrl)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(
+		"GET",
+		"/api/v1/meta/"+uuid.New().String()+"/pages/0/thumbnail?ownerUUID="+uuid.New().String()+"&w=123",
+		nil,
+	))
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func updatePageGeometry(t *testing.T) {
+	t.Parallel()
+	testUUID := "b66fd223-515f-4503-80cc-2bdaa50ef474"
+
+	ctx := context.Background()
+	ctr, err := testutil.CreateTestContainerPostgresWithInitFileName(ctx, dbUser, dbPassword, "MetaTableWithPageImage")
+	require.NoError(t, err)
+	defer testcontainers.TerminateContainer(ctr)
+
+	connectionString, err := ctr.ConnectionString(ctx, "sslmode=disable")
+	require.NoError(t, err)
+
+	dbHandle := pg.DatabaseHandler{DbConfig: pg.ConfigForDatabase{ConUrl: connectionString}}
+	metaCtrl := &v1.MetaController{MetaRepository: pg.NewMetaRepository(dbHandle)}
+	router := v1.SetupRouter(nil, nil, metaCtrl)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(
+		"PUT",
+		"/api/v1/meta/?documentUUID="+testUUID,
+		strings.NewReader(`{"UUID": "`+testUUID+`", "Pages": [{"pageNumber": 0, "mediaBox": [0, 0, 612, 792], "rotation": -90}]}`),
+	))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(
+		"GET",
+		"/api/v1/meta/?documentUUID="+testUUID+"&ownerUUID=f701aa7e-10e9-48b9-83f1-6b035a5b7564",
+		nil,
+	))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	meta := models.Meta{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &meta))
+	require.Len(t, meta.Pages, 1)
+	assert.Equal(t, "0", meta.Pages[0].PageKey)
+	assert.Equal(t, models.Box{0, 0, 612, 792}, *meta.Pages[0].MediaBox)
+	assert.Equal(t, 270, *meta.Pages[0].Rotation)
+	assert.Contains(t, *meta.Images, "0")
+}
+
+func updatePageGeometryByKey(t *testing.T) {
+	t.Parallel()
+	testUUID := "b66fd223-515f-4503-80cc-2bdaa50ef474"
+
+	ctx := context.Background()
+	ctr, err := testutil.CreateTestContainerPostgresWithInitFileName(ctx, dbUser, dbPassword, "MetaTableWithPageImage")
+	require.NoError(t, err)
+	defer testcontainers.TerminateContainer(ctr)
+
+	connectionString, err := ctr.ConnectionString(ctx, "sslmode=disable")
+	require.NoError(t, err)
+
+	dbHandle := pg.DatabaseHandler{DbConfig: pg.ConfigForDatabase{ConUrl: connectionString}}
+	metaCtrl := &v1.MetaController{MetaRepository: pg.NewMetaRepository(dbHandle)}
+	router := v1.SetupRouter(nil, nil, metaCtrl)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(
+		"PUT",
+		"/api/v1/meta/?documentUUID="+testUUID,
+		strings.NewReader(`{"UUID": "`+testUUID+`", "Pages": [{"pageNumber": 3, "pageKey": "0", "mediaBox": [0, 0, 612, 792]}, {"pageNumber": 0, "pageKey": "cover", "mediaBox": [0, 0, 100, 100]}]}`),
+	))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	meta, err := pg.NewMetaRepository(dbHandle).GetPageGeometry(uuid.MustParse(testUUID))
+	require.NoError(t, err)
+	require.Len(t, meta.Pages, 2)
+	assert.Equal(t, "0", meta.Pages[0].PageKey, "the stored page keeps its key and number")
+	assert.EqualValues(t, 0, meta.Pages[0].PageNumber)
+	assert.Equal(t, models.Box{0, 0, 612, 792}, *meta.Pages[0].MediaBox)
+	assert.Equal(t, "cover", meta.Pages[1].PageKey, "a new key adds a page, numbered by key")
+	assert.EqualValues(t, 1, meta.Pages[1].PageNumber)
+	assert.Equal(t, models.Box{0, 0, 100, 100}, *meta.Pages[1].MediaBox)
+}
@@ -0,0 +1,119 @@
+package integration
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	v1 "pdf_service_api/controller/v1"
+	"pdf_service_api/service/logging"
+	postgres2 "pdf_service_api/service/postgres"
+	"pdf_service_api/testutil"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+func TestRequestLoggingIntegration(t *testing.T) {
+	t.Parallel()
+	t.Run("Log requests under an assigned or propagated request id", logRequestsWithRequestID)
+}
+
+func logRequestsWithRequestID(t *testing.T) {
+	t.Parallel()
+	documentTestUUID := uuid.MustParse("b66fd223-515f-4503-80cc-2bdaa50ef474")
+	ownerTestUUID := uuid.MustParse("ea167a48-c1b3-46c4-911b-090e807132fc")
+
+	ctx := context.Background()
+	ctr, err := testutil.CreateTestContainerPostgresWithInitFileName(ctx, dbUser, dbPassword, "OneDocumentTableEntry")
+	require.NoError(t, err)
+	defer testcontainers.TerminateContainer(ctr)
+
+	connectionString, err := ctr.ConnectionString(ctx, "sslmode=disable")
+	require.NoError(t, err)
+
+	var buffer bytes.Buffer
+	logger := logging.New(&buffer, slog.LevelDebug)
+	dbHandle := postgres2.DatabaseHandler{DbConfig: postgres2.ConfigForDatabase{ConUrl: connectionString}}
+	documentCtrl := &v1.DocumentController{DocumentRepository: postgres2.NewDocumentRepository(dbHandle)}
+	router := v1.SetupRouter(documentCtrl, nil, nil, v1.WithMiddleware(v1.RequestLogging(logger, v1.DefaultRequestLogLevels)))
+
+	request := func(target, requestId string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", target, nil)
+		if requestId != "" {
+			r.Header.Set("X-Request-ID", requestId)
+		}
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	w := request("/api/v1/documents/?documentUUID="+documentTestUUID.String()+"&ownerUUID="+ownerTestUUID.String(), "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assignedId, err := uuid.Parse(w.Header().Get("X-Request-ID"))
+	require.NoError(t, err, "a request without an id is given one")
+
+	w = request("/api/v1/documents/?documentUUID="+uuid.NewString()+"&ownerUUID="+ownerTestUUID.String(), "client-id-1")
+	require.Equal(t, http.StatusNotFound, w.Code, w.Body.String())
+	assert.Equal(t, "client-id-1", w.Header().Get("X-Request-ID"), "the id of the client is kept")
+
+	w = request("/api/v1/documents/?ownerUUID="+ownerTestUUID.String(), "not a valid id")
+	assert.NotEqual(t, "not a valid id", w.Header().Get("X-Request-ID"))
+
+	bodyOwnerUUID := uuid.New()
+	w = httptest.NewRecorder()
+	upload := httptest.NewRequest("POST", "/api/v1/documents/", strings.NewReader(`{"documentBase64String": "THIS IS A TEST DOCUMENT", "ownerUUID": "`+bodyOwnerUUID.String()+`"}`))
+	upload.Header.Set("X-Request-ID", "upload-id")
+	router.ServeHTTP(w, upload)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	lines := make([]map[string]any, 0)
+	scanner := bufio.NewScanner(strings.NewReader(buffer.String()))
+	for scanner.Scan() {
+		line := map[string]any{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		lines = append(lines, line)
+	}
+
+	handled := func(requestId string) map[string]any {
+		for _, line := range lines {
+			if line["msg"] == "request handled" && line["requestId"] == requestId {
+				return line
+			}
+		}
+		return nil
+	}
+
+	found := handled(assignedId.String())
+	require.NotNil(t, found)
+	assert.Equal(t, "INFO", found["level"])
+	assert.Equal(t, "GET", found["method"])
+	assert.Equal(t, "/api/v1/documents/", found["route"])
+	assert.EqualValues(t, http.StatusOK, found["status"])
+	assert.Equal(t, ownerTestUUID.String(), found["ownerUUID"])
+	assert.Contains(t, found, "latency")
+
+	missing := handled("client-id-1")
+	require.NotNil(t, missing)
+	assert.Equal(t, "WARN", missing["level"])
+	assert.EqualValues(t, http.StatusNotFound, missing["status"])
+
+	uploaded := handled("upload-id")
+	require.NotNil(t, uploaded)
+	assert.Equal(t, bodyOwnerUUID.String(), uploaded["ownerUUID"], "an owner sent in the body is logged")
+
+	databaseCalls := 0
+	for _, line := range lines {
+		if line["requestId"] == "client-id-1" && strings.HasPrefix(line["msg"].(string), "database call") {
+			databaseCalls++
+		}
+	}
+	assert.Positive(t, databaseCalls, "the repository logs under the id of the request")
+}
@@ -1,15 +1,24 @@
 package integration
 
 import (
+	"archive/zip"
+	"bytes"
 	"context"
 	"database/sql"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	v1 "pdf_service_api/controller/v1"
 	"pdf_service_api/models"
+	"pdf_service_api/service/imaging"
+	"pdf_service_api/service/pdf"
 	postgres2 "pdf_service_api/service/postgres"
 	"pdf_service_api/testutil"
 	"strings"
@@ -21,6 +30,18 @@ import (
 	"github.com/testcontainers/testcontainers-go"
 )
 
+// selectionOwnerUUID owns the document of the selection fixtures.
+const selectionOwnerUUID = "ea167a48-c1b3-46c4-911b-090e807132fc"
+
+// asOwner adds the owner of the fixture document to the query of a request target.
+func asOwner(target string) string {
+	if strings.Contains(target, "?") {
+		return target + "&ownerUUID=" + selectionOwnerUUID
+	}
+
+	return target + "?ownerUUID=" + selectionOwnerUUID
+}
+
 func TestSelectionsIntegration(t *testing.T) {
 	t.Parallel()
 	t.Run("Get selection from a present document uuid", getSelectionsFromPresentDocumentUUID)
@@ -35,12 +56,32 @@ func TestSelectionsIntegration(t *testing.T) {
 	t.Run("Checks that the route fails correctly, providing the correct information", CreateNewSelectionWithCoordinatesBulkFailure)
 	t.Run("Create new selection that includes a page key", CreateNewSelectionWithPageKey)
 	t.Run("Create new selection that includes some coordinates", CreateNewSelectionWithCoordinates)
+	t.Run("Extract the text of a selection", extractSelectionText)
+	t.Run("Extract the text of a selection on a page keyed other than by its number", extractSelectionTextOfKeyedPage)
+	t.Run("Create typed selections and filter them by type", createTypedSelectionsAndFilterByType)
+	t.Run("Reject selections with invalid attributes", createSelectionWithInvalidAttributes)
+	t.Run("Update a selection with put and patch", updateSelection)
+	t.Run("Reject stale changes of a selection with If-Match", updateSelectionWithIfMatch)
+	t.Run("Evaluate or reject If-Match on changes of many selections", changeSelectionListWithIfMatch)
+	t.Run("Update selections in bulk", updateSelectionBulk)
+	t.Run("Create selections in bulk with per item results", createSelectionBulkPerItem)
+	t.Run("Delete selections in bulk all or nothing", deleteSelectionBulk)
+	t.Run("Replace the selections of a page", replaceSelectionsOfPage)
+	t.Run("Validate and convert coordinates against the page geometry", selectionCoordinatesAgainstPageGeometry)
+	t.Run("Accept pdf coordinates on pages without a size", selectionCoordinatesWithoutPageSize)
+	t.Run("Deny access to selections of other owners unless shared", selectionAccessAcrossOwners)
+	t.Run("Export selections as csv, xfdf and json", exportSelections)
+	t.Run("Import selections from xfdf and report skipped annotations", importSelectionsFromXfdf)
+	t.Run("Save selection templates in versions and apply them to other documents", saveAndApplySelectionTemplates)
+	t.Run("Query selections by page, rectangle and distance", spatialSelectionQueries)
+	t.Run("Redact a document into a derived document", redactDocumentFromRedactionSelections)
+	t.Run("Crop selections out of their page images", cropSelectionImages)
 }
 
 func getSelectionFromPresentSelectionUUID(t *testing.T) {
 	t.Parallel()
 	testDocumentUuidString := "a5fdea38-0a86-4c19-ae4f-c87a01bc860d"
-	expectedJsonResponse := `{"selections":[{"selectionUUID":"a5fdea38-0a86-4c19-ae4f-c87a01bc860d","documentUUID":"b66fd223-515f-4503-80cc-2bdaa50ef474"}]}`
+	expectedJsonResponse := `{"selections":[{"selectionUUID":"a5fdea38-0a86-4c19-ae4f-c87a01bc860d","documentUUID":"b66fd223-515f-4503-80cc-2bdaa50ef474","version":1}]}`
 
 	ctx := context.Background()
 	ctr, err := testutil.CreateTestContainerPostgresWithInitFileName(ctx, dbUser, dbPassword, "OneDocumentTableEntryAndTwoSelections")
@@ -57,7 +98,7 @@ func getSelectionFromPresentSelectionUUID(t *testing.T) {
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, httptest.NewRequest(
 		"GET",
-		fmt.Sprintf("/api/v1/selections/?selectionUUID=%s", testDocumentUuidString),
+		asOwner(fmt.Sprintf("/api/v1/selections/?selectionUUID=%s", testDocumentUuidString)),
 		nil,
 	))
 
@@ -71,7 +112,7 @@ func getSelectionFromPresentSelectionUUID(t *testing.T) {
 func getSelectionsFromPresentDocumentUUID(t *testing.T) {
 	t.Parallel()
 	testDocumentUuidString := "b66fd223-515f-4503-80cc-2bdaa50ef474"
-	expectedJsonResponse := `{"selections":[{"selectionUUID":"a5fdea38-0a86-4c19-ae4f-c87a01bc860d","documentUUID":"b66fd223-515f-4503-80cc-2bdaa50ef474"},{"selectionUUID":"335a6b95-6707-4e2b-9c37-c76d017f6f97","documentUUID":"b66fd223-515f-4503-80cc-2bdaa50ef474"}]}`
+	expectedJsonResponse := `{"selections":[{"selectionUUID":"a5fdea38-0a86-4c19-ae4f-c87a01bc860d","documentUUID":"b66fd223-515f-4503-80cc-2bdaa50ef474","version":1},{"selectionUUID":"335a6b95-6707-4e2b-9c37-c76d017f6f97","documentUUID":"b66fd223-515f-4503-80cc-2bdaa50ef474","version":1}]}`
 
 	ctx := context.Background()
 	ctr, err := testutil.CreateTestContainerPostgresWithInitFileName(ctx, dbUser, dbPassword, "OneDocumentTableEntryAndTwoSelections")
@@ -88,7 +129,7 @@ func getSelectionsFromPresentDocumentUUID(t *testing.T) {
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, httptest.NewRequest(
 		"GET",
-		fmt.Sprintf("/api/v1/selections/?documentUUID=%s", testDocumentUuidString),
+		asOwner(fmt.Sprintf("/api/v1/selections/?documentUUID=%s", testDocumentUuidString)),
 		nil,
 	))
 
@@ -101,7 +142,7 @@ func getSelectionsFromPresentDocumentUUID(t *testing.T) {
 func getSelectionsFromNonExistentDocumentUUID(t *testing.T) {
 	t.Parallel()
 	testDocumentUuidString := uuid.Nil.String()
-	expectedJsonResponse := `{"selections":[]}`
+	expectedJsonResponse := `{"error":"document not found"}`
 
 	ctx := context.Background()
 	ctr, err := testutil.CreateTestContainerPostgresWithInitFileName(ctx, dbUser, dbPassword, "OneDocumentTableEntry")
@@ -118,20 +159,18 @@ func getSelectionsFromNonExistentDocumentUUID(t *testing.T) {
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, httptest.NewRequest(
 		"GET",
-		fmt.Sprintf("/api/v1/selections/?documentUUID=%s", testDocumentUuidString),
+		asOwner(fmt.Sprintf("/api/v1/selections/?documentUUID=%s", testDocumentUuidString)),
 		nil,
 	))
 
-	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
-	assert.NotNil(t, w.Body.String())
-	assert.NotContains(t, w.Body.String(), "error")
+	assert.Equal(t, http.StatusNotFound, w.Result().StatusCode)
 	assert.Equal(t, expectedJsonResponse, w.Body.String(), "Body does not match expected output.")
 }
 
 func getSelectionsFromInvalidDocumentUUID(t *testing.T) {
 	t.Parallel()
 	testDocumentUuidString := uuid.New().String()
-	expectedJsonResponse := `{"selections":[]}`
+	expectedJsonResponse := `{"error":"document not found"}`
 
 	ctx := context.Background()
 	ctr, err := testutil.CreateTestContainerPostgresWithInitFileName(ctx, dbUser, dbPassword, "OneDocumentTableEntry")
@@ -148,14 +187,12 @@ func getSelectionsFromInvalidDocumentUUID(t *testing.T) {
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, httptest.NewRequest(
 		"GET",
-		fmt.Sprintf("/api/v1/selections/?documentUUID=%s", testDocumentUuidString),
+		asOwner(fmt.Sprintf("/api/v1/selections/?documentUUID=%s", testDocumentUuidString)),
 		nil,
 	))
 
 	fmt.Println(w.Body.String())
-	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
-	assert.NotNil(t, w.Body.String())
-	assert.NotContains(t, w.Body.String(), "error")
+	assert.Equal(t, http.StatusNotFound, w.Result().StatusCode)
 	assert.Equal(t, expectedJsonResponse, w.Body.String(), "Body does not match expected output.")
 }
 
@@ -177,7 +214,7 @@ func deleteSelectionsBySelectionUUID(t *testing.T) {
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, httptest.NewRequest(
 		"DELETE",
-		fmt.Sprintf("/api/v1/selections/?selectionUUID=%s", "a5fdea38-0a86-4c19-ae4f-c87a01bc860d"),
+		asOwner(fmt.Sprintf("/api/v1/selections/?selectionUUID=%s", "a5fdea38-0a86-4c19-ae4f-c87a01bc860d")),
 		nil,
 	))
 
@@ -204,7 +241,7 @@ func deleteSelectionsByDocumentUUID(t *testing.T) {
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, httptest.NewRequest(
 		"DELETE",
-		fmt.Sprintf("/api/v1/selections/?documentUUID=%s", documentTestUUID),
+		asOwner(fmt.Sprintf("/api/v1/selections/?documentUUID=%s", documentTestUUID)),
 		nil,
 	))
 
@@ -243,12 +280,12 @@ func deleteDelectionByNonexistentSelectionUUID(t *testing.T) {
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, httptest.NewRequest(
 		"DELETE",
-		fmt.Sprintf("/api/v1/selections/?selectionUUID=%s", uuid.New().String()),
+		asOwner(fmt.Sprintf("/api/v1/selections/?selectionUUID=%s", uuid.New().String())),
 		nil,
 	))
 
 	fmt.Println(w.Body.String())
-	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.Equal(t, http.StatusNotFound, w.Result().StatusCode)
 }
 
 func createNewSelection(t *testing.T) {
@@ -275,7 +312,7 @@ func createNewSelection(t *testing.T) {
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, httptest.NewRequest(
 		"POST",
-		"/api/v1/selections/",
+		asOwner("/api/v1/selections/"),
 		strings.NewReader(string(requestJSON)),
 	))
 
@@ -308,7 +345,7 @@ func CreateNewSelectionWithPageKey(t *testing.T) {
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, httptest.NewRequest(
 		"POST",
-		"/api/v1/selections/",
+		asOwner("/api/v1/selections/"),
 		strings.NewReader(string(requestJSON)),
 	))
 
@@ -346,7 +383,7 @@ func CreateNewSelectionWithCoordinates(t *testing.T) {
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, httptest.NewRequest(
 		"POST",
-		"/api/v1/selections/",
+		asOwner("/api/v1/selections/"),
 		strings.NewReader(string(requestJSON)),
 	))
 
@@ -363,10 +400,11 @@ func CreateNewSelectionWithCoordinates(t *testing.T) {
 		return nil
 	})
 
-	assert.Equal(t, request.Coordinates.X1, storedCoordinates.X1)
-	assert.Equal(t, request.Coordinates.X2, storedCoordinates.X2)
-	assert.Equal(t, request.Coordinates.Y1, storedCoordinates.Y1)
-	assert.Equal(t, request.Coordinates.Y2, storedCoordinates.Y2)
+	// The corners are stored normalized, with the smaller values first.
+	assert.Equal(t, request.Coordinates.X2, storedCoordinates.X1)
+	assert.Equal(t, request.Coordinates.X1, storedCoordinates.X2)
+	assert.Equal(t, request.Coordinates.Y2, storedCoordinates.Y1)
+	assert.Equal(t, request.Coordinates.Y1, storedCoordinates.Y2)
 }
 
 func CreateNewSelectionWithCoordinatesBulk(t *testing.T) {
@@ -410,7 +448,7 @@ func CreateNewSelectionWithCoordinatesBulk(t *testing.T) {
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, httptest.NewRequest(
 		"POST",
-		"/api/v1/selections/bulk",
+		asOwner("/api/v1/selections/bulk"),
 		strings.NewReader(string(requestJSON)),
 	))
 	assert.Equal(t, http.StatusCreated, w.Result().StatusCode)
@@ -468,7 +506,7 @@ func CreateNewSelectionWithCoordinatesBulkFailure(t *testing.T) {
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, httptest.NewRequest(
 		"POST",
-		"/api/v1/selections/bulk",
+		asOwner("/api/v1/selections/bulk"),
 		strings.NewReader(string(requestJSON)),
 	))
 
@@ -487,3 +525,1238 @@ func CreateNewSelectionWithCoordinatesBulkFailure(t *testing.T) {
 		return nil
 	})
 }
+
+func extractSelectionText(t *testing.T) {
+	t.Parallel()
+	documentUUID := uuid.New()
+	ownerUUID := uuid.New()
+	selectionUUID := uuid.New()
+
+	ctx := context.Background()
+	ctr, err := testutil.CreateTestContainerPostgresWithInitFileName(ctx, dbUser, dbPassword, "OneDocumentTableEntry")
+	require.NoError(t, err)
+	defer testcontainers.TerminateContainer(ctr)
+
+	connectionString, err := ctr.ConnectionString(ctx, "sslmode=disable")
+	require.NoError(t, err)
+
+	dbHandle := postgres2.DatabaseHandler{DbConfig: postgres2.ConfigForDatabase{ConUrl: connectionString}}
+	documentRepository := postgres2.NewDocumentRepository(dbHandle)
+	selectionRepository := postgres2.NewSelectionRepository(dbHandle)
+
+	pdfBase64 := testutil.HundredPagesPdfInBase64
+	ownerType := 1
+	require.NoError(t, documentRepository.UploadDocument(models.Document{
+		Uuid:      documentUUID,
+		OwnerUUID: &ownerUUID,
+		OwnerType: &ownerType,
+		PdfBase64: &pdfBase64,
+	}))
+
+	pageKey := "0"
+	require.NoError(t, selectionRepository.AddNewSelection(models.Selection{
+		Uuid:         selectionUUID,
+		DocumentUUID: &documentUUID,
+		PageKey:      &pageKey,
+		Coordinates:  &models.Coordinates{X1: 0, Y1: 0, X2: 612, Y2: 792},
+	}, ownerUUID))
+
+	selectionCtrl := &v1.SelectionController{
+		SelectionRepository: selectionRepository,
+		DocumentRepository:  documentRepository,
+		TextExtractor:       pdf.NewExtractor(),
+	}
+	router := v1.SetupRouter(nil, selectionCtrl, nil)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(
+		"POST",
+		fmt.Sprintf("/api/v1/selections/%s/text?ownerUUID=%s", selectionUUID, ownerUUID),
+		nil,
+	))
+	require.Equal(t, http.StatusOK, w.Result().StatusCode, w.Body.String())
+
+	response := struct {
+		ExtractedText string `json:"extractedText"`
+	}{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.NotEmpty(t, response.ExtractedText)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(
+		"GET",
+		fmt.Sprintf("/api/v1/selections/?selectionUUID=%s&ownerUUID=%s", selectionUUID, ownerUUID),
+		nil,
+	))
+
+	selections := struct {
+		Selections []models.Selection `json:"selections"`
+	}{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &selections))
+	require.Len(t, selections.Selections, 1)
+	assert.Equal(t, response.ExtractedText, *selections.Selections[0].ExtractedText)
+	assert.NotNil(t, selections.Selections[0].TextExtractedAt)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(
+		"POST",
+		fmt.Sprintf("/api/v1/selections/%s/text?ownerUUID=%s", selectionUUID, uuid.New()),
+		nil,
+	))
+	assert.Equal(t, http.StatusNotFound, w.Result().StatusCode)
+}
+
+// recordingTextExtractor remembers the page it was asked to extract text from.
+type recordingTextExtractor struct {
+	pageNumber uint32
+}
+
+func (r *recordingTextExtractor) ExtractText(_ context.Context, _ io.ReadSeeker, pageNumber uint32, _ models.Coordinates) (string, error) {
+	r.pageNumber = pageNumber
+	return "Appendix", nil
+}
+
+func extractSelectionTextOfKeyedPage(t *testing.T) {
+	t.Parallel()
+	documentTestUUID := uuid.MustParse("b66fd223-515f-4503-80cc-2bdaa50ef474")
+	selectionUUID := uuid.New()
+
+	ctx := context.Background()
+	ctr, err := testutil.CreateTestContainerPostgresWithInitFileName(ctx, dbUser, dbPassword, "TwoDocumentsWithDifferentPageSizes")
+	require.NoError(t, err)
+	defer testcontainers.TerminateContainer(ctr)
+
+	connectionString, err := ctr.ConnectionString(ctx, "sslmode=disable")
+	require.NoError(t, err)
+
+	dbHandle := postgres2.DatabaseHandler{DbConfig: postgres2.ConfigForDatabase{ConUrl: connectionString}}
+	require.NoError(t, dbHandle.WithConnection(func(db *sql.DB) error {
+		_, err := db.Exec(`insert into documentpage_table ("Document_UUID", "Page_Number", "Page_Key", "Media_Box") values ($1, 2, 'appendix', '[0, 0, 612, 792]')`, documentTestUUID)
+		return err
+	}))
+
+	selectionRepository := postgres2.NewSelectionRepository(dbHandle)
+	pageKey := "appendix"
+	require.NoError(t, selectionRepository.AddNewSelection(models.Selection{
+		Uuid:         selectionUUID,
+		DocumentUUID: &documentTestUUID,
+		PageKey:      &pageKey,
+		Coordinates:  &models.Coordinates{X1: 72, Y1: 72, X2: 540, Y2: 144},
+	}, uuid.MustParse(selectionOwnerUUID)))
+
+	extractor := &recordingTextExtractor{}
+	selectionCtrl := &v1.SelectionController{
+		SelectionRepository: selectionRepository,
+		DocumentRepository:  postgres2.NewDocumentRepository(dbHandle),
+		MetaRepository:      postgres2.NewMetaRepository(dbHandle),
+		TextExtractor:       extractor,
+	}
+
+	w := httptest.NewRecorder()
+	v1.SetupRouter(nil, selectionCtrl, nil).ServeHTTP(w, httptest.NewRequest("POST", asOwner("/api/v1/selections/"+selectionUUID.String()+"/text"), nil))
+	require.Equal(t, http.StatusOK, w.Result().StatusCode, w.Body.String())
+	assert.EqualValues(t, 2, extractor.pageNumber, "the page number is looked up by the page key")
+}
+
+func createTypedSelectionsAndFilterByType(t *testing.T) {
+	t.Parallel()
+	documentTestUUID := uuid.MustParse("b66fd223-515f-4503-80cc-2bdaa50ef474")
+	authorUUID := uuid.New()
+
+	ctx := context.Background()
+	ctr, err := testutil.CreateTestContainerPostgresWithInitFileName(ctx, dbUser, dbPassword, "OneDocumentTableEntryAndTwoSelections")
+	require.NoError(t, err)
+	defer testcontainers.TerminateContainer(ctr)
+
+	connectionString, err := ctr.ConnectionString(ctx, "sslmode=disable")
+	require.NoError(t, err)
+
+	dbHandle := postgres2.DatabaseHandler{DbConfig: postgres2.ConfigForDatabase{ConUrl: connectionString}}
+	selectionCtrl := &v1.SelectionController{SelectionRepository: postgres2.NewSelectionRepository(dbHandle)}
+	router := v1.SetupRouter(nil, selectionCtrl, nil)
+
+	highlight, redaction := models.SelectionTypeHighlight, models.SelectionTypeRedaction
+	label, note, color := "Total", "Check the sum", "#FFD700"
+	request := []v1.AddNewSelectionRequest{
+		{DocumentUUID: &documentTestUUID, Type: &highlight, Label: &label, Note: &note, Color: &color, AuthorUUID: &authorUUID},
+		{DocumentUUID: &documentTestUUID, Type: &redaction},
+	}
+
+	requestJSON, _ := json.Marshal(request)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(
+		"POST",
+		asOwner("/api/v1/selections/bulk"),
+		strings.NewReader(string(requestJSON)),
+	))
+	require.Equal(t, http.StatusCreated, w.Result().StatusCode, w.Body.String())
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(
+		"GET",
+		asOwner(fmt.Sprintf("/api/v1/selections/?documentUUID=%s&type=highlight", documentTestUUID)),
+		nil,
+	))
+	require.Equal(t, http.StatusOK, w.Result().StatusCode)
+
+	response := struct {
+		Selections []models.Selection `json:"selections"`
+	}{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.Selections, 1)
+
+	selection := response.Selections[0]
+	assert.Equal(t, highlight, *selection.Type)
+	assert.Equal(t, label, *selection.Label)
+	assert.Equal(t, note, *selection.Note)
+	assert.Equal(t, color, *selection.Color)
+	assert.Equal(t, authorUUID, *selection.AuthorUUID)
+	require.NotNil(t, selection.CreatedAt)
+	assert.Equal(t, *selection.CreatedAt, *selection.UpdatedAt)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(
+		"GET",
+		asOwner(fmt.Sprintf("/api/v1/selections/?documentUUID=%s&type=highlight,redaction", documentTestUUID)),
+		nil,
+	))
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(t, response.Selections, 2)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(
+		"GET",
+		asOwner(fmt.Sprintf("/api/v1/selections/?documentUUID=%s", documentTestUUID)),
+		nil,
+	))
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(t, response.Selections, 4)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(
+		"GET",
+		asOwner(fmt.Sprintf("/api/v1/selections/?documentUUID=%s&type=circle", documentTestUUID)),
+		nil,
+	))
+	assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+}
+
+func createSelectionWithInvalidAttributes(t *testing.T) {
+	t.Parallel()
+	documentTestUUID := uuid.MustParse("b66fd223-515f-4503-80cc-2bdaa50ef474")
+
+	ctx := context.Background()
+	ctr, err := testutil.CreateTestContainerPostgresWithInitFileName(ctx, dbUser, dbPassword, "OneDocumentTableEntry")
+	require.NoError(t, err)
+	defer testcontainers.TerminateContainer(ctr)
+
+	connectionString, err := ctr.ConnectionString(ctx, "sslmode=disable")
+	require.NoError(t, err)
+
+	dbHandle := postgres2.DatabaseHandler{DbConfig: postgres2.ConfigForDatabase{ConUrl: connectionString}}
+	selectionCtrl := &v1.SelectionController{SelectionRepository: postgres2.NewSelectionRepository(dbHandle)}
+	router := v1.SetupRouter(nil, selectionCtrl, nil)
+
+	bodies := []string{
+		fmt.Sprintf(`{"documentUUID": "%s", "type": "circle"}`, documentTestUUID),
+		fmt.Sprintf(`{"documentUUID": "%s", "color": "gold"}`, documentTestUUID),
+		fmt.Sprintf(`{"documentUUID": "%s", "label": "%s"}`, documentTestUUID, strings.Repeat("a", 257)),
+		`{"type": "note"}`,
+	}
+
+	for _, body := range bodies {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", asOwner("/api/v1/selections/"), strings.NewReader(body)))
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode, body)
+	}
+
+	_ = dbHandle.WithConnection(func(db *sql.DB) error {
+		count := 0
+		require.NoError(t, db.QueryRow(`SELECT count(*) FROM selection_table`).Scan(&count))
+		assert.Equal(t, 0, count)
+		return nil
+	})
+}
+
+func updateSelection(t *testing.T) {
+	t.Parallel()
+	selectionUUID := "a5fdea38-0a86-4c19-ae4f-c87a01bc860d"
+
+	ctx := context.Background()
+	ctr, err := testutil.CreateTestContainerPostgresWithInitFileName(ctx, dbUser, dbPassword, "OneDocumentTableEntryAndTwoSelections")
+	require.NoError(t, err)
+	defer testcontainers.TerminateContainer(ctr)
+
+	connectionString, err := ctr.ConnectionString(ctx, "sslmode=disable")
+	require.NoError(t, err)
+
+	dbHandle := postgres2.DatabaseHandler{DbConfig: postgres2.ConfigForDatabase{ConUrl: connectionString}}
+	selectionCtrl := &v1.SelectionController{SelectionRepository: postgres2.NewSelectionRepository(dbHandle)}
+	router := v1.SetupRouter(nil, selectionCtrl, nil)
+
+	response := struct {
+		Selection models.Selection `json:"selection"`
+	}{}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(
+		"PUT",
+		asOwner("/api/v1/selections/"+selectionUUID),
+		strings.NewReader(`{"pageKey": "1", "coordinates": {"x1": 1, "y1": 2, "x2": 3, "y2": 4}, "label": "Total"}`),
+	))
+	require.Equal(t, http.StatusOK, w.Result().StatusCode, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, selectionUUID, response.Selection.Uuid.String())
+	assert.Equal(t, "1", *response.Selection.PageKey)
+	assert.Equal(t, models.Coordinates{X1: 1, Y1: 2, X2: 3, Y2: 4}, *response.Selection.Coordinates)
+	assert.Equal(t, "Total", *response.Selection.Label)
+	assert.NotNil(t, response.Selection.UpdatedAt)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(
+		"PATCH",
+		asOwner("/api/v1/selections/"+selectionUUID),
+		strings.NewReader(`{"coordinates": {"x1": 10, "y1": 20, "x2": 30, "y2": 40}}`),
+	))
+	require.Equal(t, http.StatusOK, w.Result().StatusCode, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, models.Coordinates{X1: 10, Y1: 20, X2: 30, Y2: 40}, *response.Selection.Coordinates)
+	assert.Equal(t, "Total", *response.Selection.Label)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(
+		"PUT",
+		asOwner("/api/v1/selections/"+selectionUUID),
+		strings.NewReader(`{"pageKey": "1"}`),
+	))
+	require.Equal(t, http.StatusOK, w.Result().StatusCode, w.Body.String())
+	response.Selection = models.Selection{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Nil(t, response.Selection.Coordinates)
+	assert.Nil(t, response.Selection.Label)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("PATCH", asOwner("/api/v1/selections/"+uuid.NewString()), strings.NewReader(`{"label": "x"}`)))
+	assert.Equal(t, http.StatusNotFound, w.Result().StatusCode)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("PATCH", asOwner("/api/v1/selections/"+selectionUUID), strings.NewReader(`{"color": "red"}`)))
+	assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+}
+
+func updateSelectionWithIfMatch(t *testing.T) {
+	t.Parallel()
+	selectionUUID := "a5fdea38-0a86-4c19-ae4f-c87a01bc860d"
+
+	ctx := context.Background()
+	ctr, err := testutil.CreateTestContainerPostgresWithInitFileName(ctx, dbUser, dbPassword, "OneDocumentTableEntryAndTwoSelections")
+	require.NoError(t, err)
+	defer testcontainers.TerminateContainer(ctr)
+
+	connectionString, err := ctr.ConnectionString(ctx, "sslmode=disable")
+	require.NoError(t, err)
+
+	dbHandle := postgres2.DatabaseHandler{DbConfig: postgres2.ConfigForDatabase{ConUrl: connectionString}}
+	selectionCtrl := &v1.SelectionController{SelectionRepository: postgres2.NewSelectionRepository(dbHandle)}
+	router := v1.SetupRouter(nil, selectionCtrl, nil)
+
+	request := func(method, target, body string, headers map[string]string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, asOwner(target), strings.NewReader(body))
+		for name, value := range headers {
+			r.Header.Set(name, value)
+		}
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	w := request("GET", "/api/v1/selections/?selectionUUID="+selectionUUID, "", nil)
+	require.Equal(t, http.StatusOK, w.Result().StatusCode, w.Body.String())
+	read := w.Header().Get("ETag")
+	assert.Equal(t, `"1"`, read)
+
+	w = request("GET", "/api/v1/selections/?selectionUUID="+selectionUUID, "", map[string]string{"If-None-Match": read})
+	assert.Equal(t, http.StatusNotModified, w.Result().StatusCode)
+	assert.Empty(t, w.Body.String())
+
+	listed := request("GET", "/api/v1/selections/?documentUUID=b66fd223-515f-4503-80cc-2bdaa50ef474", "", nil).Header().Get("ETag")
+	require.NotEmpty(t, listed)
+
+	w = request("PATCH", "/api/v1/selections/"+selectionUUID, `{"label": "First reviewer"}`, map[string]string{"If-Match": read})
+	require.Equal(t, http.StatusOK, w.Result().StatusCode, w.Body.String())
+	updated := w.Header().Get("ETag")
+	assert.Equal(t, `"2"`, updated)
+
+	w = request("PATCH", "/api/v1/selections/"+selectionUUID, `{"label": "Second reviewer"}`, map[string]string{"If-Match": read})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Result().StatusCode, "the second reviewer edited a stale version")
+
+	w = request("GET", "/api/v1/selections/?selectionUUID="+selectionUUID, "", map[string]string{"If-None-Match": read})
+	require.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.Contains(t, w.Body.String(), "First reviewer", "the stale change was not applied")
+	assert.NotEqual(t, listed, request("GET", "/api/v1/selections/?documentUUID=b66fd223-515f-4503-80cc-2bdaa50ef474", "", nil).Header().Get("ETag"))
+
+	assert.Equal(t, http.StatusPreconditionFailed, request("PUT", "/api/v1/selections/"+selectionUUID, `{}`, map[string]string{"If-Match": `W/"2"`}).Result().StatusCode)
+	assert.Equal(t, http.StatusNotFound, request("PATCH", "/api/v1/selections/"+uuid.NewString(), `{"label": "x"}`, map[string]string{"If-Match": updated}).Result().StatusCode)
+
+	w = request("DELETE", "/api/v1/selections/?selectionUUID="+selectionUUID, "", map[string]string{"If-Match": read})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Result().StatusCode)
+
+	w = request("DELETE", "/api/v1/selections/?selectionUUID="+selectionUUID, "", map[string]string{"If-Match": updated})
+	require.Equal(t, http.StatusOK, w.Result().StatusCode, w.Body.String())
+	assert.Equal(t, 1, countSelections(t, dbHandle, "b66fd223-515f-4503-80cc-2bdaa50ef474"))
+}
+
+func changeSelectionListWithIfMatch(t *testing.T) {
+	t.Parallel()
+	documentUUID, selectionUUID := "b66fd223-515f-4503-80cc-2bdaa50ef474", "a5fdea38-0a86-4c19-ae4f-c87a01bc860d"
+	listTarget := "/api/v1/selections/?documentUUID=" + documentUUID
+	replaceTarget := "/api/v1/selections/replace?documentUUID=" + documentUUID
+
+	ctx := context.Background()
+	ctr, err := testutil.CreateTestContainerPostgresWithInitFileName(ctx, dbUser, dbPassword, "OneDocumentTableEntryAndTwoSelections")
+	require.NoError(t, err)
+	defer testcontainers.TerminateContainer(ctr)
+
+	connectionString, err := ctr.ConnectionString(ctx, "sslmode=disable")
+	require.NoError(t, err)
+
+	dbHandle := postgres2.DatabaseHandler{DbConfig: postgres2.ConfigForDatabase{ConUrl: connectionString}}
+	selectionCtrl := &v1.SelectionController{SelectionRepository: postgres2.NewSelectionRepository(dbHandle)}
+	router := v1.SetupRouter(nil, selectionCtrl, nil)
+
+	request := func(method, target, body, ifMatch string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, asOwner(target), strings.NewReader(body))
+		if ifMatch != "" {
+			r.Header.Set("If-Match", ifMatch)
+		}
+		router.ServeHTTP(w, r)
+		return w
+	}
+	listETag := func() string {
+		w := request("GET", listTarget, "", "")
+		require.Equal(t, http.StatusOK, w.Result().StatusCode, w.Body.String())
+		return w.Header().Get("ETag")
+	}
+
+	listed := listETag()
+	bulkUpdate := fmt.Sprintf(`[{"selectionUUID": %q, "label": "Bulk"}]`, selectionUUID)
+	for _, method := range []string{"PUT", "PATCH"} {
+		assert.Equal(t, http.StatusPreconditionFailed, request(method, "/api/v1/selections/bulk", bulkUpdate, listed).Result().StatusCode, method)
+	}
+	assert.Equal(t, http.StatusPreconditionFailed, request("DELETE", "/api/v1/selections/bulk", fmt.Sprintf(`[%q]`, selectionUUID), listed).Result().StatusCode)
+	assert.Equal(t, http.StatusPreconditionFailed, request("POST", "/api/v1/selections/", fmt.Sprintf(`{"documentUUID": %q}`, documentUUID), listed).Result().StatusCode)
+	assert.Equal(t, listed, listETag(), "changes that do not evaluate If-Match are not made unconditionally")
+	assert.Equal(t, 2, countSelections(t, dbHandle, documentUUID))
+
+	w := request("PATCH", "/api/v1/selections/"+selectionUUID, `{"label": "Reviewed"}`, "")
+	require.Equal(t, http.StatusOK, w.Result().StatusCode, w.Body.String())
+
+	assert.Equal(t, http.StatusPreconditionFailed, request("PUT", replaceTarget, `[]`, listed).Result().StatusCode)
+	assert.Equal(t, http.StatusPreconditionFailed, request("DELETE", listTarget, "", listed).Result().StatusCode)
+	assert.Equal(t, 2, countSelections(t, dbHandle, documentUUID), "stale list changes were not applied")
+
+	current := listETag()
+	assert.Equal(t, http.StatusPreconditionFailed, request("PUT", replaceTarget, `[]`, "W/"+current).Result().StatusCode, "weak tags never match")
+	w = request("PUT", replaceTarget, `[]`, listed+", "+current)
+	require.Equal(t, http.StatusOK, w.Result().StatusCode, w.Body.String())
+	assert.Equal(t, 0, countSelections(t, dbHandle, documentUUID))
+
+	w = request("DELETE", listTarget, "", listETag())
+	require.Equal(t, http.StatusOK, w.Result().StatusCode, w.Body.String())
+	assert.Equal(t, http.StatusNotFound, request("DELETE", "/api/v1/selections/?documentUUID="+uuid.NewString(), "", current).Result().StatusCode)
+}
+
+func updateSelectionBulk(t *testing.T) {
+	t.Parallel()
+	firstUUID, secondUUID := "a5fdea38-0a86-4c19-ae4f-c87a01bc860d", "335a6b95-6707-4e2b-9c37-c76d017f6f97"
+
+	ctx := context.Background()
+	ctr, err := testutil.CreateTestContainerPostgresWithInitFileName(ctx, dbUser, dbPassword, "OneDocumentTableEntryAndTwoSelections")
+	require.NoError(t, err)
+	defer testcontainers.TerminateContainer(ctr)
+
+	connectionString, err := ctr.ConnectionString(ctx, "sslmode=disable")
+	require.NoError(t, err)
+
+	dbHandle := postgres2.DatabaseHandler{DbConfig: postgres2.ConfigForDatabase{ConUrl: connectionString}}
+	selectionCtrl := &v1.SelectionController{SelectionRepository: postgres2.NewSelectionRepository(dbHandle)}
+	router := v1.SetupRouter(nil, selectionCtrl, nil)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(
+		"PATCH",
+		asOwner("/api/v1/selections/bulk"),
+		strings.NewReader(fmt.Sprintf(`[{"selectionUUID": "%s", "pageKey": "3"}, {"selectionUUID": "%s", "type": "note"}]`, firstUUID, secondUUID)),
+	))
+	require.Equal(t, http.StatusOK, w.Result().StatusCode, w.Body.String())
+
+	response := struct {
+		Selections []models.Selection `json:"selections"`
+	}{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.Selections, 2)
+	assert.Equal(t, "3", *response.Selections[0].PageKey)
+	assert.Equal(t, models.SelectionTypeNote, *response.Selections[1].Type)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(
+		"PUT",
+		asOwner("/api/v1/selections/bulk"),
+		strings.NewReader(`[{"pageKey": "3"}]`),
+	))
+	assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+}
+
+func countSelections(t *testing.T, dbHandle postgres2.DatabaseHandler, documentUUID string) int {
+	count := 0
+	_ = dbHandle.WithConnection(func(db *sql.DB) error {
+		require.NoError(t, db.QueryRow(`SELECT count(*) FROM selection_table WHERE "Document_UUID" = $1`, documentUUID).Scan(&count))
+		return nil
+	})
+
+	return count
+}
+
+func createSelectionBulkPerItem(t *testing.T) {
+	t.Parallel()
+	documentTestUUID := "b66fd223-515f-4503-80cc-2bdaa50ef474"
+
+	ctx := context.Background()
+	ctr, err := testutil.CreateTestContainerPostgresWithInitFileName(ctx, dbUser, dbPassword, "OneDocumentTableEntry")
+	require.NoError(t, err)
+	defer testcontainers.TerminateContainer(ctr)
+
+	connectionString, err := ctr.ConnectionString(ctx, "sslmode=disable")
+	require.NoError(t, err)
+
+	dbHandle := postgres2.DatabaseHandler{DbConfig: postgres2.ConfigForDatabase{ConUrl: connectionString}}
+	selectionCtrl := &v1.SelectionController{SelectionRepository: postgres2.NewSelectionRepository(dbHandle)}
+	router := v1.SetupRouter(nil, selectionCtrl, nil)
+
+	body := fmt.Sprintf(`[{"documentUUID": "%s", "pageKey": "0"}, {"documentUUID": "%s"}, {"documentUUID": "%s", "color": "red"}]`,
+		documentTestUUID, uuid.NewString(), documentTestUUID)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", asOwner("/api/v1/selections/bulk?mode=perItem"), strings.NewReader(body)))
+	require.Equal(t, http.StatusMultiStatus, w.Result().StatusCode, w.Body.String())
+
+	response := struct {
+		Results []v1.BulkSelectionResult `json:"results"`
+	}{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.Results, 3)
+	assert.NotNil(t, response.Results[0].SelectionUUID)
+	assert.Nil(t, response.Results[0].Error)
+	assert.NotNil(t, response.Results[1].Error)
+	assert.NotNil(t, response.Results[2].Error)
+	assert.Equal(t, 1, countSelections(t, dbHandle, documentTestUUID))
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", asOwner("/api/v1/selections/bulk"), strings.NewReader(body)))
+	assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+	assert.Equal(t, 1, countSelections(t, dbHandle, documentTestUUID))
+}
+
+func deleteSelectionBulk(t *testing.T) {
+	t.Parallel()
+	documentTestUUID := "b66fd223-515f-4503-80cc-2bdaa50ef474"
+	firstUUID, secondUUID := "a5fdea38-0a86-4c19-ae4f-c87a01bc860d", "335a6b95-6707-4e2b-9c37-c76d017f6f97"
+
+	ctx := context.Background()
+	ctr, err := testutil.CreateTestContainerPostgresWithInitFileName(ctx, dbUser, dbPassword, "OneDocumentTableEntryAndTwoSelections")
+	require.NoError(t, err)
+	defer testcontainers.TerminateContainer(ctr)
+
+	connectionString, err := ctr.ConnectionString(ctx, "sslmode=disable")
+	require.NoError(t, err)
+
+	dbHandle := postgres2.DatabaseHandler{DbConfig: postgres2.ConfigForDatabase{ConUrl: connectionString}}
+	selectionCtrl := &v1.SelectionController{SelectionRepository: postgres2.NewSelectionRepository(dbHandle)}
+	router := v1.SetupRouter(nil, selectionCtrl, nil)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("DELETE", asOwner("/api/v1/selections/bulk"),
+		strings.NewReader(fmt.Sprintf(`{"selectionUUIDs": ["%s", "%s"]}`, firstUUID, uuid.NewString()))))
+	assert.Equal(t, http.StatusNotFound, w.Result().StatusCode)
+	assert.Equal(t, 2, countSelections(t, dbHandle, documentTestUUID))
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("DELETE", asOwner("/api/v1/selections/bulk"),
+		strings.NewReader(fmt.Sprintf(`{"selectionUUIDs": ["%s", "%s"]}`, firstUUID, secondUUID))))
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.Equal(t, 0, countSelections(t, dbHandle, documentTestUUID))
+}
+
+func replaceSelectionsOfPage(t *testing.T) {
+	t.Parallel()
+	documentTestUUID := "b66fd223-515f-4503-80cc-2bdaa50ef474"
+
+	ctx := context.Background()
+	ctr, err := testutil.CreateTestContainerPostgresWithInitFileName(ctx, dbUser, dbPassword, "OneDocumentTableEntry")
+	require.NoError(t, err)
+	defer testcontainers.TerminateContainer(ctr)
+
+	connectionString, err := ctr.ConnectionString(ctx, "sslmode=disable")
+	require.NoError(t, err)
+
+	dbHandle := postgres2.DatabaseHandler{DbConfig: postgres2.ConfigForDatabase{ConUrl: connectionString}}
+	selectionCtrl := &v1.SelectionController{SelectionRepository: postgres2.NewSelectionRepository(dbHandle)}
+	router := v1.SetupRouter(nil, selectionCtrl, nil)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", asOwner("/api/v1/selections/bulk"), strings.NewReader(fmt.Sprintf(
+		`[{"documentUUID": "%[1]s", "pageKey": "0"}, {"documentUUID": "%[1]s", "pageKey": "0"}, {"documentUUID": "%[1]s", "pageKey": "1"}]`, documentTestUUID))))
+	require.Equal(t, http.StatusCreated, w.Result().StatusCode, w.Body.String())
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("PUT",
+		asOwner(fmt.Sprintf("/api/v1/selections/replace?documentUUID=%s&pageKey=0", documentTestUUID)),
+		strings.NewReader(`[{"coordinates": {"x1": 1, "y1": 1, "x2": 2, "y2": 2}}]`)))
+	require.Equal(t, http.StatusOK, w.Result().StatusCode, w.Body.String())
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", asOwner(fmt.Sprintf("/api/v1/selections/?documentUUID=%s", documentTestUUID)), nil))
+	response := struct {
+		Selections []models.Selection `json:"selections"`
+	}{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.Selections, 2)
+
+	pageKeys := []string{*response.Selections[0].PageKey, *response.Selections[1].PageKey}
+	assert.ElementsMatch(t, []string{"0", "1"}, pageKeys)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("PUT",
+		asOwner(fmt.Sprintf("/api/v1/selections/replace?documentUUID=%s&pageKey=0", documentTestUUID)),
+		strings.NewReader(`[{"pageKey": "1"}]`)))
+	assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+	assert.Equal(t, 2, countSelections(t, dbHandle, documentTestUUID))
+}
+
+func selectionCoordinatesAgainstPageGeometry(t *testing.T) {
+	t.Parallel()
+	documentTestUUID := uuid.MustParse("b66fd223-515f-4503-80cc-2bdaa50ef474")
+
+	ctx := context.Background()
+	ctr, err := testutil.CreateTestContainerPostgresWithInitFileName(ctx, dbUser, dbPassword, "OneDocumentTableEntry")
+	require.NoError(t, err)
+	defer testcontainers.TerminateContainer(ctr)
+
+	connectionString, err := ctr.ConnectionString(ctx, "sslmode=disable")
+	require.NoError(t, err)
+
+	dbHandle := postgres2.DatabaseHandler{DbConfig: postgres2.ConfigForDatabase{ConUrl: connectionString}}
+	metaRepository := postgres2.NewMetaRepository(dbHandle)
+
+	numberOfPages, width, height, rotation := uint32(2), float32(612), float32(792), 90
+	require.NoError(t, metaRepository.AddMeta(models.Meta{
+		DocumentUUID:  documentTestUUID,
+		NumberOfPages: &numberOfPages,
+		Width:         &width,
+		Height:        &height,
+		Pages: []models.PageGeometry{
+			{PageNumber: 0, PageKey: "0", MediaBox: &models.Box{0, 0, 612, 792}},
+			{PageNumber: 1, PageKey: "1", MediaBox: &models.Box{0, 0, 612, 792}, Rotation: &rotation},
+		},
+	}))
+
+	selectionCtrl := &v1.SelectionController{SelectionRepository: postgres2.NewSelectionRepository(dbHandle), MetaRepository: metaRepository}
+	router := v1.SetupRouter(nil, selectionCtrl, nil)
+
+	post := func(query, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", asOwner("/api/v1/selections/"+query), strings.NewReader(body)))
+		return w
+	}
+
+	// The upper left inch of the page, given at 144 dpi.
+	w := post("?coordinateSpace=px&dpi=144", fmt.Sprintf(`{"documentUUID": "%s", "pageKey": "0", "coordinates": {"x1": 144, "y1": 144, "x2": 0, "y2": 0}}`, documentTestUUID))
+	require.Equal(t, http.StatusOK, w.Result().StatusCode, w.Body.String())
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", asOwner(fmt.Sprintf("/api/v1/selections/?documentUUID=%s", documentTestUUID)), nil))
+	response := struct {
+		Selections []models.Selection `json:"selections"`
+	}{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.Selections, 1)
+	assert.Equal(t, models.Coordinates{X1: 0, Y1: 720, X2: 72, Y2: 792}, *response.Selections[0].Coordinates)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", asOwner(fmt.Sprintf("/api/v1/selections/?documentUUID=%s&coordinateSpace=relative", documentTestUUID)), nil))
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.InDelta(t, 72.0/612, response.Selections[0].Coordinates.X2, 1e-9)
+	assert.InDelta(t, 72.0/792, response.Selections[0].Coordinates.Y2, 1e-9)
+
+	assert.Equal(t, http.StatusBadRequest, post("", fmt.Sprintf(`{"documentUUID": "%s", "pageKey": "5", "coordinates": {"x1": 1, "y1": 1, "x2": 2, "y2": 2}}`, documentTestUUID)).Result().StatusCode)
+	assert.Equal(t, http.StatusBadRequest, post("", fmt.Sprintf(`{"documentUUID": "%s", "pageKey": "1", "coordinates": {"x1": 0, "y1": 0, "x2": 800, "y2": 10}}`, documentTestUUID)).Result().StatusCode)
+	assert.Equal(t, http.StatusBadRequest, post("?coordinateSpace=px", fmt.Sprintf(`{"documentUUID": "%s", "pageKey": "0", "coordinates": {"x1": 0, "y1": 0, "x2": 1, "y2": 1}}`, documentTestUUID)).Result().StatusCode)
+	assert.Equal(t, http.StatusBadRequest, post("", fmt.Sprintf(`{"documentUUID": "%s", "pageKey": "cover"}`, documentTestUUID)).Result().StatusCode)
+	assert.Equal(t, http.StatusUnprocessableEntity, post("?coordinateSpace=relative", fmt.Sprintf(`{"documentUUID": "%s", "coordinates": {"x1": 0, "y1": 0, "x2": 1, "y2": 1}}`, documentTestUUID)).Result().StatusCode)
+}
+
+func selectionCoordinatesWithoutPageSize(t *testing.T) {
+	t.Parallel()
+	documentTestUUID := uuid.MustParse("b66fd223-515f-4503-80cc-2bdaa50ef474")
+
+	ctx := context.Background()
+	ctr, err := testutil.CreateTestContainerPostgresWithInitFileName(ctx, dbUser, dbPassword, "OneDocumentTableEntry")
+	require.NoError(t, err)
+	defer testcontainers.TerminateContainer(ctr)
+
+	connectionString, err := ctr.ConnectionString(ctx, "sslmode=disable")
+	require.NoError(t, err)
+
+	dbHandle := postgres2.DatabaseHandler{DbConfig: postgres2.ConfigForDatabase{ConUrl: connectionString}}
+	metaRepository := postgres2.NewMetaRepository(dbHandle)
+	require.NoError(t, metaRepository.AddMeta(models.Meta{
+		DocumentUUID: documentTestUUID,
+		Pages:        []models.PageGeometry{{PageNumber: 0, PageKey: "0"}},
+	}))
+
+	selectionCtrl := &v1.SelectionController{SelectionRepository: postgres2.NewSelectionRepository(dbHandle), MetaRepository: metaRepository}
+	router := v1.SetupRouter(nil, selectionCtrl, nil)
+
+	post := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		body := fmt.Sprintf(`{"documentUUID": "%s", "pageKey": "0", "coordinates": {"x1": 10, "y1": 10, "x2": 0, "y2": 0}}`, documentTestUUID)
+		router.ServeHTTP(w, httptest.NewRequest("POST", target, strings.NewReader(body)))
+		return w
+	}
+
+	w := post(asOwner("/api/v1/selections/"))
+	require.Equal(t, http.StatusOK, w.Result().StatusCode, w.Body.String())
+	assert.Equal(t, http.StatusUnprocessableEntity, post(asOwner("/api/v1/selections/?coordinateSpace=px")).Result().StatusCode)
+
+	w = post("/api/v1/selections/?coordinateSpace=px&ownerUUID=" + uuid.NewString())
+	assert.Equal(t, http.StatusNotFound, w.Result().StatusCode, "the page geometry of other documents is not looked at")
+}
+
+func selectionAccessAcrossOwners(t *testing.T) {
+	t.Parallel()
+	foreignOwnerUUID := "0c6f1a8e-5b0b-4a57-9d7e-3b1f0e2f6a11"
+	foreignDocumentUUID, foreignSelectionUUID := "7e9a4c52-1f3d-4b8e-a6c2-9d5f0b3e1a27", "4c1d9e3a-6b2f-4e85-9a70-2f8b5c6d1e94"
+	readDocumentUUID, readSelectionUUID := "2b8f6d1c-9e4a-4c37-b5d2-6a1e0f9c3b48", "8e3a1f5d-2c7b-4d96-a0e4-5b9c6f2d7a13"
+	writeDocumentUUID, writeSelectionUUID := "5d2c9a7e-3f1b-4a68-8e05-c7b4d1f6a392", "e6f0b3c8-4a9d-4217-bd5e-1c3a8f7e0b56"
+
+	ctx := context.Background()
+	ctr, err := testutil.CreateTestContainerPostgresWithInitFileName(ctx, dbUser, dbPassword, "TwoOwnersWithSharedSelections")
+	require.NoError(t, err)
+	defer testcontainers.TerminateContainer(ctr)
+
+	connectionString, err := ctr.ConnectionString(ctx, "sslmode=disable")
+	require.NoError(t, err)
+
+	dbHandle := postgres2.DatabaseHandler{DbConfig: postgres2.ConfigForDatabase{ConUrl: connectionString}}
+	selectionCtrl := &v1.SelectionController{SelectionRepository: postgres2.NewSelectionRepository(dbHandle)}
+	router := v1.SetupRouter(nil, selectionCtrl, nil)
+
+	request := func(method, target, body string) int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return w.Result().StatusCode
+	}
+	newSelection := func(documentUUID string) string {
+		return fmt.Sprintf(`{"documentUUID": "%s", "pageKey": "0"}`, documentUUID)
+	}
+
+	assert.Equal(t, http.StatusBadRequest, request("GET", "/api/v1/selections/?documentUUID="+foreignDocumentUUID, ""))
+
+	// Documents of another owner are not found, for reading and writing.
+	assert.Equal(t, http.StatusNotFound, request("GET", asOwner("/api/v1/selections/?documentUUID="+foreignDocumentUUID), ""))
+	assert.Equal(t, http.StatusNotFound, request("GET", asOwner("/api/v1/selections/?selectionUUID="+foreignSelectionUUID), ""))
+	assert.Equal(t, http.StatusNotFound, request("POST", asOwner("/api/v1/selections/"), newSelection(foreignDocumentUUID)))
+	assert.Equal(t, http.StatusNotFound, request("PATCH", asOwner("/api/v1/selections/"+foreignSelectionUUID), `{"label": "x"}`))
+	assert.Equal(t, http.StatusNotFound, request("DELETE", asOwner("/api/v1/selections/?documentUUID="+foreignDocumentUUID), ""))
+	assert.Equal(t, http.StatusNotFound, request("DELETE", asOwner("/api/v1/selections/bulk"), fmt.Sprintf(`{"selectionUUIDs": ["%s"]}`, foreignSelectionUUID)))
+	assert.Equal(t, http.StatusNotFound, request("PUT", asOwner("/api/v1/selections/replace?documentUUID="+foreignDocumentUUID), `[]`))
+	assert.Equal(t, http.StatusNotFound, request("DELETE", asOwner("/api/v1/selections/?selectionUUID="+foreignSelectionUUID), ""))
+	assert.Equal(t, 1, countSelections(t, dbHandle, foreignDocumentUUID))
+
+	// The owner still has access.
+	assert.Equal(t, http.StatusOK, request("GET", fmt.Sprintf("/api/v1/selections/?documentUUID=%s&ownerUUID=%s", foreignDocumentUUID, foreignOwnerUUID), ""))
+
+	// A read share allows reading but not writing.
+	assert.Equal(t, http.StatusOK, request("GET", asOwner("/api/v1/selections/?documentUUID="+readDocumentUUID), ""))
+	assert.Equal(t, http.StatusOK, request("GET", asOwner("/api/v1/selections/?selectionUUID="+readSelectionUUID), ""))
+	assert.Equal(t, http.StatusNotFound, request("POST", asOwner("/api/v1/selections/"), newSelection(readDocumentUUID)))
+	assert.Equal(t, http.StatusNotFound, request("PATCH", asOwner("/api/v1/selections/"+readSelectionUUID), `{"label": "x"}`))
+	assert.Equal(t, http.StatusNotFound, request("DELETE", asOwner("/api/v1/selections/?documentUUID="+readDocumentUUID), ""))
+	assert.Equal(t, 1, countSelections(t, dbHandle, readDocumentUUID))
+
+	// A write share allows both.
+	assert.Equal(t, http.StatusOK, request("POST", asOwner("/api/v1/selections/"), newSelection(writeDocumentUUID)))
+	assert.Equal(t, http.StatusOK, request("PATCH", asOwner("/api/v1/selections/"+writeSelectionUUID), `{"label": "x"}`))
+	assert.Equal(t, 2, countSelections(t, dbHandle, writeDocumentUUID))
+}
+
+func exportSelections(t *testing.T) {
+	t.Parallel()
+	documentTestUUID := "b66fd223-515f-4503-80cc-2bdaa50ef474"
+
+	ctx := context.Background()
+	ctr, err := testutil.CreateTestContainerPostgresWithInitFileName(ctx, dbUser, dbPassword, "OneDocumentTableEntryAndTwoSelections")
+	require.NoError(t, err)
+	defer testcontainers.TerminateContainer(ctr)
+
+	connectionString, err := ctr.ConnectionString(ctx, "sslmode=disable")
+	require.NoError(t, err)
+
+	dbHandle := postgres2.DatabaseHandler{DbConfig: postgres2.ConfigForDatabase{ConUrl: connectionString}}
+	selectionCtrl := &v1.SelectionController{SelectionRepository: postgres2.NewSelectionRepository(dbHandle)}
+	router := v1.SetupRouter(nil, selectionCtrl, nil)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", asOwner("/api/v1/selections/"), strings.NewReader(fmt.Sprintf(
+		`{"documentUUID": "%s", "pageKey": "0", "type": "highlight", "label": "Total", "coordinates": {"x1": 10, "y1": 20, "x2": 30, "y2": 40}}`, documentTestUUID))))
+	require.Equal(t, http.StatusOK, w.Result().StatusCode, w.Body.String())
+
+	export := func(query, accept string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		request := httptest.NewRequest("GET", asOwner(fmt.Sprintf("/api/v1/selections/export?documentUUID=%s%s", documentTestUUID, query)), nil)
+		if accept != "" {
+			request.Header.Set("Accept", accept)
+		}
+		router.ServeHTTP(w, request)
+		return w
+	}
+
+	w = export("&format=csv", "")
+	require.Equal(t, http.StatusOK, w.Result().StatusCode, w.Body.String())
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), documentTestUUID+"-selections.csv")
+	assert.Len(t, strings.Split(strings.TrimSpace(w.Body.String()), "\n"), 4)
+
+	w = export("", "application/vnd.adobe.xfdf")
+	require.Equal(t, http.StatusOK, w.Result().StatusCode, w.Body.String())
+	assert.Equal(t, "application/vnd.adobe.xfdf", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), `<highlight page="0" rect="10,20,30,40"`)
+	assert.Contains(t, w.Body.String(), `subject="Total"`)
+
+	w = export("&type=highlight", "")
+	require.Equal(t, http.StatusOK, w.Result().StatusCode, w.Body.String())
+	response := struct {
+		Pages []struct {
+			PageKey  string            `json:"pageKey"`
+			Features []json.RawMessage `json:"features"`
+		} `json:"pages"`
+	}{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.Pages, 1)
+	assert.Equal(t, "0", response.Pages[0].PageKey)
+	assert.Len(t, response.Pages[0].Features, 1)
+
+	assert.Equal(t, http.StatusBadRequest, export("&format=pdf", "").Result().StatusCode)
+	assert.Equal(t, http.StatusNotAcceptable, export("", "image/png").Result().StatusCode)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", fmt.Sprintf("/api/v1/selections/export?documentUUID=%s&ownerUUID=%s", documentTestUUID, uuid.NewString()), nil))
+	assert.Equal(t, http.StatusNotFound, w.Result().StatusCode)
+}
+
+func importSelectionsFromXfdf(t *testing.T) {
+	t.Parallel()
+	documentTestUUID := "b66fd223-515f-4503-80cc-2bdaa50ef474"
+
+	ctx := context.Background()
+	ctr, err := testutil.CreateTestContainerPostgresWithInitFileName(ctx, dbUser, dbPassword, "OneDocumentTableEntryAndTwoSelections")
+	require.NoError(t, err)
+	defer testcontainers.TerminateContainer(ctr)
+
+	connectionString, err := ctr.ConnectionString(ctx, "sslmode=disable")
+	require.NoError(t, err)
+
+	dbHandle := postgres2.DatabaseHandler{DbConfig: postgres2.ConfigForDatabase{ConUrl: connectionString}}
+	selectionCtrl := &v1.SelectionController{SelectionRepository: postgres2.NewSelectionRepository(dbHandle)}
+	router := v1.SetupRouter(nil, selectionCtrl, nil)
+
+	xfdf := `<xfdf xmlns="http://ns.adobe.com/xfdf/"><annots>
+		<highlight page="0" rect="30,40,10,20" subject="Total" color="#FFD700"><contents>Check</contents></highlight>
+		<circle page="0" rect="10,20,30,40"/>
+	</annots></xfdf>`
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", asOwner("/api/v1/selections/import?documentUUID="+documentTestUUID), strings.NewReader(xfdf)))
+	require.Equal(t, http.StatusCreated, w.Result().StatusCode, w.Body.String())
+
+	response := v1.ImportSelectionsResponse{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.Selections, 1)
+	assert.Equal(t, "0", *response.Selections[0].PageKey)
+	assert.Equal(t, models.Coordinates{X1: 10, Y1: 20, X2: 30, Y2: 40}, *response.Selections[0].Coordinates)
+	assert.Equal(t, "Total", *response.Selections[0].Label)
+	require.Len(t, response.Skipped, 1)
+	assert.Equal(t, 1, response.Skipped[0].Index)
+	assert.Equal(t, "circle", response.Skipped[0].Type)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", asOwner("/api/v1/selections/?documentUUID="+documentTestUUID+"&type=highlight"), nil))
+	require.Equal(t, http.StatusOK, w.Result().StatusCode, w.Body.String())
+	assert.Contains(t, w.Body.String(), response.Selections[0].Uuid.String())
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", asOwner("/api/v1/selections/import?documentUUID="+documentTestUUID), strings.NewReader("<fdf/>")))
+	assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", asOwner("/api/v1/selections/import?source=pdf&documentUUID="+documentTestUUID), nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Result().StatusCode)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", fmt.Sprintf("/api/v1/selections/import?documentUUID=%s&ownerUUID=%s", documentTestUUID, uuid.NewString()), strings.NewReader(xfdf)))
+	assert.Equal(t, http.StatusNotFound, w.Result().StatusCode)
+}
+
+func saveAndApplySelectionTemplates(t *testing.T) {
+	t.Parallel()
+	sourceDocumentUUID, targetDocumentUUID := "b66fd223-515f-4503-80cc-2bdaa50ef474", "9f4b2e61-7c3a-4d85-b1e9-0a6d5c8f2b37"
+
+	ctx := context.Background()
+	ctr, err := testutil.CreateTestContainerPostgresWithInitFileName(ctx, dbUser, dbPassword, "TwoDocumentsWithDifferentPageSizes")
+	require.NoError(t, err)
+	defer testcontainers.TerminateContainer(ctr)
+
+	connectionString, err := ctr.ConnectionString(ctx, "sslmode=disable")
+	require.NoError(t, err)
+
+	dbHandle := postgres2.DatabaseHandler{DbConfig: postgres2.ConfigForDatabase{ConUrl: connectionString}}
+	selectionCtrl := &v1.SelectionController{
+		SelectionRepository: postgres2.NewSelectionRepository(dbHandle),
+		MetaRepository:      postgres2.NewMetaRepository(dbHandle),
+		TemplateRepository:  postgres2.NewSelectionTemplateRepository(dbHandle),
+	}
+	router := v1.SetupRouter(nil, selectionCtrl, nil)
+
+	request := func(method, target, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return w
+	}
+
+	w := request("POST", asOwner("/api/v1/selections/templates"), fmt.Sprintf(`{"name": "ACME invoice", "documentUUID": "%s"}`, sourceDocumentUUID))
+	require.Equal(t, http.StatusCreated, w.Result().StatusCode, w.Body.String())
+	first := models.SelectionTemplate{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &first))
+	assert.Equal(t, 1, first.Version)
+	require.Len(t, first.Selections, 2)
+	assert.NotNil(t, first.Selections[0].PageGeometry)
+
+	w = request("POST", asOwner("/api/v1/selections/templates"), fmt.Sprintf(`{"name": "ACME invoice", "documentUUID": "%s", "pageKeys": ["0"]}`, sourceDocumentUUID))
+	require.Equal(t, http.StatusCreated, w.Result().StatusCode, w.Body.String())
+	second := models.SelectionTemplate{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &second))
+	assert.Equal(t, 2, second.Version)
+	assert.Len(t, second.Selections, 1)
+
+	w = request("GET", asOwner("/api/v1/selections/templates?name=ACME%20invoice"), "")
+	require.Equal(t, http.StatusOK, w.Result().StatusCode, w.Body.String())
+	list := struct {
+		Templates []models.SelectionTemplate `json:"templates"`
+	}{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Templates, 2)
+	assert.Equal(t, second.Uuid, list.Templates[0].Uuid)
+	assert.Empty(t, list.Templates[0].Selections)
+
+	w = request("POST", asOwner("/api/v1/selections/templates/"+first.Uuid.String()+"/apply"),
+		fmt.Sprintf(`{"documentUUID": "%s", "scaleToPageSize": true, "pageMapping": {"1": null}}`, targetDocumentUUID))
+	require.Equal(t, http.StatusCreated, w.Result().StatusCode, w.Body.String())
+	applied := struct {
+		Selections []models.Selection `json:"selections"`
+	}{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &applied))
+	require.Len(t, applied.Selections, 1)
+	assert.Equal(t, "0", *applied.Selections[0].PageKey)
+	assert.Equal(t, "Invoice number", *applied.Selections[0].Label)
+	assert.InDeltaSlice(t, []float64{144, 1400, 288, 1440}, []float64{applied.Selections[0].Coordinates.X1, applied.Selections[0].Coordinates.Y1,
+		applied.Selections[0].Coordinates.X2, applied.Selections[0].Coordinates.Y2}, 1e-3)
+
+	w = request("POST", asOwner("/api/v1/selections/templates/"+first.Uuid.String()+"/apply"),
+		fmt.Sprintf(`{"documentUUID": "%s", "pageMapping": {"1": "5"}}`, targetDocumentUUID))
+	assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode, "the mapped page does not exist")
+
+	w = request("GET", asOwner("/api/v1/selections/?documentUUID="+targetDocumentUUID), "")
+	require.Equal(t, http.StatusOK, w.Result().StatusCode, w.Body.String())
+	assert.Equal(t, 1, strings.Count(w.Body.String(), "selectionUUID"), "nothing is created when a selection does not fit")
+
+	w = request("POST", asOwner("/api/v1/selections/templates/"+first.Uuid.String()+"/apply"),
+		fmt.Sprintf(`{"documentUUID": "%s", "pageMapping": {"0": null, "1": null}}`, uuid.NewString()))
+	assert.Equal(t, http.StatusNotFound, w.Result().StatusCode, "the document is checked even if no page is kept")
+
+	w = request("GET", fmt.Sprintf("/api/v1/selections/templates/%s?ownerUUID=%s", first.Uuid, uuid.NewString()), "")
+	assert.Equal(t, http.StatusNotFound, w.Result().StatusCode, "templates of other owners are not found")
+
+	w = request("DELETE", asOwner("/api/v1/selections/templates/"+first.Uuid.String()), "")
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode, w.Body.String())
+	w = request("GET", asOwner("/api/v1/selections/templates/"+first.Uuid.String()), "")
+	assert.Equal(t, http.StatusNotFound, w.Result().StatusCode)
+}
+
+func spatialSelectionQueries(t *testing.T) {
+	t.Parallel()
+	documentTestUUID := "b66fd223-515f-4503-80cc-2bdaa50ef474"
+	invoiceNumberUUID, totalUUID := "a5fdea38-0a86-4c19-ae4f-c87a01bc860d", "335a6b95-6707-4e2b-9c37-c76d017f6f97"
+
+	ctx := context.Background()
+	ctr, err := testutil.CreateTestContainerPostgresWithInitFileName(ctx, dbUser, dbPassword, "TwoDocumentsWithDifferentPageSizes")
+	require.NoError(t, err)
+	defer testcontainers.TerminateContainer(ctr)
+
+	connectionString, err := ctr.ConnectionString(ctx, "sslmode=disable")
+	require.NoError(t, err)
+
+	dbHandle := postgres2.DatabaseHandler{DbConfig: postgres2.ConfigForDatabase{ConUrl: connectionString}}
+	selectionCtrl := &v1.SelectionController{SelectionRepository: postgres2.NewSelectionRepository(dbHandle), MetaRepository: postgres2.NewMetaRepository(dbHandle)}
+	router := v1.SetupRouter(nil, selectionCtrl, nil)
+
+	query := func(parameters string) (int, []string) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", asOwner("/api/v1/selections/?documentUUID="+documentTestUUID+parameters), nil))
+
+		response := struct {
+			Selections []models.Selection `json:"selections"`
+		}{}
+		uids := make([]string, 0)
+		if w.Result().StatusCode == http.StatusOK {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			for _, selection := range response.Selections {
+				uids = append(uids, selection.Uuid.String())
+			}
+		}
+
+		return w.Result().StatusCode, uids
+	}
+
+	status, uids := query("")
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, []string{invoiceNumberUUID, totalUUID}, uids, "ordered by page")
+
+	_, uids = query("&pageKey=1")
+	assert.Equal(t, []string{totalUUID}, uids)
+
+	_, uids = query("&intersects=100,710,100,710")
+	assert.Equal(t, []string{invoiceNumberUUID}, uids, "a click inside the selection hits it")
+
+	_, uids = query("&intersects=100,730,100,730")
+	assert.Empty(t, uids)
+
+	_, uids = query("&within=0,0,612,200")
+	assert.Equal(t, []string{totalUUID}, uids)
+
+	_, uids = query("&within=0,0,300,200")
+	assert.Empty(t, uids, "the selection is only partly inside")
+
+	_, uids = query("&near=80,690&limit=1")
+	assert.Equal(t, []string{invoiceNumberUUID}, uids)
+
+	_, uids = query("&near=80,150")
+	assert.Equal(t, []string{totalUUID, invoiceNumberUUID}, uids)
+
+	status, uids = query("&coordinateSpace=px&dpi=72&pageKey=0&intersects=100,82,100,82")
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, []string{invoiceNumberUUID}, uids, "pixel coordinates are measured from the top of the page")
+
+	status, _ = query("&coordinateSpace=px&dpi=72&intersects=100,82,100,82")
+	assert.Equal(t, http.StatusBadRequest, status, "pixel coordinates need a page")
+
+	status, uids = query("&coordinateSpace=px&dpi=72&pageKey=1&intersects=500,700,700,900")
+	require.Equal(t, http.StatusOK, status, "query rectangles may reach past the page")
+	assert.Equal(t, []string{totalUUID}, uids)
+
+	status, uids = query("&coordinateSpace=relative&pageKey=1&within=-0.1,0,1.1,1.2")
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, []string{totalUUID}, uids)
+
+	status, _ = query("&intersects=1,2,3")
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	status, _ = query("&limit=0")
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
+// recordingRedactor stands in for the data service, it keeps what it was asked to redact.
+type recordingRedactor struct {
+	document string
+	regions  []models.RedactionRegion
+}
+
+func (r *recordingRedactor) Redact(_ context.Context, base64 io.ReadSeeker, regions []models.RedactionRegion) (string, error) {
+	document, err := io.ReadAll(base64)
+	if err != nil {
+		return "", err
+	}
+
+	r.document, r.regions = string(document), regions
+	return "Redacted invoice", nil
+}
+
+func redactDocumentFromRedactionSelections(t *testing.T) {
+	t.Parallel()
+	documentTestUUID := uuid.MustParse("b66fd223-515f-4503-80cc-2bdaa50ef474")
+
+	ctx := context.Background()
+	ctr, err := testutil.CreateTestContainerPostgresWithInitFileName(ctx, dbUser, dbPassword, "TwoDocumentsWithDifferentPageSizes")
+	require.NoError(t, err)
+	defer testcontainers.TerminateContainer(ctr)
+
+	connectionString, err := ctr.ConnectionString(ctx, "sslmode=disable")
+	require.NoError(t, err)
+
+	dbHandle := postgres2.DatabaseHandler{DbConfig: postgres2.ConfigForDatabase{ConUrl: connectionString}}
+	documentRepository := postgres2.NewDocumentRepository(dbHandle)
+	redactor := &recordingRedactor{}
+	selectionCtrl := &v1.SelectionController{
+		SelectionRepository: postgres2.NewSelectionRepository(dbHandle),
+		MetaRepository:      postgres2.NewMetaRepository(dbHandle),
+		DocumentRepository:  documentRepository,
+	}
+
+	redact := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		v1.SetupRouter(nil, selectionCtrl, nil).ServeHTTP(w, httptest.NewRequest("POST", asOwner("/api/v1/selections/redact?documentUUID="+documentTestUUID.String()), nil))
+		return w
+	}
+
+	assert.Equal(t, http.StatusServiceUnavailable, redact().Result().StatusCode, "redaction needs the data service")
+
+	selectionCtrl.Redactor = redactor
+	w := redact()
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Result().StatusCode, "the fixture only has fields")
+
+	redaction := models.SelectionTypeRedaction
+	requestJSON, _ := json.Marshal(v1.AddNewSelectionRequest{
+		DocumentUUID: &documentTestUUID,
+		PageKey:      "1",
+		Coordinates:  &models.Coordinates{X1: 72, Y1: 72, X2: 540, Y2: 144},
+		Type:         &redaction,
+	})
+	w = httptest.NewRecorder()
+	v1.SetupRouter(nil, selectionCtrl, nil).ServeHTTP(w, httptest.NewRequest("POST", asOwner("/api/v1/selections/"), strings.NewReader(string(requestJSON))))
+	require.Equal(t, http.StatusCreated, w.Result().StatusCode, w.Body.String())
+
+	w = redact()
+	require.Equal(t, http.StatusCreated, w.Result().StatusCode, w.Body.String())
+	response := struct {
+		DocumentUUID    uuid.UUID `json:"documentUUID"`
+		DerivedFromUUID uuid.UUID `json:"derivedFromUUID"`
+		Redactions      int       `json:"redactions"`
+	}{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, documentTestUUID, response.DerivedFromUUID)
+	assert.Equal(t, 1, response.Redactions)
+
+	assert.Equal(t, "Letter sized invoice", redactor.document)
+	assert.Equal(t, []models.RedactionRegion{{PageNumber: 1, Region: models.Coordinates{X1: 72, Y1: 72, X2: 540, Y2: 144}}}, redactor.regions)
+
+	derived, err := documentRepository.GetDocumentByDocumentUUID(response.DocumentUUID, uuid.MustParse(selectionOwnerUUID), make(models.Exclude))
+	require.NoError(t, err)
+	assert.Equal(t, "Redacted invoice", *derived.PdfBase64)
+	assert.Equal(t, documentTestUUID, *derived.DerivedFromUUID)
+
+	original, err := documentRepository.GetDocumentByDocumentUUID(documentTestUUID, uuid.MustParse(selectionOwnerUUID), make(models.Exclude))
+	require.NoError(t, err)
+	assert.Equal(t, "Letter sized invoice", *original.PdfBase64, "the original is left unchanged")
+	assert.Nil(t, original.DerivedFromUUID)
+}
+
+func cropSelectionImages(t *testing.T) {
+	t.Parallel()
+	documentTestUUID := uuid.MustParse("b66fd223-515f-4503-80cc-2bdaa50ef474")
+	invoiceNumberUUID, totalUUID := "a5fdea38-0a86-4c19-ae4f-c87a01bc860d", "335a6b95-6707-4e2b-9c37-c76d017f6f97"
+
+	ctx := context.Background()
+	ctr, err := testutil.CreateTestContainerPostgresWithInitFileName(ctx, dbUser, dbPassword, "TwoDocumentsWithDifferentPageSizes")
+	require.NoError(t, err)
+	defer testcontainers.TerminateContainer(ctr)
+
+	connectionString, err := ctr.ConnectionString(ctx, "sslmode=disable")
+	require.NoError(t, err)
+
+	dbHandle := postgres2.DatabaseHandler{DbConfig: postgres2.ConfigForDatabase{ConUrl: connectionString}}
+	metaRepository := postgres2.NewMetaRepository(dbHandle)
+
+	// The first page rendered at 36 dpi, with the invoice number painted red.
+	page := image.NewRGBA(image.Rect(0, 0, 306, 396))
+	for y := 36; y < 46; y++ {
+		for x := 36; x < 72; x++ {
+			page.Set(x, y, color.RGBA{R: 255, A: 255})
+		}
+	}
+	var encoded bytes.Buffer
+	require.NoError(t, png.Encode(&encoded, page))
+	reference := base64.StdEncoding.EncodeToString(encoded.Bytes())
+	require.NoError(t, metaRepository.AddPages(documentTestUUID, []models.Page{imaging.NewPage(documentTestUUID, 0, "0", reference)}))
+
+	selectionCtrl := &v1.SelectionController{SelectionRepository: postgres2.NewSelectionRepository(dbHandle), MetaRepository: metaRepository}
+	router := v1.SetupRouter(nil, selectionCtrl, nil)
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", asOwner(target), nil))
+		return w
+	}
+
+	w := get("/api/v1/selections/" + invoiceNumberUUID + "/image")
+	require.Equal(t, http.StatusOK, w.Result().StatusCode, w.Body.String())
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	crop, err := png.Decode(w.Body)
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 36, 10), crop.Bounds())
+	for _, point := range []image.Point{{0, 0}, {35, 9}} {
+		r, g, _, _ := crop.At(point.X, point.Y).RGBA()
+		assert.Equal(t, [2]uint32{0xffff, 0}, [2]uint32{r, g}, "the crop only holds the selection")
+	}
+
+	w = get("/api/v1/selections/" + invoiceNumberUUID + "/image?scale=2")
+	require.Equal(t, http.StatusOK, w.Result().StatusCode, w.Body.String())
+	config, err := png.DecodeConfig(w.Body)
+	require.NoError(t, err)
+	assert.Equal(t, [2]int{72, 20}, [2]int{config.Width, config.Height})
+
+	w = get("/api/v1/selections/" + invoiceNumberUUID + "/image?format=jpeg")
+	require.Equal(t, http.StatusOK, w.Result().StatusCode, w.Body.String())
+	assert.Equal(t, "image/jpeg", w.Header().Get("Content-Type"))
+
+	assert.Equal(t, http.StatusNotFound, get("/api/v1/selections/"+totalUUID+"/image").Result().StatusCode, "the second page has no image")
+	assert.Equal(t, http.StatusNotFound, get("/api/v1/selections/"+uuid.NewString()+"/image").Result().StatusCode)
+	assert.Equal(t, http.StatusBadRequest, get("/api/v1/selections/"+invoiceNumberUUID+"/image?scale=5").Result().StatusCode)
+	assert.Equal(t, http.StatusBadRequest, get("/api/v1/selections/"+invoiceNumberUUID+"/image?format=gif").Result().StatusCode)
+
+	w = get("/api/v1/selections/images?documentUUID=" + documentTestUUID.String())
+	require.Equal(t, http.StatusOK, w.Result().StatusCode, w.Body.String())
+	assert.Equal(t, "application/zip", w.Header().Get("Content-Type"))
+	archive, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	require.NoError(t, err)
+
+	files := make(map[string][]byte)
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		require.NoError(t, err)
+		files[file.Name], err = io.ReadAll(reader)
+		require.NoError(t, err)
+	}
+	assert.Len(t, files, 2)
+	assert.Contains(t, files, invoiceNumberUUID+".png")
+
+	manifest := make([]v1.SelectionCropEntry, 0)
+	require.NoError(t, json.Unmarshal(files["manifest.json"], &manifest))
+	require.Len(t, manifest, 2)
+	assert.Equal(t, invoiceNumberUUID+".png", manifest[0].File)
+	assert.Equal(t, "Invoice number", *manifest[0].Label)
+	assert.Equal(t, totalUUID, manifest[1].SelectionUUID.String())
+	assert.Empty(t, manifest[1].File)
+	assert.Contains(t, manifest[1].Skipped, "page has no image")
+
+	w = get("/api/v1/selections/images?documentUUID=" + uuid.NewString())
+	assert.Equal(t, http.StatusNotFound, w.Result().StatusCode)
+
+	// Users the document is shared with crop from the same page images.
+	granteeUUID := uuid.NewString()
+	require.NoError(t, dbHandle.WithConnection(func(db *sql.DB) error {
+		_, err := db.Exec(`INSERT INTO documentshare_table ("Document_UUID", "Grantee_UUID") VALUES ($1, $2)`, documentTestUUID, granteeUUID)
+		return err
+	}))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/selections/"+invoiceNumberUUID+"/image?ownerUUID="+granteeUUID, nil))
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode, w.Body.String())
+}
@@ -1,5 +1,11 @@
 insert into document_table ("Document_UUID", "Document_Base64", "Owner_UUID", "Owner_Type")
 values (uuid('b66fd223-515f-4503-80cc-2bdaa50ef474'), 'Fake document for testing', uuid('f701aa7e-10e9-48b9-83f1-6b035a5b7564'), 1);
 
-insert into documentmeta_table ("Document_UUID", "Number_Of_Pages", "Height", "Width", "Images")
-values (uuid('b66fd223-515f-4503-80cc-2bdaa50ef474'), 31, 1920, 1080, '{"0":"test0","1":"test1","2":"test2","3":"test3"}');
+insert into documentmeta_table ("Document_UUID", "Number_Of_Pages", "Height", "Width")
+values (uuid('b66fd223-515f-4503-80cc-2bdaa50ef474'), 31, 1920, 1080);
+
+insert into documentpage_table ("Document_UUID", "Page_Number", "Page_Key", "Image")
+values (uuid('b66fd223-515f-4503-80cc-2bdaa50ef474'), 0, '0', 'test0'),
+       (uuid('b66fd223-515f-4503-80cc-2bdaa50ef474'), 1, '1', 'test1'),
+       (uuid('b66fd223-515f-4503-80cc-2bdaa50ef474'), 2, '2', 'test2'),
+       (uuid('b66fd223-515f-4503-80cc-2bdaa50ef474'), 3, '3', 'test3');
@@ -0,0 +1,8 @@
+insert into document_table ("Document_UUID", "Document_Base64", "Owner_UUID", "Owner_Type")
+values (uuid('b66fd223-515f-4503-80cc-2bdaa50ef474'), 'Fake document for testing', uuid('f701aa7e-10e9-48b9-83f1-6b035a5b7564'), 1);
+
+insert into documentmeta_table ("Document_UUID", "Number_Of_Pages", "Height", "Width")
+values (uuid('b66fd223-515f-4503-80cc-2bdaa50ef474'), 1, 792, 612);
+
+insert into documentpage_table ("Document_UUID", "Page_Number", "Page_Key", "Image", "Width", "Height", "Mime_Type")
+values (uuid('b66fd223-515f-4503-80cc-2bdaa50ef474'), 0, '0', 'iVBORw0KGgoAAAANSUhEUgAAAAQAAAACCAIAAADwyuo0AAAAEElEQVR4nGP4z8AARwzIHABvqgf5gNwAKAAAAABJRU5ErkJggg==', 4, 2, 'image/png');
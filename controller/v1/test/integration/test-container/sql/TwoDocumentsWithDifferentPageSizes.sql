@@ -0,0 +1,17 @@
+insert into document_table ("Document_UUID", "Document_Base64", "Owner_UUID", "Owner_Type")
+values (uuid('b66fd223-515f-4503-80cc-2bdaa50ef474'), 'Letter sized invoice', uuid('ea167a48-c1b3-46c4-911b-090e807132fc'), 1),
+       (uuid('9f4b2e61-7c3a-4d85-b1e9-0a6d5c8f2b37'), 'Invoice scanned at twice the size', uuid('ea167a48-c1b3-46c4-911b-090e807132fc'), 1);
+
+insert into documentmeta_table ("Document_UUID", "Number_Of_Pages", "Height", "Width")
+values (uuid('b66fd223-515f-4503-80cc-2bdaa50ef474'), 2, 792, 612),
+       (uuid('9f4b2e61-7c3a-4d85-b1e9-0a6d5c8f2b37'), 2, 1584, 1224);
+
+insert into documentpage_table ("Document_UUID", "Page_Number", "Page_Key", "Media_Box")
+values (uuid('b66fd223-515f-4503-80cc-2bdaa50ef474'), 0, '0', '[0, 0, 612, 792]'),
+       (uuid('b66fd223-515f-4503-80cc-2bdaa50ef474'), 1, '1', '[0, 0, 612, 792]'),
+       (uuid('9f4b2e61-7c3a-4d85-b1e9-0a6d5c8f2b37'), 0, '0', '[0, 0, 1224, 1584]'),
+       (uuid('9f4b2e61-7c3a-4d85-b1e9-0a6d5c8f2b37'), 1, '1', '[0, 0, 1224, 1584]');
+
+insert into selection_table ("Selection_UUID", "Document_UUID", "Page_Key", "Coordinates", "Type", "Label")
+values (uuid('a5fdea38-0a86-4c19-ae4f-c87a01bc860d'), uuid('b66fd223-515f-4503-80cc-2bdaa50ef474'), '0', '{"x1": 72, "y1": 700, "x2": 144, "y2": 720}', 'field', 'Invoice number'),
+       (uuid('335a6b95-6707-4e2b-9c37-c76d017f6f97'), uuid('b66fd223-515f-4503-80cc-2bdaa50ef474'), '1', '{"x1": 72, "y1": 72, "x2": 540, "y2": 144}', 'field', 'Total');
@@ -0,0 +1,15 @@
+insert into document_table ("Document_UUID", "Document_Base64", "Owner_UUID", "Owner_Type")
+values (uuid('b66fd223-515f-4503-80cc-2bdaa50ef474'), 'Fake document for testing', uuid('ea167a48-c1b3-46c4-911b-090e807132fc'), 1),
+       (uuid('7e9a4c52-1f3d-4b8e-a6c2-9d5f0b3e1a27'), 'Foreign document', uuid('0c6f1a8e-5b0b-4a57-9d7e-3b1f0e2f6a11'), 1),
+       (uuid('2b8f6d1c-9e4a-4c37-b5d2-6a1e0f9c3b48'), 'Document shared for reading', uuid('0c6f1a8e-5b0b-4a57-9d7e-3b1f0e2f6a11'), 1),
+       (uuid('5d2c9a7e-3f1b-4a68-8e05-c7b4d1f6a392'), 'Document shared for writing', uuid('0c6f1a8e-5b0b-4a57-9d7e-3b1f0e2f6a11'), 1);
+
+insert into documentshare_table ("Document_UUID", "Grantee_UUID", "Can_Write")
+values (uuid('2b8f6d1c-9e4a-4c37-b5d2-6a1e0f9c3b48'), uuid('ea167a48-c1b3-46c4-911b-090e807132fc'), false),
+       (uuid('5d2c9a7e-3f1b-4a68-8e05-c7b4d1f6a392'), uuid('ea167a48-c1b3-46c4-911b-090e807132fc'), true);
+
+insert into selection_table ("Selection_UUID", "Document_UUID", "Page_Key")
+values (uuid('a5fdea38-0a86-4c19-ae4f-c87a01bc860d'), uuid('b66fd223-515f-4503-80cc-2bdaa50ef474'), '0'),
+       (uuid('4c1d9e3a-6b2f-4e85-9a70-2f8b5c6d1e94'), uuid('7e9a4c52-1f3d-4b8e-a6c2-9d5f0b3e1a27'), '0'),
+       (uuid('8e3a1f5d-2c7b-4d96-a0e4-5b9c6f2d7a13'), uuid('2b8f6d1c-9e4a-4c37-b5d2-6a1e0f9c3b48'), '0'),
+       (uuid('e6f0b3c8-4a9d-4217-bd5e-1c3a8f7e0b56'), uuid('5d2c9a7e-3f1b-4a68-8e05-c7b4d1f6a392'), '0');
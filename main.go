@@ -2,21 +2,35 @@ package main
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	v1 "pdf_service_api/controller/v1"
 	"pdf_service_api/service/dataapi"
+	"pdf_service_api/service/events"
+	"pdf_service_api/service/extraction"
+	"pdf_service_api/service/logging"
+	"pdf_service_api/service/pdf"
 	"pdf_service_api/service/postgres"
+	"strconv"
+	"strings"
+	"time"
 )
 
 var (
-	dbUser         = os.Getenv("DATABASE_USER")
-	dbPassword     = os.Getenv("DATABASE_PASSWORD")
-	dbPort         = os.Getenv("DATABASE_PORT")
-	dbHost         = os.Getenv("DATABASE_HOST")
-	dbDatabase     = os.Getenv("DATABASE_DB")
-	appPort        = os.Getenv("APP_PORT")
-	dataServiceUrl = os.Getenv("DATA_SERVICE_URL")
+	dbUser            = os.Getenv("DATABASE_USER")
+	dbPassword        = os.Getenv("DATABASE_PASSWORD")
+	dbPort            = os.Getenv("DATABASE_PORT")
+	dbHost            = os.Getenv("DATABASE_HOST")
+	dbDatabase        = os.Getenv("DATABASE_DB")
+	appPort           = os.Getenv("APP_PORT")
+	dataServiceUrl    = os.Getenv("DATA_SERVICE_URL")
+	autoExtractMeta   = os.Getenv("AUTO_EXTRACT_META")
+	dataTimeout       = os.Getenv("DATA_SERVICE_TIMEOUT")
+	dataRetries       = os.Getenv("DATA_SERVICE_RETRIES")
+	thumbnailSizes    = os.Getenv("THUMBNAIL_SIZES")
+	idempotencyWindow = os.Getenv("IDEMPOTENCY_WINDOW")
+	logLevel          = os.Getenv("LOG_LEVEL")
+	requestLogLevel   = os.Getenv("LOG_REQUEST_LEVEL")
 )
 
 // @title           Go Backend API
@@ -37,7 +51,15 @@ var (
 // @externalDocs.description  OpenAPI
 // @externalDocs.url          https://swagger.io/resources/open-api/
 func main() {
-	fmt.Println(os.Hostname())
+	logger := logging.New(os.Stdout, logLevelConfig("LOG_LEVEL", logLevel, slog.LevelInfo))
+	slog.SetDefault(logger)
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		logger.Warn("hostname could not be read", "error", err)
+	}
+	logger.Info("starting pdf service api", "hostname", hostname)
+
 	errHandleFunction := func(str string) {
 		panic("Database login credentials must be present.")
 	}
@@ -49,25 +71,135 @@ func main() {
 		Username: dbUser,
 		Password: dbPassword,
 		Database: dbDatabase,
-	}}
+	}, Logger: logger}
 
-	err := dbHandler.RunInitScript()
+	err = dbHandler.RunInitScript()
 	if err != nil {
 		err = fmt.Errorf("failed to run init script: %w", err)
 		panic(err)
 	}
 
-	documentCtrl := &v1.DocumentController{DocumentRepository: postgres.NewDocumentRepository(dbHandler)}
-	selectionCtrl := &v1.SelectionController{SelectionRepository: postgres.NewSelectionRepository(dbHandler)}
-	metaCtrl := &v1.MetaController{MetaRepository: postgres.NewMetaRepository(dbHandler), DocumentRepository: postgres.NewDocumentRepository(dbHandler), DataService: dataapi.DataService{BaseUrl: dataServiceUrl}}
+	eventBus := events.NewBus()
+	auditRepository := postgres.NewAuditRepository(dbHandler)
+	documentCtrl := &v1.DocumentController{DocumentRepository: postgres.NewDocumentRepository(dbHandler), Events: eventBus, AuditRepository: auditRepository}
+	selectionCtrl := &v1.SelectionController{SelectionRepository: postgres.NewSelectionRepository(dbHandler), MetaRepository: postgres.NewMetaRepository(dbHandler), TemplateRepository: postgres.NewSelectionTemplateRepository(dbHandler), Events: eventBus, AuditRepository: auditRepository}
+	metaCtrl := &v1.MetaController{MetaRepository: postgres.NewMetaRepository(dbHandler), DocumentRepository: postgres.NewDocumentRepository(dbHandler), ThumbnailRepository: postgres.NewThumbnailRepository(dbHandler), ThumbnailSizes: thumbnailSizeConfig(), AuditRepository: auditRepository}
+	auditCtrl := &v1.AuditController{AuditRepository: auditRepository}
 
-	router := v1.SetupRouter(documentCtrl, selectionCtrl, metaCtrl)
+	metaExtractor := extraction.FallbackExtractor{Fallback: pdf.NewExtractor()}
+	textExtractor := extraction.FallbackTextExtractor{Fallback: pdf.NewExtractor()}
+	dataService, err := dataapi.NewDataService(dataServiceConfig())
+	if err != nil {
+		logger.Warn("data service disabled, meta data is extracted without page images and documents cannot be redacted", "error", err)
+	} else {
+		metaExtractor.Primary = dataService
+		textExtractor.Primary = dataService
+		selectionCtrl.Redactor = dataService
+	}
+	metaCtrl.MetaExtractor = metaExtractor
+	selectionCtrl.DocumentRepository = postgres.NewDocumentRepository(dbHandler)
+	selectionCtrl.TextExtractor = textExtractor
+
+	queue := extraction.NewQueue(metaExtractor, postgres.NewMetaRepository(dbHandler), postgres.NewDocumentRepository(dbHandler), 100)
+	queue.Events = eventBus
+	queue.Logger = logger
+	queue.Start(2)
+
+	documentCtrl.MetaExtractionQueue = queue
+	documentCtrl.ExtractMetaByDefault = autoExtractMeta == "true"
+
+	requestLogging := v1.RequestLogging(logger, requestLogLevelConfig())
+	idempotency := v1.Idempotency(postgres.NewIdempotencyRepository(dbHandler), idempotencyWindowConfig())
+	router := v1.SetupRouter(documentCtrl, selectionCtrl, metaCtrl, v1.WithAuditController(auditCtrl), v1.WithMiddleware(requestLogging, idempotency))
 
 	if appPort == "" {
 		appPort = "8080"
 	}
 
-	log.Fatal(router.Run(":" + appPort))
+	logger.Info("listening", "port", appPort)
+	if err := router.Run(":" + appPort); err != nil {
+		logger.Error("server stopped", "error", err)
+		os.Exit(1)
+	}
+}
+
+func dataServiceConfig() dataapi.Config {
+	config := dataapi.Config{BaseUrl: dataServiceUrl}
+
+	if dataTimeout != "" {
+		timeout, err := time.ParseDuration(dataTimeout)
+		if err != nil {
+			panic(fmt.Errorf("invalid DATA_SERVICE_TIMEOUT: %w", err))
+		}
+		config.RequestTimeout = timeout
+	}
+
+	if dataRetries != "" {
+		retries, err := strconv.Atoi(dataRetries)
+		if err != nil {
+			panic(fmt.Errorf("invalid DATA_SERVICE_RETRIES: %w", err))
+		}
+		if retries == 0 {
+			retries = -1
+		}
+		config.MaxRetries = retries
+	}
+
+	return config
+}
+
+// thumbnailSizeConfig parses THUMBNAIL_SIZES, a comma separated list of pixel sizes.
+func thumbnailSizeConfig() []uint32 {
+	if thumbnailSizes == "" {
+		return nil
+	}
+
+	sizes := make([]uint32, 0)
+	for _, value := range strings.Split(thumbnailSizes, ",") {
+		size, err := strconv.ParseUint(strings.TrimSpace(value), 10, 32)
+		if err != nil || size == 0 {
+			panic(fmt.Errorf("invalid THUMBNAIL_SIZES entry %q", value))
+		}
+		sizes = append(sizes, uint32(size))
+	}
+
+	return sizes
+}
+
+// idempotencyWindowConfig parses IDEMPOTENCY_WINDOW, the duration idempotency keys are remembered.
+func idempotencyWindowConfig() time.Duration {
+	if idempotencyWindow == "" {
+		return v1.DefaultIdempotencyWindow
+	}
+
+	window, err := time.ParseDuration(idempotencyWindow)
+	if err != nil || window <= 0 {
+		panic(fmt.Errorf("invalid IDEMPOTENCY_WINDOW %q", idempotencyWindow))
+	}
+
+	return window
+}
+
+// logLevelConfig parses the level named by the environment variable, falling back when it is empty.
+func logLevelConfig(name, value string, fallback slog.Level) slog.Level {
+	if value == "" {
+		return fallback
+	}
+
+	level, err := logging.ParseLevel(value)
+	if err != nil {
+		panic(fmt.Errorf("invalid %s %q", name, value))
+	}
+
+	return level
+}
+
+// requestLogLevelConfig reads LOG_REQUEST_LEVEL, the level successful requests are logged at.
+// Failed requests keep being logged as warnings and errors.
+func requestLogLevelConfig() v1.RequestLogLevels {
+	levels := v1.DefaultRequestLogLevels
+	levels.Success = logLevelConfig("LOG_REQUEST_LEVEL", requestLogLevel, levels.Success)
+	return levels
 }
 
 func mustNotBeEmpty(errorHandle func(string), a ...string) {
@@ -0,0 +1,136 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AuditAction is what a request did to a resource.
+type AuditAction string
+
+const (
+	AuditActionCreate AuditAction = "create"
+	AuditActionUpdate AuditAction = "update"
+	AuditActionDelete AuditAction = "delete"
+)
+
+func (a AuditAction) IsValid() bool {
+	return a == AuditActionCreate || a == AuditActionUpdate || a == AuditActionDelete
+}
+
+// AuditResourceType is the kind of resource an audit entry is about.
+type AuditResourceType string
+
+const (
+	AuditResourceDocument          AuditResourceType = "document"
+	AuditResourceMeta              AuditResourceType = "meta"
+	AuditResourceSelection         AuditResourceType = "selection"
+	AuditResourceSelectionTemplate AuditResourceType = "selectionTemplate"
+	// AuditResourceShare entries are about the share of a document, with the grantee as resource.
+	AuditResourceShare AuditResourceType = "share"
+)
+
+func (r AuditResourceType) IsValid() bool {
+	switch r {
+	case AuditResourceDocument, AuditResourceMeta, AuditResourceSelection, AuditResourceSelectionTemplate, AuditResourceShare:
+		return true
+	}
+
+	return false
+}
+
+// AuditEntry records a change made to a resource by a request. The actor is the caller given by
+// the request, the owner the owner of the document the resource belongs to, which differs from
+// the actor on shared documents. Entries are kept after their resource is deleted.
+type AuditEntry struct {
+	Uuid         uuid.UUID              `json:"auditUUID"`
+	ActorUUID    *uuid.UUID             `json:"actorUUID,omitempty"`
+	OwnerUUID    *uuid.UUID             `json:"ownerUUID,omitempty"`
+	Action       AuditAction            `json:"action" example:"delete"`
+	ResourceType AuditResourceType      `json:"resourceType" example:"document"`
+	ResourceUUID uuid.UUID              `json:"resourceUUID"`
+	DocumentUUID *uuid.UUID             `json:"documentUUID,omitempty"`
+	RequestID    *string                `json:"requestID,omitempty"`
+	IP           *string                `json:"ip,omitempty" example:"203.0.113.7"`
+	Timestamp    time.Time              `json:"timestamp" example:"2024-05-01T12:00:00Z"`
+	Changes      map[string]AuditChange `json:"changes,omitempty"`
+}
+
+// AuditChange is the value of a field before and after a change, nil where the field was not set.
+type AuditChange struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+// AuditChanges compares the json representation of a resource before and after a change and
+// returns the fields that differ. Before is nil for created and after is nil for deleted
+// resources, in which case every field that is set is returned.
+func AuditChanges(before, after any) (map[string]AuditChange, error) {
+	beforeFields, err := jsonFields(before)
+	if err != nil {
+		return nil, err
+	}
+
+	afterFields, err := jsonFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]AuditChange)
+	for name, value := range beforeFields {
+		if afterValue, isPresent := afterFields[name]; !isPresent || !reflect.DeepEqual(value, afterValue) {
+			changes[name] = AuditChange{Before: value, After: afterFields[name]}
+		}
+	}
+
+	for name, value := range afterFields {
+		if _, isPresent := beforeFields[name]; !isPresent {
+			changes[name] = AuditChange{After: value}
+		}
+	}
+
+	return changes, nil
+}
+
+func jsonFields(value any) (map[string]any, error) {
+	fields := make(map[string]any)
+	if value == nil || (reflect.ValueOf(value).Kind() == reflect.Pointer && reflect.ValueOf(value).IsNil()) {
+		return fields, nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	return fields, nil
+}
+
+// AuditFilter narrows the audit entries returned. From is inclusive and To exclusive, nil fields
+// do not filter.
+type AuditFilter struct {
+	From         *time.Time
+	To           *time.Time
+	Action       *AuditAction
+	ResourceType *AuditResourceType
+	ResourceUUID *uuid.UUID
+	DocumentUUID *uuid.UUID
+	// Limit is the maximum number of entries returned, newest first.
+	Limit int
+}
+
+// AuditRepository stores the audit log.
+type AuditRepository interface {
+	// AddEntries stores the entries. Entries without an owner or actor get the owner of their
+	// document, if the document still exists.
+	AddEntries(entries []AuditEntry) error
+	// GetEntries returns the entries the caller is the actor or the owner of, newest first.
+	GetEntries(ownerUid uuid.UUID, filter AuditFilter) ([]AuditEntry, error)
+}
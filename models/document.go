@@ -1,26 +1,69 @@
 package models
 
 import (
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 type Document struct {
-	Uuid          uuid.UUID    `json:"documentUUID" example:"ba3ca973-5052-4030-a528-39b49736d8ad"`
-	DocumentTitle *string      `json:"documentTitle,omitempty"`
-	TimeCreated   *time.Time   `json:"timeCreated,omitempty"`
-	OwnerUUID     *uuid.UUID   `json:"ownerUUID,omitempty"`
-	OwnerType     *int         `json:"ownerType,omitempty"`
-	PdfBase64     *string      `json:"pdfBase64,omitempty"`
-	SelectionData *[]Selection `json:"selectionData,omitempty"`
+	Uuid          uuid.UUID   `json:"documentUUID" example:"ba3ca973-5052-4030-a528-39b49736d8ad"`
+	DocumentTitle *string     `json:"documentTitle,omitempty"`
+	TimeCreated   *time.Time  `json:"timeCreated,omitempty"`
+	OwnerUUID     *uuid.UUID  `json:"ownerUUID,omitempty"`
+	OwnerType     *int        `json:"ownerType,omitempty"`
+	PdfBase64     *string     `json:"pdfBase64,omitempty"`
+	MetaStatus    *MetaStatus `json:"metaStatus,omitempty" example:"complete"`
+	// DerivedFromUUID links a document produced from another one, such as a redacted copy, to
+	// its original.
+	DerivedFromUUID *uuid.UUID   `json:"derivedFromUUID,omitempty"`
+	SelectionData   *[]Selection `json:"selectionData,omitempty"`
+	// Version is incremented on every change of the document. The meta status is progress of the
+	// extraction, not a change of the document, and is followed through the document's events.
+	Version int `json:"version,omitempty" example:"3"`
 }
 
+// ErrVersionConflict is returned when a change is conditional on a version of a document, meta
+// data or selection that is no longer its current version.
+var ErrVersionConflict = errors.New("resource was changed in the meantime")
+
+// MetaStatus tracks the progress of the meta extraction for a document.
+// Documents that never requested an extraction have no status.
+type MetaStatus string
+
+const (
+	MetaStatusPending    MetaStatus = "pending"
+	MetaStatusProcessing MetaStatus = "processing"
+	MetaStatusComplete   MetaStatus = "complete"
+	MetaStatusFailed     MetaStatus = "failed"
+)
+
 type DocumentRepository interface {
 	UploadDocument(document Document) error
 	GetDocumentByDocumentUUID(document, owner uuid.UUID, excludes Exclude) (Document, error)
 	GetDocumentByOwnerUUID(owner uuid.UUID, limit uint32, offset uint32, excludes Exclude) ([]Document, error)
-	DeleteDocumentById(documentUuid, ownerUuid uuid.UUID) error
+	// DeleteDocumentById deletes the document, when ifVersion is not nil only if it is still at
+	// that version, failing with ErrVersionConflict otherwise.
+	DeleteDocumentById(documentUuid, ownerUuid uuid.UUID, ifVersion *int) error
+	SetMetaStatus(documentUuid uuid.UUID, status MetaStatus) error
+	// GetDocumentShares lists who the owner shared the document with, failing with
+	// sql.ErrNoRows if the owner has no such document.
+	GetDocumentShares(documentUuid, ownerUuid uuid.UUID) ([]DocumentShare, error)
+	// ShareDocument grants the grantee access to the selections of a document of the owner, or
+	// changes the access granted before. It fails with sql.ErrNoRows if the owner has no such
+	// document.
+	ShareDocument(documentUuid, ownerUuid uuid.UUID, share DocumentShare) error
+	// UnshareDocument revokes the access of the grantee, failing with sql.ErrNoRows if the
+	// document of the owner is not shared with them.
+	UnshareDocument(documentUuid, ownerUuid, granteeUuid uuid.UUID) error
+}
+
+// DocumentShare grants a user other than the owner access to the selections of a document,
+// for reading and with CanWrite also for changing them.
+type DocumentShare struct {
+	GranteeUUID uuid.UUID `json:"granteeUUID" binding:"required" example:"ea167a48-c1b3-46c4-911b-090e807132fc"`
+	CanWrite    bool      `json:"canWrite" example:"true"`
 }
 
 type Exclude map[string]bool
@@ -49,3 +92,13 @@ func (e Exclude) PdfBase64(value bool) Exclude {
 	e["pdfBase64"] = value
 	return e
 }
+
+func (e Exclude) MetaStatus(value bool) Exclude {
+	e["metaStatus"] = value
+	return e
+}
+
+func (e Exclude) DerivedFromUUID(value bool) Exclude {
+	e["derivedFromUUID"] = value
+	return e
+}
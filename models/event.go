@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type EventType string
+
+const (
+	EventMetaStatus          EventType = "meta-status"
+	EventExtractionStarted   EventType = "extraction-started"
+	EventExtractionProgress  EventType = "extraction-progress"
+	EventExtractionCompleted EventType = "extraction-completed"
+	EventExtractionFailed    EventType = "extraction-failed"
+	EventSelectionsChanged   EventType = "selections-changed"
+)
+
+// Event describes something that happened to a document while it is being processed.
+type Event struct {
+	Type          EventType   `json:"type" example:"extraction-progress"`
+	DocumentUUID  uuid.UUID   `json:"documentUUID" example:"ba3ca973-5052-4030-a528-39b49736d8ad"`
+	Time          time.Time   `json:"time"`
+	MetaStatus    *MetaStatus `json:"metaStatus,omitempty" example:"processing"`
+	PageKey       *string     `json:"pageKey,omitempty" example:"3"`
+	PagesDone     *uint32     `json:"pagesDone,omitempty" example:"4"`
+	NumberOfPages *uint32     `json:"numberOfPages,omitempty" example:"31"`
+	SelectionUUID *uuid.UUID  `json:"selectionUUID,omitempty"`
+	Error         *string     `json:"error,omitempty"`
+}
+
+type EventBus interface {
+	Publish(event Event)
+	// Subscribe returns a channel receiving every event published for the document, and a function
+	// that has to be called once the subscriber is no longer interested.
+	Subscribe(documentUuid uuid.UUID) (<-chan Event, func())
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"net/http"
+	"time"
+)
+
+// IdempotencyRecord remembers a request made with an Idempotency-Key header, so a retry of it
+// is answered with the original response instead of being processed again. Keys are only unique
+// within their Scope, which names the caller and route of the request. Fingerprint identifies
+// the method, target and body of the request. Status, Header and Body hold the response, Status
+// is nil while the first request is still being processed. LeaseExpiresAt bounds how long that
+// may take, a request that did not answer by then is taken to have died and its key is reclaimed.
+type IdempotencyRecord struct {
+	Scope          string
+	Key            string
+	Fingerprint    string
+	Status         *int
+	Header         http.Header
+	Body           []byte
+	CreatedAt      time.Time
+	LeaseExpiresAt time.Time
+}
+
+type IdempotencyRepository interface {
+	// Reserve stores the record unless a record with its scope and key created at or after
+	// expiredBefore exists. It returns false together with the existing record in that case,
+	// older records are discarded, and so are records without a response whose lease expired
+	// before the record was created.
+	Reserve(record IdempotencyRecord, expiredBefore time.Time) (IdempotencyRecord, bool, error)
+	// Complete stores the response of a reserved key.
+	Complete(scope, key string, status int, header http.Header, body []byte) error
+	// Release discards a reserved key, so the request can be retried.
+	Release(scope, key string) error
+}
@@ -1,13 +1,40 @@
 package models
 
-import "github.com/google/uuid"
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/google/uuid"
+)
 
 type MetaRepository interface {
 	AddMeta(data Meta) error
-	DeleteMeta(data Meta) error
-	UpdateMeta(uid uuid.UUID, data Meta) error
+	// DeleteMeta and UpdateMeta change the meta data, when ifVersion is not nil only if it is
+	// still at that version, failing with ErrVersionConflict otherwise.
+	DeleteMeta(data Meta, ifVersion *int) error
+	UpdateMeta(uid uuid.UUID, data Meta, ifVersion *int) error
 	GetMeta(documentUid, ownerUid uuid.UUID) (Meta, error)
 	GetMetaPagination(documentUid, ownerUid uuid.UUID, start, end uint32) (Meta, error)
+	// AddPages stores the given pages, replacing pages of the document with the same page key.
+	// The page numbers of the given pages are ignored, all pages are renumbered by their key.
+	AddPages(documentUid uuid.UUID, pages []Page) error
+	// StoreExtraction replaces the meta data and pages of a document with the result of an
+	// extraction. extract runs outside of any transaction, the pages it hands to addPages as they
+	// arrive are staged and swapped in together with the meta data in one transaction once it
+	// returned. Nothing is stored when it fails. Existing meta data is overwritten.
+	StoreExtraction(documentUid uuid.UUID, extract func(addPages func(pages []Page) error) (Meta, error)) error
+	// GetPages returns the pages of a document with a page number between first and last, both inclusive.
+	GetPages(documentUid, ownerUid uuid.UUID, first, last uint32) ([]Page, error)
+	// GetPageByKey returns the page of a document the caller owns or that is shared with them.
+	GetPageByKey(documentUid, ownerUid uuid.UUID, pageKey string) (Page, error)
+	// GetPageGeometry returns the number of pages, size and page geometry of a document without
+	// any images. A document without meta data yields an empty Meta.
+	GetPageGeometry(documentUid uuid.UUID) (Meta, error)
+	// GetPageGeometryForOwner is GetPageGeometry on behalf of a caller, failing with
+	// sql.ErrNoRows unless they own the document or it is shared with them.
+	GetPageGeometryForOwner(documentUid, ownerUid uuid.UUID) (Meta, error)
 }
 
 type Meta struct {
@@ -16,6 +43,176 @@ type Meta struct {
 	Width         *float32           `json:"width,omitempty" example:"1920"`
 	Height        *float32           `json:"height,omitempty" example:"1080"`
 	Images        *map[string]string `json:"images,omitempty"`
+	Pages         []PageGeometry     `json:"pages,omitempty"`
 	OwnerUUID     *uuid.UUID         `json:"ownerUUID,omitempty" example:"34906041-2d68-45a2-9671-9f0ba89f31a9"`
 	OwnerType     *int               `json:"ownerType,omitempty" example:"1"`
+	// Version is incremented on every change of the meta data or the pages of the document.
+	Version int `json:"version,omitempty" example:"2"`
+}
+
+// Page is a single rendered page of a document. Image holds the reference returned by the
+// data service, which is a base64 encoded image or a data uri.
+type Page struct {
+	DocumentUUID uuid.UUID `json:"documentUUID" example:"ba3ca973-5052-4030-a528-39b49736d8ad"`
+	// PageNumber is the position of the page in the key order of the pages of its document,
+	// starting at 0. Numeric keys are ordered by their value and come before any other keys.
+	PageNumber uint32  `json:"pageNumber" example:"0"`
+	PageKey    string  `json:"pageKey" example:"0"`
+	Image      *string `json:"image,omitempty"`
+	Width      *uint32 `json:"width,omitempty" example:"1275"`
+	Height     *uint32 `json:"height,omitempty" example:"1650"`
+	MimeType   *string `json:"mimeType,omitempty" example:"image/png"`
+}
+
+// Box is a rectangle in pdf user space, given as [llx, lly, urx, ury].
+type Box [4]float32
+
+// Width returns the horizontal extent of the box, regardless of the order of its corners.
+func (b Box) Width() float32 {
+	if b[2] < b[0] {
+		return b[0] - b[2]
+	}
+	return b[2] - b[0]
+}
+
+// Height returns the vertical extent of the box, regardless of the order of its corners.
+func (b Box) Height() float32 {
+	if b[3] < b[1] {
+		return b[1] - b[3]
+	}
+	return b[3] - b[1]
+}
+
+// PageGeometry describes the boxes and orientation of a single pdf page. Rotation is the
+// clockwise rotation in degrees applied when the page is displayed, always one of 0, 90, 180
+// or 270, and UserUnit the size of a user space unit in multiples of 1/72 inch.
+type PageGeometry struct {
+	PageNumber uint32   `json:"pageNumber" example:"6"`
+	PageKey    string   `json:"pageKey,omitempty" example:"6"`
+	MediaBox   *Box     `json:"mediaBox,omitempty" swaggertype:"array,number" example:"0,0,612,792"`
+	CropBox    *Box     `json:"cropBox,omitempty" swaggertype:"array,number" example:"0,0,612,792"`
+	Rotation   *int     `json:"rotation,omitempty" example:"90"`
+	UserUnit   *float32 `json:"userUnit,omitempty" example:"1"`
+}
+
+// VisibleBox returns the crop box of the page, falling back to the media box as the pdf
+// specification does. The second return value is false if neither is known.
+func (g PageGeometry) VisibleBox() (Box, bool) {
+	if g.CropBox != nil {
+		return *g.CropBox, true
+	}
+	if g.MediaBox != nil {
+		return *g.MediaBox, true
+	}
+	return Box{}, false
+}
+
+// DisplaySize returns the size of the page in points as it is displayed, that is with the
+// user unit and rotation applied.
+func (g PageGeometry) DisplaySize() (width, height float32, ok bool) {
+	box, ok := g.VisibleBox()
+	if !ok {
+		return 0, 0, false
+	}
+
+	unit := float32(1)
+	if g.UserUnit != nil && *g.UserUnit > 0 {
+		unit = *g.UserUnit
+	}
+
+	width, height = box.Width()*unit, box.Height()*unit
+	if g.Rotation != nil && (*g.Rotation == 90 || *g.Rotation == 270) {
+		width, height = height, width
+	}
+
+	return width, height, true
+}
+
+// PageGeometry returns the geometry of the page with the given key. Pages without stored
+// geometry fall back to the document wide size, which is the displayed size of the first page.
+// It fails with ErrPageOutOfRange for pages known not to exist and with ErrNoPageGeometry if
+// nothing is known about the page.
+func (m Meta) PageGeometry(pageKey string) (PageGeometry, error) {
+	for _, page := range m.Pages {
+		if page.PageKey == pageKey {
+			return m.withDocumentSize(page), nil
+		}
+	}
+
+	pageNumber, err := strconv.ParseUint(pageKey, 10, 32)
+	if err != nil {
+		if len(m.Pages) > 0 {
+			return PageGeometry{}, fmt.Errorf("%w: no page with key %q", ErrPageOutOfRange, pageKey)
+		}
+		return PageGeometry{}, ErrNoPageGeometry
+	}
+
+	if m.NumberOfPages != nil && pageNumber >= uint64(*m.NumberOfPages) {
+		return PageGeometry{}, fmt.Errorf("%w: page %d of %d", ErrPageOutOfRange, pageNumber, *m.NumberOfPages)
+	}
+
+	for _, page := range m.Pages {
+		if uint64(page.PageNumber) == pageNumber {
+			return m.withDocumentSize(page), nil
+		}
+	}
+
+	if m.Width == nil || m.Height == nil {
+		return PageGeometry{}, ErrNoPageGeometry
+	}
+
+	return m.withDocumentSize(PageGeometry{PageNumber: uint32(pageNumber), PageKey: pageKey}), nil
+}
+
+// withDocumentSize gives a page without boxes the document wide size as its media box.
+func (m Meta) withDocumentSize(page PageGeometry) PageGeometry {
+	if _, ok := page.VisibleBox(); ok || m.Width == nil || m.Height == nil {
+		return page
+	}
+
+	page.MediaBox = &Box{0, 0, *m.Width, *m.Height}
+	return page
+}
+
+// NormalizeRotation maps any multiple of 90 degrees onto 0, 90, 180 or 270.
+// The second return value is false if the rotation is not a multiple of 90.
+func NormalizeRotation(rotation int) (int, bool) {
+	if rotation%90 != 0 {
+		return 0, false
+	}
+
+	rotation %= 360
+	if rotation < 0 {
+		rotation += 360
+	}
+
+	return rotation, true
+}
+
+// MetaExtractionJob describes a document whose meta data should be generated in the background.
+// PdfBase64 may be left nil, in which case the document is loaded from the DocumentRepository.
+type MetaExtractionJob struct {
+	DocumentUUID uuid.UUID
+	OwnerUUID    uuid.UUID
+	OwnerType    int
+	PdfBase64    *string
+	// RequestID is the id of the request that queued the job, the extraction is logged under it.
+	RequestID string
+}
+
+type MetaExtractionQueue interface {
+	Enqueue(job MetaExtractionJob) error
+}
+
+// PageHandler receives the page images of an extraction one at a time, together with the number
+// of pages of the document when the extractor knows it before the last page, nil otherwise.
+type PageHandler func(pageKey string, image string, numberOfPages *uint32) error
+
+// MetaExtractor generates the meta data of a pdf document, read as base64 from the given reader.
+// When onPage is nil the page images are collected into Meta.Images, otherwise every image is
+// handed to onPage and Meta.Images is left empty. The reader is rewound when a request is retried,
+// but once a page was handed to onPage the request is neither retried nor repeated elsewhere, so
+// onPage sees every page at most once.
+type MetaExtractor interface {
+	SendMetaRequest(ctx context.Context, base64 io.ReadSeeker, onPage PageHandler) (Meta, error)
 }
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"context"
+	"io"
+)
+
+// RedactionRegion is a region of a page whose content is removed, in pdf user space of the page.
+type RedactionRegion struct {
+	PageNumber uint32      `json:"pageNumber"`
+	Region     Coordinates `json:"region"`
+}
+
+// Redactor produces a copy of a pdf in which the content inside the regions is removed and the
+// regions are covered. The document is read as base64 from the given reader and the redacted
+// copy is returned as base64.
+type Redactor interface {
+	Redact(ctx context.Context, base64 io.ReadSeeker, regions []RedactionRegion) (string, error)
+}
@@ -1,20 +1,148 @@
 package models
 
-import "github.com/google/uuid"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+)
 
 type Selection struct {
-	Uuid         uuid.UUID    `json:"selectionUUID"`
-	PageKey      *string      `json:"pageKey,omitempty"`
-	DocumentUUID *uuid.UUID   `json:"documentUUID,omitempty"`
-	Coordinates  *Coordinates `json:"coordinates,omitempty"`
+	Uuid            uuid.UUID      `json:"selectionUUID"`
+	PageKey         *string        `json:"pageKey,omitempty"`
+	DocumentUUID    *uuid.UUID     `json:"documentUUID,omitempty"`
+	Coordinates     *Coordinates   `json:"coordinates,omitempty"`
+	Type            *SelectionType `json:"type,omitempty" example:"highlight"`
+	Label           *string        `json:"label,omitempty" example:"Invoice number"`
+	Note            *string        `json:"note,omitempty" example:"Check against the order"`
+	Color           *string        `json:"color,omitempty" example:"#ffd700"`
+	AuthorUUID      *uuid.UUID     `json:"authorUUID,omitempty"`
+	CreatedAt       *time.Time     `json:"createdAt,omitempty" example:"2024-05-01T12:00:00Z"`
+	UpdatedAt       *time.Time     `json:"updatedAt,omitempty" example:"2024-05-01T12:00:00Z"`
+	ExtractedText   *string        `json:"extractedText,omitempty" example:"Invoice number 2024-0042"`
+	TextExtractedAt *time.Time     `json:"textExtractedAt,omitempty" example:"2024-05-01T12:00:00Z"`
+	// Version is incremented on every change of the selection.
+	Version int `json:"version,omitempty" example:"2"`
+}
+
+// SelectionType tells what a selection is used for. Selections created before types existed
+// have no type.
+type SelectionType string
+
+const (
+	SelectionTypeHighlight SelectionType = "highlight"
+	SelectionTypeNote      SelectionType = "note"
+	SelectionTypeRedaction SelectionType = "redaction"
+	SelectionTypeField     SelectionType = "field"
+)
+
+func (s SelectionType) IsValid() bool {
+	switch s {
+	case SelectionTypeHighlight, SelectionTypeNote, SelectionTypeRedaction, SelectionTypeField:
+		return true
+	}
+	return false
+}
+
+// SelectionFilter narrows down the selections of a document. Empty fields match every selection.
+// The rectangles and the point are in pdf user space, selections without coordinates never
+// match them.
+type SelectionFilter struct {
+	Types   []SelectionType
+	PageKey *string
+	// Intersects matches the selections overlapping the rectangle, including its border.
+	Intersects *Coordinates
+	// Within matches the selections lying completely inside the rectangle.
+	Within *Coordinates
+	// Near orders the selections by their distance to the point, nearest first.
+	Near *Point
+	// Limit is the maximum number of selections returned, 0 for all of them.
+	Limit int
+}
+
+// Point is a position on a page.
+type Point struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
 }
 
+// ListPrecondition is checked against the current selections of a document before they are
+// changed together, listed in the order of GetSelectionListByDocumentUUID. The selections can not
+// change until the change is done, an error aborts it and is returned, typically wrapping
+// ErrVersionConflict.
+type ListPrecondition func(current []Selection) error
+
+// SelectionRepository stores selections. Every method takes the UUID of the caller, who has to
+// own the document of the selections or hold a share of it: reading needs any share, writing a
+// share with write access. Selections of other documents are treated as if they did not exist.
 type SelectionRepository interface {
-	GetSelectionListByDocumentUUID(uid uuid.UUID) ([]Selection, error)
-	GetSelectionBySelectionUUID(uid uuid.UUID) ([]Selection, error)
-	DeleteSelectionBySelectionUUID(uid uuid.UUID) error
-	AddNewSelection(selection Selection) error
-	DeleteSelectionByDocumentUUID(uid uuid.UUID) error
+	GetSelectionListByDocumentUUID(uid, ownerUid uuid.UUID, filter SelectionFilter) ([]Selection, error)
+	GetSelectionBySelectionUUID(uid, ownerUid uuid.UUID) ([]Selection, error)
+	// DeleteSelectionBySelectionUUID deletes the selection, when ifVersion is not nil only if it is
+	// still at that version, failing with ErrVersionConflict otherwise. A selection that does not
+	// exist fails with sql.ErrNoRows.
+	DeleteSelectionBySelectionUUID(uid, ownerUid uuid.UUID, ifVersion *int) error
+	AddNewSelection(selection Selection, ownerUid uuid.UUID) error
+	// DeleteSelectionByDocumentUUID and ReplaceSelections change all selections of a document,
+	// when precondition is not nil only if it accepts the selections they change, see
+	// ListPrecondition.
+	DeleteSelectionByDocumentUUID(uid, ownerUid uuid.UUID, precondition ListPrecondition) error
+	SetExtractedText(uid, ownerUid uuid.UUID, text string, extractedAt time.Time) error
+	UpdateSelection(uid, ownerUid uuid.UUID, update SelectionUpdate, updatedAt time.Time) (Selection, error)
+	AddSelections(selections []Selection, ownerUid uuid.UUID, mode BulkMode) ([]error, error)
+	UpdateSelections(updates []BulkSelectionUpdate, ownerUid uuid.UUID, updatedAt time.Time, mode BulkMode) ([]Selection, []error, error)
+	DeleteSelections(uids []uuid.UUID, ownerUid uuid.UUID, mode BulkMode) ([]error, error)
+	ReplaceSelections(documentUid, ownerUid uuid.UUID, pageKey *string, selections []Selection, precondition ListPrecondition) error
+	// CheckDocumentAccess fails with sql.ErrNoRows unless the caller may read the selections of
+	// the document, or with write also change them.
+	CheckDocumentAccess(documentUid, ownerUid uuid.UUID, write bool) error
+}
+
+// BulkMode decides how a bulk operation treats failing items. Both modes run in one transaction.
+type BulkMode string
+
+const (
+	// BulkModeAtomic stores all items or none of them. The item errors are always nil, the first
+	// failure is returned as the error of the operation.
+	BulkModeAtomic BulkMode = "atomic"
+	// BulkModePerItem stores every item that succeeds and reports the failure of each other item.
+	BulkModePerItem BulkMode = "perItem"
+)
+
+func (m BulkMode) IsValid() bool {
+	return m == BulkModeAtomic || m == BulkModePerItem
+}
+
+// BulkSelectionUpdate is the update of one selection within a bulk update.
+type BulkSelectionUpdate struct {
+	SelectionUUID uuid.UUID
+	Update        SelectionUpdate
+}
+
+// SelectionUpdate holds the new values of the editable fields of a selection. Without Replace,
+// nil fields keep their stored value; with Replace, every field is overwritten and nil clears it.
+type SelectionUpdate struct {
+	PageKey     *string
+	Coordinates *Coordinates
+	Type        *SelectionType
+	Label       *string
+	Note        *string
+	Color       *string
+	AuthorUUID  *uuid.UUID
+	Replace     bool
+	// IfVersion makes the update conditional on the selection still being at that version, it
+	// fails with ErrVersionConflict otherwise. Nil updates whatever version is stored.
+	IfVersion *int
+}
+
+// TextExtractor reads the text inside a region of a pdf page. The document is read as base64
+// from the given reader and the region is given in pdf user space of the page.
+type TextExtractor interface {
+	ExtractText(ctx context.Context, base64 io.ReadSeeker, pageNumber uint32, region Coordinates) (string, error)
 }
 
 type Coordinates struct {
@@ -23,3 +151,233 @@ type Coordinates struct {
 	X2 float64 `json:"x2" example:"13"`
 	Y2 float64 `json:"y2" example:"27.853"`
 }
+
+// Normalized returns the coordinates with X1/Y1 as the smaller and X2/Y2 as the larger values.
+func (c Coordinates) Normalized() Coordinates {
+	return Coordinates{
+		X1: math.Min(c.X1, c.X2),
+		Y1: math.Min(c.Y1, c.Y2),
+		X2: math.Max(c.X1, c.X2),
+		Y2: math.Max(c.Y1, c.Y2),
+	}
+}
+
+var (
+	ErrInvalidCoordinateSystem = errors.New("invalid coordinate system")
+	ErrInvalidCoordinates      = errors.New("invalid coordinates")
+	ErrPageOutOfRange          = errors.New("page does not exist in the document")
+	ErrNoPageGeometry          = errors.New("page geometry of the document is unknown")
+)
+
+// CoordinateSpace is the unit and origin coordinates of a selection are given in.
+type CoordinateSpace string
+
+const (
+	// CoordinateSpacePdf is pdf user space in points, with the origin in the lower left corner
+	// of the unrotated page. Selections are stored in this space.
+	CoordinateSpacePdf CoordinateSpace = "pdf"
+	// CoordinateSpacePixels is pixels of the displayed page rendered at a given dpi, with the
+	// origin in the upper left corner.
+	CoordinateSpacePixels CoordinateSpace = "px"
+	// CoordinateSpaceRelative is fractions between 0 and 1 of the displayed page, with the origin
+	// in the upper left corner.
+	CoordinateSpaceRelative CoordinateSpace = "relative"
+)
+
+// CoordinateSystem is a coordinate space together with its resolution, which only pixels use.
+type CoordinateSystem struct {
+	Space CoordinateSpace
+	DPI   float64
+}
+
+func (s CoordinateSystem) Validate() error {
+	switch s.Space {
+	case CoordinateSpacePdf, CoordinateSpaceRelative:
+		return nil
+	case CoordinateSpacePixels:
+		if s.DPI <= 0 || math.IsInf(s.DPI, 0) || math.IsNaN(s.DPI) {
+			return fmt.Errorf("%w: pixels need a positive dpi", ErrInvalidCoordinateSystem)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("%w: unknown coordinate space %q, expected pdf, px or relative", ErrInvalidCoordinateSystem, s.Space)
+}
+
+// geometryTolerance allows coordinates to exceed the page by rounding errors of the client.
+const geometryTolerance = 0.01
+
+// ToPdf converts coordinates given in the coordinate system into pdf user space of the page,
+// normalizes their corners and checks that they lie on the page.
+func (g PageGeometry) ToPdf(c Coordinates, system CoordinateSystem) (Coordinates, error) {
+	return g.toPdf(c, system, true)
+}
+
+// ToPdfUnbounded converts like ToPdf, but accepts coordinates reaching past the page, such as the
+// rectangles of spatial queries near its edges.
+func (g PageGeometry) ToPdfUnbounded(c Coordinates, system CoordinateSystem) (Coordinates, error) {
+	return g.toPdf(c, system, false)
+}
+
+func (g PageGeometry) toPdf(c Coordinates, system CoordinateSystem, onPage bool) (Coordinates, error) {
+	if err := system.Validate(); err != nil {
+		return Coordinates{}, err
+	}
+
+	if err := c.Validate(); err != nil {
+		return Coordinates{}, err
+	}
+
+	box, ok := g.VisibleBox()
+	if !ok || box.Width() == 0 || box.Height() == 0 {
+		return Coordinates{}, ErrNoPageGeometry
+	}
+
+	if system.Space == CoordinateSpacePdf {
+		c = c.Normalized()
+		if onPage && !boxContains(box, c) {
+			return Coordinates{}, fmt.Errorf("%w: rectangle lies outside of page %d", ErrInvalidCoordinates, g.PageNumber)
+		}
+		return c, nil
+	}
+
+	if onPage && system.Space == CoordinateSpaceRelative {
+		c = c.Normalized()
+		if c.X1 < -geometryTolerance || c.Y1 < -geometryTolerance || c.X2 > 1+geometryTolerance || c.Y2 > 1+geometryTolerance {
+			return Coordinates{}, fmt.Errorf("%w: relative coordinates must be between 0 and 1", ErrInvalidCoordinates)
+		}
+	}
+
+	x1, y1 := g.displayToPdf(box, system, c.X1, c.Y1)
+	x2, y2 := g.displayToPdf(box, system, c.X2, c.Y2)
+	result := Coordinates{X1: x1, Y1: y1, X2: x2, Y2: y2}.Normalized()
+	if onPage && !boxContains(box, result) {
+		return Coordinates{}, fmt.Errorf("%w: rectangle lies outside of page %d", ErrInvalidCoordinates, g.PageNumber)
+	}
+
+	return result, nil
+}
+
+// FromPdf converts coordinates in pdf user space of the page into the coordinate system, with
+// the corners of the result normalized.
+func (g PageGeometry) FromPdf(c Coordinates, system CoordinateSystem) (Coordinates, error) {
+	if err := system.Validate(); err != nil {
+		return Coordinates{}, err
+	}
+
+	if system.Space == CoordinateSpacePdf {
+		return c.Normalized(), nil
+	}
+
+	box, ok := g.VisibleBox()
+	if !ok || box.Width() == 0 || box.Height() == 0 {
+		return Coordinates{}, ErrNoPageGeometry
+	}
+
+	x1, y1 := g.pdfToDisplay(box, system, c.X1, c.Y1)
+	x2, y2 := g.pdfToDisplay(box, system, c.X2, c.Y2)
+	return Coordinates{X1: x1, Y1: y1, X2: x2, Y2: y2}.Normalized(), nil
+}
+
+// Validate checks that all coordinates are finite numbers.
+func (c Coordinates) Validate() error {
+	for _, value := range []float64{c.X1, c.Y1, c.X2, c.Y2} {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return fmt.Errorf("%w: coordinates must be finite numbers", ErrInvalidCoordinates)
+		}
+	}
+
+	return nil
+}
+
+func boxContains(box Box, c Coordinates) bool {
+	minX, maxX := math.Min(float64(box[0]), float64(box[2])), math.Max(float64(box[0]), float64(box[2]))
+	minY, maxY := math.Min(float64(box[1]), float64(box[3])), math.Max(float64(box[1]), float64(box[3]))
+	tolerance := geometryTolerance * math.Max(maxX-minX, maxY-minY)
+
+	return c.X1 >= minX-tolerance && c.X2 <= maxX+tolerance && c.Y1 >= minY-tolerance && c.Y2 <= maxY+tolerance
+}
+
+// unrotatedSize returns the width and height of the visible box in points, with the user unit
+// applied but without rotation, together with the user unit.
+func (g PageGeometry) unrotatedSize(box Box) (width, height, unit float64) {
+	unit = 1
+	if g.UserUnit != nil && *g.UserUnit > 0 {
+		unit = float64(*g.UserUnit)
+	}
+
+	return float64(box.Width()) * unit, float64(box.Height()) * unit, unit
+}
+
+func (g PageGeometry) rotation() int {
+	if g.Rotation == nil {
+		return 0
+	}
+
+	rotation, _ := NormalizeRotation(*g.Rotation)
+	return rotation
+}
+
+// displayToPdf maps a point of the displayed page, whose origin is the upper left corner,
+// into pdf user space.
+func (g PageGeometry) displayToPdf(box Box, system CoordinateSystem, x, y float64) (float64, float64) {
+	width, height, unit := g.unrotatedSize(box)
+
+	// Scale into points of the displayed page.
+	if system.Space == CoordinateSpacePixels {
+		x, y = x*72/system.DPI, y*72/system.DPI
+	} else {
+		displayWidth, displayHeight := width, height
+		if g.rotation() == 90 || g.rotation() == 270 {
+			displayWidth, displayHeight = height, width
+		}
+		x, y = x*displayWidth, y*displayHeight
+	}
+
+	// Undo the clockwise rotation, giving points of the unrotated page from its upper left corner.
+	var ux, uy float64
+	switch g.rotation() {
+	case 90:
+		ux, uy = y, height-x
+	case 180:
+		ux, uy = width-x, height-y
+	case 270:
+		ux, uy = width-y, x
+	default:
+		ux, uy = x, y
+	}
+
+	left := math.Min(float64(box[0]), float64(box[2]))
+	top := math.Max(float64(box[1]), float64(box[3]))
+	return left + ux/unit, top - uy/unit
+}
+
+// pdfToDisplay is the inverse of displayToPdf.
+func (g PageGeometry) pdfToDisplay(box Box, system CoordinateSystem, x, y float64) (float64, float64) {
+	width, height, unit := g.unrotatedSize(box)
+
+	left := math.Min(float64(box[0]), float64(box[2]))
+	top := math.Max(float64(box[1]), float64(box[3]))
+	ux, uy := (x-left)*unit, (top-y)*unit
+
+	var dx, dy float64
+	displayWidth, displayHeight := width, height
+	switch g.rotation() {
+	case 90:
+		dx, dy = height-uy, ux
+		displayWidth, displayHeight = height, width
+	case 180:
+		dx, dy = width-ux, height-uy
+	case 270:
+		dx, dy = uy, width-ux
+		displayWidth, displayHeight = height, width
+	default:
+		dx, dy = ux, uy
+	}
+
+	if system.Space == CoordinateSpacePixels {
+		return dx * system.DPI / 72, dy * system.DPI / 72
+	}
+
+	return dx / displayWidth, dy / displayHeight
+}
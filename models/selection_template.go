@@ -0,0 +1,70 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SelectionTemplate is a named set of selections saved from one document, to be applied to
+// other documents with the same layout. Saving a template under a name the owner already used
+// adds a new version, the older versions stay available.
+type SelectionTemplate struct {
+	Uuid               uuid.UUID           `json:"templateUUID"`
+	OwnerUUID          uuid.UUID           `json:"ownerUUID"`
+	Name               string              `json:"name" example:"ACME invoice"`
+	Version            int                 `json:"version" example:"2"`
+	SourceDocumentUUID *uuid.UUID          `json:"sourceDocumentUUID,omitempty"`
+	CreatedAt          time.Time           `json:"createdAt" example:"2024-05-01T12:00:00Z"`
+	Selections         []TemplateSelection `json:"selections,omitempty"`
+}
+
+// TemplateSelection is a selection of a template. Its coordinates are in pdf user space of the
+// source page, whose geometry is kept to scale the selection onto pages of another size.
+type TemplateSelection struct {
+	PageKey      string         `json:"pageKey" example:"0"`
+	PageGeometry *PageGeometry  `json:"pageGeometry,omitempty"`
+	Coordinates  *Coordinates   `json:"coordinates,omitempty"`
+	Type         *SelectionType `json:"type,omitempty" example:"field"`
+	Label        *string        `json:"label,omitempty" example:"Invoice number"`
+	Note         *string        `json:"note,omitempty"`
+	Color        *string        `json:"color,omitempty" example:"#ffd700"`
+}
+
+// ScaledTo moves the coordinates of the selection onto a page of another size, keeping their
+// position relative to the displayed page. It fails with ErrNoPageGeometry if the geometry of
+// the source page was unknown when the template was saved.
+func (s TemplateSelection) ScaledTo(page PageGeometry) (*Coordinates, error) {
+	if s.Coordinates == nil {
+		return nil, nil
+	}
+
+	if s.PageGeometry == nil {
+		return nil, ErrNoPageGeometry
+	}
+
+	relative := CoordinateSystem{Space: CoordinateSpaceRelative}
+	coordinates, err := s.PageGeometry.FromPdf(*s.Coordinates, relative)
+	if err != nil {
+		return nil, err
+	}
+
+	scaled, err := page.ToPdf(coordinates, relative)
+	if err != nil {
+		return nil, err
+	}
+
+	return &scaled, nil
+}
+
+// SelectionTemplateRepository stores the selection templates of their owners. Templates of
+// other owners are treated as if they did not exist.
+type SelectionTemplateRepository interface {
+	// AddTemplate stores the template as the next version of its name and returns the version.
+	AddTemplate(template SelectionTemplate) (int, error)
+	// GetTemplates lists the templates of the owner without their selections, every version of
+	// the name if one is given, ordered by name and newest version first.
+	GetTemplates(ownerUid uuid.UUID, name *string) ([]SelectionTemplate, error)
+	GetTemplate(uid, ownerUid uuid.UUID) (SelectionTemplate, error)
+	DeleteTemplate(uid, ownerUid uuid.UUID) error
+}
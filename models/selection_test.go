@@ -0,0 +1,128 @@
+package models_test
+
+import (
+	"pdf_service_api/models"
+	_ "pdf_service_api/testutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func geometry(rotation int) models.PageGeometry {
+	return models.PageGeometry{MediaBox: &models.Box{0, 0, 612, 792}, Rotation: &rotation}
+}
+
+func TestToPdfNormalizesPdfCoordinates(t *testing.T) {
+	converted, err := geometry(0).ToPdf(models.Coordinates{X1: 100, Y1: 700, X2: 50, Y2: 600}, models.CoordinateSystem{Space: models.CoordinateSpacePdf})
+	require.NoError(t, err)
+	assert.Equal(t, models.Coordinates{X1: 50, Y1: 600, X2: 100, Y2: 700}, converted)
+
+	_, err = geometry(0).ToPdf(models.Coordinates{X1: 0, Y1: 0, X2: 700, Y2: 10}, models.CoordinateSystem{Space: models.CoordinateSpacePdf})
+	assert.ErrorIs(t, err, models.ErrInvalidCoordinates)
+}
+
+func TestToPdfConvertsPixelsAndRelative(t *testing.T) {
+	// The upper left inch of the page at 144 dpi.
+	converted, err := geometry(0).ToPdf(models.Coordinates{X1: 0, Y1: 0, X2: 144, Y2: 144}, models.CoordinateSystem{Space: models.CoordinateSpacePixels, DPI: 144})
+	require.NoError(t, err)
+	assert.InDeltaSlice(t, []float64{0, 720, 72, 792}, []float64{converted.X1, converted.Y1, converted.X2, converted.Y2}, 1e-9)
+
+	converted, err = geometry(0).ToPdf(models.Coordinates{X1: 0.5, Y1: 0.5, X2: 1, Y2: 1}, models.CoordinateSystem{Space: models.CoordinateSpaceRelative})
+	require.NoError(t, err)
+	assert.InDeltaSlice(t, []float64{306, 0, 612, 396}, []float64{converted.X1, converted.Y1, converted.X2, converted.Y2}, 1e-9)
+
+	_, err = geometry(0).ToPdf(models.Coordinates{X1: 0, Y1: 0, X2: 1.5, Y2: 1}, models.CoordinateSystem{Space: models.CoordinateSpaceRelative})
+	assert.ErrorIs(t, err, models.ErrInvalidCoordinates)
+}
+
+func TestToPdfUnboundedAcceptsRectanglesPastThePage(t *testing.T) {
+	// A rectangle around the lower right corner of the page at 72 dpi.
+	converted, err := geometry(0).ToPdfUnbounded(models.Coordinates{X1: 600, Y1: 780, X2: 624, Y2: 804}, models.CoordinateSystem{Space: models.CoordinateSpacePixels, DPI: 72})
+	require.NoError(t, err)
+	assert.InDeltaSlice(t, []float64{600, -12, 624, 12}, []float64{converted.X1, converted.Y1, converted.X2, converted.Y2}, 1e-9)
+
+	converted, err = geometry(0).ToPdfUnbounded(models.Coordinates{X1: 0.5, Y1: 0.5, X2: 1.5, Y2: 1}, models.CoordinateSystem{Space: models.CoordinateSpaceRelative})
+	require.NoError(t, err)
+	assert.InDeltaSlice(t, []float64{306, 0, 918, 396}, []float64{converted.X1, converted.Y1, converted.X2, converted.Y2}, 1e-9)
+
+	_, err = geometry(0).ToPdf(models.Coordinates{X1: 600, Y1: 780, X2: 624, Y2: 804}, models.CoordinateSystem{Space: models.CoordinateSpacePixels, DPI: 72})
+	assert.ErrorIs(t, err, models.ErrInvalidCoordinates, "stored selections still have to lie on the page")
+}
+
+func TestConversionRoundTripsOnRotatedPages(t *testing.T) {
+	stored := models.Coordinates{X1: 72, Y1: 100, X2: 200, Y2: 300}
+	systems := []models.CoordinateSystem{
+		{Space: models.CoordinateSpacePixels, DPI: 96},
+		{Space: models.CoordinateSpaceRelative},
+	}
+
+	for _, rotation := range []int{0, 90, 180, 270} {
+		for _, system := range systems {
+			displayed, err := geometry(rotation).FromPdf(stored, system)
+			require.NoError(t, err)
+
+			converted, err := geometry(rotation).ToPdf(displayed, system)
+			require.NoError(t, err)
+			assert.InDeltaSlice(t, []float64{stored.X1, stored.Y1, stored.X2, stored.Y2}, []float64{converted.X1, converted.Y1, converted.X2, converted.Y2}, 1e-6)
+		}
+	}
+
+	// Rotated by 90 degrees the lower left corner of the page is displayed in the upper left.
+	displayed, err := geometry(90).FromPdf(models.Coordinates{X1: 0, Y1: 0, X2: 72, Y2: 72}, models.CoordinateSystem{Space: models.CoordinateSpacePixels, DPI: 72})
+	require.NoError(t, err)
+	assert.InDeltaSlice(t, []float64{0, 0, 72, 72}, []float64{displayed.X1, displayed.Y1, displayed.X2, displayed.Y2}, 1e-9)
+}
+
+func TestCoordinateSystemValidate(t *testing.T) {
+	assert.ErrorIs(t, models.CoordinateSystem{Space: models.CoordinateSpacePixels}.Validate(), models.ErrInvalidCoordinateSystem)
+	assert.ErrorIs(t, models.CoordinateSystem{Space: "inch"}.Validate(), models.ErrInvalidCoordinateSystem)
+	assert.NoError(t, models.CoordinateSystem{Space: models.CoordinateSpaceRelative}.Validate())
+}
+
+func TestMetaPageGeometry(t *testing.T) {
+	numberOfPages := uint32(2)
+	width, height := float32(612), float32(792)
+	meta := models.Meta{NumberOfPages: &numberOfPages, Width: &width, Height: &height}
+
+	page, err := meta.PageGeometry("1")
+	require.NoError(t, err)
+	assert.Equal(t, models.Box{0, 0, 612, 792}, *page.MediaBox)
+
+	_, err = meta.PageGeometry("2")
+	assert.ErrorIs(t, err, models.ErrPageOutOfRange)
+
+	_, err = models.Meta{}.PageGeometry("cover")
+	assert.ErrorIs(t, err, models.ErrNoPageGeometry)
+}
+
+func TestTemplateSelectionScaledToLargerPage(t *testing.T) {
+	source := geometry(0)
+	selection := models.TemplateSelection{PageGeometry: &source, Coordinates: &models.Coordinates{X1: 72, Y1: 700, X2: 144, Y2: 720}}
+
+	scaled, err := selection.ScaledTo(models.PageGeometry{MediaBox: &models.Box{0, 0, 1224, 1584}})
+	require.NoError(t, err)
+	assert.InDeltaSlice(t, []float64{144, 1400, 288, 1440}, []float64{scaled.X1, scaled.Y1, scaled.X2, scaled.Y2}, 1e-3)
+
+	selection.PageGeometry = nil
+	_, err = selection.ScaledTo(source)
+	assert.ErrorIs(t, err, models.ErrNoPageGeometry)
+}
+
+func TestAuditChanges(t *testing.T) {
+	label, renamed := "Total", "Sum"
+	before := models.Selection{Label: &label, Coordinates: &models.Coordinates{X1: 1, Y1: 2, X2: 3, Y2: 4}}
+	after := models.Selection{Label: &renamed, Coordinates: &models.Coordinates{X1: 1, Y1: 2, X2: 3, Y2: 4}, Color: &label}
+
+	changes, err := models.AuditChanges(before, after)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]models.AuditChange{
+		"label": {Before: "Total", After: "Sum"},
+		"color": {After: "Total"},
+	}, changes, "unchanged fields are left out")
+
+	changes, err = models.AuditChanges(&before, (*models.Selection)(nil))
+	require.NoError(t, err)
+	assert.Equal(t, models.AuditChange{Before: "Total"}, changes["label"], "deleting clears every field")
+	assert.Contains(t, changes, "selectionUUID")
+}
@@ -0,0 +1,22 @@
+package models
+
+import "github.com/google/uuid"
+
+// Thumbnail is a resized variant of a page image. SourceETag identifies the page image it was
+// derived from, so variants of a page that has been extracted again are not served.
+type Thumbnail struct {
+	DocumentUUID uuid.UUID
+	PageKey      string
+	Width        uint32
+	Height       uint32
+	Fit          string
+	MimeType     string
+	SourceETag   string
+	Data         []byte
+}
+
+type ThumbnailRepository interface {
+	// GetThumbnail returns the stored variant matching the document, page key, size, fit and mime type of the given thumbnail.
+	GetThumbnail(thumbnail Thumbnail) (Thumbnail, error)
+	SaveThumbnail(thumbnail Thumbnail) error
+}
@@ -0,0 +1,281 @@
+package annotations
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"pdf_service_api/models"
+	"pdf_service_api/service/pdf"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidXFDF = errors.New("invalid xfdf")
+
+var xfdfColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// Imported is an annotation converted into a selection. The selection has its type, coordinates
+// in pdf user space and descriptive fields set, but no UUID, document or page key yet.
+type Imported struct {
+	// Index is the position of the annotation in the XFDF file or the document.
+	Index      int
+	PageNumber uint32
+	// Subtype is the annotation type as named in the source.
+	Subtype   string
+	Name      string
+	Selection models.Selection
+}
+
+// Skip reports the imported annotation as skipped after all, for a reason found later on.
+func (i Imported) Skip(reason string) Skipped {
+	pageNumber := i.PageNumber
+	return Skipped{Index: i.Index, Type: i.Subtype, Name: i.Name, PageNumber: &pageNumber, Reason: reason}
+}
+
+// Skipped is an annotation that could not be converted into a selection.
+type Skipped struct {
+	Index      int     `json:"index" example:"3"`
+	Type       string  `json:"type" example:"circle"`
+	Name       string  `json:"name,omitempty"`
+	PageNumber *uint32 `json:"pageNumber,omitempty" example:"0"`
+	Reason     string  `json:"reason" example:"unsupported annotation type"`
+}
+
+type Result struct {
+	Imported []Imported
+	Skipped  []Skipped
+}
+
+// selectionTypes maps the annotation types, in lower case, to selection types. Squares become
+// selections without a type, all other annotation types are skipped.
+var selectionTypes = map[string]*models.SelectionType{
+	"highlight": selectionType(models.SelectionTypeHighlight),
+	"underline": selectionType(models.SelectionTypeHighlight),
+	"strikeout": selectionType(models.SelectionTypeHighlight),
+	"squiggly":  selectionType(models.SelectionTypeHighlight),
+	"text":      selectionType(models.SelectionTypeNote),
+	"redact":    selectionType(models.SelectionTypeRedaction),
+	"square":    nil,
+}
+
+func selectionType(t models.SelectionType) *models.SelectionType {
+	return &t
+}
+
+// annotation is the source independent form of an annotation.
+type annotation struct {
+	subtype      string
+	name         string
+	pageNumber   *uint32
+	rect         *[4]float64
+	contents     string
+	subject      string
+	title        string
+	color        *string
+	creationDate *time.Time
+	modDate      *time.Time
+}
+
+func (r *Result) add(index int, a annotation) {
+	skip := func(reason string) {
+		r.Skipped = append(r.Skipped, Skipped{Index: index, Type: a.subtype, Name: a.name, PageNumber: a.pageNumber, Reason: reason})
+	}
+
+	selectionType, isSupported := selectionTypes[strings.ToLower(a.subtype)]
+	switch {
+	case !isSupported:
+		skip("unsupported annotation type")
+		return
+	case a.pageNumber == nil:
+		skip("annotation has no valid page")
+		return
+	case a.rect == nil:
+		skip("annotation has no valid rectangle")
+		return
+	}
+
+	coordinates := models.Coordinates{X1: a.rect[0], Y1: a.rect[1], X2: a.rect[2], Y2: a.rect[3]}
+	if err := coordinates.Validate(); err != nil {
+		skip(err.Error())
+		return
+	}
+	coordinates = coordinates.Normalized()
+
+	selection := models.Selection{
+		Coordinates: &coordinates,
+		Type:        selectionType,
+		Color:       a.color,
+		CreatedAt:   a.creationDate,
+		UpdatedAt:   a.modDate,
+	}
+
+	if a.subject != "" {
+		selection.Label = &a.subject
+	}
+
+	if a.contents != "" {
+		selection.Note = &a.contents
+	}
+
+	// Only authors exported by this service are UUIDs, names of people are not kept.
+	if author, err := uuid.Parse(a.title); err == nil && author != uuid.Nil {
+		selection.AuthorUUID = &author
+	}
+
+	r.Imported = append(r.Imported, Imported{Index: index, PageNumber: *a.pageNumber, Subtype: a.subtype, Name: a.name, Selection: selection})
+}
+
+type xfdfFile struct {
+	XMLName xml.Name `xml:"xfdf"`
+	Annots  struct {
+		Annotations []xfdfAnnotation `xml:",any"`
+	} `xml:"annots"`
+}
+
+type xfdfAnnotation struct {
+	XMLName      xml.Name
+	Page         string `xml:"page,attr"`
+	Rect         string `xml:"rect,attr"`
+	Name         string `xml:"name,attr"`
+	Title        string `xml:"title,attr"`
+	Subject      string `xml:"subject,attr"`
+	Color        string `xml:"color,attr"`
+	Opacity      string `xml:"opacity,attr"`
+	CreationDate string `xml:"creationdate,attr"`
+	Date         string `xml:"date,attr"`
+	Contents     string `xml:"contents"`
+}
+
+// FromXFDF converts the annotations of an XFDF file, as exported by pdf viewers, into selections.
+func FromXFDF(r io.Reader) (Result, error) {
+	file := xfdfFile{}
+	if err := xml.NewDecoder(r).Decode(&file); err != nil {
+		return Result{}, fmt.Errorf("%w: %w", ErrInvalidXFDF, err)
+	}
+
+	result := Result{}
+	for i, item := range file.Annots.Annotations {
+		a := annotation{
+			subtype:      item.XMLName.Local,
+			name:         item.Name,
+			contents:     strings.TrimSpace(item.Contents),
+			subject:      strings.TrimSpace(item.Subject),
+			title:        strings.TrimSpace(item.Title),
+			creationDate: pdf.ParseDate(item.CreationDate),
+			modDate:      pdf.ParseDate(item.Date),
+		}
+
+		if page, err := strconv.ParseUint(strings.TrimSpace(item.Page), 10, 32); err == nil {
+			pageNumber := uint32(page)
+			a.pageNumber = &pageNumber
+		}
+
+		if values := strings.Split(item.Rect, ","); len(values) == 4 {
+			rect := [4]float64{}
+			for j, value := range values {
+				parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+				if err != nil {
+					break
+				}
+				rect[j] = parsed
+				if j == 3 {
+					a.rect = &rect
+				}
+			}
+		}
+
+		if xfdfColorPattern.MatchString(item.Color) {
+			color := strings.ToLower(item.Color)
+			if opacity, err := strconv.ParseFloat(item.Opacity, 64); err == nil {
+				color += alphaHex(opacity)
+			}
+			a.color = &color
+		}
+
+		result.add(i, a)
+	}
+
+	return result, nil
+}
+
+// FromPDF converts the annotations stored in the pages of a document into selections.
+func FromPDF(document *pdf.Document) (Result, error) {
+	pages, err := document.Pages()
+	if err != nil {
+		return Result{}, err
+	}
+
+	result := Result{}
+	index := 0
+	for _, page := range pages {
+		for _, item := range document.Annotations(page) {
+			pageNumber := item.PageNumber
+			result.add(index, annotation{
+				subtype:      item.Subtype,
+				name:         item.Name,
+				pageNumber:   &pageNumber,
+				rect:         item.Rect,
+				contents:     item.Contents,
+				subject:      item.Subject,
+				title:        item.Title,
+				color:        colorOfComponents(item.Color, item.Opacity),
+				creationDate: item.CreationDate,
+				modDate:      item.ModDate,
+			})
+			index++
+		}
+	}
+
+	return result, nil
+}
+
+// colorOfComponents converts the gray, RGB or CMYK components of a pdf color into a hex color,
+// with the opacity as alpha channel when the annotation is translucent.
+func colorOfComponents(components []float64, opacity *float64) *string {
+	var r, g, b float64
+	switch len(components) {
+	case 1:
+		r, g, b = components[0], components[0], components[0]
+	case 3:
+		r, g, b = components[0], components[1], components[2]
+	case 4:
+		k := 1 - clamp(components[3])
+		r, g, b = (1-clamp(components[0]))*k, (1-clamp(components[1]))*k, (1-clamp(components[2]))*k
+	default:
+		return nil
+	}
+
+	color := fmt.Sprintf("#%02x%02x%02x", channel(r), channel(g), channel(b))
+	if opacity != nil {
+		color += alphaHex(*opacity)
+	}
+
+	return &color
+}
+
+// alphaHex is the alpha channel of a hex color for the opacity, empty when it is opaque.
+func alphaHex(opacity float64) string {
+	if math.IsNaN(opacity) || opacity >= 1 {
+		return ""
+	}
+
+	return fmt.Sprintf("%02x", channel(opacity))
+}
+
+func channel(value float64) int {
+	return int(math.Round(clamp(value) * 255))
+}
+
+func clamp(value float64) float64 {
+	if math.IsNaN(value) {
+		return 0
+	}
+
+	return math.Max(0, math.Min(1, value))
+}
@@ -0,0 +1,83 @@
+package annotations
+
+import (
+	"pdf_service_api/models"
+	_ "pdf_service_api/testutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testXFDF = `<?xml version="1.0" encoding="UTF-8"?>
+<xfdf xmlns="http://ns.adobe.com/xfdf/" xml:space="preserve">
+	<annots>
+		<highlight page="2" rect="144,720,72,700" name="h1" subject="Invoice number" color="#FFD700" opacity="0.5"
+			title="a5fdea38-0a86-4c19-ae4f-c87a01bc860d" creationdate="D:20240501123000Z">
+			<contents>Check this</contents>
+		</highlight>
+		<square page="0" rect="10,20,30,40" title="Jane Doe"/>
+		<circle page="0" rect="10,20,30,40" name="c1"/>
+		<text rect="10,20,30,40"/>
+		<redact page="1" rect="10,20,x,40"/>
+		<underline page="1" rect="10,20,Inf,40"/>
+	</annots>
+</xfdf>`
+
+func TestFromXFDF(t *testing.T) {
+	result, err := FromXFDF(strings.NewReader(testXFDF))
+	require.NoError(t, err)
+	require.Len(t, result.Imported, 2)
+
+	highlight := result.Imported[0]
+	assert.Equal(t, 0, highlight.Index)
+	assert.EqualValues(t, 2, highlight.PageNumber)
+	assert.Equal(t, models.SelectionTypeHighlight, *highlight.Selection.Type)
+	assert.Equal(t, models.Coordinates{X1: 72, Y1: 700, X2: 144, Y2: 720}, *highlight.Selection.Coordinates)
+	assert.Equal(t, "Invoice number", *highlight.Selection.Label)
+	assert.Equal(t, "Check this", *highlight.Selection.Note)
+	assert.Equal(t, "#ffd70080", *highlight.Selection.Color)
+	assert.Equal(t, uuid.MustParse("a5fdea38-0a86-4c19-ae4f-c87a01bc860d"), *highlight.Selection.AuthorUUID)
+	assert.Equal(t, time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC), highlight.Selection.CreatedAt.UTC())
+	assert.Nil(t, highlight.Selection.UpdatedAt)
+
+	square := result.Imported[1]
+	assert.Equal(t, 1, square.Index)
+	assert.Nil(t, square.Selection.Type)
+	assert.Nil(t, square.Selection.AuthorUUID, "names of authors are not kept")
+	assert.Nil(t, square.Selection.Color)
+
+	require.Len(t, result.Skipped, 4)
+	assert.Equal(t, Skipped{Index: 2, Type: "circle", Name: "c1", PageNumber: pageNumber(0), Reason: "unsupported annotation type"}, result.Skipped[0])
+	assert.Equal(t, Skipped{Index: 3, Type: "text", Reason: "annotation has no valid page"}, result.Skipped[1])
+	assert.Equal(t, Skipped{Index: 4, Type: "redact", PageNumber: pageNumber(1), Reason: "annotation has no valid rectangle"}, result.Skipped[2])
+	assert.Equal(t, 5, result.Skipped[3].Index)
+	assert.Contains(t, result.Skipped[3].Reason, "invalid coordinates")
+
+	assert.Equal(t, Skipped{Index: 1, Type: "square", PageNumber: pageNumber(0), Reason: "page out of range"}, square.Skip("page out of range"))
+}
+
+func TestFromXFDFRejectsOtherXML(t *testing.T) {
+	_, err := FromXFDF(strings.NewReader(`<fdf><annots/></fdf>`))
+	assert.ErrorIs(t, err, ErrInvalidXFDF)
+
+	_, err = FromXFDF(strings.NewReader(`<xfdf><annots>`))
+	assert.ErrorIs(t, err, ErrInvalidXFDF)
+}
+
+func TestColorOfComponents(t *testing.T) {
+	opacity := 0.25
+	assert.Equal(t, "#808080", *colorOfComponents([]float64{0.5}, nil))
+	assert.Equal(t, "#ffd700", *colorOfComponents([]float64{1, 0.843, 0}, nil))
+	assert.Equal(t, "#ff000040", *colorOfComponents([]float64{0, 1, 1, 0}, &opacity))
+	assert.Equal(t, "#00ff00", *colorOfComponents([]float64{-1, 2, 0}, nil), "components are clamped")
+	assert.Nil(t, colorOfComponents(nil, nil), "an empty color is transparent")
+	assert.Nil(t, colorOfComponents([]float64{1, 0}, nil))
+}
+
+func pageNumber(number uint32) *uint32 {
+	return &number
+}
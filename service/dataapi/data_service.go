@@ -3,56 +3,353 @@ package dataapi
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand/v2"
+	"net"
 	"net/http"
 	"pdf_service_api/models"
+	"pdf_service_api/service/logging"
 	"strings"
 	"time"
 )
 
-type DataService struct {
+var ErrNoBaseUrl = errors.New("no BaseUrl provided for the data service")
+
+// ErrPartialResponse is returned when a streamed response fails after part of it was handed on.
+// Such requests are not retried, as the parts handed on can not be taken back.
+var ErrPartialResponse = errors.New("data service response failed after part of it was handed on")
+
+// requestIDHeader passes the id of the request being served on to the data service.
+const requestIDHeader = "X-Request-ID"
+
+// StatusError is returned when the data service answers with anything other than 200 OK.
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("data service responded with status %d: %s", e.StatusCode, e.Body)
+}
+
+// Retryable reports if the request may succeed when it is sent again.
+func (e *StatusError) Retryable() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests
+}
+
+// Config holds the settings of a DataService, zero values are replaced by the defaults below.
+type Config struct {
 	BaseUrl string
+	// RequestTimeout bounds a single attempt, retries get their own timeout.
+	RequestTimeout time.Duration
+	// MaxRetries is the number of additional attempts after the first one failed,
+	// a negative value disables retrying.
+	MaxRetries     int
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+	// BreakerThreshold is the number of consecutive failures after which the circuit opens.
+	BreakerThreshold int
+	// BreakerCooldown is how long an open circuit rejects requests before a trial request is let through.
+	BreakerCooldown time.Duration
+	HttpClient      *http.Client
 }
 
-func (t DataService) SendMetaRequest(base64 string) (models.Meta, error) {
-	if t.BaseUrl == "" {
-		panic("No BaseUrl Provided")
+const (
+	defaultRequestTimeout   = 30 * time.Second
+	defaultMaxRetries       = 3
+	defaultRetryBaseDelay   = 200 * time.Millisecond
+	defaultRetryMaxDelay    = 5 * time.Second
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 30 * time.Second
+)
+
+// DataService is the client of the pdf data service. It is safe for concurrent use and
+// reuses its connections, so a single instance should be shared.
+type DataService struct {
+	config  Config
+	client  *http.Client
+	breaker *circuitBreaker
+}
+
+func NewDataService(config Config) (*DataService, error) {
+	if config.BaseUrl == "" {
+		return nil, ErrNoBaseUrl
+	}
+	config.BaseUrl = strings.TrimSuffix(config.BaseUrl, "/")
+
+	if config.RequestTimeout <= 0 {
+		config.RequestTimeout = defaultRequestTimeout
+	}
+	if config.MaxRetries < 0 {
+		config.MaxRetries = 0
+	} else if config.MaxRetries == 0 {
+		config.MaxRetries = defaultMaxRetries
+	}
+	if config.RetryBaseDelay <= 0 {
+		config.RetryBaseDelay = defaultRetryBaseDelay
+	}
+	if config.RetryMaxDelay <= 0 {
+		config.RetryMaxDelay = defaultRetryMaxDelay
+	}
+	if config.BreakerThreshold <= 0 {
+		config.BreakerThreshold = defaultBreakerThreshold
+	}
+	if config.BreakerCooldown <= 0 {
+		config.BreakerCooldown = defaultBreakerCooldown
+	}
+
+	client := config.HttpClient
+	if client == nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.MaxIdleConns = 20
+		transport.MaxIdleConnsPerHost = 10
+		client = &http.Client{Transport: transport}
 	}
 
-	url := fmt.Sprintf("%s/meta", t.BaseUrl)
-	method := "POST"
-	payload := strings.NewReader(fmt.Sprintf(`{"base64": "%s"}`, base64))
+	return &DataService{
+		config:  config,
+		client:  client,
+		breaker: newCircuitBreaker(config.BreakerThreshold, config.BreakerCooldown),
+	}, nil
+}
 
-	client := &http.Client{}
-	ctx := context.Background()
-	ctx, cancelFunc := context.WithTimeout(ctx, 30*time.Second)
-	defer cancelFunc()
+func (t *DataService) SendMetaRequest(ctx context.Context, base64 io.ReadSeeker, onPage models.PageHandler) (models.Meta, error) {
+	data := models.Meta{}
+	delivered := false
+	handler := onPage
+	if onPage != nil {
+		handler = func(pageKey string, image string, numberOfPages *uint32) error {
+			delivered = true
+			return onPage(pageKey, image, numberOfPages)
+		}
+	}
 
-	req, err := http.NewRequestWithContext(ctx, method, url, payload)
+	err := t.postDocument(ctx, "/meta", base64, nil, func(body io.Reader) error {
+		meta, err := decodeMetaResponse(body, handler)
+		data = meta
+		if err != nil && delivered {
+			return fmt.Errorf("%w: %w", ErrPartialResponse, err)
+		}
+		return err
+	})
 	if err != nil {
 		return models.Meta{}, err
 	}
 
-	req.Header.Add("Accept", "application/json")
-	req.Header.Add("Content-Type", "application/json")
+	return data, nil
+}
+
+// ExtractText asks the data service for the text inside the given region of a page, the region
+// is given in pdf user space of the page.
+func (t *DataService) ExtractText(ctx context.Context, base64 io.ReadSeeker, pageNumber uint32, region models.Coordinates) (string, error) {
+	fields := map[string]any{"pageNumber": pageNumber, "region": region}
+
+	text := ""
+	err := t.postDocument(ctx, "/text", base64, fields, func(body io.Reader) error {
+		response := struct {
+			Text *string `json:"text"`
+		}{}
+		if err := json.NewDecoder(body).Decode(&response); err != nil {
+			return err
+		}
+		if response.Text == nil {
+			return errors.New("response contains no text")
+		}
 
-	res, err := client.Do(req)
+		text = *response.Text
+		return nil
+	})
 	if err != nil {
-		return models.Meta{}, err
+		return "", err
 	}
-	defer res.Body.Close()
 
-	body, err := io.ReadAll(res.Body)
+	return text, nil
+}
+
+// Redact asks the data service for a copy of the document with the content inside the regions
+// removed and covered, and returns the copy as base64.
+func (t *DataService) Redact(ctx context.Context, base64 io.ReadSeeker, regions []models.RedactionRegion) (string, error) {
+	fields := map[string]any{"regions": regions}
+
+	redacted := ""
+	err := t.postDocument(ctx, "/redact", base64, fields, func(body io.Reader) error {
+		response := struct {
+			Base64 *string `json:"base64"`
+		}{}
+		if err := json.NewDecoder(body).Decode(&response); err != nil {
+			return err
+		}
+		if response.Base64 == nil || *response.Base64 == "" {
+			return errors.New("response contains no document")
+		}
+
+		redacted = *response.Base64
+		return nil
+	})
 	if err != nil {
-		return models.Meta{}, err
+		return "", err
+	}
+
+	return redacted, nil
+}
+
+// postDocument streams a request with the base64 document and the given fields to the data service.
+func (t *DataService) postDocument(ctx context.Context, path string, base64 io.ReadSeeker, fields map[string]any, decode func(body io.Reader) error) error {
+	url := t.config.BaseUrl + path
+
+	// The payload of an attempt is written by its own goroutine, which has to be finished
+	// before the reader is rewound for the next attempt.
+	var payload *io.PipeReader
+	var written chan struct{}
+	waitForPayload := func() {
+		if payload != nil {
+			payload.Close()
+			<-written
+		}
 	}
+	defer waitForPayload()
 
-	data := &models.Meta{}
-	err = json.Unmarshal(body, data)
+	return t.do(ctx, func(ctx context.Context) (*http.Request, error) {
+		waitForPayload()
+		if _, err := base64.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+
+		var writer *io.PipeWriter
+		payload, writer = io.Pipe()
+		written = make(chan struct{})
+		go func() {
+			defer close(written)
+			writer.CloseWithError(writeDocumentPayload(writer, base64, fields))
+		}()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, payload)
+		if err != nil {
+			payload.Close()
+			return nil, err
+		}
+
+		req.Header.Add("Accept", "application/json")
+		req.Header.Add("Content-Type", "application/json")
+		return req, nil
+	}, decode)
+}
+
+// do sends the request built by newRequest, retrying failures that are likely to be transient,
+// and hands the body of the first successful response to decode.
+func (t *DataService) do(ctx context.Context, newRequest func(ctx context.Context) (*http.Request, error), decode func(body io.Reader) error) error {
+	var lastErr error
+	for attempt := 0; attempt <= t.config.MaxRetries; attempt++ {
+		if attempt > 0 {
+			if err := t.wait(ctx, attempt); err != nil {
+				return fmt.Errorf("%w (last error: %w)", err, lastErr)
+			}
+		}
+
+		if err := t.breaker.allow(); err != nil {
+			if lastErr != nil {
+				return fmt.Errorf("%w (last error: %w)", err, lastErr)
+			}
+			return err
+		}
+
+		lastErr = t.attempt(ctx, newRequest, decode)
+		if lastErr == nil {
+			t.breaker.success()
+			return nil
+		}
+
+		if !retryable(ctx, lastErr) {
+			logging.FromContext(ctx).Warn("data service request failed", "attempt", attempt+1, "error", lastErr)
+			// Client errors say nothing about the health of the data service.
+			var statusErr *StatusError
+			if errors.As(lastErr, &statusErr) || errors.Is(lastErr, ErrInvalidBase64) {
+				t.breaker.success()
+			} else {
+				t.breaker.failure()
+			}
+			return lastErr
+		}
+
+		t.breaker.failure()
+		if attempt < t.config.MaxRetries {
+			logging.FromContext(ctx).Warn("data service request failed, retrying", "attempt", attempt+1, "error", lastErr)
+		}
+	}
+
+	return lastErr
+}
+
+func (t *DataService) attempt(ctx context.Context, newRequest func(ctx context.Context) (*http.Request, error), decode func(body io.Reader) error) error {
+	ctx, cancelFunc := context.WithTimeout(ctx, t.config.RequestTimeout)
+	defer cancelFunc()
+
+	req, err := newRequest(ctx)
 	if err != nil {
-		return models.Meta{}, err
+		return err
+	}
+	if requestId := logging.RequestID(ctx); requestId != "" {
+		req.Header.Set(requestIDHeader, requestId)
+	}
+
+	started := time.Now()
+	res, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	logging.FromContext(ctx).Debug("data service responded", "path", req.URL.Path, "status", res.StatusCode, "latency", time.Since(started))
+
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return &StatusError{StatusCode: res.StatusCode, Body: strings.TrimSpace(string(body))}
+	}
+
+	if err := decode(res.Body); err != nil {
+		return fmt.Errorf("failed to decode data service response: %w", err)
+	}
+
+	return nil
+}
+
+// wait sleeps before the given retry, using exponential backoff with full jitter.
+func (t *DataService) wait(ctx context.Context, attempt int) error {
+	backoff := t.config.RetryBaseDelay << (attempt - 1)
+	if backoff <= 0 || backoff > t.config.RetryMaxDelay {
+		backoff = t.config.RetryMaxDelay
+	}
+
+	timer := time.NewTimer(rand.N(backoff) + 1)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || errors.Is(err, ErrPartialResponse) {
+		return false
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Retryable()
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return netErr.Timeout()
 	}
 
-	return *data, nil
+	return false
 }
@@ -1,13 +1,26 @@
 package dataapi
 
 import (
+	"bytes"
+	"context"
 	_ "embed"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"pdf_service_api/models"
+	"pdf_service_api/service/logging"
+	"pdf_service_api/testutil"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/testcontainers/testcontainers-go"
-	"pdf_service_api/testutil"
-	"testing"
 )
 
 func TestSendMetaRequest(t *testing.T) {
@@ -19,11 +32,294 @@ func TestSendMetaRequest(t *testing.T) {
 	require.NoError(t, err)
 	defer testcontainers.TerminateContainer(ctr)
 
-	srv := DataService{BaseUrl: fmt.Sprintf("http://localhost:%d", p.Int())}
-	meta, err := srv.SendMetaRequest(testutil.HundredPagesPdfInBase64)
+	srv, err := NewDataService(Config{BaseUrl: fmt.Sprintf("http://localhost:%d", p.Int())})
+	require.NoError(t, err)
+	meta, err := srv.SendMetaRequest(context.Background(), strings.NewReader(testutil.HundredPagesPdfInBase64), nil)
 	require.NoError(t, err)
 	assert.EqualValues(t, 792, *meta.Height)
 	assert.EqualValues(t, 612, *meta.Width)
 	assert.EqualValues(t, 101, *meta.NumberOfPages)
 	assert.EqualValues(t, 101, len(*meta.Images))
 }
+
+func newTestDataService(t *testing.T, handler http.HandlerFunc, config Config) *DataService {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	config.BaseUrl = server.URL
+	if config.RetryBaseDelay == 0 {
+		config.RetryBaseDelay = time.Millisecond
+	}
+
+	srv, err := NewDataService(config)
+	require.NoError(t, err)
+	return srv
+}
+
+func TestNewDataServiceWithoutBaseUrl(t *testing.T) {
+	_, err := NewDataService(Config{})
+	assert.ErrorIs(t, err, ErrNoBaseUrl)
+}
+
+func TestSendMetaRequestDecodesResponse(t *testing.T) {
+	srv := newTestDataService(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/meta", r.URL.Path)
+		assert.Equal(t, http.MethodPost, r.Method)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"numberOfPages": 2, "width": 612, "height": 792, "images": {"0": "a", "1": "b"}}`))
+	}, Config{})
+
+	meta, err := srv.SendMetaRequest(context.Background(), strings.NewReader("JVBERi0="), nil)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, *meta.NumberOfPages)
+	assert.EqualValues(t, 612, *meta.Width)
+	assert.EqualValues(t, 792, *meta.Height)
+	assert.Len(t, *meta.Images, 2)
+}
+
+func TestSendMetaRequestDoesNotRetryClientErrors(t *testing.T) {
+	var calls atomic.Int32
+	srv := newTestDataService(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, "not a pdf", http.StatusBadRequest)
+	}, Config{})
+
+	_, err := srv.SendMetaRequest(context.Background(), strings.NewReader("JVBERi0="), nil)
+
+	var statusErr *StatusError
+	require.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, http.StatusBadRequest, statusErr.StatusCode)
+	assert.Equal(t, "not a pdf", statusErr.Body)
+	assert.EqualValues(t, 1, calls.Load())
+}
+
+func TestSendMetaRequestRetriesServerErrors(t *testing.T) {
+	var calls atomic.Int32
+	srv := newTestDataService(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"numberOfPages": 1}`))
+	}, Config{MaxRetries: 3})
+
+	meta, err := srv.SendMetaRequest(context.Background(), strings.NewReader("JVBERi0="), nil)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, *meta.NumberOfPages)
+	assert.EqualValues(t, 3, calls.Load())
+}
+
+func TestSendMetaRequestRetriesTimeouts(t *testing.T) {
+	var calls atomic.Int32
+	srv := newTestDataService(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(200 * time.Millisecond):
+			}
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"numberOfPages": 1}`))
+	}, Config{RequestTimeout: 50 * time.Millisecond})
+
+	_, err := srv.SendMetaRequest(context.Background(), strings.NewReader("JVBERi0="), nil)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, calls.Load())
+}
+
+func TestSendMetaRequestDoesNotRetryPartialPageStreams(t *testing.T) {
+	var calls atomic.Int32
+	srv := newTestDataService(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		_, _ = io.Copy(io.Discard, r.Body)
+		_, _ = w.Write([]byte(`{"numberOfPages": 3, "images": {"0": "first", `))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}, Config{RequestTimeout: 100 * time.Millisecond, MaxRetries: 3})
+
+	pages := make([]string, 0)
+	_, err := srv.SendMetaRequest(context.Background(), strings.NewReader("JVBERi0="), func(pageKey string, image string, numberOfPages *uint32) error {
+		pages = append(pages, pageKey+"="+image)
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrPartialResponse)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, []string{"0=first"}, pages, "pages handed on are not handed on again")
+	assert.EqualValues(t, 1, calls.Load(), "a stream that timed out after the first page is not retried")
+}
+
+func TestCircuitBreakerOpensAfterConsecutiveFailures(t *testing.T) {
+	var calls atomic.Int32
+	srv := newTestDataService(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, "down", http.StatusInternalServerError)
+	}, Config{MaxRetries: -1, BreakerThreshold: 2, BreakerCooldown: time.Hour})
+
+	for i := 0; i < 2; i++ {
+		_, err := srv.SendMetaRequest(context.Background(), strings.NewReader("JVBERi0="), nil)
+		var statusErr *StatusError
+		require.True(t, errors.As(err, &statusErr))
+	}
+
+	_, err := srv.SendMetaRequest(context.Background(), strings.NewReader("JVBERi0="), nil)
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.EqualValues(t, 2, calls.Load())
+}
+
+func TestCircuitBreakerClosesAfterSuccessfulTrial(t *testing.T) {
+	now := time.Now()
+	breaker := newCircuitBreaker(1, time.Minute)
+	breaker.now = func() time.Time { return now }
+
+	require.NoError(t, breaker.allow())
+	breaker.failure()
+	assert.ErrorIs(t, breaker.allow(), ErrCircuitOpen)
+
+	now = now.Add(2 * time.Minute)
+	require.NoError(t, breaker.allow())
+	assert.ErrorIs(t, breaker.allow(), ErrCircuitOpen, "only one trial call may be in flight")
+
+	breaker.success()
+	assert.NoError(t, breaker.allow())
+}
+
+func TestSendMetaRequestStreamsPayloadAndPages(t *testing.T) {
+	var calls atomic.Int32
+	srv := newTestDataService(t, func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"base64": "JVBERi0xLjQ="}`, string(body))
+
+		if calls.Add(1) == 1 {
+			http.Error(w, "busy", http.StatusBadGateway)
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"numberOfPages": 2, "documentUUID": null, "images": {"0": "first", "1": "second"}, "width": 612}`))
+	}, Config{})
+
+	pages := make([]string, 0)
+	totals := make([]uint32, 0)
+	meta, err := srv.SendMetaRequest(context.Background(), strings.NewReader("JVBERi0x\nLjQ="), func(pageKey string, image string, numberOfPages *uint32) error {
+		pages = append(pages, pageKey+"="+image)
+		if numberOfPages != nil {
+			totals = append(totals, *numberOfPages)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"0=first", "1=second"}, pages)
+	assert.Equal(t, []uint32{2, 2}, totals, "the number of pages sent before the images is passed on")
+	assert.Nil(t, meta.Images)
+	assert.EqualValues(t, 2, *meta.NumberOfPages)
+	assert.EqualValues(t, 612, *meta.Width)
+	assert.EqualValues(t, 2, calls.Load())
+}
+
+func TestSendMetaRequestRejectsInvalidBase64(t *testing.T) {
+	srv := newTestDataService(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		_, _ = w.Write([]byte(`{}`))
+	}, Config{})
+
+	_, err := srv.SendMetaRequest(context.Background(), strings.NewReader(`JVBER"}, "x": "`), nil)
+	assert.ErrorIs(t, err, ErrInvalidBase64)
+}
+
+func TestSendMetaRequestDecodesPageGeometry(t *testing.T) {
+	srv := newTestDataService(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		_, _ = w.Write([]byte(`{"numberOfPages": 2, "pages": [
+			{"pageNumber": 0, "mediaBox": [0, 0, 612, 792]},
+			{"pageNumber": 1, "pageKey": "b", "mediaBox": [0, 0, 612, 792], "cropBox": [10, 10, 602, 782], "rotation": -90, "userUnit": 2}
+		]}`))
+	}, Config{})
+
+	meta, err := srv.SendMetaRequest(context.Background(), strings.NewReader("JVBERi0="), nil)
+	require.NoError(t, err)
+	require.Len(t, meta.Pages, 2)
+
+	assert.Equal(t, "0", meta.Pages[0].PageKey)
+	assert.Nil(t, meta.Pages[0].Rotation)
+	width, height, ok := meta.Pages[0].DisplaySize()
+	assert.True(t, ok)
+	assert.EqualValues(t, 612, width)
+	assert.EqualValues(t, 792, height)
+
+	assert.Equal(t, "b", meta.Pages[1].PageKey)
+	assert.Equal(t, 270, *meta.Pages[1].Rotation)
+	width, height, ok = meta.Pages[1].DisplaySize()
+	assert.True(t, ok)
+	assert.EqualValues(t, 1544, width)
+	assert.EqualValues(t, 1184, height)
+}
+
+func TestSendMetaRequestRejectsInvalidRotation(t *testing.T) {
+	srv := newTestDataService(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		_, _ = w.Write([]byte(`{"pages": [{"pageNumber": 0, "rotation": 45}]}`))
+	}, Config{})
+
+	_, err := srv.SendMetaRequest(context.Background(), strings.NewReader("JVBERi0="), nil)
+	assert.Error(t, err)
+}
+
+func TestExtractTextSendsPageAndRegion(t *testing.T) {
+	srv := newTestDataService(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/text", r.URL.Path)
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"base64": "JVBERi0=", "pageNumber": 3, "region": {"x1": 1, "y1": 2, "x2": 30, "y2": 40}}`, string(body))
+		_, _ = w.Write([]byte(`{"text": "Hello World"}`))
+	}, Config{})
+
+	text, err := srv.ExtractText(context.Background(), strings.NewReader("JVBERi0="), 3, models.Coordinates{X1: 1, Y1: 2, X2: 30, Y2: 40})
+	require.NoError(t, err)
+	assert.Equal(t, "Hello World", text)
+}
+
+func TestRedactSendsRegions(t *testing.T) {
+	srv := newTestDataService(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/redact", r.URL.Path)
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"base64": "JVBERi0=", "regions": [{"pageNumber": 1, "region": {"x1": 1, "y1": 2, "x2": 30, "y2": 40}}]}`, string(body))
+		_, _ = w.Write([]byte(`{"base64": "UmVkYWN0ZWQ="}`))
+	}, Config{})
+
+	redacted, err := srv.Redact(context.Background(), strings.NewReader("JVBERi0="),
+		[]models.RedactionRegion{{PageNumber: 1, Region: models.Coordinates{X1: 1, Y1: 2, X2: 30, Y2: 40}}})
+	require.NoError(t, err)
+	assert.Equal(t, "UmVkYWN0ZWQ=", redacted)
+}
+
+func TestRedactRejectsEmptyResponse(t *testing.T) {
+	srv := newTestDataService(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{}`))
+	}, Config{})
+
+	_, err := srv.Redact(context.Background(), strings.NewReader("JVBERi0="), nil)
+	assert.Error(t, err)
+}
+
+func TestRequestIDAndLoggerArePassedOn(t *testing.T) {
+	var calls atomic.Int32
+	srv := newTestDataService(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "request-1", r.Header.Get("X-Request-ID"))
+		if calls.Add(1) < 2 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"text": "Hello World"}`))
+	}, Config{MaxRetries: 1})
+
+	var buffer bytes.Buffer
+	ctx := logging.WithRequestID(logging.NewContext(context.Background(), logging.New(&buffer, slog.LevelInfo)), "request-1")
+	_, err := srv.ExtractText(ctx, strings.NewReader("JVBERi0="), 1, models.Coordinates{})
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, calls.Load())
+	assert.Contains(t, buffer.String(), `"msg":"data service request failed, retrying"`)
+}
@@ -0,0 +1,206 @@
+package dataapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"pdf_service_api/models"
+	"strconv"
+)
+
+var ErrInvalidBase64 = errors.New("document contains characters that are not valid base64")
+
+// writeDocumentPayload streams the body of a request, {"base64": "<document>", ...fields}, without
+// holding another copy of the document in memory.
+func writeDocumentPayload(w io.Writer, base64 io.Reader, fields map[string]any) error {
+	if _, err := io.WriteString(w, `{"base64": "`); err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(base64Filter{w: w}, base64); err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, `"`); err != nil {
+		return err
+	}
+
+	for key, value := range fields {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+
+		if _, err := fmt.Fprintf(w, ", %q: %s", key, encoded); err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(w, `}`)
+	return err
+}
+
+// base64Filter drops line breaks and rejects anything outside the base64 alphabet,
+// which also guarantees that the written bytes never need escaping inside a JSON string.
+type base64Filter struct {
+	w io.Writer
+}
+
+func (f base64Filter) Write(p []byte) (int, error) {
+	start := 0
+	for i, b := range p {
+		switch {
+		case b >= 'A' && b <= 'Z', b >= 'a' && b <= 'z', b >= '0' && b <= '9', b == '+', b == '/', b == '=', b == '-', b == '_':
+			continue
+		case b == '\n', b == '\r', b == ' ', b == '\t':
+			if _, err := f.w.Write(p[start:i]); err != nil {
+				return start, err
+			}
+			start = i + 1
+		default:
+			return i, fmt.Errorf("%w: unexpected byte %q", ErrInvalidBase64, b)
+		}
+	}
+
+	if _, err := f.w.Write(p[start:]); err != nil {
+		return start, err
+	}
+
+	return len(p), nil
+}
+
+// decodeMetaResponse reads a meta response token by token, so only a single page image
+// is held in memory at a time when onPage is set.
+func decodeMetaResponse(body io.Reader, onPage models.PageHandler) (models.Meta, error) {
+	meta := models.Meta{}
+	dec := json.NewDecoder(body)
+
+	if err := expectDelim(dec, '{'); err != nil {
+		return meta, err
+	}
+
+	for dec.More() {
+		key, err := readKey(dec)
+		if err != nil {
+			return meta, err
+		}
+
+		switch key {
+		case "numberOfPages":
+			err = dec.Decode(&meta.NumberOfPages)
+		case "width":
+			err = dec.Decode(&meta.Width)
+		case "height":
+			err = dec.Decode(&meta.Height)
+		case "images":
+			err = decodeImages(dec, &meta, onPage)
+		case "pages":
+			meta.Pages, err = decodePages(dec)
+		default:
+			err = dec.Decode(&json.RawMessage{})
+		}
+
+		if err != nil {
+			return meta, fmt.Errorf("failed to decode %q: %w", key, err)
+		}
+	}
+
+	return meta, expectDelim(dec, '}')
+}
+
+func decodeImages(dec *json.Decoder, meta *models.Meta, onPage models.PageHandler) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	if token == nil {
+		return nil
+	}
+
+	if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return fmt.Errorf("expected an object but found %v", token)
+	}
+
+	images := make(map[string]string)
+	for dec.More() {
+		pageKey, err := readKey(dec)
+		if err != nil {
+			return err
+		}
+
+		var image string
+		if err := dec.Decode(&image); err != nil {
+			return err
+		}
+
+		if onPage != nil {
+			if err := onPage(pageKey, image, meta.NumberOfPages); err != nil {
+				return err
+			}
+			continue
+		}
+
+		images[pageKey] = image
+	}
+
+	if onPage == nil {
+		meta.Images = &images
+	}
+
+	return expectDelim(dec, '}')
+}
+
+// decodePages reads the per page geometry of a meta response. Page keys default to the
+// page number and rotations are normalized to 0, 90, 180 or 270 degrees.
+func decodePages(dec *json.Decoder) ([]models.PageGeometry, error) {
+	var pages []models.PageGeometry
+	if err := dec.Decode(&pages); err != nil {
+		return nil, err
+	}
+
+	for i := range pages {
+		page := &pages[i]
+		if page.PageKey == "" {
+			page.PageKey = strconv.FormatUint(uint64(page.PageNumber), 10)
+		}
+
+		if page.Rotation != nil {
+			rotation, ok := models.NormalizeRotation(*page.Rotation)
+			if !ok {
+				return nil, fmt.Errorf("page %d has a rotation of %d, which is not a multiple of 90", page.PageNumber, *page.Rotation)
+			}
+			page.Rotation = &rotation
+		}
+	}
+
+	return pages, nil
+}
+
+func readKey(dec *json.Decoder) (string, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return "", err
+	}
+
+	key, ok := token.(string)
+	if !ok {
+		return "", fmt.Errorf("expected an object key but found %v", token)
+	}
+
+	return key, nil
+}
+
+func expectDelim(dec *json.Decoder, expected json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	if delim, ok := token.(json.Delim); !ok || delim != expected {
+		return fmt.Errorf("expected %v but found %v", expected, token)
+	}
+
+	return nil
+}
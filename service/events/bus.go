@@ -0,0 +1,65 @@
+package events
+
+import (
+	"pdf_service_api/models"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const subscriberBuffer = 64
+
+// Bus is an in-process models.EventBus. Publishing never blocks, when a subscriber
+// is not keeping up the events it cannot buffer are dropped for that subscriber.
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers map[uuid.UUID]map[chan models.Event]struct{}
+}
+
+func NewBus() *Bus {
+	return &Bus{subscribers: make(map[uuid.UUID]map[chan models.Event]struct{})}
+}
+
+func (b *Bus) Publish(event models.Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for ch := range b.subscribers[event.DocumentUUID] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+func (b *Bus) Subscribe(documentUuid uuid.UUID) (<-chan models.Event, func()) {
+	ch := make(chan models.Event, subscriberBuffer)
+
+	b.mu.Lock()
+	if b.subscribers[documentUuid] == nil {
+		b.subscribers[documentUuid] = make(map[chan models.Event]struct{})
+	}
+	b.subscribers[documentUuid][ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+
+			delete(b.subscribers[documentUuid], ch)
+			if len(b.subscribers[documentUuid]) == 0 {
+				delete(b.subscribers, documentUuid)
+			}
+			close(ch)
+		})
+	}
+
+	return ch, unsubscribe
+}
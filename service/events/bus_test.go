@@ -0,0 +1,59 @@
+package events
+
+import (
+	"pdf_service_api/models"
+	_ "pdf_service_api/testutil"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBusDeliversOnlyToDocumentSubscribers(t *testing.T) {
+	bus := NewBus()
+	documentUUID := uuid.New()
+
+	events, unsubscribe := bus.Subscribe(documentUUID)
+	defer unsubscribe()
+
+	otherEvents, unsubscribeOther := bus.Subscribe(uuid.New())
+	defer unsubscribeOther()
+
+	bus.Publish(models.Event{Type: models.EventExtractionStarted, DocumentUUID: documentUUID})
+
+	require.Len(t, events, 1)
+	event := <-events
+	assert.Equal(t, models.EventExtractionStarted, event.Type)
+	assert.False(t, event.Time.IsZero())
+	assert.Len(t, otherEvents, 0)
+}
+
+func TestBusDropsEventsForSlowSubscribers(t *testing.T) {
+	bus := NewBus()
+	documentUUID := uuid.New()
+
+	events, unsubscribe := bus.Subscribe(documentUUID)
+	defer unsubscribe()
+
+	for i := 0; i < subscriberBuffer+10; i++ {
+		bus.Publish(models.Event{Type: models.EventExtractionProgress, DocumentUUID: documentUUID})
+	}
+
+	assert.Len(t, events, subscriberBuffer)
+}
+
+func TestBusUnsubscribeClosesChannel(t *testing.T) {
+	bus := NewBus()
+	documentUUID := uuid.New()
+
+	events, unsubscribe := bus.Subscribe(documentUUID)
+	unsubscribe()
+	unsubscribe()
+
+	_, open := <-events
+	assert.False(t, open)
+	assert.Empty(t, bus.subscribers)
+
+	bus.Publish(models.Event{Type: models.EventExtractionStarted, DocumentUUID: documentUUID})
+}
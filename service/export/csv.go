@@ -0,0 +1,82 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// csvHeader names the columns written by WriteCSV.
+var csvHeader = []string{"selectionUUID", "documentUUID", "pageKey", "pageNumber", "type", "label", "note", "color",
+	"authorUUID", "x1", "y1", "x2", "y2", "createdAt", "updatedAt", "extractedText"}
+
+// WriteCSV exports the selections as CSV rows with a header, ordered by page. Missing values are
+// left empty. Text written by users is prefixed with a quote when it starts like a spreadsheet
+// formula, so that opening the file cannot run it.
+func WriteCSV(w io.Writer, document Document) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvHeader); err != nil {
+		return err
+	}
+
+	for _, p := range document.pages() {
+		pageNumber := ""
+		if p.isNumbered {
+			pageNumber = strconv.FormatUint(uint64(p.number), 10)
+		}
+
+		for _, selection := range p.selections {
+			row := make([]string, 0, len(csvHeader))
+			row = append(row, selection.Uuid.String(), document.DocumentUUID.String(), cell(selection.PageKey), pageNumber)
+
+			selectionType := ""
+			if selection.Type != nil {
+				selectionType = string(*selection.Type)
+			}
+			row = append(row, selectionType, cell(selection.Label), cell(selection.Note), cell(selection.Color))
+
+			author := ""
+			if selection.AuthorUUID != nil {
+				author = selection.AuthorUUID.String()
+			}
+			row = append(row, author)
+
+			if c := selection.Coordinates; c != nil {
+				row = append(row, formatNumber(c.X1), formatNumber(c.Y1), formatNumber(c.X2), formatNumber(c.Y2))
+			} else {
+				row = append(row, "", "", "", "")
+			}
+
+			row = append(row, timeCell(selection.CreatedAt), timeCell(selection.UpdatedAt), cell(selection.ExtractedText))
+			if err := writer.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// cell escapes text which a spreadsheet would take as a formula.
+func cell(value *string) string {
+	if value == nil {
+		return ""
+	}
+
+	if *value != "" && strings.ContainsRune("=+-@\t\r", rune((*value)[0])) {
+		return "'" + *value
+	}
+
+	return *value
+}
+
+func timeCell(value *time.Time) string {
+	if value == nil {
+		return ""
+	}
+
+	return value.UTC().Format(time.RFC3339Nano)
+}
@@ -0,0 +1,154 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"pdf_service_api/models"
+	"sort"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+// Format is a file format the selections of a document can be exported to.
+type Format string
+
+const (
+	FormatXFDF Format = "xfdf"
+	FormatCSV  Format = "csv"
+	FormatJSON Format = "json"
+)
+
+// MediaTypes are the media types of the export formats offered for content negotiation, the
+// first one is the default.
+var MediaTypes = []string{"application/json", "application/geo+json", "application/vnd.adobe.xfdf", "text/csv"}
+
+// FormatOfMediaType returns the export format of one of the MediaTypes.
+func FormatOfMediaType(mediaType string) (Format, bool) {
+	switch mediaType {
+	case "application/json", "application/geo+json":
+		return FormatJSON, true
+	case "application/vnd.adobe.xfdf":
+		return FormatXFDF, true
+	case "text/csv":
+		return FormatCSV, true
+	}
+
+	return "", false
+}
+
+func (f Format) IsValid() bool {
+	switch f {
+	case FormatXFDF, FormatCSV, FormatJSON:
+		return true
+	}
+
+	return false
+}
+
+// ContentType is the media type of the exported file.
+func (f Format) ContentType() string {
+	switch f {
+	case FormatXFDF:
+		return "application/vnd.adobe.xfdf"
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	}
+
+	return "application/json; charset=utf-8"
+}
+
+// Document is the input of an export, the selections of one document.
+type Document struct {
+	DocumentUUID uuid.UUID
+	Selections   []models.Selection
+	// Space is the coordinate space the coordinates of the selections are given in.
+	Space models.CoordinateSpace
+	// PageNumber looks up the zero based page number of a page key. When it is nil or does not
+	// know the page, page keys which are numbers are taken as the page number.
+	PageNumber func(pageKey string) (uint32, bool)
+}
+
+// Write exports the document in the given format.
+func Write(w io.Writer, format Format, document Document) error {
+	switch format {
+	case FormatXFDF:
+		return WriteXFDF(w, document)
+	case FormatCSV:
+		return WriteCSV(w, document)
+	case FormatJSON:
+		return WriteJSON(w, document)
+	}
+
+	return fmt.Errorf("unknown export format %q", format)
+}
+
+// pageNumber returns the zero based page number of a selection, false if it is unknown.
+func (d Document) pageNumber(selection models.Selection) (uint32, bool) {
+	if selection.PageKey == nil || *selection.PageKey == "" {
+		return 0, false
+	}
+
+	if d.PageNumber != nil {
+		if number, ok := d.PageNumber(*selection.PageKey); ok {
+			return number, true
+		}
+	}
+
+	number, err := strconv.ParseUint(*selection.PageKey, 10, 32)
+	if err != nil {
+		return 0, false
+	}
+
+	return uint32(number), true
+}
+
+// page holds the selections of one page, selections without a page key share the page with an
+// empty key.
+type page struct {
+	key        string
+	number     uint32
+	isNumbered bool
+	selections []models.Selection
+}
+
+// pages groups the selections by page, ordered by page number. Pages without a known number
+// follow ordered by key, selections keep their order within a page.
+func (d Document) pages() []*page {
+	byKey := make(map[string]*page)
+	pages := make([]*page, 0)
+	for _, selection := range d.Selections {
+		key := ""
+		if selection.PageKey != nil {
+			key = *selection.PageKey
+		}
+
+		p, isPresent := byKey[key]
+		if !isPresent {
+			p = &page{key: key}
+			p.number, p.isNumbered = d.pageNumber(selection)
+			byKey[key] = p
+			pages = append(pages, p)
+		}
+
+		p.selections = append(p.selections, selection)
+	}
+
+	sort.SliceStable(pages, func(i, j int) bool {
+		if pages[i].isNumbered != pages[j].isNumbered {
+			return pages[i].isNumbered
+		}
+
+		if pages[i].isNumbered && pages[i].number != pages[j].number {
+			return pages[i].number < pages[j].number
+		}
+
+		return pages[i].key < pages[j].key
+	})
+
+	return pages
+}
+
+func formatNumber(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
@@ -0,0 +1,131 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"pdf_service_api/models"
+	_ "pdf_service_api/testutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testDocument() Document {
+	pageKey := func(key string) *string { return &key }
+	highlight, note := models.SelectionTypeHighlight, models.SelectionTypeNote
+	label, formula, color := "Invoice number", "=HYPERLINK(\"x\")", "#ffd70080"
+	created := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+
+	return Document{
+		DocumentUUID: uuid.MustParse("b66fd223-515f-4503-80cc-2bdaa50ef474"),
+		Selections: []models.Selection{
+			{Uuid: uuid.MustParse("335a6b95-6707-4e2b-9c37-c76d017f6f97"), PageKey: pageKey("cover"), Type: &note, Note: &formula,
+				Coordinates: &models.Coordinates{X1: 10, Y1: 20, X2: 30, Y2: 40}},
+			{Uuid: uuid.MustParse("a5fdea38-0a86-4c19-ae4f-c87a01bc860d"), PageKey: pageKey("3"), Type: &highlight, Label: &label, Color: &color,
+				CreatedAt: &created, Coordinates: &models.Coordinates{X1: 72, Y1: 700, X2: 144, Y2: 720}},
+			{Uuid: uuid.MustParse("4c1d9e3a-6b2f-4e85-9a70-2f8b5c6d1e94")},
+		},
+		PageNumber: func(pageKey string) (uint32, bool) {
+			if pageKey == "cover" {
+				return 0, true
+			}
+			return 0, false
+		},
+	}
+}
+
+func TestWriteXFDF(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	require.NoError(t, WriteXFDF(buffer, testDocument()))
+
+	parsed := struct {
+		Annots struct {
+			Items []struct {
+				XMLName      xml.Name
+				Page         string `xml:"page,attr"`
+				Rect         string `xml:"rect,attr"`
+				Coords       string `xml:"coords,attr"`
+				Name         string `xml:"name,attr"`
+				Subject      string `xml:"subject,attr"`
+				Color        string `xml:"color,attr"`
+				Opacity      string `xml:"opacity,attr"`
+				CreationDate string `xml:"creationdate,attr"`
+				Contents     string `xml:"contents"`
+			} `xml:",any"`
+		} `xml:"annots"`
+	}{}
+	require.NoError(t, xml.Unmarshal(buffer.Bytes(), &parsed), buffer.String())
+	assert.Contains(t, buffer.String(), `<xfdf xmlns="http://ns.adobe.com/xfdf/">`)
+
+	items := parsed.Annots.Items
+	require.Len(t, items, 2, "the selection without page and coordinates is left out")
+
+	assert.Equal(t, "text", items[0].XMLName.Local)
+	assert.Equal(t, "0", items[0].Page)
+	assert.Equal(t, "10,20,30,40", items[0].Rect)
+	assert.Equal(t, `=HYPERLINK("x")`, items[0].Contents)
+
+	assert.Equal(t, "highlight", items[1].XMLName.Local)
+	assert.Equal(t, "3", items[1].Page)
+	assert.Equal(t, "72,700,144,720", items[1].Rect)
+	assert.Equal(t, "72,720,144,720,72,700,144,700", items[1].Coords)
+	assert.Equal(t, "a5fdea38-0a86-4c19-ae4f-c87a01bc860d", items[1].Name)
+	assert.Equal(t, "Invoice number", items[1].Subject)
+	assert.Equal(t, "#FFD700", items[1].Color)
+	assert.Equal(t, "0.502", items[1].Opacity)
+	assert.Equal(t, "D:20240501123000Z", items[1].CreationDate)
+}
+
+func TestWriteCSV(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	require.NoError(t, WriteCSV(buffer, testDocument()))
+
+	rows, err := csv.NewReader(buffer).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 4)
+	assert.Equal(t, csvHeader, rows[0])
+
+	assert.Equal(t, []string{"335a6b95-6707-4e2b-9c37-c76d017f6f97", "b66fd223-515f-4503-80cc-2bdaa50ef474", "cover", "0", "note",
+		"", `'=HYPERLINK("x")`, "", "", "10", "20", "30", "40", "", "", ""}, rows[1])
+	assert.Equal(t, "3", rows[2][3])
+	assert.Equal(t, "2024-05-01T12:30:00Z", rows[2][13])
+	assert.Equal(t, []string{"4c1d9e3a-6b2f-4e85-9a70-2f8b5c6d1e94", "b66fd223-515f-4503-80cc-2bdaa50ef474", "", "", "",
+		"", "", "", "", "", "", "", "", "", "", ""}, rows[3])
+}
+
+func TestWriteJSONGroupsByPage(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	require.NoError(t, WriteJSON(buffer, testDocument()))
+
+	result := JSONDocument{}
+	require.NoError(t, json.Unmarshal(buffer.Bytes(), &result))
+	assert.Equal(t, models.CoordinateSpacePdf, result.CoordinateSpace)
+	require.Len(t, result.Pages, 3)
+
+	assert.Equal(t, "cover", *result.Pages[0].PageKey)
+	assert.EqualValues(t, 0, *result.Pages[0].PageNumber)
+	assert.Equal(t, "FeatureCollection", result.Pages[0].Type)
+	assert.Equal(t, "3", *result.Pages[1].PageKey)
+	assert.Nil(t, result.Pages[2].PageKey)
+	assert.Nil(t, result.Pages[2].PageNumber)
+
+	feature := result.Pages[1].Features[0]
+	assert.Equal(t, "Feature", feature.Type)
+	assert.Equal(t, uuid.MustParse("a5fdea38-0a86-4c19-ae4f-c87a01bc860d"), feature.ID)
+	assert.Equal(t, [][][2]float64{{{72, 700}, {144, 700}, {144, 720}, {72, 720}, {72, 700}}}, feature.Geometry.Coordinates)
+	assert.Nil(t, feature.Properties.Coordinates)
+	assert.Equal(t, "Invoice number", *feature.Properties.Label)
+
+	assert.Nil(t, result.Pages[2].Features[0].Geometry)
+	assert.True(t, strings.Contains(buffer.String(), `"geometry":null`))
+}
+
+func TestWriteRejectsUnknownFormat(t *testing.T) {
+	assert.Error(t, Write(&bytes.Buffer{}, Format("pdf"), testDocument()))
+}
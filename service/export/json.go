@@ -0,0 +1,79 @@
+package export
+
+import (
+	"encoding/json"
+	"io"
+	"pdf_service_api/models"
+
+	"github.com/google/uuid"
+)
+
+// JSONDocument is the structure written by WriteJSON. Every page is a GeoJSON feature collection
+// whose features are the selections of the page, with their rectangle as a polygon in the
+// coordinate space of the document.
+type JSONDocument struct {
+	DocumentUUID    uuid.UUID              `json:"documentUUID"`
+	CoordinateSpace models.CoordinateSpace `json:"coordinateSpace" example:"pdf"`
+	Pages           []JSONPage             `json:"pages"`
+}
+
+type JSONPage struct {
+	Type       string        `json:"type" example:"FeatureCollection"`
+	PageKey    *string       `json:"pageKey,omitempty" example:"0"`
+	PageNumber *uint32       `json:"pageNumber,omitempty" example:"0"`
+	Features   []JSONFeature `json:"features"`
+}
+
+type JSONFeature struct {
+	Type     string        `json:"type" example:"Feature"`
+	ID       uuid.UUID     `json:"id"`
+	Geometry *JSONGeometry `json:"geometry"`
+	// Properties is the selection without its coordinates.
+	Properties models.Selection `json:"properties"`
+}
+
+type JSONGeometry struct {
+	Type        string         `json:"type" example:"Polygon"`
+	Coordinates [][][2]float64 `json:"coordinates" swaggertype:"array,number"`
+}
+
+// WriteJSON exports the selections as a JSONDocument grouped by page. Selections without a page
+// key are collected on a page without key, selections without coordinates have a null geometry.
+func WriteJSON(w io.Writer, document Document) error {
+	space := document.Space
+	if space == "" {
+		space = models.CoordinateSpacePdf
+	}
+
+	result := JSONDocument{DocumentUUID: document.DocumentUUID, CoordinateSpace: space, Pages: make([]JSONPage, 0)}
+	for _, p := range document.pages() {
+		jsonPage := JSONPage{Type: "FeatureCollection", Features: make([]JSONFeature, 0, len(p.selections))}
+		if p.key != "" {
+			key := p.key
+			jsonPage.PageKey = &key
+		}
+
+		if p.isNumbered {
+			number := p.number
+			jsonPage.PageNumber = &number
+		}
+
+		for _, selection := range p.selections {
+			feature := JSONFeature{Type: "Feature", ID: selection.Uuid}
+			if c := selection.Coordinates; c != nil {
+				feature.Geometry = &JSONGeometry{
+					Type:        "Polygon",
+					Coordinates: [][][2]float64{{{c.X1, c.Y1}, {c.X2, c.Y1}, {c.X2, c.Y2}, {c.X1, c.Y2}, {c.X1, c.Y1}}},
+				}
+			}
+
+			selection.Coordinates = nil
+			feature.Properties = selection
+			jsonPage.Features = append(jsonPage.Features, feature)
+		}
+
+		result.Pages = append(result.Pages, jsonPage)
+	}
+
+	return json.NewEncoder(w).Encode(result)
+}
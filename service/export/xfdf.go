@@ -0,0 +1,154 @@
+package export
+
+import (
+	"encoding/xml"
+	"io"
+	"pdf_service_api/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type xfdfDocument struct {
+	XMLName xml.Name   `xml:"http://ns.adobe.com/xfdf/ xfdf"`
+	Annots  xfdfAnnots `xml:"annots"`
+}
+
+type xfdfAnnots struct {
+	Annotations []xfdfAnnotation
+}
+
+// xfdfAnnotation is a single annotation, its element name is the annotation type.
+type xfdfAnnotation struct {
+	XMLName      xml.Name
+	Page         uint32 `xml:"page,attr"`
+	Rect         string `xml:"rect,attr"`
+	Coords       string `xml:"coords,attr,omitempty"`
+	Name         string `xml:"name,attr"`
+	Title        string `xml:"title,attr,omitempty"`
+	Subject      string `xml:"subject,attr,omitempty"`
+	Color        string `xml:"color,attr,omitempty"`
+	Opacity      string `xml:"opacity,attr,omitempty"`
+	CreationDate string `xml:"creationdate,attr,omitempty"`
+	Date         string `xml:"date,attr,omitempty"`
+	Contents     string `xml:"contents,omitempty"`
+}
+
+// WriteXFDF exports the selections as XFDF annotations, which Acrobat and most pdf viewers can
+// import. The coordinates of the selections have to be in pdf user space. Selections without
+// coordinates or a known page cannot be placed on the document and are left out.
+//
+// Highlights and redactions become annotations of the same type, notes become text annotations
+// and all other selections squares. The label is the subject, the note the contents and the
+// author the title of an annotation.
+func WriteXFDF(w io.Writer, document Document) error {
+	annotations := make([]xfdfAnnotation, 0, len(document.Selections))
+	for _, p := range document.pages() {
+		if !p.isNumbered {
+			continue
+		}
+
+		for _, selection := range p.selections {
+			if selection.Coordinates == nil {
+				continue
+			}
+
+			annotations = append(annotations, xfdfAnnotationOf(selection, p.number))
+		}
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(xfdfDocument{Annots: xfdfAnnots{Annotations: annotations}}); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func xfdfAnnotationOf(selection models.Selection, pageNumber uint32) xfdfAnnotation {
+	c := selection.Coordinates.Normalized()
+	annotation := xfdfAnnotation{
+		XMLName: xml.Name{Local: "square"},
+		Page:    pageNumber,
+		Rect:    strings.Join([]string{formatNumber(c.X1), formatNumber(c.Y1), formatNumber(c.X2), formatNumber(c.Y2)}, ","),
+		Name:    selection.Uuid.String(),
+	}
+
+	if selection.Type != nil {
+		switch *selection.Type {
+		case models.SelectionTypeHighlight, models.SelectionTypeRedaction:
+			annotation.XMLName.Local = "highlight"
+			if *selection.Type == models.SelectionTypeRedaction {
+				annotation.XMLName.Local = "redact"
+			}
+
+			// The quad points of the rectangle, upper left, upper right, lower left and lower right.
+			annotation.Coords = strings.Join([]string{
+				formatNumber(c.X1), formatNumber(c.Y2), formatNumber(c.X2), formatNumber(c.Y2),
+				formatNumber(c.X1), formatNumber(c.Y1), formatNumber(c.X2), formatNumber(c.Y1),
+			}, ",")
+		case models.SelectionTypeNote:
+			annotation.XMLName.Local = "text"
+		}
+	}
+
+	if selection.AuthorUUID != nil {
+		annotation.Title = selection.AuthorUUID.String()
+	}
+
+	if selection.Label != nil {
+		annotation.Subject = *selection.Label
+	}
+
+	if selection.Note != nil {
+		annotation.Contents = *selection.Note
+	}
+
+	if selection.Color != nil {
+		annotation.Color, annotation.Opacity = xfdfColor(*selection.Color)
+	}
+
+	if selection.CreatedAt != nil {
+		annotation.CreationDate = pdfDate(*selection.CreatedAt)
+	}
+
+	if selection.UpdatedAt != nil {
+		annotation.Date = pdfDate(*selection.UpdatedAt)
+	}
+
+	return annotation
+}
+
+// xfdfColor turns a #RGB, #RRGGBB or #RRGGBBAA color into the #RRGGBB color of XFDF, with the
+// alpha channel as a separate opacity between 0 and 1.
+func xfdfColor(color string) (string, string) {
+	hex := strings.TrimPrefix(color, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+
+	if len(hex) != 6 && len(hex) != 8 {
+		return "", ""
+	}
+
+	opacity := ""
+	if len(hex) == 8 {
+		alpha, err := strconv.ParseUint(hex[6:], 16, 8)
+		if err == nil {
+			opacity = strconv.FormatFloat(float64(alpha)/255, 'f', 3, 64)
+		}
+	}
+
+	return "#" + strings.ToUpper(hex[:6]), opacity
+}
+
+// pdfDate formats a time as a pdf date string in UTC.
+func pdfDate(t time.Time) string {
+	return t.UTC().Format("D:20060102150405Z")
+}
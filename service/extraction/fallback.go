@@ -0,0 +1,86 @@
+package extraction
+
+import (
+	"context"
+	"errors"
+	"io"
+	"pdf_service_api/models"
+	"pdf_service_api/service/dataapi"
+	"pdf_service_api/service/logging"
+)
+
+// FallbackExtractor uses the Primary extractor and falls back to the Fallback extractor when the
+// primary one is missing or fails, for example because the data service is down. Requests that
+// can never succeed, such as documents which are not valid base64, are not retried, and neither
+// are requests whose primary extraction already handed pages on.
+type FallbackExtractor struct {
+	Primary  models.MetaExtractor
+	Fallback models.MetaExtractor
+}
+
+func (f FallbackExtractor) SendMetaRequest(ctx context.Context, base64 io.ReadSeeker, onPage models.PageHandler) (models.Meta, error) {
+	if f.Primary == nil {
+		return f.Fallback.SendMetaRequest(ctx, base64, onPage)
+	}
+
+	delivered := false
+	handler := onPage
+	if onPage != nil {
+		handler = func(pageKey string, image string, numberOfPages *uint32) error {
+			delivered = true
+			return onPage(pageKey, image, numberOfPages)
+		}
+	}
+
+	meta, err := f.Primary.SendMetaRequest(ctx, base64, handler)
+	if delivered || !shouldFallBack(ctx, err, f.Fallback != nil, base64) {
+		return meta, err
+	}
+
+	meta, fallbackErr := f.Fallback.SendMetaRequest(ctx, base64, onPage)
+	if fallbackErr != nil {
+		return meta, errors.Join(err, fallbackErr)
+	}
+
+	return meta, nil
+}
+
+// FallbackTextExtractor is the models.TextExtractor counterpart of FallbackExtractor.
+type FallbackTextExtractor struct {
+	Primary  models.TextExtractor
+	Fallback models.TextExtractor
+}
+
+func (f FallbackTextExtractor) ExtractText(ctx context.Context, base64 io.ReadSeeker, pageNumber uint32, region models.Coordinates) (string, error) {
+	if f.Primary == nil {
+		return f.Fallback.ExtractText(ctx, base64, pageNumber, region)
+	}
+
+	text, err := f.Primary.ExtractText(ctx, base64, pageNumber, region)
+	if !shouldFallBack(ctx, err, f.Fallback != nil, base64) {
+		return text, err
+	}
+
+	text, fallbackErr := f.Fallback.ExtractText(ctx, base64, pageNumber, region)
+	if fallbackErr != nil {
+		return text, errors.Join(err, fallbackErr)
+	}
+
+	return text, nil
+}
+
+// shouldFallBack decides if a failed request is repeated with the fallback, rewinding the document if so.
+func shouldFallBack(ctx context.Context, err error, hasFallback bool, base64 io.Seeker) bool {
+	if err == nil || !hasFallback || errors.Is(err, dataapi.ErrInvalidBase64) || ctx.Err() != nil {
+		return false
+	}
+
+	logger := logging.FromContext(ctx)
+	logger.Warn("extraction falling back", "error", err)
+	if _, seekErr := base64.Seek(0, io.SeekStart); seekErr != nil {
+		logger.Error("rewinding document failed", "error", seekErr)
+		return false
+	}
+
+	return true
+}
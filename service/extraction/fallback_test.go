@@ -0,0 +1,80 @@
+package extraction
+
+import (
+	"context"
+	"errors"
+	"io"
+	"pdf_service_api/models"
+	"pdf_service_api/service/dataapi"
+	_ "pdf_service_api/testutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubExtractor struct {
+	meta  models.Meta
+	err   error
+	calls int
+	read  string
+	// pages are handed to the page handler before err is returned.
+	pages []string
+}
+
+func (s *stubExtractor) SendMetaRequest(ctx context.Context, base64 io.ReadSeeker, onPage models.PageHandler) (models.Meta, error) {
+	s.calls++
+	data, _ := io.ReadAll(base64)
+	s.read = string(data)
+	for _, pageKey := range s.pages {
+		if err := onPage(pageKey, "aW1hZ2U=", nil); err != nil {
+			return models.Meta{}, err
+		}
+	}
+	return s.meta, s.err
+}
+
+func TestFallbackExtractorUsesFallbackOnFailure(t *testing.T) {
+	pages := uint32(3)
+	primary := &stubExtractor{err: dataapi.ErrCircuitOpen}
+	fallback := &stubExtractor{meta: models.Meta{NumberOfPages: &pages}}
+
+	meta, err := FallbackExtractor{Primary: primary, Fallback: fallback}.SendMetaRequest(context.Background(), strings.NewReader("JVBERi0="), nil)
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, *meta.NumberOfPages)
+	assert.Equal(t, "JVBERi0=", fallback.read)
+}
+
+func TestFallbackExtractorKeepsPermanentErrors(t *testing.T) {
+	primary := &stubExtractor{err: dataapi.ErrInvalidBase64}
+	fallback := &stubExtractor{}
+
+	_, err := FallbackExtractor{Primary: primary, Fallback: fallback}.SendMetaRequest(context.Background(), strings.NewReader("!"), nil)
+	assert.ErrorIs(t, err, dataapi.ErrInvalidBase64)
+	assert.Equal(t, 0, fallback.calls)
+}
+
+func TestFallbackExtractorKeepsFailuresAfterPages(t *testing.T) {
+	primary := &stubExtractor{pages: []string{"0"}, err: context.DeadlineExceeded}
+	fallback := &stubExtractor{pages: []string{"0", "1"}}
+
+	pages := make([]string, 0)
+	_, err := FallbackExtractor{Primary: primary, Fallback: fallback}.SendMetaRequest(context.Background(), strings.NewReader("JVBERi0="), func(pageKey string, image string, numberOfPages *uint32) error {
+		pages = append(pages, pageKey)
+		return nil
+	})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 0, fallback.calls, "pages handed on by the primary can not be taken back")
+	assert.Equal(t, []string{"0"}, pages)
+}
+
+func TestFallbackExtractorReportsBothErrors(t *testing.T) {
+	failure := errors.New("not a pdf")
+	primary := &stubExtractor{err: dataapi.ErrCircuitOpen}
+	fallback := &stubExtractor{err: failure}
+
+	_, err := FallbackExtractor{Primary: primary, Fallback: fallback}.SendMetaRequest(context.Background(), strings.NewReader("JVBERi0="), nil)
+	assert.ErrorIs(t, err, dataapi.ErrCircuitOpen)
+	assert.ErrorIs(t, err, failure)
+}
@@ -0,0 +1,228 @@
+package extraction
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"pdf_service_api/models"
+	"pdf_service_api/service/imaging"
+	"pdf_service_api/service/logging"
+	"strings"
+	"sync"
+)
+
+var ErrQueueFull = errors.New("meta extraction queue is full")
+var ErrQueueStopped = errors.New("meta extraction queue has been stopped")
+
+// pageBatchSize is the number of extracted pages that are written to the database at once.
+const pageBatchSize = 16
+
+// Queue runs meta extractions in the background, so that uploading a document
+// does not have to wait for the data service to finish.
+type Queue struct {
+	MetaExtractor      models.MetaExtractor
+	MetaRepository     models.MetaRepository
+	DocumentRepository models.DocumentRepository
+	Events             models.EventBus
+	// Logger receives the progress and failures of extractions, the default logger is used when
+	// it is nil.
+	Logger *slog.Logger
+
+	jobs    chan models.MetaExtractionJob
+	wg      sync.WaitGroup
+	mu      sync.RWMutex
+	stopped bool
+}
+
+func NewQueue(metaExtractor models.MetaExtractor, metaRepository models.MetaRepository, documentRepository models.DocumentRepository, capacity int) *Queue {
+	return &Queue{
+		MetaExtractor:      metaExtractor,
+		MetaRepository:     metaRepository,
+		DocumentRepository: documentRepository,
+		jobs:               make(chan models.MetaExtractionJob, capacity),
+	}
+}
+
+// Start launches the given number of workers, which process jobs until Stop is called.
+func (q *Queue) Start(workers int) {
+	for i := 0; i < workers; i++ {
+		q.wg.Add(1)
+		go func() {
+			defer q.wg.Done()
+			for job := range q.jobs {
+				q.process(job)
+			}
+		}()
+	}
+}
+
+// Stop prevents any new jobs from being queued and waits for the queued jobs to finish.
+func (q *Queue) Stop() {
+	q.mu.Lock()
+	if !q.stopped {
+		q.stopped = true
+		close(q.jobs)
+	}
+	q.mu.Unlock()
+
+	q.wg.Wait()
+}
+
+func (q *Queue) Enqueue(job models.MetaExtractionJob) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.stopped {
+		return ErrQueueStopped
+	}
+
+	select {
+	case q.jobs <- job:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+func (q *Queue) process(job models.MetaExtractionJob) {
+	logger := q.jobLogger(job)
+	documents := logging.Scoped(q.DocumentRepository, logger)
+	if err := documents.SetMetaStatus(job.DocumentUUID, models.MetaStatusProcessing); err != nil {
+		logger.Error("updating meta status failed", "error", err)
+	}
+	q.publish(models.Event{Type: models.EventExtractionStarted, DocumentUUID: job.DocumentUUID, MetaStatus: statusPointer(models.MetaStatusProcessing)})
+
+	status := models.MetaStatusFailed
+	var numberOfPages *uint32
+	var extractErr error
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("recovered from panic in meta extraction", "panic", r)
+			extractErr = fmt.Errorf("meta extraction panicked: %v", r)
+		}
+
+		if err := documents.SetMetaStatus(job.DocumentUUID, status); err != nil {
+			logger.Error("updating meta status failed", "error", err)
+		}
+
+		event := models.Event{Type: models.EventExtractionCompleted, DocumentUUID: job.DocumentUUID, MetaStatus: statusPointer(status), NumberOfPages: numberOfPages}
+		if extractErr != nil {
+			msg := extractErr.Error()
+			event.Type = models.EventExtractionFailed
+			event.Error = &msg
+		}
+		q.publish(event)
+	}()
+
+	if numberOfPages, extractErr = q.extract(job, logger); extractErr != nil {
+		logger.Error("meta extraction failed", "error", extractErr)
+		return
+	}
+
+	status = models.MetaStatusComplete
+	logger.Info("meta extraction finished")
+}
+
+// jobLogger returns the logger of the queue with the document and the request of the job.
+func (q *Queue) jobLogger(job models.MetaExtractionJob) *slog.Logger {
+	logger := q.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	logger = logger.With("documentUUID", job.DocumentUUID)
+	if job.RequestID != "" {
+		logger = logger.With("requestId", job.RequestID)
+	}
+
+	return logger
+}
+
+// extract runs the extraction of the job and stores its meta data and pages, all or nothing.
+// Pages are staged in batches as they arrive and replace the stored ones together with the meta data.
+// It returns the number of pages of the extracted meta data.
+func (q *Queue) extract(job models.MetaExtractionJob, logger *slog.Logger) (*uint32, error) {
+	if job.PdfBase64 == nil {
+		exclude := make(models.Exclude)
+		exclude.TimeCreated(true).OwnerUUID(true).OwnerType(true).DocumentTitle(true).MetaStatus(true)
+		document, err := logging.Scoped(q.DocumentRepository, logger).GetDocumentByDocumentUUID(job.DocumentUUID, job.OwnerUUID, exclude)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load document: %w", err)
+		}
+
+		job.PdfBase64 = document.PdfBase64
+	}
+
+	ctx := logging.NewContext(context.Background(), logger)
+	if job.RequestID != "" {
+		ctx = logging.WithRequestID(ctx, job.RequestID)
+	}
+
+	var numberOfPages *uint32
+	err := logging.Scoped(q.MetaRepository, logger).StoreExtraction(job.DocumentUUID, func(addPages func(pages []models.Page) error) (models.Meta, error) {
+		pages := make([]models.Page, 0, pageBatchSize)
+		flush := func() error {
+			if len(pages) == 0 {
+				return nil
+			}
+
+			err := addPages(pages)
+			pages = pages[:0]
+			return err
+		}
+
+		var pagesDone uint32
+		onPage := func(pageKey string, image string, total *uint32) error {
+			// The repository numbers the pages by their key once all of them are stored.
+			pages = append(pages, imaging.NewPage(job.DocumentUUID, pagesDone, pageKey, image))
+			pagesDone++
+			if len(pages) >= pageBatchSize {
+				if err := flush(); err != nil {
+					return fmt.Errorf("failed to store pages: %w", err)
+				}
+			}
+
+			done := pagesDone
+			q.publish(models.Event{
+				Type:          models.EventExtractionProgress,
+				DocumentUUID:  job.DocumentUUID,
+				PageKey:       &pageKey,
+				PagesDone:     &done,
+				NumberOfPages: total,
+			})
+			return nil
+		}
+
+		meta, err := q.MetaExtractor.SendMetaRequest(ctx, strings.NewReader(*job.PdfBase64), onPage)
+		if err != nil {
+			return models.Meta{}, fmt.Errorf("error sending SendMetaRequest: %w", err)
+		}
+
+		if err := flush(); err != nil {
+			return models.Meta{}, fmt.Errorf("failed to store pages: %w", err)
+		}
+
+		meta.DocumentUUID = job.DocumentUUID
+		meta.OwnerUUID = &job.OwnerUUID
+		meta.OwnerType = &job.OwnerType
+		meta.Images = nil
+		numberOfPages = meta.NumberOfPages
+		return meta, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return numberOfPages, nil
+}
+
+func (q *Queue) publish(event models.Event) {
+	if q.Events != nil {
+		q.Events.Publish(event)
+	}
+}
+
+func statusPointer(status models.MetaStatus) *models.MetaStatus {
+	return &status
+}
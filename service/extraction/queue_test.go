@@ -0,0 +1,247 @@
+package extraction
+
+import (
+	"context"
+	"errors"
+	"io"
+	"pdf_service_api/models"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pagingExtractor hands the configured pages to the page handler before returning the meta data.
+type pagingExtractor struct {
+	pages []string
+	// numberOfPages is reported with every page when set, like a data service sending it first.
+	numberOfPages *uint32
+	err           error
+	panic         bool
+}
+
+func (p *pagingExtractor) SendMetaRequest(ctx context.Context, base64 io.ReadSeeker, onPage models.PageHandler) (models.Meta, error) {
+	if p.panic {
+		panic("extractor failed")
+	}
+
+	for _, key := range p.pages {
+		if err := onPage(key, "aW1hZ2U=", p.numberOfPages); err != nil {
+			return models.Meta{}, err
+		}
+	}
+
+	number := uint32(len(p.pages))
+	return models.Meta{NumberOfPages: &number}, p.err
+}
+
+// fakeDocuments records the meta status changes of documents.
+type fakeDocuments struct {
+	models.DocumentRepository
+	mu       sync.Mutex
+	statuses []models.MetaStatus
+}
+
+func (f *fakeDocuments) SetMetaStatus(documentUuid uuid.UUID, status models.MetaStatus) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.statuses = append(f.statuses, status)
+	return nil
+}
+
+func (f *fakeDocuments) recorded() []models.MetaStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]models.MetaStatus(nil), f.statuses...)
+}
+
+// fakeMeta keeps the meta data and pages of successful extractions, like a transaction would.
+type fakeMeta struct {
+	models.MetaRepository
+	mu    sync.Mutex
+	metas []models.Meta
+	pages []models.Page
+	err   error
+}
+
+func (f *fakeMeta) StoreExtraction(documentUid uuid.UUID, extract func(addPages func(pages []models.Page) error) (models.Meta, error)) error {
+	pending := make([]models.Page, 0)
+	meta, err := extract(func(pages []models.Page) error {
+		pending = append(pending, pages...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	f.metas = append(f.metas, meta)
+	f.pages = append(f.pages, pending...)
+	return nil
+}
+
+// recordingBus collects the published events.
+type recordingBus struct {
+	mu     sync.Mutex
+	events []models.Event
+}
+
+func (b *recordingBus) Publish(event models.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.events = append(b.events, event)
+}
+
+func (b *recordingBus) Subscribe(documentUuid uuid.UUID) (<-chan models.Event, func()) {
+	return nil, func() {}
+}
+
+func (b *recordingBus) types() []models.EventType {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	types := make([]models.EventType, 0, len(b.events))
+	for _, event := range b.events {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+func runJob(t *testing.T, extractor models.MetaExtractor, meta *fakeMeta) (*fakeDocuments, *recordingBus) {
+	t.Helper()
+	documents := &fakeDocuments{}
+	bus := &recordingBus{}
+	queue := NewQueue(extractor, meta, documents, 1)
+	queue.Events = bus
+	queue.Start(1)
+
+	base64 := "JVBERi0="
+	require.NoError(t, queue.Enqueue(models.MetaExtractionJob{DocumentUUID: uuid.New(), OwnerUUID: uuid.New(), PdfBase64: &base64}))
+	queue.Stop()
+	return documents, bus
+}
+
+func TestQueueCompletesExtraction(t *testing.T) {
+	meta := &fakeMeta{}
+	documents, bus := runJob(t, &pagingExtractor{pages: []string{"1", "2"}}, meta)
+
+	assert.Equal(t, []models.MetaStatus{models.MetaStatusProcessing, models.MetaStatusComplete}, documents.recorded())
+	require.Len(t, meta.metas, 1)
+	assert.Nil(t, meta.metas[0].Images, "page images are stored as pages, not in the meta data")
+	assert.Len(t, meta.pages, 2)
+	assert.Equal(t, []models.EventType{models.EventExtractionStarted, models.EventExtractionProgress, models.EventExtractionProgress, models.EventExtractionCompleted}, bus.types())
+}
+
+func TestQueueReportsNumberOfPages(t *testing.T) {
+	numberOfPages := uint32(2)
+	_, bus := runJob(t, &pagingExtractor{pages: []string{"1", "2"}, numberOfPages: &numberOfPages}, &fakeMeta{})
+
+	require.Len(t, bus.events, 4)
+	for _, event := range bus.events[1:3] {
+		require.NotNil(t, event.NumberOfPages, "progress reports the total the extractor knows up front")
+		assert.EqualValues(t, 2, *event.NumberOfPages)
+	}
+
+	completed := bus.events[3]
+	assert.Equal(t, models.EventExtractionCompleted, completed.Type)
+	require.NotNil(t, completed.NumberOfPages)
+	assert.EqualValues(t, 2, *completed.NumberOfPages)
+	assert.EqualValues(t, 2, *bus.events[2].PagesDone)
+
+	_, bus = runJob(t, &pagingExtractor{pages: []string{"1"}}, &fakeMeta{})
+	assert.Nil(t, bus.events[1].NumberOfPages)
+	require.NotNil(t, bus.events[2].NumberOfPages, "the completion reports the total of the meta data")
+	assert.EqualValues(t, 1, *bus.events[2].NumberOfPages)
+}
+
+func TestQueueMarksFailedExtraction(t *testing.T) {
+	meta := &fakeMeta{}
+	documents, bus := runJob(t, &pagingExtractor{err: errors.New("not a pdf")}, meta)
+
+	assert.Equal(t, []models.MetaStatus{models.MetaStatusProcessing, models.MetaStatusFailed}, documents.recorded())
+	assert.Empty(t, meta.metas)
+	assert.Equal(t, []models.EventType{models.EventExtractionStarted, models.EventExtractionFailed}, bus.types())
+}
+
+func TestQueueStoresNoPagesOfFailedExtraction(t *testing.T) {
+	meta := &fakeMeta{}
+	documents, _ := runJob(t, &pagingExtractor{pages: []string{"1", "2"}, err: errors.New("connection reset")}, meta)
+
+	assert.Equal(t, []models.MetaStatus{models.MetaStatusProcessing, models.MetaStatusFailed}, documents.recorded())
+	assert.Empty(t, meta.pages)
+}
+
+func TestQueueMarksFailedStorage(t *testing.T) {
+	documents, _ := runJob(t, &pagingExtractor{}, &fakeMeta{err: errors.New("database down")})
+
+	assert.Equal(t, []models.MetaStatus{models.MetaStatusProcessing, models.MetaStatusFailed}, documents.recorded())
+}
+
+func TestQueueRecoversFromPanickingExtractor(t *testing.T) {
+	documents, bus := runJob(t, &pagingExtractor{panic: true}, &fakeMeta{})
+
+	assert.Equal(t, []models.MetaStatus{models.MetaStatusProcessing, models.MetaStatusFailed}, documents.recorded())
+	assert.Contains(t, bus.types(), models.EventExtractionFailed)
+}
+
+// blockingExtractor holds every extraction until it is released.
+type blockingExtractor struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingExtractor) SendMetaRequest(ctx context.Context, base64 io.ReadSeeker, onPage models.PageHandler) (models.Meta, error) {
+	b.started <- struct{}{}
+	<-b.release
+	return models.Meta{}, nil
+}
+
+func TestQueueRejectsJobsWhenFull(t *testing.T) {
+	extractor := &blockingExtractor{started: make(chan struct{}, 1), release: make(chan struct{})}
+	queue := NewQueue(extractor, &fakeMeta{}, &fakeDocuments{}, 1)
+	queue.Start(1)
+
+	base64 := "JVBERi0="
+	job := models.MetaExtractionJob{DocumentUUID: uuid.New(), PdfBase64: &base64}
+	require.NoError(t, queue.Enqueue(job))
+	select {
+	case <-extractor.started:
+	case <-time.After(time.Second):
+		t.Fatal("the worker did not pick up the job")
+	}
+
+	require.NoError(t, queue.Enqueue(job), "the buffer holds one waiting job")
+	assert.ErrorIs(t, queue.Enqueue(job), ErrQueueFull)
+
+	close(extractor.release)
+	queue.Stop()
+	assert.ErrorIs(t, queue.Enqueue(job), ErrQueueStopped)
+}
+
+func TestQueueRunsJobsConcurrently(t *testing.T) {
+	extractor := &blockingExtractor{started: make(chan struct{}, 2), release: make(chan struct{})}
+	queue := NewQueue(extractor, &fakeMeta{}, &fakeDocuments{}, 2)
+	queue.Start(2)
+
+	base64 := "JVBERi0="
+	for i := 0; i < 2; i++ {
+		require.NoError(t, queue.Enqueue(models.MetaExtractionJob{DocumentUUID: uuid.New(), PdfBase64: &base64}))
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-extractor.started:
+		case <-time.After(time.Second):
+			t.Fatal("both workers should run at the same time")
+		}
+	}
+
+	close(extractor.release)
+	queue.Stop()
+}
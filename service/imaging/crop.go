@@ -0,0 +1,38 @@
+package imaging
+
+import (
+	"errors"
+	"image"
+	"image/draw"
+	"math"
+	"pdf_service_api/models"
+)
+
+var ErrEmptyCrop = errors.New("the region does not cover any pixel of the image")
+
+// Crop copies the part of src covered by region into a new image, with its origin in the upper
+// left corner. The region is given in fractions of the image as in models.CoordinateSpaceRelative,
+// partly covered pixels are included and anything outside of src is cut off.
+func Crop(src image.Image, region models.Coordinates) (image.Image, error) {
+	if err := region.Validate(); err != nil {
+		return nil, err
+	}
+
+	bounds := src.Bounds()
+	region = region.Normalized()
+	width, height := float64(bounds.Dx()), float64(bounds.Dy())
+	area := image.Rect(
+		bounds.Min.X+int(math.Floor(region.X1*width)),
+		bounds.Min.Y+int(math.Floor(region.Y1*height)),
+		bounds.Min.X+int(math.Ceil(region.X2*width)),
+		bounds.Min.Y+int(math.Ceil(region.Y2*height)),
+	).Intersect(bounds)
+
+	if area.Empty() {
+		return nil, ErrEmptyCrop
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, area.Dx(), area.Dy()))
+	draw.Draw(dst, dst.Bounds(), src, area.Min, draw.Src)
+	return dst, nil
+}
@@ -0,0 +1,35 @@
+package imaging_test
+
+import (
+	"image"
+	"image/color"
+	"pdf_service_api/models"
+	"pdf_service_api/service/imaging"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCropCoversPartialPixels(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 200, 100))
+	src.Set(49, 25, color.RGBA{R: 255, A: 255})
+
+	img, err := imaging.Crop(src, models.Coordinates{X1: 0.5, Y1: 0.5, X2: 0.249, Y2: 0.25})
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 51, 25), img.Bounds())
+
+	r, _, _, _ := img.At(0, 0).RGBA()
+	assert.EqualValues(t, 0xffff, r, "the origin moves to the upper left corner of the region")
+}
+
+func TestCropCutsOffOutsideOfImage(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 200, 100))
+
+	img, err := imaging.Crop(src, models.Coordinates{X1: 0.9, Y1: -0.5, X2: 1.5, Y2: 0.1})
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 20, 10), img.Bounds())
+
+	_, err = imaging.Crop(src, models.Coordinates{X1: 1.1, Y1: 0, X2: 1.5, Y2: 1})
+	assert.ErrorIs(t, err, imaging.ErrEmptyCrop)
+}
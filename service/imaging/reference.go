@@ -0,0 +1,121 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"pdf_service_api/models"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidReference = errors.New("page image is neither a data uri nor base64 encoded")
+
+// Info describes a page image without decoding its pixels.
+type Info struct {
+	Width    int
+	Height   int
+	MimeType string
+}
+
+// Open returns a reader over the raw bytes of an image reference, which is either a
+// data uri ("data:image/png;base64,...") or plain base64 as produced by the data service.
+// The declared mime type of a data uri is returned, it is empty for plain base64.
+func Open(reference string) (io.Reader, string, error) {
+	mimeType := ""
+	data := reference
+	if strings.HasPrefix(reference, "data:") {
+		header, payload, found := strings.Cut(reference, ",")
+		if !found || !strings.HasSuffix(header, ";base64") {
+			return nil, "", ErrInvalidReference
+		}
+
+		mimeType = strings.TrimSuffix(strings.TrimPrefix(header, "data:"), ";base64")
+		data = payload
+	}
+
+	encoding := base64.StdEncoding
+	if !strings.HasSuffix(data, "=") && len(data)%4 != 0 {
+		encoding = base64.RawStdEncoding
+	}
+
+	return base64.NewDecoder(encoding, strings.NewReader(data)), mimeType, nil
+}
+
+// Decode returns the raw bytes and the mime type of an image reference.
+func Decode(reference string) ([]byte, string, error) {
+	reader, mimeType, err := Open(reference)
+	if err != nil {
+		return nil, "", err
+	}
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, "", errors.Join(ErrInvalidReference, err)
+	}
+
+	if mimeType == "" {
+		mimeType = http.DetectContentType(data)
+	}
+
+	return data, mimeType, nil
+}
+
+// Inspect reads the dimensions and format of an image reference, decoding only its header.
+func Inspect(reference string) (Info, error) {
+	reader, _, err := Open(reference)
+	if err != nil {
+		return Info{}, err
+	}
+
+	config, format, err := image.DecodeConfig(reader)
+	if err != nil {
+		return Info{}, err
+	}
+
+	return Info{Width: config.Width, Height: config.Height, MimeType: "image/" + format}, nil
+}
+
+// DecodeImage decodes the pixels of an image reference.
+func DecodeImage(reference string) (image.Image, string, error) {
+	data, _, err := Decode(reference)
+	if err != nil {
+		return nil, "", err
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+
+	return img, "image/" + format, nil
+}
+
+// NewPage builds a page for the given image reference, filling in the image dimensions and
+// mime type when the reference can be inspected.
+func NewPage(documentUid uuid.UUID, pageNumber uint32, pageKey string, reference string) models.Page {
+	page := models.Page{
+		DocumentUUID: documentUid,
+		PageNumber:   pageNumber,
+		PageKey:      pageKey,
+		Image:        &reference,
+	}
+
+	info, err := Inspect(reference)
+	if err != nil {
+		return page
+	}
+
+	width, height := uint32(info.Width), uint32(info.Height)
+	page.Width = &width
+	page.Height = &height
+	page.MimeType = &info.MimeType
+	return page
+}
@@ -0,0 +1,41 @@
+package imaging_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/png"
+	"pdf_service_api/service/imaging"
+	_ "pdf_service_api/testutil"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func encodedTestPng(t *testing.T, width, height int) string {
+	var buffer bytes.Buffer
+	require.NoError(t, png.Encode(&buffer, image.NewRGBA(image.Rect(0, 0, width, height))))
+	return base64.StdEncoding.EncodeToString(buffer.Bytes())
+}
+
+func TestInspectPlainBase64(t *testing.T) {
+	info, err := imaging.Inspect(encodedTestPng(t, 12, 7))
+	require.NoError(t, err)
+	assert.Equal(t, imaging.Info{Width: 12, Height: 7, MimeType: "image/png"}, info)
+}
+
+func TestDecodeDataUri(t *testing.T) {
+	data, mimeType, err := imaging.Decode("data:image/png;base64," + encodedTestPng(t, 3, 3))
+	require.NoError(t, err)
+	assert.Equal(t, "image/png", mimeType)
+	assert.Equal(t, []byte("\x89PNG"), data[:4])
+}
+
+func TestNewPageWithUninspectableReference(t *testing.T) {
+	page := imaging.NewPage(uuid.New(), 4, "4", "not an image")
+	assert.Equal(t, "not an image", *page.Image)
+	assert.Nil(t, page.Width)
+	assert.Nil(t, page.MimeType)
+}
@@ -0,0 +1,142 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+)
+
+// Fit decides how an image is placed into the requested box.
+type Fit string
+
+const (
+	// FitContain scales the image to fit inside the box, keeping its aspect ratio.
+	FitContain Fit = "contain"
+	// FitCover scales the image to fill the box, keeping its aspect ratio and cropping the overflow.
+	FitCover Fit = "cover"
+	// FitFill stretches the image to the exact size of the box.
+	FitFill Fit = "fill"
+)
+
+var ErrInvalidSize = errors.New("a width or height is required")
+var ErrUnsupportedFormat = errors.New("unsupported image format")
+
+func ParseFit(value string) (Fit, bool) {
+	switch Fit(value) {
+	case "":
+		return FitContain, true
+	case FitContain, FitCover, FitFill:
+		return Fit(value), true
+	default:
+		return "", false
+	}
+}
+
+// Resize scales src into a box of the given size. A zero width or height is derived from the
+// other one using the aspect ratio of src, in which case the fit makes no difference.
+func Resize(src image.Image, width, height int, fit Fit) (image.Image, error) {
+	bounds := src.Bounds()
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+	if width <= 0 && height <= 0 {
+		return nil, ErrInvalidSize
+	}
+
+	if srcWidth == 0 || srcHeight == 0 {
+		return image.NewRGBA(image.Rect(0, 0, max(width, 1), max(height, 1))), nil
+	}
+
+	if width <= 0 {
+		width = max(1, srcWidth*height/srcHeight)
+		fit = FitFill
+	} else if height <= 0 {
+		height = max(1, srcHeight*width/srcWidth)
+		fit = FitFill
+	}
+
+	crop := bounds
+	switch fit {
+	case FitCover:
+		// Crop the source to the aspect ratio of the box, centred.
+		if srcWidth*height > width*srcHeight {
+			cropWidth := srcHeight * width / height
+			offset := (srcWidth - cropWidth) / 2
+			crop = image.Rect(bounds.Min.X+offset, bounds.Min.Y, bounds.Min.X+offset+cropWidth, bounds.Max.Y)
+		} else {
+			cropHeight := srcWidth * height / width
+			offset := (srcHeight - cropHeight) / 2
+			crop = image.Rect(bounds.Min.X, bounds.Min.Y+offset, bounds.Max.X, bounds.Min.Y+offset+cropHeight)
+		}
+	case FitContain:
+		// Shrink the box to the aspect ratio of the source.
+		if srcWidth*height > width*srcHeight {
+			height = max(1, srcHeight*width/srcWidth)
+		} else {
+			width = max(1, srcWidth*height/srcHeight)
+		}
+	}
+
+	return scale(src, crop, width, height), nil
+}
+
+// scale resamples the area of src into a new image of the given size. Every destination pixel
+// is the average of the source pixels it covers, which keeps thin lines of text visible when
+// shrinking a page.
+func scale(src image.Image, area image.Rectangle, width, height int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	areaWidth, areaHeight := area.Dx(), area.Dy()
+
+	for y := 0; y < height; y++ {
+		y0 := area.Min.Y + y*areaHeight/height
+		y1 := max(y0+1, area.Min.Y+(y+1)*areaHeight/height)
+
+		for x := 0; x < width; x++ {
+			x0 := area.Min.X + x*areaWidth/width
+			x1 := max(x0+1, area.Min.X+(x+1)*areaWidth/width)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r += uint64(cr)
+					g += uint64(cg)
+					b += uint64(cb)
+					a += uint64(ca)
+					n++
+				}
+			}
+
+			dst.SetRGBA64(x, y, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(b / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+
+	return dst
+}
+
+// Encode writes img in the given mime type, either image/jpeg or image/png.
+func Encode(img image.Image, mimeType string) ([]byte, error) {
+	var buffer bytes.Buffer
+	var err error
+
+	switch mimeType {
+	case "image/jpeg":
+		err = jpeg.Encode(&buffer, img, &jpeg.Options{Quality: 85})
+	case "image/png":
+		err = png.Encode(&buffer, img)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
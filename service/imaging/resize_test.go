@@ -0,0 +1,74 @@
+package imaging_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"pdf_service_api/service/imaging"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResizeContainKeepsAspectRatio(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 400, 200))
+
+	img, err := imaging.Resize(src, 100, 100, imaging.FitContain)
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 100, 50), img.Bounds())
+}
+
+func TestResizeCoverFillsBox(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	// Only the centre of a cover crop should survive, so the red left edge must disappear.
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 100; x++ {
+			src.Set(x, y, color.RGBA{R: 255, A: 255})
+		}
+	}
+
+	img, err := imaging.Resize(src, 100, 100, imaging.FitCover)
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 100, 100), img.Bounds())
+
+	r, _, _, _ := img.At(0, 50).RGBA()
+	assert.Zero(t, r)
+}
+
+func TestResizeDerivesMissingDimension(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 612, 792))
+
+	img, err := imaging.Resize(src, 0, 200, imaging.FitCover)
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 154, 200), img.Bounds())
+
+	_, err = imaging.Resize(src, 0, 0, imaging.FitContain)
+	assert.ErrorIs(t, err, imaging.ErrInvalidSize)
+}
+
+func TestResizeAveragesPixels(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	src.Set(0, 0, color.RGBA{R: 255, G: 255, B: 255, A: 255})
+	src.Set(1, 0, color.RGBA{A: 255})
+
+	img, err := imaging.Resize(src, 1, 1, imaging.FitFill)
+	require.NoError(t, err)
+
+	r, _, _, a := img.At(0, 0).RGBA()
+	assert.InDelta(t, 0x7fff, r, 0x100)
+	assert.EqualValues(t, 0xffff, a)
+}
+
+func TestEncode(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 8, 8))
+
+	data, err := imaging.Encode(src, "image/jpeg")
+	require.NoError(t, err)
+	_, err = jpeg.Decode(bytes.NewReader(data))
+	assert.NoError(t, err)
+
+	_, err = imaging.Encode(src, "image/webp")
+	assert.ErrorIs(t, err, imaging.ErrUnsupportedFormat)
+}
@@ -0,0 +1,65 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+)
+
+type contextKey int
+
+const (
+	loggerKey contextKey = iota
+	requestIDKey
+)
+
+// New returns a logger writing JSON lines for every record at or above the level.
+func New(w io.Writer, level slog.Leveler) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level}))
+}
+
+// ParseLevel reads a level name such as debug, info, warn or error, an empty name is info.
+func ParseLevel(name string) (slog.Level, error) {
+	level := slog.LevelInfo
+	if name == "" {
+		return level, nil
+	}
+
+	err := level.UnmarshalText([]byte(name))
+	return level, err
+}
+
+// NewContext returns a copy of ctx carrying the logger.
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, logger)
+}
+
+// FromContext returns the logger carried by ctx, or the default logger when it carries none.
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey).(*slog.Logger); ok && logger != nil {
+		return logger
+	}
+
+	return slog.Default()
+}
+
+// WithRequestID returns a copy of ctx carrying the id of the request it serves.
+func WithRequestID(ctx context.Context, requestId string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestId)
+}
+
+// RequestID returns the id of the request ctx serves, or an empty string outside of a request.
+func RequestID(ctx context.Context) string {
+	requestId, _ := ctx.Value(requestIDKey).(string)
+	return requestId
+}
+
+// Scoped returns the repository logging with the logger when it has a WithLogger method
+// returning its own type, and the repository unchanged otherwise.
+func Scoped[T any](repository T, logger *slog.Logger) T {
+	if scoped, ok := any(repository).(interface{ WithLogger(*slog.Logger) T }); ok {
+		return scoped.WithLogger(logger)
+	}
+
+	return repository
+}
@@ -0,0 +1,88 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	_ "pdf_service_api/testutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type repository interface {
+	Name() string
+}
+
+type loggingRepository struct {
+	logger *slog.Logger
+}
+
+func (r loggingRepository) Name() string {
+	return "logging"
+}
+
+func (r loggingRepository) WithLogger(logger *slog.Logger) repository {
+	r.logger = logger
+	return r
+}
+
+type plainRepository struct{}
+
+func (plainRepository) Name() string {
+	return "plain"
+}
+
+func TestNewWritesJSONAtLevel(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := New(&buffer, slog.LevelWarn)
+
+	logger.Info("dropped")
+	logger.Warn("kept", "requestId", "abc")
+
+	line := map[string]any{}
+	require.NoError(t, json.Unmarshal(buffer.Bytes(), &line))
+	assert.Equal(t, "kept", line["msg"])
+	assert.Equal(t, "WARN", line["level"])
+	assert.Equal(t, "abc", line["requestId"])
+}
+
+func TestParseLevel(t *testing.T) {
+	level, err := ParseLevel("")
+	require.NoError(t, err)
+	assert.Equal(t, slog.LevelInfo, level)
+
+	level, err = ParseLevel("debug")
+	require.NoError(t, err)
+	assert.Equal(t, slog.LevelDebug, level)
+
+	_, err = ParseLevel("verbose")
+	assert.Error(t, err)
+}
+
+func TestContextCarriesLoggerAndRequestID(t *testing.T) {
+	ctx := context.Background()
+	assert.Same(t, slog.Default(), FromContext(ctx))
+	assert.Empty(t, RequestID(ctx))
+
+	logger := New(&bytes.Buffer{}, slog.LevelInfo)
+	ctx = WithRequestID(NewContext(ctx, logger), "abc")
+	assert.Same(t, logger, FromContext(ctx))
+	assert.Equal(t, "abc", RequestID(ctx))
+}
+
+func TestScopedHandsLoggerToRepositories(t *testing.T) {
+	logger := New(&bytes.Buffer{}, slog.LevelInfo)
+
+	var scoped repository = loggingRepository{}
+	scoped = Scoped(scoped, logger)
+	assert.Same(t, logger, scoped.(loggingRepository).logger)
+
+	var plain repository = plainRepository{}
+	assert.Equal(t, plain, Scoped(plain, logger))
+
+	var missing repository
+	assert.Nil(t, Scoped(missing, logger))
+}
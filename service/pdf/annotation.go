@@ -0,0 +1,101 @@
+package pdf
+
+import (
+	"strings"
+	"time"
+)
+
+// Annotation is an entry of the /Annots array of a page.
+type Annotation struct {
+	PageNumber uint32
+	// Subtype is the annotation type, such as Highlight, Square or Text.
+	Subtype string
+	// Rect is the rectangle of the annotation in pdf user space, nil if it is missing or invalid.
+	Rect *[4]float64
+	// Name is the unique name of the annotation within its page, the /NM entry.
+	Name     string
+	Contents string
+	Subject  string
+	// Title is the author of the annotation, the /T entry.
+	Title string
+	// Color holds the components of the /C entry, with 1 (gray), 3 (RGB) or 4 (CMYK) values.
+	Color        []float64
+	Opacity      *float64
+	CreationDate *time.Time
+	ModDate      *time.Time
+}
+
+// Annotations reads the annotations of a page in the order of its /Annots array. The strings of
+// encrypted documents can not be read and are left empty.
+func (d *Document) Annotations(page Page) []Annotation {
+	annots, ok := d.Resolve(page.Dict["Annots"]).(Array)
+	if !ok {
+		return nil
+	}
+
+	text := func(dict Dict, key Name) string {
+		if d.Encrypted() {
+			return ""
+		}
+
+		value, _ := d.Resolve(dict[key]).(String)
+		return strings.TrimSpace(DecodeText(value))
+	}
+
+	annotations := make([]Annotation, 0, len(annots))
+	for _, element := range annots {
+		dict, ok := d.Resolve(element).(Dict)
+		if !ok {
+			continue
+		}
+
+		subtype, _ := d.Resolve(dict["Subtype"]).(Name)
+		annotation := Annotation{
+			PageNumber:   page.Number,
+			Subtype:      string(subtype),
+			Rect:         d.rect(dict["Rect"]),
+			Name:         text(dict, "NM"),
+			Contents:     text(dict, "Contents"),
+			Subject:      text(dict, "Subj"),
+			Title:        text(dict, "T"),
+			CreationDate: ParseDate(text(dict, "CreationDate")),
+			ModDate:      ParseDate(text(dict, "M")),
+		}
+
+		if color, ok := d.Resolve(dict["C"]).(Array); ok {
+			for _, component := range color {
+				if value, ok := floatValue(d.Resolve(component)); ok {
+					annotation.Color = append(annotation.Color, value)
+				}
+			}
+		}
+
+		if opacity, ok := floatValue(d.Resolve(dict["CA"])); ok {
+			annotation.Opacity = &opacity
+		}
+
+		annotations = append(annotations, annotation)
+	}
+
+	return annotations
+}
+
+// rect reads a rectangle with full precision, unlike box which keeps the precision of the
+// stored page geometry.
+func (d *Document) rect(object Object) *[4]float64 {
+	array, ok := d.Resolve(object).(Array)
+	if !ok || len(array) != 4 {
+		return nil
+	}
+
+	rect := [4]float64{}
+	for i, element := range array {
+		value, ok := floatValue(d.Resolve(element))
+		if !ok {
+			return nil
+		}
+		rect[i] = value
+	}
+
+	return &rect
+}
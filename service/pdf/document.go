@@ -0,0 +1,548 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+var ErrNotPdf = errors.New("data is not a pdf document")
+
+// maxResolveDepth bounds chains of references pointing at references.
+const maxResolveDepth = 32
+
+type xrefEntry struct {
+	offset     int64
+	gen        int
+	compressed bool
+	// streamNum and index locate compressed objects inside an object stream.
+	streamNum int
+	index     int
+}
+
+// Document is a parsed pdf file. Objects are read lazily from the underlying data
+// when they are resolved, so opening even large documents is cheap.
+type Document struct {
+	data    []byte
+	xref    map[int]xrefEntry
+	trailer Dict
+	cache   map[int]Object
+	// resolving guards against objects whose stream length refers back to themselves.
+	resolving map[int]bool
+}
+
+// Open parses the cross-reference information of a pdf file. If the cross-reference table
+// is damaged the file is scanned for objects instead, as most readers do.
+func Open(data []byte) (*Document, error) {
+	start := bytes.Index(data, []byte("%PDF-"))
+	if start < 0 || start > 1024 {
+		return nil, ErrNotPdf
+	}
+
+	d := &Document{
+		data:      data,
+		xref:      make(map[int]xrefEntry),
+		cache:     make(map[int]Object),
+		resolving: make(map[int]bool),
+	}
+
+	if err := d.readXrefChain(); err == nil {
+		if _, ok := d.Resolve(d.trailer["Root"]).(Dict); ok {
+			return d, nil
+		}
+	}
+
+	if err := d.reconstructXref(); err != nil {
+		return nil, err
+	}
+
+	if _, ok := d.Resolve(d.trailer["Root"]).(Dict); !ok {
+		return nil, fmt.Errorf("%w: document catalog is missing", ErrMalformed)
+	}
+
+	return d, nil
+}
+
+// Trailer returns the trailer dictionary, merged over all incremental updates.
+func (d *Document) Trailer() Dict {
+	return d.trailer
+}
+
+// Encrypted reports if the document is encrypted, in which case its strings can not be read.
+func (d *Document) Encrypted() bool {
+	return d.trailer["Encrypt"] != nil
+}
+
+func (d *Document) readXrefChain() error {
+	offset, err := d.startXref()
+	if err != nil {
+		return err
+	}
+
+	d.trailer = make(Dict)
+	visited := make(map[int64]bool)
+	for offset >= 0 {
+		if visited[offset] || offset >= int64(len(d.data)) {
+			return fmt.Errorf("%w: invalid xref offset %d", ErrMalformed, offset)
+		}
+		visited[offset] = true
+
+		trailer, err := d.readXrefSection(offset)
+		if err != nil {
+			return err
+		}
+
+		// Hybrid files keep the entries of compressed objects in an additional xref stream.
+		if stm, ok := trailer["XRefStm"].(int64); ok && !visited[stm] {
+			if stm < 0 || stm >= int64(len(d.data)) {
+				return fmt.Errorf("%w: invalid xref stream offset %d", ErrMalformed, stm)
+			}
+			visited[stm] = true
+			if _, err := d.readXrefSection(stm); err != nil {
+				return err
+			}
+		}
+
+		// Newer sections come first, so keys that are already known are kept.
+		for key, value := range trailer {
+			if _, ok := d.trailer[key]; !ok {
+				d.trailer[key] = value
+			}
+		}
+
+		prev, ok := trailer["Prev"].(int64)
+		if !ok {
+			break
+		}
+		offset = prev
+	}
+	delete(d.trailer, "Prev")
+	delete(d.trailer, "XRefStm")
+	// Objects resolved while the xref was incomplete may have been cached as missing.
+	d.cache = make(map[int]Object)
+
+	return nil
+}
+
+func (d *Document) startXref() (int64, error) {
+	tail := d.data
+	if len(tail) > 2048 {
+		tail = tail[len(tail)-2048:]
+	}
+
+	index := bytes.LastIndex(tail, []byte("startxref"))
+	if index < 0 {
+		return 0, fmt.Errorf("%w: startxref not found", ErrMalformed)
+	}
+
+	l := lexer{data: tail, pos: index + len("startxref")}
+	token, err := l.token()
+	if err != nil {
+		return 0, err
+	}
+
+	offset, ok := token.(int64)
+	if !ok {
+		return 0, fmt.Errorf("%w: invalid startxref", ErrMalformed)
+	}
+
+	return offset, nil
+}
+
+// readXrefSection reads either a classic xref table or an xref stream and returns its trailer.
+func (d *Document) readXrefSection(offset int64) (Dict, error) {
+	l := lexer{data: d.data, pos: int(offset)}
+	l.skipWhitespace()
+	if bytes.HasPrefix(d.data[l.pos:], []byte("xref")) {
+		l.pos += len("xref")
+		return d.readXrefTable(&l)
+	}
+
+	_, stream, err := d.readIndirectAt(int(offset))
+	if err != nil {
+		return nil, err
+	}
+
+	xrefStream, ok := stream.(*Stream)
+	if !ok || xrefStream.Dict["Type"] != Name("XRef") {
+		return nil, fmt.Errorf("%w: no xref at offset %d", ErrMalformed, offset)
+	}
+
+	return xrefStream.Dict, d.readXrefStream(xrefStream)
+}
+
+func (d *Document) readXrefTable(l *lexer) (Dict, error) {
+	for {
+		token, err := l.token()
+		if err != nil {
+			return nil, err
+		}
+
+		if token == keyword("trailer") {
+			trailer, err := l.object()
+			if err != nil {
+				return nil, err
+			}
+
+			dict, ok := trailer.(Dict)
+			if !ok {
+				return nil, fmt.Errorf("%w: invalid trailer", ErrMalformed)
+			}
+			return dict, nil
+		}
+
+		first, ok := token.(int64)
+		if !ok {
+			return nil, fmt.Errorf("%w: invalid xref subsection", ErrMalformed)
+		}
+
+		countToken, err := l.token()
+		if err != nil {
+			return nil, err
+		}
+		count, ok := countToken.(int64)
+		if !ok || count < 0 {
+			return nil, fmt.Errorf("%w: invalid xref subsection", ErrMalformed)
+		}
+
+		for i := int64(0); i < count; i++ {
+			offsetToken, err := l.token()
+			if err != nil {
+				return nil, err
+			}
+			genToken, err := l.token()
+			if err != nil {
+				return nil, err
+			}
+			kind, err := l.token()
+			if err != nil {
+				return nil, err
+			}
+
+			entryOffset, ok1 := offsetToken.(int64)
+			gen, ok2 := genToken.(int64)
+			if !ok1 || !ok2 {
+				return nil, fmt.Errorf("%w: invalid xref entry", ErrMalformed)
+			}
+
+			num := int(first + i)
+			if _, known := d.xref[num]; known || kind != keyword("n") {
+				continue
+			}
+			d.xref[num] = xrefEntry{offset: entryOffset, gen: int(gen)}
+		}
+	}
+}
+
+func (d *Document) readXrefStream(stream *Stream) error {
+	data, err := d.StreamData(stream)
+	if err != nil {
+		return err
+	}
+
+	widths, ok := stream.Dict["W"].(Array)
+	if !ok || len(widths) < 3 {
+		return fmt.Errorf("%w: xref stream without W", ErrMalformed)
+	}
+
+	w := make([]int, 3)
+	rowLength := 0
+	for i := range w {
+		w[i] = intValue(widths[i], -1)
+		if w[i] < 0 || w[i] > 8 {
+			return fmt.Errorf("%w: invalid xref stream widths", ErrMalformed)
+		}
+		rowLength += w[i]
+	}
+	if rowLength == 0 {
+		return fmt.Errorf("%w: invalid xref stream widths", ErrMalformed)
+	}
+
+	index := Array{int64(0), stream.Dict["Size"]}
+	if value, ok := stream.Dict["Index"].(Array); ok {
+		index = value
+	}
+
+	field := func(row []byte, i int, fallback int64) int64 {
+		if w[i] == 0 {
+			return fallback
+		}
+
+		start := 0
+		for j := 0; j < i; j++ {
+			start += w[j]
+		}
+
+		var value int64
+		for _, b := range row[start : start+w[i]] {
+			value = value<<8 | int64(b)
+		}
+		return value
+	}
+
+	for i := 0; i+1 < len(index); i += 2 {
+		first, count := intValue(index[i], -1), intValue(index[i+1], -1)
+		if first < 0 || count < 0 {
+			return fmt.Errorf("%w: invalid xref stream index", ErrMalformed)
+		}
+
+		for num := first; num < first+count; num++ {
+			if len(data) < rowLength {
+				return nil
+			}
+			row := data[:rowLength]
+			data = data[rowLength:]
+
+			if _, known := d.xref[num]; known {
+				continue
+			}
+
+			switch field(row, 0, 1) {
+			case 1:
+				d.xref[num] = xrefEntry{offset: field(row, 1, 0), gen: int(field(row, 2, 0))}
+			case 2:
+				d.xref[num] = xrefEntry{compressed: true, streamNum: int(field(row, 1, 0)), index: int(field(row, 2, 0))}
+			}
+		}
+	}
+
+	return nil
+}
+
+var objectHeader = regexp.MustCompile(`(?m)(?:^|[\r\n\s])(\d+)\s+(\d+)\s+obj\b`)
+
+// reconstructXref rebuilds the cross-reference information by scanning for object headers.
+// Later definitions of the same object win, just as with incremental updates.
+func (d *Document) reconstructXref() error {
+	d.xref = make(map[int]xrefEntry)
+	d.cache = make(map[int]Object)
+	d.trailer = make(Dict)
+
+	for _, match := range objectHeader.FindAllSubmatchIndex(d.data, -1) {
+		num, err1 := strconv.Atoi(string(d.data[match[2]:match[3]]))
+		gen, err2 := strconv.Atoi(string(d.data[match[4]:match[5]]))
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		d.xref[num] = xrefEntry{offset: int64(match[2]), gen: gen}
+	}
+
+	for _, match := range regexp.MustCompile(`trailer\s*<<`).FindAllIndex(d.data, -1) {
+		l := lexer{data: d.data, pos: match[0] + len("trailer")}
+		if trailer, err := l.object(); err == nil {
+			if dict, ok := trailer.(Dict); ok {
+				for key, value := range dict {
+					d.trailer[key] = value
+				}
+			}
+		}
+	}
+
+	// Files with xref streams have no trailer keyword, their trailer is the stream dictionary
+	// and the entries of compressed objects are only known from the stream.
+	for num := range d.xref {
+		stream, ok := d.object(num).(*Stream)
+		if !ok || stream.Dict["Type"] != Name("XRef") {
+			continue
+		}
+
+		for key, value := range stream.Dict {
+			if _, known := d.trailer[key]; !known {
+				d.trailer[key] = value
+			}
+		}
+		_ = d.readXrefStream(stream)
+	}
+
+	if d.trailer["Root"] == nil {
+		for num := range d.xref {
+			if dict, ok := d.object(num).(Dict); ok && dict["Type"] == Name("Catalog") {
+				d.trailer["Root"] = Ref{Num: num, Gen: d.xref[num].gen}
+				break
+			}
+		}
+	}
+
+	if d.trailer["Root"] == nil {
+		return fmt.Errorf("%w: document catalog not found", ErrMalformed)
+	}
+
+	return nil
+}
+
+// Resolve follows indirect references until a direct object is found. Unknown or broken
+// objects resolve to nil, which is how the pdf specification treats missing objects.
+func (d *Document) Resolve(object Object) Object {
+	for i := 0; i < maxResolveDepth; i++ {
+		ref, ok := object.(Ref)
+		if !ok {
+			return object
+		}
+		object = d.object(ref.Num)
+	}
+
+	return nil
+}
+
+func (d *Document) object(num int) Object {
+	if object, ok := d.cache[num]; ok {
+		return object
+	}
+
+	entry, ok := d.xref[num]
+	if !ok || d.resolving[num] {
+		return nil
+	}
+
+	d.resolving[num] = true
+	defer delete(d.resolving, num)
+
+	var object Object
+	if entry.compressed {
+		object = d.compressedObject(entry)
+	} else if entry.offset >= 0 && entry.offset < int64(len(d.data)) {
+		if readNum, value, err := d.readIndirectAt(int(entry.offset)); err == nil && readNum == num {
+			object = value
+		}
+	}
+
+	d.cache[num] = object
+	return object
+}
+
+func (d *Document) compressedObject(entry xrefEntry) Object {
+	stream, ok := d.object(entry.streamNum).(*Stream)
+	if !ok {
+		return nil
+	}
+
+	data, err := d.StreamData(stream)
+	if err != nil {
+		return nil
+	}
+
+	count := intValue(d.Resolve(stream.Dict["N"]), 0)
+	first := intValue(d.Resolve(stream.Dict["First"]), 0)
+	if entry.index >= count || first < 0 || first > len(data) {
+		return nil
+	}
+
+	l := lexer{data: data}
+	offset := -1
+	for i := 0; i <= entry.index; i++ {
+		if _, err := l.token(); err != nil {
+			return nil
+		}
+		token, err := l.token()
+		if err != nil {
+			return nil
+		}
+		value, ok := token.(int64)
+		if !ok {
+			return nil
+		}
+		offset = int(value)
+	}
+
+	if first+offset < 0 || first+offset >= len(data) {
+		return nil
+	}
+
+	l = lexer{data: data, pos: first + offset}
+	object, err := l.object()
+	if err != nil {
+		return nil
+	}
+
+	return object
+}
+
+// readIndirectAt reads "num gen obj ... endobj" at the given offset, including stream data.
+func (d *Document) readIndirectAt(offset int) (int, Object, error) {
+	l := lexer{data: d.data, pos: offset}
+
+	numToken, err := l.token()
+	if err != nil {
+		return 0, nil, err
+	}
+	if _, err := l.token(); err != nil {
+		return 0, nil, err
+	}
+	objToken, err := l.token()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	num, ok := numToken.(int64)
+	if !ok || objToken != keyword("obj") {
+		return 0, nil, fmt.Errorf("%w: no object at offset %d", ErrMalformed, offset)
+	}
+
+	object, err := l.object()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	dict, ok := object.(Dict)
+	if !ok {
+		return int(num), object, nil
+	}
+
+	saved := l.pos
+	if token, err := l.token(); err != nil || token != keyword("stream") {
+		l.pos = saved
+		return int(num), dict, nil
+	}
+
+	// The stream keyword is followed by CRLF or LF, some writers only use CR.
+	if l.pos < len(d.data) && d.data[l.pos] == '\r' {
+		l.pos++
+	}
+	if l.pos < len(d.data) && d.data[l.pos] == '\n' {
+		l.pos++
+	}
+	start := l.pos
+
+	end := -1
+	if length := intValue(d.Resolve(dict["Length"]), -1); length >= 0 && start+length <= len(d.data) {
+		rest := lexer{data: d.data, pos: start + length}
+		if token, err := rest.token(); err == nil && token == keyword("endstream") {
+			end = start + length
+		}
+	}
+
+	if end < 0 {
+		index := bytes.Index(d.data[start:], []byte("endstream"))
+		if index < 0 {
+			return 0, nil, fmt.Errorf("%w: unterminated stream", ErrMalformed)
+		}
+		end = start + index
+		for end > start && (d.data[end-1] == '\n' || d.data[end-1] == '\r') {
+			end--
+		}
+	}
+
+	return int(num), &Stream{Dict: dict, Data: d.data[start:end]}, nil
+}
+
+func intValue(object Object, fallback int) int {
+	switch value := object.(type) {
+	case int64:
+		return int(value)
+	case float64:
+		return int(value)
+	}
+	return fallback
+}
+
+func floatValue(object Object) (float64, bool) {
+	switch value := object.(type) {
+	case int64:
+		return float64(value), true
+	case float64:
+		return value, true
+	}
+	return 0, false
+}
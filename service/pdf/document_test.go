@@ -0,0 +1,265 @@
+package pdf_test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"pdf_service_api/models"
+	"pdf_service_api/service/pdf"
+	"pdf_service_api/testutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buildPdf writes the given objects, numbered from 1, followed by a classic xref table.
+func buildPdf(trailer string, objects ...string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.7\n")
+
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d %s >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, trailer, xref)
+
+	return buf.Bytes()
+}
+
+func hundredPagesReader() *strings.Reader {
+	return strings.NewReader(testutil.HundredPagesPdfInBase64)
+}
+
+func TestOpenHundredPages(t *testing.T) {
+	data, err := base64.StdEncoding.DecodeString(testutil.HundredPagesPdfInBase64)
+	require.NoError(t, err)
+
+	document, err := pdf.Open(data)
+	require.NoError(t, err)
+
+	pages, err := document.Pages()
+	require.NoError(t, err)
+	assert.Len(t, pages, 101)
+	assert.Equal(t, models.Box{0, 0, 612, 792}, *pages[100].MediaBox)
+
+	info := document.Info()
+	assert.True(t, strings.HasPrefix(info.Title, "Microsoft Word"))
+	assert.Equal(t, "Acrobat Distiller 6.0 (Windows)", info.Producer)
+	require.NotNil(t, info.CreationDate)
+	assert.Equal(t, time.Date(2006, 3, 7, 13, 8, 43, 0, time.UTC), info.CreationDate.UTC())
+}
+
+func TestPagesInheritAttributes(t *testing.T) {
+	data := buildPdf("/Root 1 0 R /Info 5 0 R",
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 /MediaBox [0 0 612 792] /Rotate 90 >>",
+		"<< /Type /Page /Parent 2 0 R >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 842 595] /CropBox [10 10 832 585] /Rotate -90 /UserUnit 2 >>",
+		"<< /Title <FEFF00480069> /Author (Jos\\351) /CreationDate (D:20240131235959Z) >>",
+	)
+
+	document, err := pdf.Open(data)
+	require.NoError(t, err)
+
+	pages, err := document.Pages()
+	require.NoError(t, err)
+	require.Len(t, pages, 2)
+
+	assert.Equal(t, models.Box{0, 0, 612, 792}, *pages[0].MediaBox)
+	assert.Nil(t, pages[0].CropBox)
+	assert.Equal(t, 90, pages[0].Rotate)
+	assert.EqualValues(t, 1, pages[0].UserUnit)
+
+	assert.Equal(t, models.Box{10, 10, 832, 585}, *pages[1].CropBox)
+	assert.Equal(t, 270, pages[1].Rotate)
+	assert.EqualValues(t, 2, pages[1].UserUnit)
+
+	info := document.Info()
+	assert.Equal(t, "Hi", info.Title)
+	assert.Equal(t, "José", info.Author)
+	assert.Equal(t, time.Date(2024, 1, 31, 23, 59, 59, 0, time.UTC), *info.CreationDate)
+}
+
+func TestOpenReconstructsBrokenXref(t *testing.T) {
+	data := buildPdf("/Root 1 0 R",
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 100 200] >>",
+	)
+	data = bytes.Replace(data, []byte("startxref\n"), []byte("startxref\n9"), 1)
+
+	document, err := pdf.Open(data)
+	require.NoError(t, err)
+
+	pages, err := document.Pages()
+	require.NoError(t, err)
+	require.Len(t, pages, 1)
+	assert.Equal(t, models.Box{0, 0, 100, 200}, *pages[0].MediaBox)
+}
+
+func TestOpenRejectsXrefStreamOutsideFile(t *testing.T) {
+	for _, stm := range []string{"999999", "-5"} {
+		data := buildPdf("/Root 1 0 R /XRefStm "+stm,
+			"<< /Type /Catalog /Pages 2 0 R >>",
+			"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+			"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 100 200] >>",
+		)
+
+		document, err := pdf.Open(data)
+		require.NoError(t, err, "the xref is reconstructed instead")
+
+		pages, err := document.Pages()
+		require.NoError(t, err)
+		require.Len(t, pages, 1)
+	}
+}
+
+func TestOpenXrefAndObjectStreams(t *testing.T) {
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.7\n")
+
+	catalog := buf.Len()
+	buf.WriteString("1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+
+	// Objects 2 and 3 live in the object stream 4.
+	pagesObject, pageObject := "<< /Type /Pages /Kids [3 0 R] /Count 1 >> ", "<< /Type /Page /MediaBox [0 0 300 400] >>"
+	header := fmt.Sprintf("2 0 3 %d ", len(pagesObject))
+	objects := header + pagesObject + pageObject
+	objectStream := buf.Len()
+	fmt.Fprintf(&buf, "4 0 obj\n<< /Type /ObjStm /N 2 /First %d /Length %d >>\nstream\n%s\nendstream\nendobj\n", len(header), len(objects), objects)
+
+	rows := [][]byte{
+		{0, 0, 0, 0},
+		{1, byte(catalog >> 8), byte(catalog), 0},
+		{2, 0, 4, 0},
+		{2, 0, 4, 1},
+		{1, byte(objectStream >> 8), byte(objectStream), 0},
+		{1, 0, 0, 0},
+	}
+	xrefStream := buf.Len()
+	rows[5][1], rows[5][2] = byte(xrefStream>>8), byte(xrefStream)
+
+	// Encode the rows with the png up predictor, as most writers do.
+	var raw bytes.Buffer
+	previous := make([]byte, 4)
+	for _, row := range rows {
+		raw.WriteByte(2)
+		for i, b := range row {
+			raw.WriteByte(b - previous[i])
+		}
+		previous = row
+	}
+
+	var compressed bytes.Buffer
+	writer := zlib.NewWriter(&compressed)
+	_, err := writer.Write(raw.Bytes())
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	fmt.Fprintf(&buf, "5 0 obj\n<< /Type /XRef /Size 6 /W [1 2 1] /Root 1 0 R /Filter /FlateDecode /DecodeParms << /Predictor 12 /Columns 4 >> /Length %d >>\nstream\n", compressed.Len())
+	buf.Write(compressed.Bytes())
+	fmt.Fprintf(&buf, "\nendstream\nendobj\nstartxref\n%d\n%%%%EOF\n", xrefStream)
+
+	document, err := pdf.Open(buf.Bytes())
+	require.NoError(t, err)
+
+	pages, err := document.Pages()
+	require.NoError(t, err)
+	require.Len(t, pages, 1)
+	assert.Equal(t, models.Box{0, 0, 300, 400}, *pages[0].MediaBox)
+}
+
+func TestPagesRejectsCycles(t *testing.T) {
+	data := buildPdf("/Root 1 0 R",
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Pages /Kids [2 0 R] /Count 1 >>",
+	)
+
+	document, err := pdf.Open(data)
+	require.NoError(t, err)
+
+	_, err = document.Pages()
+	assert.ErrorIs(t, err, pdf.ErrMalformed)
+}
+
+func TestOpenRejectsOtherData(t *testing.T) {
+	_, err := pdf.Open([]byte("hello world"))
+	assert.ErrorIs(t, err, pdf.ErrNotPdf)
+}
+
+func TestExtractorSendMetaRequest(t *testing.T) {
+	meta, err := pdf.NewExtractor().SendMetaRequest(context.Background(), strings.NewReader(testutil.HundredPagesPdfInBase64), nil)
+	require.NoError(t, err)
+
+	assert.EqualValues(t, 101, *meta.NumberOfPages)
+	assert.EqualValues(t, 612, *meta.Width)
+	assert.EqualValues(t, 792, *meta.Height)
+	assert.Len(t, meta.Pages, 101)
+	assert.Nil(t, meta.Images)
+
+	_, err = pdf.NewExtractor().SendMetaRequest(context.Background(), strings.NewReader("not base64!"), nil)
+	assert.ErrorIs(t, err, pdf.ErrInvalidBase64)
+}
+
+func TestParseDate(t *testing.T) {
+	date := pdf.ParseDate("D:19981223195200-08'00'")
+	require.NotNil(t, date)
+	assert.Equal(t, time.Date(1998, 12, 24, 3, 52, 0, 0, time.UTC), date.UTC())
+
+	date = pdf.ParseDate("D:2001")
+	require.NotNil(t, date)
+	assert.Equal(t, time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC), *date)
+
+	assert.Nil(t, pdf.ParseDate("yesterday"))
+}
+
+func TestAnnotations(t *testing.T) {
+	data := buildPdf("/Root 1 0 R",
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Annots [4 0 R 5 0 R 6 0 R] >>",
+		"<< /Type /Annot /Subtype /Highlight /Rect [72.5 700 144 720] /NM (a1) /Contents <FEFF00480069> /Subj (Total) "+
+			"/T (Jos\\351) /C [1 0.84 0] /CA 0.5 /CreationDate (D:20240131235959Z) /M (D:20240201000000Z) >>",
+		"<< /Type /Annot /Subtype /Popup /Rect [1 2 3] >>",
+		"<< /Type /Annot /Subtype /Square /Rect [10 20 30 4 0 R] >>",
+	)
+
+	document, err := pdf.Open(data)
+	require.NoError(t, err)
+
+	pages, err := document.Pages()
+	require.NoError(t, err)
+	require.Len(t, pages, 1)
+
+	annotations := document.Annotations(pages[0])
+	require.Len(t, annotations, 3)
+
+	highlight := annotations[0]
+	assert.Equal(t, "Highlight", highlight.Subtype)
+	assert.Equal(t, [4]float64{72.5, 700, 144, 720}, *highlight.Rect)
+	assert.Equal(t, "a1", highlight.Name)
+	assert.Equal(t, "Hi", highlight.Contents)
+	assert.Equal(t, "Total", highlight.Subject)
+	assert.Equal(t, "José", highlight.Title)
+	assert.Equal(t, []float64{1, 0.84, 0}, highlight.Color)
+	assert.Equal(t, 0.5, *highlight.Opacity)
+	assert.Equal(t, time.Date(2024, 1, 31, 23, 59, 59, 0, time.UTC), highlight.CreationDate.UTC())
+	assert.Equal(t, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), highlight.ModDate.UTC())
+
+	assert.Equal(t, "Popup", annotations[1].Subtype)
+	assert.Nil(t, annotations[1].Rect, "a rectangle needs four numbers")
+	assert.Nil(t, annotations[2].Rect, "a rectangle needs four numbers")
+}
@@ -0,0 +1,120 @@
+package pdf
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"pdf_service_api/models"
+)
+
+var ErrInvalidBase64 = errors.New("document is not valid base64")
+var ErrPageNotFound = errors.New("page does not exist in the document")
+
+// Extractor is a models.MetaExtractor and models.TextExtractor that reads the document directly.
+// It does not render pages, so the meta data it produces has no images, and it can only extract
+// text that is part of the content, not text within scanned images.
+type Extractor struct{}
+
+func NewExtractor() Extractor {
+	return Extractor{}
+}
+
+func (e Extractor) SendMetaRequest(ctx context.Context, encoded io.ReadSeeker, onPage models.PageHandler) (models.Meta, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Meta{}, err
+	}
+
+	document, err := OpenBase64(encoded)
+	if err != nil {
+		return models.Meta{}, err
+	}
+
+	pages, err := document.Pages()
+	if err != nil {
+		return models.Meta{}, err
+	}
+
+	return MetaFromPages(pages), nil
+}
+
+func (e Extractor) ExtractText(ctx context.Context, encoded io.ReadSeeker, pageNumber uint32, region models.Coordinates) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	document, err := OpenBase64(encoded)
+	if err != nil {
+		return "", err
+	}
+
+	pages, err := document.Pages()
+	if err != nil {
+		return "", err
+	}
+
+	if pageNumber >= uint32(len(pages)) {
+		return "", fmt.Errorf("%w: page %d of %d", ErrPageNotFound, pageNumber, len(pages))
+	}
+
+	return document.TextInRegion(pages[pageNumber], region)
+}
+
+// MetaFromPages builds the meta data of a document from its pages. The document wide size
+// is the displayed size of the first page.
+func MetaFromPages(pages []Page) models.Meta {
+	numberOfPages := uint32(len(pages))
+	meta := models.Meta{NumberOfPages: &numberOfPages, Pages: make([]models.PageGeometry, 0, len(pages))}
+
+	for _, page := range pages {
+		meta.Pages = append(meta.Pages, page.Geometry())
+	}
+
+	if len(meta.Pages) > 0 {
+		if width, height, ok := meta.Pages[0].DisplaySize(); ok {
+			meta.Width, meta.Height = &width, &height
+		}
+	}
+
+	return meta
+}
+
+// OpenBase64 decodes a base64 encoded document, optionally given as a data uri, and opens it.
+func OpenBase64(r io.Reader) (*Document, error) {
+	encoded, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.HasPrefix(encoded, []byte("data:")) {
+		if comma := bytes.IndexByte(encoded, ','); comma >= 0 {
+			encoded = encoded[comma+1:]
+		}
+	}
+
+	encoded = bytes.Map(func(r rune) rune {
+		if r == '\n' || r == '\r' || r == ' ' || r == '\t' {
+			return -1
+		}
+		return r
+	}, encoded)
+
+	encoding := base64.StdEncoding
+	if bytes.ContainsAny(encoded, "-_") {
+		encoding = base64.URLEncoding
+	}
+	if len(encoded)%4 != 0 {
+		encoding = encoding.WithPadding(base64.NoPadding)
+		encoded = bytes.TrimRight(encoded, "=")
+	}
+
+	data := make([]byte, encoding.DecodedLen(len(encoded)))
+	n, err := encoding.Decode(data, encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidBase64, err)
+	}
+
+	return Open(data[:n])
+}
@@ -0,0 +1,207 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var ErrUnsupportedFilter = errors.New("unsupported stream filter")
+
+// maxDecodedSize limits the size of a single decoded stream, protecting against compression bombs.
+const maxDecodedSize = 256 << 20
+
+// StreamData decodes the data of a stream by applying its filters in order.
+func (d *Document) StreamData(stream *Stream) ([]byte, error) {
+	filters, params := d.filters(stream.Dict)
+
+	data := stream.Data
+	for i, filter := range filters {
+		var err error
+		switch filter {
+		case "FlateDecode", "Fl":
+			data, err = flateDecode(data, params[i])
+		case "ASCIIHexDecode", "AHx":
+			data, err = asciiHexDecode(data)
+		case "ASCII85Decode", "A85":
+			data, err = ascii85Decode(data)
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedFilter, filter)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrMalformed, filter, err)
+		}
+	}
+
+	return data, nil
+}
+
+func (d *Document) filters(dict Dict) ([]Name, []Dict) {
+	var filters []Name
+	var params []Dict
+
+	switch filter := d.Resolve(dict["Filter"]).(type) {
+	case Name:
+		filters = append(filters, filter)
+	case Array:
+		for _, element := range filter {
+			if name, ok := d.Resolve(element).(Name); ok {
+				filters = append(filters, name)
+			}
+		}
+	}
+
+	switch param := d.Resolve(dict["DecodeParms"]).(type) {
+	case Dict:
+		params = append(params, param)
+	case Array:
+		for _, element := range param {
+			p, _ := d.Resolve(element).(Dict)
+			params = append(params, p)
+		}
+	}
+
+	for len(params) < len(filters) {
+		params = append(params, nil)
+	}
+
+	return filters, params
+}
+
+func flateDecode(data []byte, params Dict) ([]byte, error) {
+	reader, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	decoded, err := io.ReadAll(io.LimitReader(reader, maxDecodedSize+1))
+	if len(decoded) > maxDecodedSize {
+		return nil, errors.New("decoded stream too large")
+	}
+	// Many writers produce streams without a proper checksum, keep what could be read.
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, zlib.ErrChecksum) {
+		return nil, err
+	}
+
+	return applyPredictor(decoded, params)
+}
+
+// applyPredictor reverses the png predictors used by xref and object streams.
+func applyPredictor(data []byte, params Dict) ([]byte, error) {
+	predictor := intValue(params["Predictor"], 1)
+	if predictor < 10 {
+		if predictor == 2 {
+			return nil, fmt.Errorf("%w: tiff predictor", ErrUnsupportedFilter)
+		}
+		return data, nil
+	}
+
+	colors := intValue(params["Colors"], 1)
+	bits := intValue(params["BitsPerComponent"], 8)
+	columns := intValue(params["Columns"], 1)
+	if colors < 1 || bits < 1 || columns < 1 {
+		return nil, errors.New("invalid predictor parameters")
+	}
+
+	bytesPerPixel := (colors*bits + 7) / 8
+	rowLength := (colors*bits*columns + 7) / 8
+
+	decoded := make([]byte, 0, len(data))
+	previous := make([]byte, rowLength)
+	for len(data) > 0 {
+		if len(data) < rowLength+1 {
+			break
+		}
+
+		filterType := data[0]
+		row := append([]byte(nil), data[1:rowLength+1]...)
+		data = data[rowLength+1:]
+
+		for i := range row {
+			var left, upperLeft byte
+			if i >= bytesPerPixel {
+				left = row[i-bytesPerPixel]
+				upperLeft = previous[i-bytesPerPixel]
+			}
+			up := previous[i]
+
+			switch filterType {
+			case 0:
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[i] += paeth(left, up, upperLeft)
+			default:
+				return nil, fmt.Errorf("invalid png filter type %d", filterType)
+			}
+		}
+
+		decoded = append(decoded, row...)
+		previous = row
+	}
+
+	return decoded, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	default:
+		return c
+	}
+}
+
+func abs(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
+
+func asciiHexDecode(data []byte) ([]byte, error) {
+	cleaned := make([]byte, 0, len(data))
+	for _, b := range data {
+		if b == '>' {
+			break
+		}
+		if !isWhitespace(b) {
+			cleaned = append(cleaned, b)
+		}
+	}
+
+	if len(cleaned)%2 == 1 {
+		cleaned = append(cleaned, '0')
+	}
+
+	return hex.DecodeString(string(cleaned))
+}
+
+func ascii85Decode(data []byte) ([]byte, error) {
+	if end := bytes.Index(data, []byte("~>")); end >= 0 {
+		data = data[:end]
+	}
+	data = bytes.TrimPrefix(bytes.TrimSpace(data), []byte("<~"))
+
+	decoded := make([]byte, 4*len(data)+4)
+	n, _, err := ascii85.Decode(decoded, data, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return decoded[:n], nil
+}
@@ -0,0 +1,428 @@
+package pdf
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// font decodes the codes shown by text operators into text and glyph widths.
+type font struct {
+	composite    bool
+	toUnicode    *cmap
+	encoding     *[256]rune
+	widths       map[int]float64
+	defaultWidth float64
+}
+
+// glyph is a single decoded character code, width is in thousandths of the font size.
+type glyph struct {
+	text    string
+	width   float64
+	isSpace bool
+}
+
+func (d *Document) loadFont(dict Dict) *font {
+	f := &font{widths: make(map[int]float64), defaultWidth: 500}
+
+	if stream, ok := d.Resolve(dict["ToUnicode"]).(*Stream); ok {
+		if data, err := d.StreamData(stream); err == nil {
+			f.toUnicode = parseCMap(data)
+		}
+	}
+
+	if dict["Subtype"] == Name("Type0") {
+		f.composite = true
+		f.defaultWidth = 1000
+
+		descendants, _ := d.Resolve(dict["DescendantFonts"]).(Array)
+		if len(descendants) > 0 {
+			if descendant, ok := d.Resolve(descendants[0]).(Dict); ok {
+				if value, ok := floatValue(d.Resolve(descendant["DW"])); ok {
+					f.defaultWidth = value
+				}
+				d.loadCIDWidths(f, descendant)
+			}
+		}
+		return f
+	}
+
+	firstChar := intValue(d.Resolve(dict["FirstChar"]), 0)
+	if widths, ok := d.Resolve(dict["Widths"]).(Array); ok {
+		for i, width := range widths {
+			if value, ok := floatValue(d.Resolve(width)); ok {
+				f.widths[firstChar+i] = value
+			}
+		}
+	}
+	if descriptor, ok := d.Resolve(dict["FontDescriptor"]).(Dict); ok {
+		if value, ok := floatValue(d.Resolve(descriptor["MissingWidth"])); ok && value > 0 {
+			f.defaultWidth = value
+		}
+	}
+
+	f.encoding = d.simpleEncoding(dict["Encoding"])
+	return f
+}
+
+// loadCIDWidths reads the W array of a CID font, which mixes "c [w1 w2 ...]" and "first last w".
+func (d *Document) loadCIDWidths(f *font, descendant Dict) {
+	widths, _ := d.Resolve(descendant["W"]).(Array)
+	for i := 0; i < len(widths); {
+		first, ok := floatValue(d.Resolve(widths[i]))
+		if !ok || i+1 >= len(widths) {
+			return
+		}
+
+		if list, ok := d.Resolve(widths[i+1]).(Array); ok {
+			for j, width := range list {
+				if value, ok := floatValue(d.Resolve(width)); ok {
+					f.widths[int(first)+j] = value
+				}
+			}
+			i += 2
+			continue
+		}
+
+		if i+2 >= len(widths) {
+			return
+		}
+		last, ok1 := floatValue(d.Resolve(widths[i+1]))
+		width, ok2 := floatValue(d.Resolve(widths[i+2]))
+		if !ok1 || !ok2 || last-first > 0xFFFF {
+			return
+		}
+		for code := int(first); code <= int(last); code++ {
+			f.widths[code] = width
+		}
+		i += 3
+	}
+}
+
+func (d *Document) simpleEncoding(object Object) *[256]rune {
+	encoding := winAnsiEncoding()
+
+	var differences Array
+	switch value := d.Resolve(object).(type) {
+	case Name:
+		// MacRoman and Standard only differ from WinAnsi outside of ASCII for the text we care about.
+	case Dict:
+		differences, _ = d.Resolve(value["Differences"]).(Array)
+	}
+
+	code := 0
+	for _, element := range differences {
+		switch value := d.Resolve(element).(type) {
+		case int64:
+			code = int(value)
+		case Name:
+			if code >= 0 && code < 256 {
+				if r, ok := glyphNameToRune(string(value)); ok {
+					encoding[code] = r
+				}
+			}
+			code++
+		}
+	}
+
+	return &encoding
+}
+
+// decode splits a shown string into glyphs.
+func (f *font) decode(data []byte) []glyph {
+	glyphs := make([]glyph, 0, len(data))
+	for len(data) > 0 {
+		length := 1
+		if f.toUnicode != nil {
+			length = f.toUnicode.codeLength(data)
+		} else if f.composite {
+			length = 2
+		}
+		if length > len(data) {
+			length = len(data)
+		}
+
+		code := 0
+		for _, b := range data[:length] {
+			code = code<<8 | int(b)
+		}
+		data = data[length:]
+
+		width, ok := f.widths[code]
+		if !ok {
+			width = f.defaultWidth
+		}
+
+		text := ""
+		if f.toUnicode != nil {
+			text, ok = f.toUnicode.lookup(code, length)
+		}
+		if text == "" && !f.composite && f.encoding != nil && code < 256 {
+			if r := f.encoding[code]; r != 0 {
+				text = string(r)
+			}
+		}
+
+		glyphs = append(glyphs, glyph{text: text, width: width, isSpace: length == 1 && code == ' '})
+	}
+
+	return glyphs
+}
+
+type codeRange struct {
+	length int
+	low    int
+	high   int
+}
+
+type bfRange struct {
+	length int
+	low    int
+	high   int
+	// base is the unicode of low, ranges map consecutive codes to consecutive characters.
+	base []rune
+	// list holds one destination per code when the range maps onto an array.
+	list []string
+}
+
+// cmap is the subset of a ToUnicode CMap needed to map character codes to text.
+type cmap struct {
+	codespace []codeRange
+	chars     map[[2]int]string
+	ranges    []bfRange
+}
+
+func parseCMap(data []byte) *cmap {
+	c := &cmap{chars: make(map[[2]int]string)}
+	l := lexer{data: data}
+
+	var operands []Object
+	for {
+		token, err := l.token()
+		if err != nil {
+			break
+		}
+
+		word, isKeyword := token.(keyword)
+		if !isKeyword {
+			operands = append(operands, token)
+			continue
+		}
+
+		switch word {
+		case "begincodespacerange", "beginbfchar", "beginbfrange":
+			operands = operands[:0]
+			continue
+		case "[":
+			if array, err := l.arrayRest(); err == nil {
+				operands = append(operands, array)
+			}
+			continue
+		case "endcodespacerange":
+			for i := 0; i+1 < len(operands); i += 2 {
+				low, ok1 := operands[i].(String)
+				high, ok2 := operands[i+1].(String)
+				if ok1 && ok2 && len(low) == len(high) && len(low) > 0 && len(low) <= 4 {
+					c.codespace = append(c.codespace, codeRange{length: len(low), low: codeValue(low), high: codeValue(high)})
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				code, ok := operands[i].(String)
+				if !ok || len(code) == 0 || len(code) > 4 {
+					continue
+				}
+				c.chars[[2]int{len(code), codeValue(code)}] = destinationText(operands[i+1])
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				low, ok1 := operands[i].(String)
+				high, ok2 := operands[i+1].(String)
+				if !ok1 || !ok2 || len(low) == 0 || len(low) > 4 {
+					continue
+				}
+
+				r := bfRange{length: len(low), low: codeValue(low), high: codeValue(high)}
+				switch destination := operands[i+2].(type) {
+				case String:
+					r.base = []rune(utf16BE(destination))
+				case Array:
+					for _, element := range destination {
+						r.list = append(r.list, destinationText(element))
+					}
+				}
+				c.ranges = append(c.ranges, r)
+			}
+		}
+		operands = operands[:0]
+	}
+
+	return c
+}
+
+// arrayRest reads the elements of an array whose opening bracket was already consumed.
+func (l *lexer) arrayRest() (Array, error) {
+	array := make(Array, 0)
+	for {
+		l.skipWhitespace()
+		if l.pos < len(l.data) && l.data[l.pos] == ']' {
+			l.pos++
+			return array, nil
+		}
+
+		element, err := l.object()
+		if err != nil {
+			return nil, err
+		}
+		array = append(array, element)
+	}
+}
+
+func (c *cmap) codeLength(data []byte) int {
+	for length := 1; length <= 4 && length <= len(data); length++ {
+		value := codeValue(data[:length])
+		for _, r := range c.codespace {
+			if r.length == length && value >= r.low && value <= r.high {
+				return length
+			}
+		}
+	}
+
+	if len(c.codespace) > 0 {
+		return c.codespace[0].length
+	}
+	return 1
+}
+
+func (c *cmap) lookup(code, length int) (string, bool) {
+	if text, ok := c.chars[[2]int{length, code}]; ok {
+		return text, true
+	}
+
+	for _, r := range c.ranges {
+		if r.length != length || code < r.low || code > r.high {
+			continue
+		}
+
+		offset := code - r.low
+		if r.list != nil {
+			if offset < len(r.list) {
+				return r.list[offset], true
+			}
+			return "", false
+		}
+
+		if len(r.base) == 0 {
+			return "", false
+		}
+		text := append([]rune(nil), r.base...)
+		text[len(text)-1] += rune(offset)
+		return string(text), true
+	}
+
+	return "", false
+}
+
+func codeValue(code []byte) int {
+	value := 0
+	for _, b := range code {
+		value = value<<8 | int(b)
+	}
+	return value
+}
+
+func destinationText(object Object) string {
+	switch value := object.(type) {
+	case String:
+		return utf16BE(value)
+	case Name:
+		if r, ok := glyphNameToRune(string(value)); ok {
+			return string(r)
+		}
+	}
+	return ""
+}
+
+func utf16BE(value []byte) string {
+	units := make([]uint16, 0, len(value)/2)
+	for i := 0; i+1 < len(value); i += 2 {
+		units = append(units, uint16(value[i])<<8|uint16(value[i+1]))
+	}
+	return string(utf16.Decode(units))
+}
+
+// windows1252 lists the characters of WinAnsiEncoding that differ from Latin-1.
+var windows1252 = map[int]rune{
+	0x80: '€', 0x82: '‚', 0x83: 'ƒ', 0x84: '„', 0x85: '…', 0x86: '†', 0x87: '‡', 0x88: 'ˆ',
+	0x89: '‰', 0x8A: 'Š', 0x8B: '‹', 0x8C: 'Œ', 0x8E: 'Ž', 0x91: '‘', 0x92: '’', 0x93: '“',
+	0x94: '”', 0x95: '•', 0x96: '–', 0x97: '—', 0x98: '˜', 0x99: '™', 0x9A: 'š', 0x9B: '›',
+	0x9C: 'œ', 0x9E: 'ž', 0x9F: 'Ÿ',
+}
+
+func winAnsiEncoding() [256]rune {
+	var encoding [256]rune
+	for code := 0x20; code < 256; code++ {
+		if r, ok := windows1252[code]; ok {
+			encoding[code] = r
+		} else if code < 0x7F || code >= 0xA0 {
+			encoding[code] = rune(code)
+		}
+	}
+	return encoding
+}
+
+// glyphNames maps the glyph names used in font encodings that are not a single character.
+var glyphNames = map[string]rune{
+	"space": ' ', "exclam": '!', "quotedbl": '"', "numbersign": '#', "dollar": '$', "percent": '%',
+	"ampersand": '&', "quotesingle": '\'', "parenleft": '(', "parenright": ')', "asterisk": '*',
+	"plus": '+', "comma": ',', "hyphen": '-', "period": '.', "slash": '/', "colon": ':',
+	"semicolon": ';', "less": '<', "equal": '=', "greater": '>', "question": '?', "at": '@',
+	"bracketleft": '[', "backslash": '\\', "bracketright": ']', "asciicircum": '^',
+	"underscore": '_', "grave": '`', "braceleft": '{', "bar": '|', "braceright": '}',
+	"asciitilde": '~', "zero": '0', "one": '1', "two": '2', "three": '3', "four": '4',
+	"five": '5', "six": '6', "seven": '7', "eight": '8', "nine": '9',
+	"quoteleft": '‘', "quoteright": '’', "quotedblleft": '“', "quotedblright": '”',
+	"quotesinglbase": '‚', "quotedblbase": '„', "endash": '–', "emdash": '—', "bullet": '•',
+	"ellipsis": '…', "dagger": '†', "daggerdbl": '‡', "perthousand": '‰', "trademark": '™',
+	"copyright": '©', "registered": '®', "degree": '°', "section": '§', "paragraph": '¶',
+	"Euro": '€', "sterling": '£', "yen": '¥', "cent": '¢', "fi": 'ﬁ', "fl": 'ﬂ',
+	"germandbls": 'ß', "nbspace": ' ', "minus": '−', "multiply": '×', "divide": '÷',
+	"adieresis": 'ä', "odieresis": 'ö', "udieresis": 'ü', "Adieresis": 'Ä', "Odieresis": 'Ö',
+	"Udieresis": 'Ü', "eacute": 'é', "egrave": 'è', "ecircumflex": 'ê', "edieresis": 'ë',
+	"aacute": 'á', "agrave": 'à', "acircumflex": 'â', "atilde": 'ã', "aring": 'å',
+	"iacute": 'í', "igrave": 'ì', "icircumflex": 'î', "idieresis": 'ï', "oacute": 'ó',
+	"ograve": 'ò', "ocircumflex": 'ô', "otilde": 'õ', "uacute": 'ú', "ugrave": 'ù',
+	"ucircumflex": 'û', "ccedilla": 'ç', "ntilde": 'ñ', "Eacute": 'É', "Egrave": 'È',
+	"Aacute": 'Á', "Agrave": 'À', "Ccedilla": 'Ç', "Ntilde": 'Ñ', "oslash": 'ø', "Oslash": 'Ø',
+	"ae": 'æ', "AE": 'Æ', "oe": 'œ', "OE": 'Œ', "scaron": 'š', "Scaron": 'Š', "zcaron": 'ž',
+	"Zcaron": 'Ž', "ydieresis": 'ÿ', "Ydieresis": 'Ÿ',
+}
+
+// glyphNameToRune resolves a glyph name following the Adobe glyph list conventions
+// for the common names, uniXXXX and uXXXX[XX].
+func glyphNameToRune(name string) (rune, bool) {
+	if index := strings.IndexByte(name, '.'); index > 0 {
+		name = name[:index]
+	}
+
+	if len(name) == 1 {
+		return rune(name[0]), true
+	}
+
+	if r, ok := glyphNames[name]; ok {
+		return r, true
+	}
+
+	for _, prefix := range []string{"uni", "u"} {
+		if hex, found := strings.CutPrefix(name, prefix); found && len(hex) >= 4 && len(hex) <= 6 {
+			if value, err := strconv.ParseUint(hex[:4], 16, 32); err == nil && prefix == "uni" {
+				return rune(value), true
+			}
+			if value, err := strconv.ParseUint(hex, 16, 32); err == nil && prefix == "u" {
+				return rune(value), true
+			}
+		}
+	}
+
+	return 0, false
+}
@@ -0,0 +1,126 @@
+package pdf
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Info holds the entries of the document information dictionary.
+type Info struct {
+	Title        string
+	Author       string
+	Subject      string
+	Creator      string
+	Producer     string
+	CreationDate *time.Time
+	ModDate      *time.Time
+}
+
+// Info reads the document information dictionary. Encrypted documents and documents without
+// one return an empty Info, as their strings can not be read.
+func (d *Document) Info() Info {
+	info := Info{}
+	if d.Encrypted() {
+		return info
+	}
+
+	dict, ok := d.Resolve(d.trailer["Info"]).(Dict)
+	if !ok {
+		return info
+	}
+
+	text := func(key Name) string {
+		value, _ := d.Resolve(dict[key]).(String)
+		return strings.TrimSpace(DecodeText(value))
+	}
+
+	info.Title = text("Title")
+	info.Author = text("Author")
+	info.Subject = text("Subject")
+	info.Creator = text("Creator")
+	info.Producer = text("Producer")
+	info.CreationDate = ParseDate(text("CreationDate"))
+	info.ModDate = ParseDate(text("ModDate"))
+
+	return info
+}
+
+// pdfDocEncoding lists the code points of PDFDocEncoding that differ from Latin-1.
+var pdfDocEncoding = map[byte]rune{
+	0x18: '˘', 0x19: 'ˇ', 0x1A: 'ˆ', 0x1B: '˙', 0x1C: '˝', 0x1D: '˛', 0x1E: '˚', 0x1F: '˜',
+	0x80: '•', 0x81: '†', 0x82: '‡', 0x83: '…', 0x84: '—', 0x85: '–', 0x86: 'ƒ', 0x87: '⁄',
+	0x88: '‹', 0x89: '›', 0x8A: '−', 0x8B: '‰', 0x8C: '„', 0x8D: '“', 0x8E: '”', 0x8F: '‘',
+	0x90: '’', 0x91: '‚', 0x92: '™', 0x93: 'ﬁ', 0x94: 'ﬂ', 0x95: 'Ł', 0x96: 'Œ', 0x97: 'Š',
+	0x98: 'Ÿ', 0x99: 'Ž', 0x9A: 'ı', 0x9B: 'ł', 0x9C: 'œ', 0x9D: 'š', 0x9E: 'ž', 0xA0: '€',
+}
+
+// DecodeText decodes a pdf text string, which is UTF-16BE or UTF-8 when it starts with a
+// byte order mark and PDFDocEncoding otherwise.
+func DecodeText(value String) string {
+	switch {
+	case len(value) >= 2 && value[0] == 0xFE && value[1] == 0xFF:
+		units := make([]uint16, 0, len(value)/2)
+		for i := 2; i+1 < len(value); i += 2 {
+			units = append(units, uint16(value[i])<<8|uint16(value[i+1]))
+		}
+		return string(utf16.Decode(units))
+	case len(value) >= 3 && value[0] == 0xEF && value[1] == 0xBB && value[2] == 0xBF:
+		return strings.ToValidUTF8(string(value[3:]), "�")
+	}
+
+	var builder strings.Builder
+	for _, b := range value {
+		if r, ok := pdfDocEncoding[b]; ok {
+			builder.WriteRune(r)
+			continue
+		}
+		if b >= 0x80 && b < 0xA0 {
+			builder.WriteRune(utf8.RuneError)
+			continue
+		}
+		builder.WriteRune(rune(b))
+	}
+
+	return builder.String()
+}
+
+var datePattern = regexp.MustCompile(`^(?:D:)?(\d{4})(\d{2})?(\d{2})?(\d{2})?(\d{2})?(\d{2})?(?:([Zz+\-])(?:(\d{2})'?(\d{2})?'?)?)?`)
+
+// ParseDate parses a pdf date of the form D:YYYYMMDDHHmmSSOHH'mm', where everything after the
+// year is optional. Dates without a time zone are read as UTC. Returns nil if value is no date.
+func ParseDate(value string) *time.Time {
+	match := datePattern.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil {
+		return nil
+	}
+
+	number := func(index, fallback int) int {
+		if match[index] == "" {
+			return fallback
+		}
+		value, _ := strconv.Atoi(match[index])
+		return value
+	}
+
+	month, day := number(2, 1), number(3, 1)
+	hour, minute, second := number(4, 0), number(5, 0), number(6, 0)
+	if month < 1 || month > 12 || day < 1 || day > 31 || hour > 23 || minute > 59 || second > 59 {
+		return nil
+	}
+
+	location := time.UTC
+	if sign := match[7]; sign == "+" || sign == "-" {
+		offset := number(8, 0)*3600 + number(9, 0)*60
+		if sign == "-" {
+			offset = -offset
+		}
+		location = time.FixedZone("", offset)
+	}
+
+	date := time.Date(number(1, 0), time.Month(month), day, hour, minute, second, 0, location)
+	return &date
+}
@@ -0,0 +1,359 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+var ErrMalformed = errors.New("malformed pdf")
+
+// Object is any pdf object: nil, bool, int64, float64, String, Name, Array, Dict, Ref or *Stream.
+type Object any
+
+// Name is a pdf name object without its leading slash.
+type Name string
+
+// String holds the raw bytes of a literal or hexadecimal pdf string.
+type String []byte
+
+type Array []Object
+
+type Dict map[Name]Object
+
+// Ref is an indirect reference to the object with the given number and generation.
+type Ref struct {
+	Num int
+	Gen int
+}
+
+// Stream is a stream object. Data holds the encoded bytes, use Document.StreamData to decode them.
+type Stream struct {
+	Dict Dict
+	Data []byte
+}
+
+// keyword is a bare token such as obj, endobj, stream or R, which is only meaningful to the parser.
+type keyword string
+
+type lexer struct {
+	data []byte
+	pos  int
+}
+
+func isWhitespace(b byte) bool {
+	switch b {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	}
+	return false
+}
+
+func isDelimiter(b byte) bool {
+	switch b {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+func (l *lexer) skipWhitespace() {
+	for l.pos < len(l.data) {
+		b := l.data[l.pos]
+		switch {
+		case isWhitespace(b):
+			l.pos++
+		case b == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// token reads the next token, which is a complete object for everything except arrays,
+// dictionaries and indirect references. Those are returned as the keywords "[", "<<" and so on.
+func (l *lexer) token() (Object, error) {
+	l.skipWhitespace()
+	if l.pos >= len(l.data) {
+		return nil, fmt.Errorf("%w: unexpected end of data", ErrMalformed)
+	}
+
+	b := l.data[l.pos]
+	switch {
+	case b == '/':
+		l.pos++
+		return l.name(), nil
+	case b == '(':
+		l.pos++
+		return l.literalString()
+	case b == '<':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '<' {
+			l.pos += 2
+			return keyword("<<"), nil
+		}
+		l.pos++
+		return l.hexString()
+	case b == '>':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '>' {
+			l.pos += 2
+			return keyword(">>"), nil
+		}
+		return nil, fmt.Errorf("%w: unexpected '>' at offset %d", ErrMalformed, l.pos)
+	case b == '[' || b == ']' || b == '{' || b == '}':
+		l.pos++
+		return keyword(string(b)), nil
+	case b == ')':
+		return nil, fmt.Errorf("%w: unexpected ')' at offset %d", ErrMalformed, l.pos)
+	}
+
+	start := l.pos
+	for l.pos < len(l.data) && !isWhitespace(l.data[l.pos]) && !isDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	word := l.data[start:l.pos]
+
+	switch string(word) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+
+	if number, ok := parseNumber(word); ok {
+		return number, nil
+	}
+
+	return keyword(word), nil
+}
+
+func parseNumber(word []byte) (Object, bool) {
+	if len(word) == 0 {
+		return nil, false
+	}
+
+	for _, b := range word {
+		if (b < '0' || b > '9') && b != '+' && b != '-' && b != '.' {
+			return nil, false
+		}
+	}
+
+	if !bytes.ContainsRune(word, '.') {
+		if value, err := strconv.ParseInt(string(word), 10, 64); err == nil {
+			return value, true
+		}
+	}
+
+	value, err := strconv.ParseFloat(string(word), 64)
+	if err != nil {
+		return nil, false
+	}
+
+	return value, true
+}
+
+func (l *lexer) name() Name {
+	var name []byte
+	for l.pos < len(l.data) && !isWhitespace(l.data[l.pos]) && !isDelimiter(l.data[l.pos]) {
+		b := l.data[l.pos]
+		if b == '#' && l.pos+2 < len(l.data) {
+			if value, err := strconv.ParseUint(string(l.data[l.pos+1:l.pos+3]), 16, 8); err == nil {
+				name = append(name, byte(value))
+				l.pos += 3
+				continue
+			}
+		}
+		name = append(name, b)
+		l.pos++
+	}
+
+	return Name(name)
+}
+
+func (l *lexer) literalString() (String, error) {
+	var value []byte
+	depth := 0
+	for l.pos < len(l.data) {
+		b := l.data[l.pos]
+		l.pos++
+
+		switch b {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return value, nil
+			}
+			depth--
+		case '\r':
+			// An unescaped end of line is always read as a single line feed.
+			if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+				l.pos++
+			}
+			b = '\n'
+		case '\\':
+			if l.pos >= len(l.data) {
+				break
+			}
+
+			escaped := l.data[l.pos]
+			l.pos++
+			switch escaped {
+			case 'n':
+				b = '\n'
+			case 'r':
+				b = '\r'
+			case 't':
+				b = '\t'
+			case 'b':
+				b = '\b'
+			case 'f':
+				b = '\f'
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if escaped >= '0' && escaped <= '7' {
+					octal := int(escaped - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						octal = octal*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					b = byte(octal)
+				} else {
+					b = escaped
+				}
+			}
+		}
+
+		value = append(value, b)
+	}
+
+	return nil, fmt.Errorf("%w: unterminated string", ErrMalformed)
+}
+
+func (l *lexer) hexString() (String, error) {
+	var value []byte
+	var high byte
+	odd := false
+	for l.pos < len(l.data) {
+		b := l.data[l.pos]
+		l.pos++
+
+		var digit byte
+		switch {
+		case b == '>':
+			if odd {
+				value = append(value, high<<4)
+			}
+			return value, nil
+		case isWhitespace(b):
+			continue
+		case b >= '0' && b <= '9':
+			digit = b - '0'
+		case b >= 'a' && b <= 'f':
+			digit = b - 'a' + 10
+		case b >= 'A' && b <= 'F':
+			digit = b - 'A' + 10
+		default:
+			return nil, fmt.Errorf("%w: invalid hex string", ErrMalformed)
+		}
+
+		if odd {
+			value = append(value, high<<4|digit)
+		} else {
+			high = digit
+		}
+		odd = !odd
+	}
+
+	return nil, fmt.Errorf("%w: unterminated hex string", ErrMalformed)
+}
+
+// object reads a complete object, combining "n g R" into a Ref. Streams are not handled here
+// as their length may depend on other objects, see Document.readIndirect.
+func (l *lexer) object() (Object, error) {
+	return l.objectDepth(0)
+}
+
+const maxNesting = 256
+
+func (l *lexer) objectDepth(depth int) (Object, error) {
+	if depth > maxNesting {
+		return nil, fmt.Errorf("%w: objects nested too deeply", ErrMalformed)
+	}
+
+	token, err := l.token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token {
+	case keyword("["):
+		array := make(Array, 0)
+		for {
+			l.skipWhitespace()
+			if l.pos < len(l.data) && l.data[l.pos] == ']' {
+				l.pos++
+				return array, nil
+			}
+
+			element, err := l.objectDepth(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, element)
+		}
+	case keyword("<<"):
+		dict := make(Dict)
+		for {
+			token, err := l.token()
+			if err != nil {
+				return nil, err
+			}
+
+			if token == keyword(">>") {
+				return dict, nil
+			}
+
+			key, ok := token.(Name)
+			if !ok {
+				return nil, fmt.Errorf("%w: expected a name as dictionary key but found %v", ErrMalformed, token)
+			}
+
+			value, err := l.objectDepth(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			dict[key] = value
+		}
+	}
+
+	if num, ok := token.(int64); ok {
+		// Look ahead for "gen R" without consuming anything if it is not there.
+		saved := l.pos
+		if gen, err := l.token(); err == nil {
+			if genNum, ok := gen.(int64); ok {
+				if r, err := l.token(); err == nil && r == keyword("R") {
+					return Ref{Num: int(num), Gen: int(genNum)}, nil
+				}
+			}
+		}
+		l.pos = saved
+	}
+
+	if word, ok := token.(keyword); ok {
+		return nil, fmt.Errorf("%w: unexpected %q at offset %d", ErrMalformed, string(word), l.pos)
+	}
+
+	return token, nil
+}
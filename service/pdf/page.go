@@ -0,0 +1,148 @@
+package pdf
+
+import (
+	"fmt"
+	"pdf_service_api/models"
+	"strconv"
+)
+
+// maxPageTreeDepth bounds the depth of the page tree, real documents rarely exceed ten levels.
+const maxPageTreeDepth = 64
+
+// Page is a leaf of the page tree with its inheritable attributes already applied.
+type Page struct {
+	Number    uint32
+	Dict      Dict
+	Resources Dict
+	MediaBox  *models.Box
+	CropBox   *models.Box
+	// Rotate is the clockwise display rotation, normalized to 0, 90, 180 or 270.
+	Rotate   int
+	UserUnit float32
+}
+
+// Geometry converts the page into the representation stored with the meta data of a document.
+func (p Page) Geometry() models.PageGeometry {
+	rotation := p.Rotate
+	userUnit := p.UserUnit
+
+	return models.PageGeometry{
+		PageNumber: p.Number,
+		PageKey:    strconv.FormatUint(uint64(p.Number), 10),
+		MediaBox:   p.MediaBox,
+		CropBox:    p.CropBox,
+		Rotation:   &rotation,
+		UserUnit:   &userUnit,
+	}
+}
+
+// inherited holds the page attributes that pages take over from their ancestors.
+type inherited struct {
+	resources Dict
+	mediaBox  *models.Box
+	cropBox   *models.Box
+	rotate    int
+}
+
+// Pages walks the page tree in document order.
+func (d *Document) Pages() ([]Page, error) {
+	catalog, ok := d.Resolve(d.trailer["Root"]).(Dict)
+	if !ok {
+		return nil, fmt.Errorf("%w: document catalog is missing", ErrMalformed)
+	}
+
+	root, ok := d.Resolve(catalog["Pages"]).(Dict)
+	if !ok {
+		return nil, fmt.Errorf("%w: page tree is missing", ErrMalformed)
+	}
+
+	pages := make([]Page, 0)
+	visited := make(map[int]bool)
+	if ref, ok := catalog["Pages"].(Ref); ok {
+		visited[ref.Num] = true
+	}
+	if err := d.walkPages(root, inherited{}, 0, visited, &pages); err != nil {
+		return nil, err
+	}
+
+	return pages, nil
+}
+
+func (d *Document) walkPages(node Dict, attributes inherited, depth int, visited map[int]bool, pages *[]Page) error {
+	if depth > maxPageTreeDepth {
+		return fmt.Errorf("%w: page tree nested too deeply", ErrMalformed)
+	}
+
+	if resources, ok := d.Resolve(node["Resources"]).(Dict); ok {
+		attributes.resources = resources
+	}
+	if box := d.box(node["MediaBox"]); box != nil {
+		attributes.mediaBox = box
+	}
+	if box := d.box(node["CropBox"]); box != nil {
+		attributes.cropBox = box
+	}
+	if rotate, ok := d.Resolve(node["Rotate"]).(int64); ok {
+		if normalized, ok := models.NormalizeRotation(int(rotate)); ok {
+			attributes.rotate = normalized
+		}
+	}
+
+	kids, isTree := d.Resolve(node["Kids"]).(Array)
+	if node["Type"] == Name("Page") || !isTree {
+		userUnit := float32(1)
+		if value, ok := floatValue(d.Resolve(node["UserUnit"])); ok && value > 0 {
+			userUnit = float32(value)
+		}
+
+		*pages = append(*pages, Page{
+			Number:    uint32(len(*pages)),
+			Dict:      node,
+			Resources: attributes.resources,
+			MediaBox:  attributes.mediaBox,
+			CropBox:   attributes.cropBox,
+			Rotate:    attributes.rotate,
+			UserUnit:  userUnit,
+		})
+		return nil
+	}
+
+	for _, kid := range kids {
+		// Every node may only be visited once, otherwise the tree contains a cycle.
+		if ref, ok := kid.(Ref); ok {
+			if visited[ref.Num] {
+				return fmt.Errorf("%w: page tree contains a cycle", ErrMalformed)
+			}
+			visited[ref.Num] = true
+		}
+
+		child, ok := d.Resolve(kid).(Dict)
+		if !ok {
+			continue
+		}
+
+		if err := d.walkPages(child, attributes, depth+1, visited, pages); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *Document) box(object Object) *models.Box {
+	array, ok := d.Resolve(object).(Array)
+	if !ok || len(array) != 4 {
+		return nil
+	}
+
+	box := models.Box{}
+	for i, element := range array {
+		value, ok := floatValue(d.Resolve(element))
+		if !ok {
+			return nil
+		}
+		box[i] = float32(value)
+	}
+
+	return &box
+}
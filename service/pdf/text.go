@@ -0,0 +1,421 @@
+package pdf
+
+import (
+	"bytes"
+	"math"
+	"pdf_service_api/models"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxFormDepth bounds the nesting of form xobjects drawn by other form xobjects.
+const maxFormDepth = 8
+
+// matrix is an affine transformation [a b c d e f] as used throughout pdf.
+type matrix [6]float64
+
+var identity = matrix{1, 0, 0, 1, 0, 0}
+
+// multiply returns m × n, that is m applied first and n second.
+func (m matrix) multiply(n matrix) matrix {
+	return matrix{
+		m[0]*n[0] + m[1]*n[2],
+		m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2],
+		m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4],
+		m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+func (m matrix) apply(x, y float64) (float64, float64) {
+	return m[0]*x + m[2]*y + m[4], m[1]*x + m[3]*y + m[5]
+}
+
+// placedGlyph is a glyph with its position in user space.
+type placedGlyph struct {
+	text         string
+	x, y         float64
+	endX         float64
+	centerX      float64
+	centerY      float64
+	size         float64
+	isWhitespace bool
+}
+
+type textState struct {
+	font        *font
+	size        float64
+	charSpacing float64
+	wordSpacing float64
+	scale       float64
+	leading     float64
+	rise        float64
+}
+
+type graphicsState struct {
+	ctm  matrix
+	text textState
+}
+
+// textExtractor interprets content streams and collects every shown glyph.
+type textExtractor struct {
+	document *Document
+	fonts    map[string]*font
+	glyphs   []placedGlyph
+}
+
+// TextInRegion returns the text shown on the page whose glyphs have their center inside the
+// region, which is given in pdf user space. Lines are separated by line feeds.
+func (d *Document) TextInRegion(page Page, region models.Coordinates) (string, error) {
+	data, err := d.pageContents(page)
+	if err != nil {
+		return "", err
+	}
+
+	extractor := &textExtractor{document: d, fonts: make(map[string]*font)}
+	extractor.run(data, page.Resources, identity, 0)
+
+	minX, maxX := math.Min(region.X1, region.X2), math.Max(region.X1, region.X2)
+	minY, maxY := math.Min(region.Y1, region.Y2), math.Max(region.Y1, region.Y2)
+
+	inside := make([]placedGlyph, 0)
+	for _, g := range extractor.glyphs {
+		if g.centerX >= minX && g.centerX <= maxX && g.centerY >= minY && g.centerY <= maxY {
+			inside = append(inside, g)
+		}
+	}
+
+	return layoutText(inside), nil
+}
+
+func (d *Document) pageContents(page Page) ([]byte, error) {
+	var streams []*Stream
+	switch contents := d.Resolve(page.Dict["Contents"]).(type) {
+	case *Stream:
+		streams = append(streams, contents)
+	case Array:
+		for _, element := range contents {
+			if stream, ok := d.Resolve(element).(*Stream); ok {
+				streams = append(streams, stream)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	for _, stream := range streams {
+		data, err := d.StreamData(stream)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (e *textExtractor) run(data []byte, resources Dict, ctm matrix, depth int) {
+	state := graphicsState{ctm: ctm, text: textState{scale: 1}}
+	stack := make([]graphicsState, 0)
+	var textMatrix, lineMatrix matrix
+
+	l := lexer{data: data}
+	operands := make([]Object, 0)
+	for {
+		token, err := l.token()
+		if err != nil {
+			return
+		}
+
+		op, isOperator := token.(keyword)
+		if !isOperator {
+			operands = append(operands, token)
+			continue
+		}
+
+		switch op {
+		case "[":
+			if array, err := l.arrayRest(); err == nil {
+				operands = append(operands, array)
+			}
+			continue
+		case "<<":
+			// Dictionaries only appear as operands of marked content, parse and keep them.
+			l.pos -= 2
+			if dict, err := l.object(); err == nil {
+				operands = append(operands, dict)
+			}
+			continue
+		case "BI":
+			skipInlineImage(&l)
+		case "q":
+			stack = append(stack, state)
+		case "Q":
+			if len(stack) > 0 {
+				state = stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+			}
+		case "cm":
+			if m, ok := matrixOperands(operands); ok {
+				state.ctm = m.multiply(state.ctm)
+			}
+		case "BT":
+			textMatrix, lineMatrix = identity, identity
+		case "Tf":
+			if len(operands) == 2 {
+				name, _ := operands[0].(Name)
+				state.text.font = e.font(resources, string(name))
+				state.text.size, _ = floatValue(operands[1])
+			}
+		case "Tc":
+			state.text.charSpacing = numberOperand(operands, 0)
+		case "Tw":
+			state.text.wordSpacing = numberOperand(operands, 0)
+		case "Tz":
+			state.text.scale = numberOperand(operands, 0) / 100
+		case "TL":
+			state.text.leading = numberOperand(operands, 0)
+		case "Ts":
+			state.text.rise = numberOperand(operands, 0)
+		case "Td", "TD":
+			if len(operands) == 2 {
+				tx, ty := numberOperand(operands, 0), numberOperand(operands, 1)
+				if op == "TD" {
+					state.text.leading = -ty
+				}
+				lineMatrix = matrix{1, 0, 0, 1, tx, ty}.multiply(lineMatrix)
+				textMatrix = lineMatrix
+			}
+		case "Tm":
+			if m, ok := matrixOperands(operands); ok {
+				textMatrix, lineMatrix = m, m
+			}
+		case "T*":
+			lineMatrix = matrix{1, 0, 0, 1, 0, -state.text.leading}.multiply(lineMatrix)
+			textMatrix = lineMatrix
+		case "Tj", "'", "\"":
+			if op == "\"" && len(operands) == 3 {
+				state.text.wordSpacing = numberOperand(operands, 0)
+				state.text.charSpacing = numberOperand(operands, 1)
+				operands = operands[2:]
+			}
+			if op != "Tj" {
+				lineMatrix = matrix{1, 0, 0, 1, 0, -state.text.leading}.multiply(lineMatrix)
+				textMatrix = lineMatrix
+			}
+			if len(operands) == 1 {
+				if value, ok := operands[0].(String); ok {
+					textMatrix = e.show(value, state, textMatrix)
+				}
+			}
+		case "TJ":
+			if len(operands) == 1 {
+				array, _ := operands[0].(Array)
+				for _, element := range array {
+					switch value := element.(type) {
+					case String:
+						textMatrix = e.show(value, state, textMatrix)
+					case int64, float64:
+						adjustment, _ := floatValue(value)
+						tx := -adjustment / 1000 * state.text.size * state.text.scale
+						textMatrix = matrix{1, 0, 0, 1, tx, 0}.multiply(textMatrix)
+					}
+				}
+			}
+		case "Do":
+			if len(operands) == 1 && depth < maxFormDepth {
+				name, _ := operands[0].(Name)
+				e.drawForm(resources, string(name), state.ctm, depth)
+			}
+		}
+
+		operands = operands[:0]
+	}
+}
+
+// show places the glyphs of a string and returns the text matrix after it.
+func (e *textExtractor) show(value String, state graphicsState, textMatrix matrix) matrix {
+	text := state.text
+	if text.font == nil {
+		return textMatrix
+	}
+
+	for _, g := range text.font.decode(value) {
+		// The text rendering matrix maps glyph space, scaled by the font size, into user space.
+		rendering := matrix{text.size * text.scale, 0, 0, text.size, 0, text.rise}.multiply(textMatrix).multiply(state.ctm)
+
+		width := g.width / 1000
+		x, y := rendering.apply(0, 0)
+		endX, _ := rendering.apply(width, 0)
+		centerX, centerY := rendering.apply(width/2, 0.3)
+		_, top := rendering.apply(0, 1)
+
+		e.glyphs = append(e.glyphs, placedGlyph{
+			text:         g.text,
+			x:            x,
+			y:            y,
+			endX:         endX,
+			centerX:      centerX,
+			centerY:      centerY,
+			size:         math.Abs(top - y),
+			isWhitespace: strings.TrimSpace(g.text) == "",
+		})
+
+		advance := width*text.size + text.charSpacing
+		if g.isSpace {
+			advance += text.wordSpacing
+		}
+		textMatrix = matrix{1, 0, 0, 1, advance * text.scale, 0}.multiply(textMatrix)
+	}
+
+	return textMatrix
+}
+
+func (e *textExtractor) font(resources Dict, name string) *font {
+	fonts, _ := e.document.Resolve(resources["Font"]).(Dict)
+	object := fonts[Name(name)]
+
+	// Fonts are cached by their object number, as the same name may differ between forms.
+	key := name
+	if ref, ok := object.(Ref); ok {
+		key = "ref:" + strconv.Itoa(ref.Num)
+	}
+	if f, ok := e.fonts[key]; ok {
+		return f
+	}
+
+	dict, ok := e.document.Resolve(object).(Dict)
+	if !ok {
+		return nil
+	}
+
+	f := e.document.loadFont(dict)
+	e.fonts[key] = f
+	return f
+}
+
+func (e *textExtractor) drawForm(resources Dict, name string, ctm matrix, depth int) {
+	xObjects, _ := e.document.Resolve(resources["XObject"]).(Dict)
+	form, ok := e.document.Resolve(xObjects[Name(name)]).(*Stream)
+	if !ok || form.Dict["Subtype"] != Name("Form") {
+		return
+	}
+
+	data, err := e.document.StreamData(form)
+	if err != nil {
+		return
+	}
+
+	if array, ok := e.document.Resolve(form.Dict["Matrix"]).(Array); ok {
+		if m, ok := matrixOperands([]Object(array)); ok {
+			ctm = m.multiply(ctm)
+		}
+	}
+
+	formResources := resources
+	if own, ok := e.document.Resolve(form.Dict["Resources"]).(Dict); ok {
+		formResources = own
+	}
+
+	e.run(data, formResources, ctm, depth+1)
+}
+
+// skipInlineImage moves past the data of an inline image, which is not tokenizable.
+func skipInlineImage(l *lexer) {
+	index := bytes.Index(l.data[l.pos:], []byte("ID"))
+	if index < 0 {
+		l.pos = len(l.data)
+		return
+	}
+	l.pos += index + 2
+
+	for l.pos < len(l.data) {
+		index := bytes.Index(l.data[l.pos:], []byte("EI"))
+		if index < 0 {
+			l.pos = len(l.data)
+			return
+		}
+
+		end := l.pos + index
+		l.pos = end + 2
+		if end > 0 && isWhitespace(l.data[end-1]) && (l.pos >= len(l.data) || isWhitespace(l.data[l.pos])) {
+			return
+		}
+	}
+}
+
+func numberOperand(operands []Object, index int) float64 {
+	if index >= len(operands) {
+		return 0
+	}
+	value, _ := floatValue(operands[index])
+	return value
+}
+
+func matrixOperands(operands []Object) (matrix, bool) {
+	if len(operands) != 6 {
+		return matrix{}, false
+	}
+
+	m := matrix{}
+	for i, operand := range operands {
+		value, ok := floatValue(operand)
+		if !ok {
+			return matrix{}, false
+		}
+		m[i] = value
+	}
+
+	return m, true
+}
+
+// layoutText orders glyphs into lines from top to bottom and left to right, inserting spaces
+// where the gap between two glyphs is wider than a fraction of the font size.
+func layoutText(glyphs []placedGlyph) string {
+	if len(glyphs) == 0 {
+		return ""
+	}
+
+	sort.SliceStable(glyphs, func(i, j int) bool {
+		return glyphs[i].y > glyphs[j].y
+	})
+
+	lines := make([][]placedGlyph, 0)
+	for _, g := range glyphs {
+		last := len(lines) - 1
+		if last >= 0 {
+			reference := lines[last][0]
+			if math.Abs(reference.y-g.y) <= math.Max(reference.size, g.size)/2 {
+				lines[last] = append(lines[last], g)
+				continue
+			}
+		}
+		lines = append(lines, []placedGlyph{g})
+	}
+
+	text := make([]string, 0, len(lines))
+	for _, line := range lines {
+		sort.SliceStable(line, func(i, j int) bool {
+			return line[i].x < line[j].x
+		})
+
+		var builder strings.Builder
+		for i, g := range line {
+			if i > 0 {
+				previous := line[i-1]
+				if !previous.isWhitespace && !g.isWhitespace && g.x-previous.endX > math.Max(previous.size, g.size)*0.2 {
+					builder.WriteByte(' ')
+				}
+			}
+			builder.WriteString(g.text)
+		}
+
+		if value := strings.Join(strings.Fields(builder.String()), " "); value != "" {
+			text = append(text, value)
+		}
+	}
+
+	return strings.Join(text, "\n")
+}
@@ -0,0 +1,66 @@
+package pdf_test
+
+import (
+	"fmt"
+	"pdf_service_api/models"
+	"pdf_service_api/service/pdf"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func streamObject(dict, data string) string {
+	return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+func TestTextInRegion(t *testing.T) {
+	content := "BT /F1 12 Tf 72 700 Td (Hello World) Tj 0 -20 Td [(Sec) 20 (ond) -400 (line)] TJ ET\n" +
+		"BT /F1 12 Tf 300 700 Td (Outside) Tj ET\n" +
+		"q 1 0 0 1 72 500 cm BT /F2 10 Tf 0 0 Td <0102> Tj ET Q"
+	toUnicode := "/CIDInit /ProcSet findresource begin 12 dict begin begincmap\n" +
+		"1 begincodespacerange <00> <FF> endcodespacerange\n" +
+		"1 beginbfchar <01> <0048> endbfchar\n" +
+		"1 beginbfrange <02> <02> <0069> endbfrange\n" +
+		"endcmap CMapName currentdict /CMap defineresource pop end end"
+
+	data := buildPdf("/Root 1 0 R",
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 /MediaBox [0 0 612 792] >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 4 0 R /Resources << /Font << /F1 5 0 R /F2 6 0 R >> >> >>",
+		streamObject("", content),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Custom /ToUnicode 7 0 R >>",
+		streamObject("", toUnicode),
+	)
+
+	document, err := pdf.Open(data)
+	require.NoError(t, err)
+
+	pages, err := document.Pages()
+	require.NoError(t, err)
+
+	text, err := document.TextInRegion(pages[0], models.Coordinates{X1: 60, Y1: 720, X2: 250, Y2: 660})
+	require.NoError(t, err)
+	assert.Equal(t, "Hello World\nSecond line", text)
+
+	text, err = document.TextInRegion(pages[0], models.Coordinates{X1: 60, Y1: 490, X2: 200, Y2: 520})
+	require.NoError(t, err)
+	assert.Equal(t, "Hi", text)
+
+	text, err = document.TextInRegion(pages[0], models.Coordinates{X1: 0, Y1: 0, X2: 10, Y2: 10})
+	require.NoError(t, err)
+	assert.Empty(t, text)
+}
+
+func TestTextInRegionOfHundredPages(t *testing.T) {
+	document, err := pdf.OpenBase64(hundredPagesReader())
+	require.NoError(t, err)
+
+	pages, err := document.Pages()
+	require.NoError(t, err)
+
+	text, err := document.TextInRegion(pages[0], models.Coordinates{X1: 0, Y1: 0, X2: 612, Y2: 792})
+	require.NoError(t, err)
+	assert.NotEmpty(t, text)
+}
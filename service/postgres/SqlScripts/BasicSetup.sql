@@ -36,3 +36,227 @@ create table if not exists selection_table
     "Coordinates" json,
     "Page_Key"          text
 );
+
+alter table document_table
+    add column if not exists "Meta_Status" text;
+
+-- Links documents produced from another document, such as redacted copies, to the original.
+alter table document_table
+    add column if not exists "Derived_From_UUID" uuid
+        constraint document_table_derived_from_fk
+            references document_table
+            on delete set null;
+
+alter table selection_table
+    add column if not exists "Extracted_Text"    text,
+    add column if not exists "Text_Extracted_At" timestamp with time zone;
+
+alter table selection_table
+    add column if not exists "Type"        text,
+    add column if not exists "Label"       text,
+    add column if not exists "Note"        text,
+    add column if not exists "Color"       text,
+    add column if not exists "Author_UUID" uuid,
+    add column if not exists "Created_At"  timestamp with time zone,
+    add column if not exists "Updated_At"  timestamp with time zone;
+
+create index if not exists selection_table_document_type_index
+    on selection_table ("Document_UUID", "Type");
+
+-- Grants users other than the owner access to the selections of a document.
+create table if not exists documentshare_table
+(
+    "Document_UUID" uuid    not null
+        constraint documentshare_table_document_table_fk
+            references document_table
+            on delete cascade,
+    "Grantee_UUID"  uuid    not null,
+    "Can_Write"     boolean not null default false,
+    constraint documentshare_table_pk
+        primary key ("Document_UUID", "Grantee_UUID")
+);
+
+create table if not exists documentpage_table
+(
+    "Document_UUID" uuid    not null
+        constraint documentpage_table_document_table_fk
+            references document_table
+            on delete cascade,
+    "Page_Number"   integer not null,
+    "Page_Key"      text    not null,
+    "Image"         text,
+    "Width"         integer,
+    "Height"        integer,
+    "Mime_Type"     text,
+    constraint documentpage_table_pk
+        primary key ("Document_UUID", "Page_Number")
+);
+
+create unique index if not exists documentpage_table_page_key_uindex
+    on documentpage_table ("Document_UUID", "Page_Key");
+
+alter table documentpage_table
+    add column if not exists "Media_Box" json,
+    add column if not exists "Crop_Box"  json,
+    add column if not exists "Rotation"  integer,
+    add column if not exists "User_Unit" real;
+
+-- Pages of a running extraction, swapped into documentpage_table once the extraction succeeded.
+create table if not exists documentpagestaging_table
+(
+    "Extraction_UUID" uuid                     not null,
+    "Document_UUID"   uuid                     not null
+        constraint documentpagestaging_table_document_table_fk
+            references document_table
+            on delete cascade,
+    "Page_Key"        text                     not null,
+    "Image"           text,
+    "Width"           integer,
+    "Height"          integer,
+    "Mime_Type"       text,
+    "Created_At"      timestamp with time zone not null default now(),
+    constraint documentpagestaging_table_pk
+        primary key ("Extraction_UUID", "Page_Key")
+);
+
+-- Splits the images of documents stored before the page table existed into one row per page,
+-- numbered like renumberPages in meta_repository.go. The images are kept until the migration has
+-- been verified, documents that already have pages are left alone.
+insert into documentpage_table ("Document_UUID", "Page_Number", "Page_Key", "Image")
+select img."Document_UUID",
+       (row_number() over (partition by img."Document_UUID"
+           order by case when img.key ~ '^[0-9]+$' then img.key::numeric end nulls last, img.key) - 1)::integer,
+       img.key,
+       img.value
+from (select mt."Document_UUID", e.key, e.value
+      from documentmeta_table as mt
+               cross join lateral json_each_text(
+                  case when json_typeof(mt."Images") = 'object' then mt."Images" else '{}'::json end) as e
+      where mt."Images" is not null
+        and not exists (select 1
+                        from documentpage_table as pt
+                        where pt."Document_UUID" = mt."Document_UUID")) as img
+on conflict do nothing;
+
+alter table documentmeta_table
+    alter column "Images" set default null;
+
+create table if not exists pagethumbnail_table
+(
+    "Document_UUID" uuid    not null
+        constraint pagethumbnail_table_document_table_fk
+            references document_table
+            on delete cascade,
+    "Page_Key"      text    not null,
+    "Width"         integer not null,
+    "Height"        integer not null,
+    "Fit"           text    not null,
+    "Mime_Type"     text    not null,
+    "Source_ETag"   text    not null,
+    "Data"          bytea   not null,
+    "Time_Created"  timestamp default now(),
+    constraint pagethumbnail_table_pk
+        primary key ("Document_UUID", "Page_Key", "Width", "Height", "Fit", "Mime_Type")
+);
+
+-- Named sets of selections owners apply to documents with the same layout, one row per version.
+create table if not exists selectiontemplate_table
+(
+    "Template_UUID"        uuid                     not null
+        constraint selectiontemplate_table_pk
+            primary key,
+    "Owner_UUID"           uuid                     not null,
+    "Name"                 text                     not null,
+    "Version"              integer                  not null,
+    "Source_Document_UUID" uuid,
+    "Created_At"           timestamp with time zone not null,
+    constraint selectiontemplate_table_name_version_uindex
+        unique ("Owner_UUID", "Name", "Version")
+);
+
+create table if not exists selectiontemplateentry_table
+(
+    "Template_UUID" uuid    not null
+        constraint selectiontemplateentry_table_selectiontemplate_table_fk
+            references selectiontemplate_table
+            on delete cascade,
+    "Position"      integer not null,
+    "Page_Key"      text    not null,
+    "Page_Geometry" json,
+    "Coordinates"   json,
+    "Type"          text,
+    "Label"         text,
+    "Note"          text,
+    "Color"         text,
+    constraint selectiontemplateentry_table_pk
+        primary key ("Template_UUID", "Position")
+);
+
+-- The rectangle of a selection as geometric type, kept in sync with the json coordinates, for
+-- spatial queries backed by a GiST index.
+alter table selection_table
+    add column if not exists "Box" box generated always as (
+        box(point(("Coordinates" ->> 'x1')::double precision, ("Coordinates" ->> 'y1')::double precision),
+            point(("Coordinates" ->> 'x2')::double precision, ("Coordinates" ->> 'y2')::double precision))) stored;
+
+create index if not exists selection_table_box_index
+    on selection_table using gist ("Box");
+
+-- Changes made through the api, kept after the changed resources are deleted.
+create table if not exists audit_table
+(
+    "Audit_UUID"    uuid                     not null
+        constraint audit_table_pk
+            primary key,
+    "Actor_UUID"    uuid,
+    "Owner_UUID"    uuid,
+    "Action"        text                     not null,
+    "Resource_Type" text                     not null,
+    "Resource_UUID" uuid                     not null,
+    "Document_UUID" uuid,
+    "Request_ID"    text,
+    "IP"            text,
+    "Created_At"    timestamp with time zone not null,
+    "Changes"       jsonb
+);
+
+create index if not exists audit_table_owner_index
+    on audit_table ("Owner_UUID", "Created_At");
+
+create index if not exists audit_table_actor_index
+    on audit_table ("Actor_UUID", "Created_At");
+
+-- Counts the changes of a row, entity tags and If-Match preconditions are derived from it.
+alter table document_table
+    add column if not exists "Version" integer not null default 1;
+
+alter table documentmeta_table
+    add column if not exists "Version" integer not null default 1;
+
+alter table selection_table
+    add column if not exists "Version" integer not null default 1;
+
+-- The version of the last meta data of a document, kept when the meta data is deleted so that
+-- meta data added again continues its versions and no entity tag read before is current again.
+alter table document_table
+    add column if not exists "Meta_Version" integer not null default 0;
+
+-- Responses of requests made with an Idempotency-Key header, replayed when the request is retried.
+-- Keys are scoped to the caller and route they were sent by, so clients can not collide. Keys of
+-- requests still unanswered when their lease expires are taken over by the next retry.
+create table if not exists idempotency_table
+(
+    "Scope"            text                     not null,
+    "Key"              text                     not null,
+    "Fingerprint"      text                     not null,
+    "Status"           integer,
+    "Headers"          jsonb,
+    "Body"             bytea,
+    "Created_At"       timestamp with time zone not null,
+    "Lease_Expires_At" timestamp with time zone not null,
+    constraint idempotency_table_pk
+        primary key ("Scope", "Key")
+);
+
+create index if not exists idempotency_table_created_at_index
+    on idempotency_table ("Created_At");
@@ -0,0 +1,157 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"pdf_service_api/models"
+
+	"github.com/google/uuid"
+)
+
+type auditRepository struct {
+	databaseManager DatabaseHandler
+}
+
+func NewAuditRepository(db DatabaseHandler) models.AuditRepository {
+	return auditRepository{databaseManager: db}
+}
+
+// WithLogger returns a copy of the repository that logs its database calls with the logger.
+func (a auditRepository) WithLogger(logger *slog.Logger) models.AuditRepository {
+	a.databaseManager.Logger = logger
+	return a
+}
+
+func (a auditRepository) AddEntries(entries []models.AuditEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	err := a.databaseManager.WithTransaction(func(tx *sql.Tx) error {
+		return insertAuditEntries(tx, entries)
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (a auditRepository) GetEntries(ownerUid uuid.UUID, filter models.AuditFilter) ([]models.AuditEntry, error) {
+	entries := make([]models.AuditEntry, 0)
+	callbackFunction := func(data []models.AuditEntry) {
+		entries = data
+	}
+
+	if err := a.databaseManager.WithConnection(getAuditEntriesFunction(ownerUid, filter, callbackFunction)); err != nil {
+		return entries, err
+	}
+
+	return entries, nil
+}
+
+// insertAuditEntries stores the entries, taking the owner and actor of entries without them from
+// their document.
+func insertAuditEntries(tx *sql.Tx, entries []models.AuditEntry) error {
+	statement, err := tx.Prepare(`INSERT INTO audit_table ("Audit_UUID", "Actor_UUID", "Owner_UUID", "Action", "Resource_Type", "Resource_UUID", "Document_UUID", "Request_ID", "IP", "Created_At", "Changes")
+		values ($1, coalesce($2, (SELECT "Owner_UUID" FROM document_table WHERE "Document_UUID" = $6)), coalesce($3, (SELECT "Owner_UUID" FROM document_table WHERE "Document_UUID" = $6)), $4, $5, $7, $6, $8, $9, $10, $11)`)
+	if err != nil {
+		return err
+	}
+	defer statement.Close()
+
+	for _, entry := range entries {
+		var changes any
+		if len(entry.Changes) > 0 {
+			data, err := json.Marshal(entry.Changes)
+			if err != nil {
+				return err
+			}
+			changes = string(data)
+		}
+
+		if _, err := statement.Exec(entry.Uuid, entry.ActorUUID, entry.OwnerUUID, entry.Action, entry.ResourceType, entry.DocumentUUID,
+			entry.ResourceUUID, entry.RequestID, entry.IP, entry.Timestamp, changes); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func getAuditEntriesFunction(ownerUid uuid.UUID, filter models.AuditFilter, callback func(data []models.AuditEntry)) func(db *sql.DB) error {
+	return func(db *sql.DB) error {
+		sqlStatement, args := auditEntriesQuery(ownerUid, filter)
+		rows, err := db.Query(sqlStatement, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		entries := make([]models.AuditEntry, 0)
+		for rows.Next() {
+			entry := models.AuditEntry{}
+			var changes []byte
+			if err := rows.Scan(&entry.Uuid, &entry.ActorUUID, &entry.OwnerUUID, &entry.Action, &entry.ResourceType, &entry.ResourceUUID,
+				&entry.DocumentUUID, &entry.RequestID, &entry.IP, &entry.Timestamp, &changes); err != nil {
+				return err
+			}
+
+			if changes != nil {
+				if err := json.Unmarshal(changes, &entry.Changes); err != nil {
+					return err
+				}
+			}
+
+			entries = append(entries, entry)
+		}
+
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		callback(entries)
+		return nil
+	}
+}
+
+// auditEntriesQuery builds the query for the entries of the caller matching the filter.
+func auditEntriesQuery(ownerUid uuid.UUID, filter models.AuditFilter) (string, []any) {
+	sqlStatement := `SELECT "Audit_UUID", "Actor_UUID", "Owner_UUID", "Action", "Resource_Type", "Resource_UUID", "Document_UUID", "Request_ID", "IP", "Created_At", "Changes"
+		FROM audit_table WHERE ("Owner_UUID" = $1 OR "Actor_UUID" = $1)`
+	args := []any{ownerUid}
+
+	condition := func(format string, value any) {
+		args = append(args, value)
+		sqlStatement += fmt.Sprintf(" AND "+format, len(args))
+	}
+
+	if filter.From != nil {
+		condition(`"Created_At" >= $%d`, *filter.From)
+	}
+	if filter.To != nil {
+		condition(`"Created_At" < $%d`, *filter.To)
+	}
+	if filter.Action != nil {
+		condition(`"Action" = $%d`, *filter.Action)
+	}
+	if filter.ResourceType != nil {
+		condition(`"Resource_Type" = $%d`, *filter.ResourceType)
+	}
+	if filter.ResourceUUID != nil {
+		condition(`"Resource_UUID" = $%d`, *filter.ResourceUUID)
+	}
+	if filter.DocumentUUID != nil {
+		condition(`"Document_UUID" = $%d`, *filter.DocumentUUID)
+	}
+
+	sqlStatement += ` ORDER BY "Created_At" DESC, "Audit_UUID"`
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		sqlStatement += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	return sqlStatement, args
+}
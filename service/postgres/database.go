@@ -3,11 +3,24 @@ package postgres
 import (
 	"database/sql"
 	_ "embed"
-	"fmt"
+	"errors"
+	"log/slog"
+	"time"
 )
 
 type DatabaseHandler struct {
 	DbConfig ConfigForDatabase
+	// Logger receives the database calls at debug level and recovered panics as errors, the
+	// default logger is used when it is nil.
+	Logger *slog.Logger
+}
+
+func (t *DatabaseHandler) logger() *slog.Logger {
+	if t.Logger == nil {
+		return slog.Default()
+	}
+
+	return t.Logger
 }
 
 type createdCallback func(db *sql.DB) error
@@ -19,10 +32,13 @@ func (t *DatabaseHandler) WithConnection(callback createdCallback) error {
 		return err
 	}
 
+	started := time.Now()
 	err = callback(db)
 	if err != nil {
+		t.logger().Debug("database call failed", "duration", time.Since(started), "error", err)
 		return err
 	}
+	t.logger().Debug("database call finished", "duration", time.Since(started))
 
 	defer func(db *sql.DB) { // Runs once withConnection has finished execution!
 		err := db.Close()
@@ -31,13 +47,36 @@ func (t *DatabaseHandler) WithConnection(callback createdCallback) error {
 		}
 
 		if r := recover(); r != nil {
-			fmt.Printf("Recovered from panic: %v (type: %T)\n", r, r)
+			t.logger().Error("recovered from panic in database call", "panic", r)
 		}
 	}(db)
 
 	return nil
 }
 
+type transactionCallback func(tx *sql.Tx) error
+
+// WithTransaction runs the callback inside a single transaction, which is committed when the
+// callback succeeds and rolled back otherwise.
+func (t *DatabaseHandler) WithTransaction(callback transactionCallback) error {
+	return t.WithConnection(func(db *sql.DB) error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+
+		if err := callback(tx); err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil {
+				return errors.Join(err, rollbackErr)
+			}
+
+			return err
+		}
+
+		return tx.Commit()
+	})
+}
+
 //go:embed SqlScripts/BasicSetup.sql
 var sqlScript string
 
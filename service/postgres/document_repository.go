@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"database/sql"
 	"errors"
+	"fmt"
+	"log/slog"
 	"pdf_service_api/models"
 	"text/template"
 
@@ -18,8 +20,14 @@ func NewDocumentRepository(databaseManager DatabaseHandler) models.DocumentRepos
 	return documentRepository{databaseManager: databaseManager}
 }
 
-func (d documentRepository) DeleteDocumentById(documentUuid, ownerUuid uuid.UUID) error {
-	err := d.databaseManager.WithConnection(deleteDocumentSqlDatabase(documentUuid, ownerUuid))
+// WithLogger returns a copy of the repository that logs its database calls with the logger.
+func (d documentRepository) WithLogger(logger *slog.Logger) models.DocumentRepository {
+	d.databaseManager.Logger = logger
+	return d
+}
+
+func (d documentRepository) DeleteDocumentById(documentUuid, ownerUuid uuid.UUID, ifVersion *int) error {
+	err := d.databaseManager.WithConnection(deleteDocumentSqlDatabase(documentUuid, ownerUuid, ifVersion))
 	if err != nil {
 		return err
 	}
@@ -66,9 +74,38 @@ func (d documentRepository) UploadDocument(document models.Document) error {
 	return nil
 }
 
+func (d documentRepository) SetMetaStatus(documentUuid uuid.UUID, status models.MetaStatus) error {
+	err := d.databaseManager.WithConnection(setMetaStatusFunction(documentUuid, status))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (d documentRepository) GetDocumentShares(documentUuid, ownerUuid uuid.UUID) ([]models.DocumentShare, error) {
+	shares := make([]models.DocumentShare, 0)
+	err := d.databaseManager.WithConnection(getDocumentSharesFunction(documentUuid, ownerUuid, func(data []models.DocumentShare) {
+		shares = data
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	return shares, nil
+}
+
+func (d documentRepository) ShareDocument(documentUuid, ownerUuid uuid.UUID, share models.DocumentShare) error {
+	return d.databaseManager.WithConnection(shareDocumentFunction(documentUuid, ownerUuid, share))
+}
+
+func (d documentRepository) UnshareDocument(documentUuid, ownerUuid, granteeUuid uuid.UUID) error {
+	return d.databaseManager.WithConnection(unshareDocumentFunction(documentUuid, ownerUuid, granteeUuid))
+}
+
 func getDocumentByDocumentUUIDFunction(uid, ownerUid uuid.UUID, excludes map[string]bool, callback func(data models.Document)) func(db *sql.DB) error {
 	return func(db *sql.DB) error {
-		sqlStatement := `SELECT {{if .documentTitle }}{{else}}"Document_Title", {{end}}{{if .pdfBase64 }}{{else}}"Document_Base64", {{end}}{{if .timeCreated }}{{else}}"Time_Created", {{end}}{{if .ownerUUID }}{{else}}"Owner_UUID", {{end}}{{if .ownerType }}{{else}}"Owner_Type",{{end}} "Document_UUID" FROM document_table WHERE "Document_UUID" = $1 and "Owner_UUID" = $2`
+		sqlStatement := `SELECT {{if .documentTitle }}{{else}}"Document_Title", {{end}}{{if .pdfBase64 }}{{else}}"Document_Base64", {{end}}{{if .timeCreated }}{{else}}"Time_Created", {{end}}{{if .ownerUUID }}{{else}}"Owner_UUID", {{end}}{{if .ownerType }}{{else}}"Owner_Type", {{end}}{{if .metaStatus }}{{else}}"Meta_Status", {{end}}{{if .derivedFromUUID }}{{else}}"Derived_From_UUID",{{end}} "Version", "Document_UUID" FROM document_table WHERE "Document_UUID" = $1 and "Owner_UUID" = $2`
 		templ, err := template.New("documentQuery").Parse(sqlStatement)
 		if err != nil {
 			return err
@@ -108,7 +145,15 @@ func getDocumentByDocumentUUIDFunction(uid, ownerUid uuid.UUID, excludes map[str
 		if !excludes["ownerType"] {
 			scanDestinations = append(scanDestinations, &document.OwnerType)
 		}
-		scanDestinations = append(scanDestinations, &document.Uuid)
+
+		if !excludes["metaStatus"] {
+			scanDestinations = append(scanDestinations, &document.MetaStatus)
+		}
+
+		if !excludes["derivedFromUUID"] {
+			scanDestinations = append(scanDestinations, &document.DerivedFromUUID)
+		}
+		scanDestinations = append(scanDestinations, &document.Version, &document.Uuid)
 
 		err = rows.Scan(scanDestinations...)
 		if err != nil {
@@ -122,7 +167,7 @@ func getDocumentByDocumentUUIDFunction(uid, ownerUid uuid.UUID, excludes map[str
 
 func getDocumentByOwnerUUIDFunction(uid uuid.UUID, limit uint32, offset uint32, excludes map[string]bool, callback func(data []models.Document)) func(db *sql.DB) error {
 	return func(db *sql.DB) error {
-		sqlStatement := `SELECT {{if .documentTitle }}{{else}}"Document_Title", {{end}}{{if .pdfBase64 }}{{else}}"Document_Base64", {{end}}{{if .timeCreated }}{{else}}"Time_Created", {{end}}{{if .ownerUUID }}{{else}}"Owner_UUID", {{end}}{{if .ownerType }}{{else}}"Owner_Type",{{end}} "Document_UUID" FROM document_table WHERE "Owner_UUID" = $1 order by "Time_Created" DESC limit $2 offset $3`
+		sqlStatement := `SELECT {{if .documentTitle }}{{else}}"Document_Title", {{end}}{{if .pdfBase64 }}{{else}}"Document_Base64", {{end}}{{if .timeCreated }}{{else}}"Time_Created", {{end}}{{if .ownerUUID }}{{else}}"Owner_UUID", {{end}}{{if .ownerType }}{{else}}"Owner_Type", {{end}}{{if .metaStatus }}{{else}}"Meta_Status", {{end}}{{if .derivedFromUUID }}{{else}}"Derived_From_UUID",{{end}} "Version", "Document_UUID" FROM document_table WHERE "Owner_UUID" = $1 order by "Time_Created" DESC limit $2 offset $3`
 		templ, err := template.New("documentQuery").Parse(sqlStatement)
 		if err != nil {
 			return err
@@ -164,7 +209,15 @@ func getDocumentByOwnerUUIDFunction(uid uuid.UUID, limit uint32, offset uint32,
 			if !excludes["ownerType"] {
 				scanDestinations = append(scanDestinations, &document.OwnerType)
 			}
-			scanDestinations = append(scanDestinations, &document.Uuid)
+
+			if !excludes["metaStatus"] {
+				scanDestinations = append(scanDestinations, &document.MetaStatus)
+			}
+
+			if !excludes["derivedFromUUID"] {
+				scanDestinations = append(scanDestinations, &document.DerivedFromUUID)
+			}
+			scanDestinations = append(scanDestinations, &document.Version, &document.Uuid)
 
 			err = rows.Scan(scanDestinations...)
 			if err != nil {
@@ -181,8 +234,44 @@ func getDocumentByOwnerUUIDFunction(uid uuid.UUID, limit uint32, offset uint32,
 
 func createDocumentFunction(document *models.Document) func(db *sql.DB) error {
 	return func(db *sql.DB) error {
-		sqlStatement := `insert into document_table("Document_UUID", "Document_Title", "Document_Base64", "Owner_UUID", "Owner_Type") values ($1, $2, $3, $4, $5) returning "Document_UUID"`
-		_, err := db.Exec(sqlStatement, document.Uuid, document.DocumentTitle, document.PdfBase64, document.OwnerUUID, document.OwnerType)
+		sqlStatement := `insert into document_table("Document_UUID", "Document_Title", "Document_Base64", "Owner_UUID", "Owner_Type", "Meta_Status", "Derived_From_UUID") values ($1, $2, $3, $4, $5, $6, $7) returning "Document_UUID"`
+		_, err := db.Exec(sqlStatement, document.Uuid, document.DocumentTitle, document.PdfBase64, document.OwnerUUID, document.OwnerType, document.MetaStatus, document.DerivedFromUUID)
+
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}
+}
+
+func deleteDocumentSqlDatabase(documentUuid, ownerUuid uuid.UUID, ifVersion *int) func(db *sql.DB) error {
+	return func(db *sql.DB) error {
+		sqlStatement := `DELETE FROM document_table where "Document_UUID" = $1 and "Owner_UUID" = $2 and ` + versionCondition(`"Version"`, 3)
+		result, err := db.Exec(sqlStatement, documentUuid.String(), ownerUuid.String(), ifVersion)
+
+		if err != nil {
+			return err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		// Without a version deleting a missing document succeeds, as it always did.
+		if affected == 0 && ifVersion != nil {
+			return versionMismatch(db, ifVersion, `SELECT "Version" FROM document_table WHERE "Document_UUID" = $1 and "Owner_UUID" = $2`, documentUuid, ownerUuid)
+		}
+
+		return nil
+	}
+}
+
+func setMetaStatusFunction(documentUuid uuid.UUID, status models.MetaStatus) func(db *sql.DB) error {
+	return func(db *sql.DB) error {
+		sqlStatement := `UPDATE document_table SET "Meta_Status" = $1 WHERE "Document_UUID" = $2`
+		_, err := db.Exec(sqlStatement, status, documentUuid)
 
 		if err != nil {
 			return err
@@ -192,14 +281,92 @@ func createDocumentFunction(document *models.Document) func(db *sql.DB) error {
 	}
 }
 
-func deleteDocumentSqlDatabase(documentUuid, ownerUuid uuid.UUID) func(db *sql.DB) error {
+// checkDocumentOwner returns sql.ErrNoRows unless the document belongs to the owner. Only the
+// owner manages the shares of a document, grantees cannot pass them on.
+func checkDocumentOwner(db queryRower, documentUuid, ownerUuid uuid.UUID) error {
+	var owned bool
+	err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM document_table WHERE "Document_UUID" = $1 AND "Owner_UUID" = $2)`, documentUuid, ownerUuid).Scan(&owned)
+	if err != nil {
+		return err
+	}
+
+	if !owned {
+		return fmt.Errorf("document %s not found: %w", documentUuid, sql.ErrNoRows)
+	}
+
+	return nil
+}
+
+func getDocumentSharesFunction(documentUuid, ownerUuid uuid.UUID, callback func(data []models.DocumentShare)) func(db *sql.DB) error {
 	return func(db *sql.DB) error {
-		sqlStatement := `DELETE FROM document_table where "Document_UUID" = $1 and "Owner_UUID" = $2`
-		_, err := db.Exec(sqlStatement, documentUuid.String(), ownerUuid.String())
+		if err := checkDocumentOwner(db, documentUuid, ownerUuid); err != nil {
+			return err
+		}
 
+		rows, err := db.Query(`SELECT "Grantee_UUID", "Can_Write" FROM documentshare_table WHERE "Document_UUID" = $1 ORDER BY "Grantee_UUID"`, documentUuid)
 		if err != nil {
 			return err
 		}
+		defer rows.Close()
+
+		shares := make([]models.DocumentShare, 0)
+		for rows.Next() {
+			var share models.DocumentShare
+			if err := rows.Scan(&share.GranteeUUID, &share.CanWrite); err != nil {
+				return err
+			}
+			shares = append(shares, share)
+		}
+
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		callback(shares)
+		return nil
+	}
+}
+
+func shareDocumentFunction(documentUuid, ownerUuid uuid.UUID, share models.DocumentShare) func(db *sql.DB) error {
+	return func(db *sql.DB) error {
+		sqlStatement := `INSERT INTO documentshare_table ("Document_UUID", "Grantee_UUID", "Can_Write")
+			SELECT "Document_UUID", $3, $4 FROM document_table WHERE "Document_UUID" = $1 AND "Owner_UUID" = $2
+			ON CONFLICT ("Document_UUID", "Grantee_UUID") DO UPDATE SET "Can_Write" = excluded."Can_Write"`
+		result, err := db.Exec(sqlStatement, documentUuid, ownerUuid, share.GranteeUUID, share.CanWrite)
+		if err != nil {
+			return err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if affected == 0 {
+			return fmt.Errorf("document %s not found: %w", documentUuid, sql.ErrNoRows)
+		}
+
+		return nil
+	}
+}
+
+func unshareDocumentFunction(documentUuid, ownerUuid, granteeUuid uuid.UUID) func(db *sql.DB) error {
+	return func(db *sql.DB) error {
+		sqlStatement := `DELETE FROM documentshare_table AS s WHERE s."Document_UUID" = $1 AND s."Grantee_UUID" = $3
+			AND EXISTS (SELECT 1 FROM document_table AS d WHERE d."Document_UUID" = s."Document_UUID" AND d."Owner_UUID" = $2)`
+		result, err := db.Exec(sqlStatement, documentUuid, ownerUuid, granteeUuid)
+		if err != nil {
+			return err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if affected == 0 {
+			return sql.ErrNoRows
+		}
 
 		return nil
 	}
@@ -0,0 +1,111 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"pdf_service_api/models"
+	"time"
+)
+
+type idempotencyRepository struct {
+	databaseManager DatabaseHandler
+}
+
+func NewIdempotencyRepository(db DatabaseHandler) models.IdempotencyRepository {
+	return idempotencyRepository{databaseManager: db}
+}
+
+// WithLogger returns a copy of the repository that logs its database calls with the logger.
+func (r idempotencyRepository) WithLogger(logger *slog.Logger) models.IdempotencyRepository {
+	r.databaseManager.Logger = logger
+	return r
+}
+
+func (r idempotencyRepository) Reserve(record models.IdempotencyRecord, expiredBefore time.Time) (models.IdempotencyRecord, bool, error) {
+	stored := models.IdempotencyRecord{}
+	reserved := false
+	err := r.databaseManager.WithTransaction(reserveIdempotencyKeyFunction(record, expiredBefore, func(data models.IdempotencyRecord, isReserved bool) {
+		stored, reserved = data, isReserved
+	}))
+	if err != nil {
+		return models.IdempotencyRecord{}, false, err
+	}
+
+	return stored, reserved, nil
+}
+
+func (r idempotencyRepository) Complete(scope, key string, status int, header http.Header, body []byte) error {
+	headers, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+
+	err = r.databaseManager.WithConnection(func(db *sql.DB) error {
+		_, err := db.Exec(`UPDATE idempotency_table SET "Status" = $1, "Headers" = $2, "Body" = $3 WHERE "Scope" = $4 AND "Key" = $5`, status, headers, body, scope, key)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r idempotencyRepository) Release(scope, key string) error {
+	err := r.databaseManager.WithConnection(func(db *sql.DB) error {
+		_, err := db.Exec(`DELETE FROM idempotency_table WHERE "Scope" = $1 AND "Key" = $2`, scope, key)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// reserveIdempotencyKeyFunction discards the expired keys and inserts the record, taking over the
+// key of a request that is still unanswered after its lease expired. A concurrent reservation of
+// the same key waits for the first one to commit and then finds it stored.
+func reserveIdempotencyKeyFunction(record models.IdempotencyRecord, expiredBefore time.Time, callback func(data models.IdempotencyRecord, isReserved bool)) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM idempotency_table WHERE "Created_At" < $1`, expiredBefore); err != nil {
+			return err
+		}
+
+		result, err := tx.Exec(`INSERT INTO idempotency_table ("Scope", "Key", "Fingerprint", "Created_At", "Lease_Expires_At") values ($1, $2, $3, $4, $5)
+			ON CONFLICT ("Scope", "Key") DO UPDATE SET "Fingerprint" = excluded."Fingerprint", "Created_At" = excluded."Created_At", "Lease_Expires_At" = excluded."Lease_Expires_At"
+			WHERE idempotency_table."Status" IS NULL AND idempotency_table."Lease_Expires_At" < excluded."Created_At"`,
+			record.Scope, record.Key, record.Fingerprint, record.CreatedAt, record.LeaseExpiresAt)
+		if err != nil {
+			return err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if affected > 0 {
+			callback(record, true)
+			return nil
+		}
+
+		stored := models.IdempotencyRecord{}
+		var headers []byte
+		row := tx.QueryRow(`SELECT "Scope", "Key", "Fingerprint", "Status", "Headers", "Body", "Created_At", "Lease_Expires_At" FROM idempotency_table WHERE "Scope" = $1 AND "Key" = $2`, record.Scope, record.Key)
+		if err := row.Scan(&stored.Scope, &stored.Key, &stored.Fingerprint, &stored.Status, &headers, &stored.Body, &stored.CreatedAt, &stored.LeaseExpiresAt); err != nil {
+			return err
+		}
+
+		if headers != nil {
+			if err := json.Unmarshal(headers, &stored.Header); err != nil {
+				return err
+			}
+		}
+
+		callback(stored, false)
+		return nil
+	}
+}
@@ -3,7 +3,13 @@ package postgres
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"log/slog"
+	"math"
 	"pdf_service_api/models"
+	"pdf_service_api/service/imaging"
+	"sort"
+	"strconv"
 
 	"github.com/google/uuid"
 )
@@ -16,24 +22,30 @@ func NewMetaRepository(db DatabaseHandler) models.MetaRepository {
 	return metaRepository{DatabaseHandler: db}
 }
 
+// WithLogger returns a copy of the repository that logs its database calls with the logger.
+func (m metaRepository) WithLogger(logger *slog.Logger) models.MetaRepository {
+	m.DatabaseHandler.Logger = logger
+	return m
+}
+
 func (m metaRepository) AddMeta(data models.Meta) error {
-	if err := m.DatabaseHandler.WithConnection(addMetaDataFunction(data)); err != nil {
+	if err := m.DatabaseHandler.WithTransaction(addMetaDataFunction(data)); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (m metaRepository) DeleteMeta(data models.Meta) error {
-	if err := m.DatabaseHandler.WithConnection(removeMetaDataFunction(data)); err != nil {
+func (m metaRepository) DeleteMeta(data models.Meta, ifVersion *int) error {
+	if err := m.DatabaseHandler.WithTransaction(removeMetaDataFunction(data, ifVersion)); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (m metaRepository) UpdateMeta(uid uuid.UUID, data models.Meta) error {
-	if err := m.DatabaseHandler.WithConnection(updateMetaDataFunction(uid, data)); err != nil {
+func (m metaRepository) UpdateMeta(uid uuid.UUID, data models.Meta, ifVersion *int) error {
+	if err := m.DatabaseHandler.WithTransaction(updateMetaDataFunction(uid, data, ifVersion)); err != nil {
 		return err
 	}
 
@@ -68,27 +80,226 @@ func (m metaRepository) GetMetaPagination(documentUid, ownerUid uuid.UUID, offse
 	return *returnedData, nil
 }
 
-func addMetaDataFunction(data models.Meta) func(db *sql.DB) error {
-	return func(db *sql.DB) error {
-		SqlStatement := `INSERT INTO documentmeta_table ("Document_UUID", "Number_Of_Pages", "Height", "Width", "Images") values ($1, $2, $3, $4, $5)`
+func (m metaRepository) AddPages(documentUid uuid.UUID, pages []models.Page) error {
+	if err := m.DatabaseHandler.WithTransaction(func(tx *sql.Tx) error {
+		if err := insertPages(tx, documentUid, pages); err != nil {
+			return err
+		}
 
-		imagesJson, err := json.Marshal(data.Images)
-		if err != nil {
+		if err := renumberPages(tx, documentUid); err != nil {
 			return err
 		}
 
-		if _, err := db.Exec(SqlStatement, data.DocumentUUID, data.NumberOfPages, data.Height, data.Width, imagesJson); err != nil {
+		_, err := tx.Exec(`UPDATE documentmeta_table SET "Version" = "Version" + 1 WHERE "Document_UUID" = $1`, documentUid)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m metaRepository) StoreExtraction(documentUid uuid.UUID, extract func(addPages func(pages []models.Page) error) (models.Meta, error)) error {
+	if err := m.DatabaseHandler.WithConnection(discardAbandonedStagedPagesFunction()); err != nil {
+		return err
+	}
+
+	extractionUid := uuid.New()
+	data, err := extract(func(pages []models.Page) error {
+		return m.DatabaseHandler.WithTransaction(stagePagesFunction(extractionUid, documentUid, pages))
+	})
+	if err == nil {
+		err = m.DatabaseHandler.WithTransaction(storeExtractionFunction(extractionUid, documentUid, data))
+	}
+	if err != nil {
+		if discardErr := m.DatabaseHandler.WithConnection(discardStagedPagesFunction(extractionUid)); discardErr != nil {
+			return errors.Join(err, discardErr)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (m metaRepository) GetPages(documentUid, ownerUid uuid.UUID, first, last uint32) ([]models.Page, error) {
+	pages := make([]models.Page, 0)
+	callbackFunction := func(data []models.Page) {
+		pages = data
+	}
+
+	if err := m.DatabaseHandler.WithConnection(getPagesFunction(documentUid, ownerUid, first, last, callbackFunction)); err != nil {
+		return pages, err
+	}
+
+	return pages, nil
+}
+
+func (m metaRepository) GetPageGeometry(documentUid uuid.UUID) (models.Meta, error) {
+	meta := models.Meta{}
+	callbackFunction := func(data models.Meta) {
+		meta = data
+	}
+
+	if err := m.DatabaseHandler.WithConnection(getPageGeometryFunction(documentUid, callbackFunction)); err != nil {
+		return models.Meta{}, err
+	}
+
+	return meta, nil
+}
+
+func (m metaRepository) GetPageGeometryForOwner(documentUid, ownerUid uuid.UUID) (models.Meta, error) {
+	meta := models.Meta{}
+	callbackFunction := func(data models.Meta) {
+		meta = data
+	}
+
+	if err := m.DatabaseHandler.WithConnection(getPageGeometryForOwnerFunction(documentUid, ownerUid, callbackFunction)); err != nil {
+		return models.Meta{}, err
+	}
+
+	return meta, nil
+}
+
+func (m metaRepository) GetPageByKey(documentUid, ownerUid uuid.UUID, pageKey string) (models.Page, error) {
+	page := models.Page{}
+	callbackFunction := func(data models.Page) {
+		page = data
+	}
+
+	if err := m.DatabaseHandler.WithConnection(getPageByKeyFunction(documentUid, ownerUid, pageKey, callbackFunction)); err != nil {
+		return models.Page{}, err
+	}
+
+	return page, nil
+}
+
+// nextMetaVersion is the version of meta data added for the document in parameter $1, which
+// continues the versions of meta data deleted before.
+const nextMetaVersion = `COALESCE((SELECT "Meta_Version" FROM document_table WHERE "Document_UUID" = $1), 0) + 1`
+
+func addMetaDataFunction(data models.Meta) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		SqlStatement := `INSERT INTO documentmeta_table ("Document_UUID", "Number_Of_Pages", "Height", "Width", "Version") values ($1, $2, $3, $4, ` + nextMetaVersion + `)`
+
+		if _, err := tx.Exec(SqlStatement, data.DocumentUUID, data.NumberOfPages, data.Height, data.Width); err != nil {
+			return err
+		}
+
+		if data.Images != nil {
+			if err := insertPages(tx, data.DocumentUUID, pagesFromImages(data.DocumentUUID, *data.Images)); err != nil {
+				return err
+			}
+
+			if err := renumberPages(tx, data.DocumentUUID); err != nil {
+				return err
+			}
+		}
+
+		return insertPageGeometry(tx, data.DocumentUUID, data.Pages)
+	}
+}
+
+// stagedPagesRetention is how long the staged pages of an extraction are kept, older ones belong
+// to extractions that were abandoned, for example because the process stopped.
+const stagedPagesRetention = `interval '1 day'`
+
+// stagePagesFunction keeps the pages of a running extraction until storeExtractionFunction swaps
+// them in, a page staged again replaces the earlier one with the same key.
+func stagePagesFunction(extractionUid, documentUid uuid.UUID, pages []models.Page) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		sqlStatement := `INSERT INTO documentpagestaging_table ("Extraction_UUID", "Document_UUID", "Page_Key", "Image", "Width", "Height", "Mime_Type") values ($1, $2, $3, $4, $5, $6, $7)
+			ON CONFLICT ("Extraction_UUID", "Page_Key") DO UPDATE SET "Image" = excluded."Image", "Width" = excluded."Width", "Height" = excluded."Height", "Mime_Type" = excluded."Mime_Type"`
+
+		statement, err := tx.Prepare(sqlStatement)
+		if err != nil {
 			return err
 		}
+		defer statement.Close()
+
+		for _, page := range pages {
+			if _, err := statement.Exec(extractionUid, documentUid, page.PageKey, page.Image, page.Width, page.Height, page.MimeType); err != nil {
+				return err
+			}
+		}
 
 		return nil
 	}
 }
 
-func removeMetaDataFunction(data models.Meta) func(db *sql.DB) error {
+func discardStagedPagesFunction(extractionUid uuid.UUID) func(db *sql.DB) error {
+	return func(db *sql.DB) error {
+		_, err := db.Exec(`DELETE FROM documentpagestaging_table WHERE "Extraction_UUID" = $1`, extractionUid)
+		return err
+	}
+}
+
+func discardAbandonedStagedPagesFunction() func(db *sql.DB) error {
 	return func(db *sql.DB) error {
-		SqlStatement := `DELETE FROM documentmeta_table WHERE "Document_UUID" = $1`
-		if _, err := db.Exec(SqlStatement, data.DocumentUUID); err != nil {
+		_, err := db.Exec(`DELETE FROM documentpagestaging_table WHERE "Created_At" < now() - ` + stagedPagesRetention)
+		return err
+	}
+}
+
+// storeExtractionFunction replaces the pages of a document with the pages staged by the
+// extraction, then inserts or overwrites its meta data.
+func storeExtractionFunction(extractionUid, documentUid uuid.UUID, data models.Meta) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM documentpage_table WHERE "Document_UUID" = $1`, documentUid); err != nil {
+			return err
+		}
+
+		// The staged pages are numbered below 0 until all pages are renumbered by key.
+		swapIn := `INSERT INTO documentpage_table ("Document_UUID", "Page_Number", "Page_Key", "Image", "Width", "Height", "Mime_Type")
+			SELECT "Document_UUID", -(ROW_NUMBER() OVER (ORDER BY "Page_Key"))::integer, "Page_Key", "Image", "Width", "Height", "Mime_Type"
+			FROM documentpagestaging_table WHERE "Extraction_UUID" = $1`
+		if _, err := tx.Exec(swapIn, extractionUid); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(`DELETE FROM documentpagestaging_table WHERE "Extraction_UUID" = $1`, extractionUid); err != nil {
+			return err
+		}
+
+		if data.Images != nil {
+			if err := insertPages(tx, documentUid, pagesFromImages(documentUid, *data.Images)); err != nil {
+				return err
+			}
+		}
+
+		if err := renumberPages(tx, documentUid); err != nil {
+			return err
+		}
+
+		// The legacy images are superseded by the pages, so they are not migrated again.
+		sqlStatement := `INSERT INTO documentmeta_table ("Document_UUID", "Number_Of_Pages", "Height", "Width", "Version") values ($1, $2, $3, $4, ` + nextMetaVersion + `)
+			ON CONFLICT ("Document_UUID") DO UPDATE SET "Number_Of_Pages" = excluded."Number_Of_Pages", "Height" = excluded."Height", "Width" = excluded."Width", "Images" = null, "Version" = documentmeta_table."Version" + 1`
+		if _, err := tx.Exec(sqlStatement, documentUid, data.NumberOfPages, data.Height, data.Width); err != nil {
+			return err
+		}
+
+		return insertPageGeometry(tx, documentUid, data.Pages)
+	}
+}
+
+func removeMetaDataFunction(data models.Meta, ifVersion *int) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		SqlStatement := `DELETE FROM documentmeta_table WHERE "Document_UUID" = $1 AND ` + versionCondition(`"Version"`, 2) + ` RETURNING "Version"`
+		var deleted int
+		err := tx.QueryRow(SqlStatement, data.DocumentUUID, ifVersion).Scan(&deleted)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			if ifVersion != nil {
+				return versionMismatch(tx, ifVersion, `SELECT "Version" FROM documentmeta_table WHERE "Document_UUID" = $1`, data.DocumentUUID)
+			}
+		case err != nil:
+			return err
+		default:
+			if _, err := tx.Exec(`UPDATE document_table SET "Meta_Version" = $2 WHERE "Document_UUID" = $1`, data.DocumentUUID, deleted); err != nil {
+				return err
+			}
+		}
+
+		if _, err := tx.Exec(`DELETE FROM documentpage_table WHERE "Document_UUID" = $1`, data.DocumentUUID); err != nil {
 			return err
 		}
 
@@ -96,38 +307,117 @@ func removeMetaDataFunction(data models.Meta) func(db *sql.DB) error {
 	}
 }
 
-func updateMetaDataFunction(uid uuid.UUID, data models.Meta) func(db *sql.DB) error {
-	return func(db *sql.DB) error {
-		SqlStatement := `UPDATE documentmeta_table SET "Number_Of_Pages" = COALESCE($1, "Number_Of_Pages"), "Height" = COALESCE($2, "Height"), "Width" = COALESCE($3, "Width"), "Images" = COALESCE($4, "Images") where "Document_UUID" = $5`
-		bytes, err := json.Marshal(data.Images)
+func updateMetaDataFunction(uid uuid.UUID, data models.Meta, ifVersion *int) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		SqlStatement := `UPDATE documentmeta_table SET "Number_Of_Pages" = COALESCE($1, "Number_Of_Pages"), "Height" = COALESCE($2, "Height"), "Width" = COALESCE($3, "Width"), "Version" = "Version" + 1 where "Document_UUID" = $4 AND ` + versionCondition(`"Version"`, 5)
+		result, err := tx.Exec(SqlStatement, data.NumberOfPages, data.Height, data.Width, uid, ifVersion)
 		if err != nil {
 			return err
 		}
 
-		if _, err := db.Exec(SqlStatement, data.NumberOfPages, data.Height, data.Width, string(bytes), uid); err != nil {
+		if err := checkMetaVersion(tx, result, uid, ifVersion); err != nil {
 			return err
 		}
 
+		if data.Images != nil {
+			// Replacing the images recreates the page rows, so the known geometry is carried over.
+			geometry, err := selectPageGeometry(tx, uid)
+			if err != nil {
+				return err
+			}
+
+			if _, err := tx.Exec(`DELETE FROM documentpage_table WHERE "Document_UUID" = $1`, uid); err != nil {
+				return err
+			}
+
+			if _, err := tx.Exec(`UPDATE documentmeta_table SET "Images" = null WHERE "Document_UUID" = $1`, uid); err != nil {
+				return err
+			}
+
+			if err := insertPages(tx, uid, pagesFromImages(uid, *data.Images)); err != nil {
+				return err
+			}
+
+			if err := renumberPages(tx, uid); err != nil {
+				return err
+			}
+
+			kept := make([]models.PageGeometry, 0, len(geometry))
+			for _, page := range geometry {
+				if page.PageNumber < uint32(len(*data.Images)) {
+					kept = append(kept, page)
+				}
+			}
+
+			if err := insertPageGeometry(tx, uid, kept); err != nil {
+				return err
+			}
+		}
+
+		return insertPageGeometry(tx, uid, data.Pages)
+	}
+}
+
+// checkMetaVersion fails a change of the meta data conditional on ifVersion that affected no row,
+// see versionMismatch. Unconditional changes of missing meta data succeed, as they always did.
+func checkMetaVersion(tx *sql.Tx, result sql.Result, documentUid uuid.UUID, ifVersion *int) error {
+	if ifVersion == nil {
 		return nil
 	}
+
+	affected, err := result.RowsAffected()
+	if err != nil || affected > 0 {
+		return err
+	}
+
+	return versionMismatch(tx, ifVersion, `SELECT "Version" FROM documentmeta_table WHERE "Document_UUID" = $1`, documentUid)
 }
 
 func getMetaDataFunction(documentUid, ownerUid uuid.UUID, callback func(data models.Meta) error) func(db *sql.DB) error {
+	return getMetaDataPaginationFunction(documentUid, ownerUid, 0, math.MaxUint32, callback)
+}
+
+// getMetaDataPaginationFunction loads the meta of a document together with the images of at most
+// limit pages, starting at the page with the offset as number.
+func getMetaDataPaginationFunction(documentUid, ownerUid uuid.UUID, offset, limit uint32, callback func(data models.Meta) error) func(db *sql.DB) error {
 	return func(db *sql.DB) error {
 		meta := &models.Meta{}
-		SqlStatement := `SELECT mt."Document_UUID", mt."Number_Of_Pages", mt."Height", mt."Width", mt."Images" FROM documentmeta_table as mt join public.document_table dt on dt."Document_UUID" = mt."Document_UUID" where mt."Document_UUID" = $1 and dt."Owner_UUID" = $2`
+		SqlStatement := `SELECT mt."Document_UUID", mt."Number_Of_Pages", mt."Height", mt."Width", mt."Version" FROM documentmeta_table as mt where mt."Document_UUID" = $1 and ` + documentAccess(`mt."Document_UUID"`, 2, false)
 
 		row := db.QueryRow(SqlStatement, documentUid, ownerUid)
+		err := row.Scan(&meta.DocumentUUID, &meta.NumberOfPages, &meta.Height, &meta.Width, &meta.Version)
+		if err != nil {
+			return err
+		}
 
-		var imageStr string
-		err := row.Scan(&meta.DocumentUUID, &meta.NumberOfPages, &meta.Height, &meta.Width, &imageStr)
+		rows, err := db.Query(`SELECT "Page_Number", "Page_Key", "Image", "Media_Box", "Crop_Box", "Rotation", "User_Unit" FROM documentpage_table WHERE "Document_UUID" = $1 ORDER BY "Page_Number" LIMIT $2 OFFSET $3`, documentUid, limit, offset)
 		if err != nil {
 			return err
 		}
+		defer rows.Close()
 
 		imageMap := make(map[string]string)
-		err = json.Unmarshal([]byte(imageStr), &imageMap)
-		if err != nil {
+		for rows.Next() {
+			var image sql.NullString
+			var geometry models.PageGeometry
+			var mediaBox, cropBox []byte
+			if err := rows.Scan(&geometry.PageNumber, &geometry.PageKey, &image, &mediaBox, &cropBox, &geometry.Rotation, &geometry.UserUnit); err != nil {
+				return err
+			}
+
+			if image.Valid {
+				imageMap[geometry.PageKey] = image.String
+			}
+
+			if err := scanPageGeometry(&geometry, mediaBox, cropBox); err != nil {
+				return err
+			}
+			if geometry.MediaBox != nil || geometry.CropBox != nil || geometry.Rotation != nil || geometry.UserUnit != nil {
+				meta.Pages = append(meta.Pages, geometry)
+			}
+		}
+
+		if err := rows.Err(); err != nil {
 			return err
 		}
 		meta.Images = &imageMap
@@ -136,36 +426,286 @@ func getMetaDataFunction(documentUid, ownerUid uuid.UUID, callback func(data mod
 	}
 }
 
-func getMetaDataPaginationFunction(documentUid, ownerUid uuid.UUID, offset, limit uint32, callback func(data models.Meta) error) func(db *sql.DB) error {
+func getPagesFunction(documentUid, ownerUid uuid.UUID, first, last uint32, callback func(data []models.Page)) func(db *sql.DB) error {
 	return func(db *sql.DB) error {
-		meta := &models.Meta{}
-		SqlStatement := `select mt."Document_UUID",
-					mt."Number_Of_Pages",
-					mt."Height",
-					mt."Width",
-					p.Pagination_Images
-					from documentmeta_table as mt
-					cross join LATERAL (
-					select coalesce(json_object_agg(f.key, f.value), '{}') AS Pagination_Images
-						from (select key, value from json_each_text(mt."Images")
-							limit $2 offset $3)
-							f) p
-							WHERE mt."Document_UUID" = $1;`
-		row := db.QueryRow(SqlStatement, documentUid, limit, offset)
-
-		var imageStr string
-		err := row.Scan(&meta.DocumentUUID, &meta.NumberOfPages, &meta.Height, &meta.Width, &imageStr)
+		sqlStatement := `SELECT pt."Document_UUID", pt."Page_Number", pt."Page_Key", pt."Image", pt."Width", pt."Height", pt."Mime_Type" FROM documentpage_table as pt join document_table dt on dt."Document_UUID" = pt."Document_UUID" WHERE pt."Document_UUID" = $1 and dt."Owner_UUID" = $2 and pt."Page_Number" between $3 and $4 ORDER BY pt."Page_Number"`
+
+		rows, err := db.Query(sqlStatement, documentUid, ownerUid, first, last)
 		if err != nil {
 			return err
 		}
+		defer rows.Close()
 
-		imageMap := make(map[string]string)
-		err = json.Unmarshal([]byte(imageStr), &imageMap)
+		pages := make([]models.Page, 0)
+		for rows.Next() {
+			page := models.Page{}
+			if err := rows.Scan(&page.DocumentUUID, &page.PageNumber, &page.PageKey, &page.Image, &page.Width, &page.Height, &page.MimeType); err != nil {
+				return err
+			}
+
+			pages = append(pages, page)
+		}
+
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		callback(pages)
+		return nil
+	}
+}
+
+func getPageByKeyFunction(documentUid, ownerUid uuid.UUID, pageKey string, callback func(data models.Page)) func(db *sql.DB) error {
+	return func(db *sql.DB) error {
+		sqlStatement := `SELECT pt."Document_UUID", pt."Page_Number", pt."Page_Key", pt."Image", pt."Width", pt."Height", pt."Mime_Type" FROM documentpage_table as pt WHERE pt."Document_UUID" = $1 and pt."Page_Key" = $3 and ` + documentAccess(`pt."Document_UUID"`, 2, false)
+
+		page := models.Page{}
+		row := db.QueryRow(sqlStatement, documentUid, ownerUid, pageKey)
+		if err := row.Scan(&page.DocumentUUID, &page.PageNumber, &page.PageKey, &page.Image, &page.Width, &page.Height, &page.MimeType); err != nil {
+			return err
+		}
+
+		callback(page)
+		return nil
+	}
+}
+
+// insertPages stores the given pages, replacing the image of pages with the same key. The pages
+// are added with negative page numbers below the stored ones, renumberPages has to be called
+// before the transaction ends.
+func insertPages(tx *sql.Tx, documentUid uuid.UUID, pages []models.Page) error {
+	if len(pages) == 0 {
+		return nil
+	}
+
+	lowest, err := lowestPageNumber(tx, documentUid)
+	if err != nil {
+		return err
+	}
+
+	sqlStatement := `INSERT INTO documentpage_table ("Document_UUID", "Page_Number", "Page_Key", "Image", "Width", "Height", "Mime_Type") values ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT ("Document_UUID", "Page_Key") DO UPDATE SET "Image" = excluded."Image", "Width" = excluded."Width", "Height" = excluded."Height", "Mime_Type" = excluded."Mime_Type"`
+
+	statement, err := tx.Prepare(sqlStatement)
+	if err != nil {
+		return err
+	}
+	defer statement.Close()
+
+	for i, page := range pages {
+		if _, err := statement.Exec(documentUid, lowest-1-int64(i), page.PageKey, page.Image, page.Width, page.Height, page.MimeType); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// lowestPageNumber returns the lowest page number of a document, or 0 when it has no lower one.
+// Pages are added below it until they are renumbered.
+func lowestPageNumber(tx *sql.Tx, documentUid uuid.UUID) (int64, error) {
+	var lowest int64
+	err := tx.QueryRow(`SELECT COALESCE(LEAST(MIN("Page_Number"), 0), 0) FROM documentpage_table WHERE "Document_UUID" = $1`, documentUid).Scan(&lowest)
+	return lowest, err
+}
+
+// pageKeyOrder orders the pages of a document by key, numeric keys by their value before any
+// other keys. The migration of the legacy images in BasicSetup.sql numbers pages the same way.
+const pageKeyOrder = `CASE WHEN "Page_Key" ~ '^[0-9]+$' THEN "Page_Key"::numeric END NULLS LAST, "Page_Key"`
+
+// renumberPages numbers the pages of a document by their position in key order, starting at 0.
+// The pages are first moved below all current numbers, so that no number is ever taken twice.
+func renumberPages(tx *sql.Tx, documentUid uuid.UUID) error {
+	moveBelow := `UPDATE documentpage_table SET "Page_Number" = "Page_Number" - (SELECT MAX("Page_Number") - MIN("Page_Number") + 1 FROM documentpage_table WHERE "Document_UUID" = $1) WHERE "Document_UUID" = $1`
+	if _, err := tx.Exec(moveBelow, documentUid); err != nil {
+		return err
+	}
+
+	renumber := `UPDATE documentpage_table AS pt SET "Page_Number" = numbered.number
+		FROM (SELECT "Page_Key", (ROW_NUMBER() OVER (ORDER BY ` + pageKeyOrder + `) - 1)::integer AS number FROM documentpage_table WHERE "Document_UUID" = $1) AS numbered
+		WHERE pt."Document_UUID" = $1 AND pt."Page_Key" = numbered."Page_Key"`
+	_, err := tx.Exec(renumber, documentUid)
+	return err
+}
+
+// insertPageGeometry stores the boxes and rotation of the given pages, which are matched to the
+// stored pages by key, or by number for pages without a key. Existing page rows keep their image,
+// pages without a row are added without one and all pages are renumbered.
+func insertPageGeometry(tx *sql.Tx, documentUid uuid.UUID, pages []models.PageGeometry) error {
+	if len(pages) == 0 {
+		return nil
+	}
+
+	lowest, err := lowestPageNumber(tx, documentUid)
+	if err != nil {
+		return err
+	}
+
+	sqlStatement := `INSERT INTO documentpage_table ("Document_UUID", "Page_Number", "Page_Key", "Media_Box", "Crop_Box", "Rotation", "User_Unit") values ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT ("Document_UUID", "Page_Key") DO UPDATE SET "Media_Box" = excluded."Media_Box", "Crop_Box" = excluded."Crop_Box", "Rotation" = excluded."Rotation", "User_Unit" = excluded."User_Unit"`
+
+	statement, err := tx.Prepare(sqlStatement)
+	if err != nil {
+		return err
+	}
+	defer statement.Close()
+
+	for i, page := range pages {
+		mediaBox, err := boxValue(page.MediaBox)
 		if err != nil {
 			return err
 		}
-		meta.Images = &imageMap
 
-		return callback(*meta)
+		cropBox, err := boxValue(page.CropBox)
+		if err != nil {
+			return err
+		}
+
+		pageKey := page.PageKey
+		if pageKey == "" {
+			if pageKey, err = pageKeyOfNumber(tx, documentUid, page.PageNumber); err != nil {
+				return err
+			}
+		}
+
+		if _, err := statement.Exec(documentUid, lowest-1-int64(i), pageKey, mediaBox, cropBox, page.Rotation, page.UserUnit); err != nil {
+			return err
+		}
+	}
+
+	return renumberPages(tx, documentUid)
+}
+
+// pageKeyOfNumber returns the key of the stored page with the number, or the number itself as key
+// when the document has no such page.
+func pageKeyOfNumber(tx *sql.Tx, documentUid uuid.UUID, pageNumber uint32) (string, error) {
+	var pageKey string
+	err := tx.QueryRow(`SELECT "Page_Key" FROM documentpage_table WHERE "Document_UUID" = $1 AND "Page_Number" = $2`, documentUid, pageNumber).Scan(&pageKey)
+	if errors.Is(err, sql.ErrNoRows) {
+		return strconv.FormatUint(uint64(pageNumber), 10), nil
+	}
+
+	return pageKey, err
+}
+
+// selectPageGeometry loads the geometry of every page of a document that has any.
+func selectPageGeometry(tx *sql.Tx, documentUid uuid.UUID) ([]models.PageGeometry, error) {
+	rows, err := tx.Query(`SELECT "Page_Number", "Page_Key", "Media_Box", "Crop_Box", "Rotation", "User_Unit" FROM documentpage_table WHERE "Document_UUID" = $1 and ("Media_Box" is not null or "Crop_Box" is not null or "Rotation" is not null or "User_Unit" is not null) ORDER BY "Page_Number"`, documentUid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pages := make([]models.PageGeometry, 0)
+	for rows.Next() {
+		var geometry models.PageGeometry
+		var mediaBox, cropBox []byte
+		if err := rows.Scan(&geometry.PageNumber, &geometry.PageKey, &mediaBox, &cropBox, &geometry.Rotation, &geometry.UserUnit); err != nil {
+			return nil, err
+		}
+
+		if err := scanPageGeometry(&geometry, mediaBox, cropBox); err != nil {
+			return nil, err
+		}
+		pages = append(pages, geometry)
+	}
+
+	return pages, rows.Err()
+}
+
+func scanPageGeometry(geometry *models.PageGeometry, mediaBox, cropBox []byte) error {
+	if mediaBox != nil {
+		geometry.MediaBox = &models.Box{}
+		if err := json.Unmarshal(mediaBox, geometry.MediaBox); err != nil {
+			return err
+		}
+	}
+
+	if cropBox != nil {
+		geometry.CropBox = &models.Box{}
+		if err := json.Unmarshal(cropBox, geometry.CropBox); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func boxValue(box *models.Box) (any, error) {
+	if box == nil {
+		return nil, nil
+	}
+
+	value, err := json.Marshal(box)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(value), nil
+}
+
+// pagesFromImages converts the image map of a models.Meta into pages, which are numbered once
+// they are stored.
+func pagesFromImages(documentUid uuid.UUID, images map[string]string) []models.Page {
+	keys := make([]string, 0, len(images))
+	for key := range images {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pages := make([]models.Page, 0, len(keys))
+	for _, key := range keys {
+		pages = append(pages, imaging.NewPage(documentUid, 0, key, images[key]))
+	}
+
+	return pages
+}
+
+// getPageGeometryForOwnerFunction loads the page geometry of a document the caller may read.
+func getPageGeometryForOwnerFunction(documentUid, ownerUid uuid.UUID, callback func(data models.Meta)) func(db *sql.DB) error {
+	return func(db *sql.DB) error {
+		if err := checkDocumentAccess(db, documentUid, ownerUid, false); err != nil {
+			return err
+		}
+
+		return getPageGeometryFunction(documentUid, callback)(db)
+	}
+}
+
+// getPageGeometryFunction loads the size of a document and the geometry of all of its pages,
+// including pages that only have a key.
+func getPageGeometryFunction(documentUid uuid.UUID, callback func(data models.Meta)) func(db *sql.DB) error {
+	return func(db *sql.DB) error {
+		meta := models.Meta{DocumentUUID: documentUid}
+		row := db.QueryRow(`SELECT "Number_Of_Pages", "Height", "Width", "Version" FROM documentmeta_table WHERE "Document_UUID" = $1`, documentUid)
+		if err := row.Scan(&meta.NumberOfPages, &meta.Height, &meta.Width, &meta.Version); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		rows, err := db.Query(`SELECT "Page_Number", "Page_Key", "Media_Box", "Crop_Box", "Rotation", "User_Unit" FROM documentpage_table WHERE "Document_UUID" = $1 ORDER BY "Page_Number"`, documentUid)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var geometry models.PageGeometry
+			var mediaBox, cropBox []byte
+			if err := rows.Scan(&geometry.PageNumber, &geometry.PageKey, &mediaBox, &cropBox, &geometry.Rotation, &geometry.UserUnit); err != nil {
+				return err
+			}
+
+			if err := scanPageGeometry(&geometry, mediaBox, cropBox); err != nil {
+				return err
+			}
+			meta.Pages = append(meta.Pages, geometry)
+		}
+
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		callback(meta)
+		return nil
 	}
 }
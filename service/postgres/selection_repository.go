@@ -4,9 +4,13 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"log/slog"
 	"pdf_service_api/models"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 type selectionRepository struct {
@@ -17,8 +21,14 @@ func NewSelectionRepository(db DatabaseHandler) models.SelectionRepository {
 	return selectionRepository{databaseManager: db}
 }
 
-func (s selectionRepository) AddNewSelection(selection models.Selection) error {
-	err := s.databaseManager.WithConnection(AddNewSelectionFunction(selection))
+// WithLogger returns a copy of the repository that logs its database calls with the logger.
+func (s selectionRepository) WithLogger(logger *slog.Logger) models.SelectionRepository {
+	s.databaseManager.Logger = logger
+	return s
+}
+
+func (s selectionRepository) AddNewSelection(selection models.Selection, ownerUid uuid.UUID) error {
+	err := s.databaseManager.WithConnection(AddNewSelectionFunction(selection, ownerUid))
 	if err != nil {
 		return err
 	}
@@ -26,9 +36,9 @@ func (s selectionRepository) AddNewSelection(selection models.Selection) error {
 	return nil
 }
 
-func (s selectionRepository) GetSelectionBySelectionUUID(uid uuid.UUID) ([]models.Selection, error) {
+func (s selectionRepository) GetSelectionBySelectionUUID(uid, ownerUid uuid.UUID) ([]models.Selection, error) {
 	var ss []models.Selection
-	getSelection := getSelectionBySelectionUUIDFunction(uid, func(data []models.Selection) {
+	getSelection := getSelectionBySelectionUUIDFunction(uid, ownerUid, func(data []models.Selection) {
 		ss = data
 	})
 
@@ -40,9 +50,9 @@ func (s selectionRepository) GetSelectionBySelectionUUID(uid uuid.UUID) ([]model
 	return ss, nil
 }
 
-func (s selectionRepository) GetSelectionListByDocumentUUID(uid uuid.UUID) ([]models.Selection, error) {
+func (s selectionRepository) GetSelectionListByDocumentUUID(uid, ownerUid uuid.UUID, filter models.SelectionFilter) ([]models.Selection, error) {
 	ss := make([]models.Selection, 0)
-	getSelection := getSelectionListByDocumentUUIDFunction(uid, func(data []models.Selection) {
+	getSelection := getSelectionListByDocumentUUIDFunction(uid, ownerUid, filter, func(data []models.Selection) {
 		ss = data
 	})
 
@@ -54,8 +64,8 @@ func (s selectionRepository) GetSelectionListByDocumentUUID(uid uuid.UUID) ([]mo
 	return ss, nil
 }
 
-func (s selectionRepository) DeleteSelectionByDocumentUUID(uid uuid.UUID) error {
-	err := s.databaseManager.WithConnection(deleteSelectionByDocumentUUIDFunction(uid))
+func (s selectionRepository) DeleteSelectionByDocumentUUID(uid, ownerUid uuid.UUID, precondition models.ListPrecondition) error {
+	err := s.databaseManager.WithTransaction(deleteSelectionByDocumentUUIDFunction(uid, ownerUid, precondition))
 	if err != nil {
 		return err
 	}
@@ -63,8 +73,8 @@ func (s selectionRepository) DeleteSelectionByDocumentUUID(uid uuid.UUID) error
 	return nil
 }
 
-func (s selectionRepository) DeleteSelectionBySelectionUUID(uid uuid.UUID) error {
-	err := s.databaseManager.WithConnection(deleteSelectionBySelectionUUIDFunction(uid))
+func (s selectionRepository) DeleteSelectionBySelectionUUID(uid, ownerUid uuid.UUID, ifVersion *int) error {
+	err := s.databaseManager.WithConnection(deleteSelectionBySelectionUUIDFunction(uid, ownerUid, ifVersion))
 	if err != nil {
 		return err
 	}
@@ -72,130 +82,638 @@ func (s selectionRepository) DeleteSelectionBySelectionUUID(uid uuid.UUID) error
 	return nil
 }
 
-func AddNewSelectionFunction(selection models.Selection) func(db *sql.DB) error {
-	return func(db *sql.DB) error {
-		sqlStatement := `insert into selection_table ("Selection_UUID", "Document_UUID", "Coordinates", "Page_Key") values ($1, $2, $3, $4);`
+func (s selectionRepository) CheckDocumentAccess(documentUid, ownerUid uuid.UUID, write bool) error {
+	return s.databaseManager.WithConnection(func(db *sql.DB) error {
+		return checkDocumentAccess(db, documentUid, ownerUid, write)
+	})
+}
+
+func (s selectionRepository) SetExtractedText(uid, ownerUid uuid.UUID, text string, extractedAt time.Time) error {
+	err := s.databaseManager.WithConnection(setExtractedTextFunction(uid, ownerUid, text, extractedAt))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s selectionRepository) UpdateSelection(uid, ownerUid uuid.UUID, update models.SelectionUpdate, updatedAt time.Time) (models.Selection, error) {
+	selection := models.Selection{}
+	err := s.databaseManager.WithConnection(updateSelectionFunction(uid, ownerUid, update, updatedAt, func(data models.Selection) {
+		selection = data
+	}))
+	if err != nil {
+		return models.Selection{}, err
+	}
+
+	return selection, nil
+}
+
+func (s selectionRepository) AddSelections(selections []models.Selection, ownerUid uuid.UUID, mode models.BulkMode) ([]error, error) {
+	var errs []error
+	err := s.databaseManager.WithTransaction(func(tx *sql.Tx) error {
+		if mode != models.BulkModePerItem {
+			checked := make(map[uuid.UUID]bool)
+			for i, selection := range selections {
+				if selection.DocumentUUID == nil || checked[*selection.DocumentUUID] {
+					continue
+				}
 
-		pageKey := selection.PageKey
-		selUid := selection.Uuid
-		if selUid == uuid.Nil {
-			return errors.New("selection uuid cannot be nil")
+				if err := checkDocumentAccess(tx, *selection.DocumentUUID, ownerUid, true); err != nil {
+					return fmt.Errorf("selection %d: %w", i, err)
+				}
+				checked[*selection.DocumentUUID] = true
+			}
+
+			return copySelections(tx, selections)
 		}
 
-		docUid := selection.DocumentUUID
-		if *docUid == uuid.Nil {
-			return errors.New("selection uuid cannot be nil")
+		var err error
+		errs, err = eachItem(tx, len(selections), mode, func(i int) error {
+			return insertSelection(tx, selections[i], ownerUid)
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return errs, nil
+}
+
+func (s selectionRepository) UpdateSelections(updates []models.BulkSelectionUpdate, ownerUid uuid.UUID, updatedAt time.Time, mode models.BulkMode) ([]models.Selection, []error, error) {
+	selections := make([]models.Selection, len(updates))
+	var errs []error
+	err := s.databaseManager.WithTransaction(func(tx *sql.Tx) error {
+		var err error
+		errs, err = eachItem(tx, len(updates), mode, func(i int) error {
+			selection, err := updateSelection(tx, updates[i].SelectionUUID, ownerUid, updates[i].Update, updatedAt)
+			if err != nil {
+				return err
+			}
+
+			selections[i] = selection
+			return nil
+		})
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return selections, errs, nil
+}
+
+func (s selectionRepository) DeleteSelections(uids []uuid.UUID, ownerUid uuid.UUID, mode models.BulkMode) ([]error, error) {
+	var errs []error
+	err := s.databaseManager.WithTransaction(func(tx *sql.Tx) error {
+		var err error
+		errs, err = eachItem(tx, len(uids), mode, func(i int) error {
+			result, err := tx.Exec(`DELETE FROM selection_table WHERE "Selection_UUID" = $1 AND `+documentAccess(`selection_table."Document_UUID"`, 2, true), uids[i], ownerUid)
+			if err != nil {
+				return err
+			}
+
+			affected, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+
+			if affected == 0 {
+				return sql.ErrNoRows
+			}
+
+			return nil
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return errs, nil
+}
+
+func (s selectionRepository) ReplaceSelections(documentUid, ownerUid uuid.UUID, pageKey *string, selections []models.Selection, precondition models.ListPrecondition) error {
+	err := s.databaseManager.WithTransaction(func(tx *sql.Tx) error {
+		if err := checkDocumentAccess(tx, documentUid, ownerUid, true); err != nil {
+			return err
 		}
 
-		bytes, err := json.Marshal(selection.Coordinates)
-		if err != nil {
+		if err := checkListPrecondition(tx, documentUid, models.SelectionFilter{PageKey: pageKey}, precondition); err != nil {
 			return err
 		}
 
-		_, err = db.Exec(sqlStatement, selUid, docUid, bytes, pageKey)
+		for i, selection := range selections {
+			if selection.DocumentUUID == nil || *selection.DocumentUUID != documentUid {
+				return fmt.Errorf("selection %d does not belong to document %s", i, documentUid)
+			}
+
+			if pageKey != nil && (selection.PageKey == nil || *selection.PageKey != *pageKey) {
+				return fmt.Errorf("selection %d does not belong to page %s", i, *pageKey)
+			}
+		}
+
+		var err error
+		if pageKey != nil {
+			_, err = tx.Exec(`DELETE FROM selection_table WHERE "Document_UUID" = $1 AND "Page_Key" = $2`, documentUid, *pageKey)
+		} else {
+			_, err = tx.Exec(`DELETE FROM selection_table WHERE "Document_UUID" = $1`, documentUid)
+		}
 		if err != nil {
 			return err
 		}
 
-		return nil
+		return copySelections(tx, selections)
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func AddNewSelectionFunction(selection models.Selection, ownerUid uuid.UUID) func(db *sql.DB) error {
+	return func(db *sql.DB) error {
+		return insertSelection(db, selection, ownerUid)
+	}
+}
+
+// execer is implemented by both *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// queryRower is implemented by both *sql.DB and *sql.Tx.
+type queryRower interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// queryExecer is implemented by both *sql.DB and *sql.Tx.
+type queryExecer interface {
+	execer
+	queryRower
+}
+
+// documentAccess is a condition that the document in column belongs to the caller given by the
+// numbered parameter, or is shared with them. With write the share has to allow writing.
+func documentAccess(column string, param int, write bool) string {
+	canWrite := ""
+	if write {
+		canWrite = ` AND s."Can_Write"`
+	}
+
+	return fmt.Sprintf(`EXISTS (SELECT 1 FROM document_table AS d WHERE d."Document_UUID" = %[1]s
+		AND (d."Owner_UUID" = $%[2]d OR EXISTS (SELECT 1 FROM documentshare_table AS s
+			WHERE s."Document_UUID" = d."Document_UUID" AND s."Grantee_UUID" = $%[2]d%[3]s)))`, column, param, canWrite)
+}
+
+// checkDocumentAccess returns an error wrapping sql.ErrNoRows unless the caller may read the
+// selections of the document, or with write also change them.
+func checkDocumentAccess(db queryRower, documentUid, ownerUid uuid.UUID, write bool) error {
+	var isAllowed bool
+	err := db.QueryRow(`SELECT `+documentAccess("$1", 2, write), documentUid, ownerUid).Scan(&isAllowed)
+	if err != nil {
+		return err
+	}
+
+	if !isAllowed {
+		return fmt.Errorf("document %s not found: %w", documentUid, sql.ErrNoRows)
+	}
+
+	return nil
+}
+
+// versionCondition is a condition that the version in column equals the numbered parameter,
+// which holds for every version when the parameter is null.
+func versionCondition(column string, param int) string {
+	return fmt.Sprintf(`($%[2]d::integer IS NULL OR %[1]s = $%[2]d)`, column, param)
+}
+
+// versionMismatch tells why a change conditional on ifVersion affected no row. The query selects
+// the current version of the row: if there still is one the change failed with
+// models.ErrVersionConflict, otherwise the row does not exist and sql.ErrNoRows is returned.
+func versionMismatch(db queryRower, ifVersion *int, query string, args ...any) error {
+	if ifVersion == nil {
+		return sql.ErrNoRows
+	}
+
+	var version int
+	if err := db.QueryRow(query, args...).Scan(&version); err != nil {
+		return err
+	}
+
+	return fmt.Errorf("%w: expected version %d, current version is %d", models.ErrVersionConflict, *ifVersion, version)
+}
+
+// selectionInsertColumns are the columns written for a new selection, in the order of selectionValues.
+var selectionInsertColumns = []string{"Selection_UUID", "Document_UUID", "Coordinates", "Page_Key", "Type", "Label", "Note", "Color", "Author_UUID", "Created_At", "Updated_At"}
+
+func insertSelection(db queryExecer, selection models.Selection, ownerUid uuid.UUID) error {
+	sqlStatement := `insert into selection_table ("Selection_UUID", "Document_UUID", "Coordinates", "Page_Key", "Type", "Label", "Note", "Color", "Author_UUID", "Created_At", "Updated_At") values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11);`
+
+	values, err := selectionValues(selection)
+	if err != nil {
+		return err
+	}
+
+	if err := checkDocumentAccess(db, *selection.DocumentUUID, ownerUid, true); err != nil {
+		return err
+	}
+
+	_, err = db.Exec(sqlStatement, values...)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// selectionValues checks a new selection and returns its values for selectionInsertColumns.
+func selectionValues(selection models.Selection) ([]any, error) {
+	if selection.Uuid == uuid.Nil {
+		return nil, errors.New("selection uuid cannot be nil")
+	}
+
+	if selection.DocumentUUID == nil || *selection.DocumentUUID == uuid.Nil {
+		return nil, errors.New("document uuid cannot be nil")
+	}
+
+	coordinates, err := coordinatesValue(selection.Coordinates)
+	if err != nil {
+		return nil, err
+	}
+
+	return []any{selection.Uuid, selection.DocumentUUID, coordinates, selection.PageKey, selection.Type, selection.Label,
+		selection.Note, selection.Color, selection.AuthorUUID, selection.CreatedAt, selection.UpdatedAt}, nil
+}
+
+// coordinatesValue encodes coordinates for the json column, missing coordinates are stored as null.
+func coordinatesValue(coordinates *models.Coordinates) (any, error) {
+	if coordinates == nil {
+		return nil, nil
+	}
+
+	bytes, err := json.Marshal(coordinates)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(bytes), nil
+}
+
+// selectionColumns are the columns read by scanSelection, in order.
+const selectionColumns = `"Selection_UUID", "Document_UUID", "Coordinates", "Page_Key", "Type", "Label", "Note", "Color", "Author_UUID", "Created_At", "Updated_At", "Extracted_Text", "Text_Extracted_At", "Version"`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSelection(rows rowScanner) (models.Selection, error) {
+	data := models.Selection{}
+
+	var coordinateStr sql.NullString
+	err := rows.Scan(&data.Uuid, &data.DocumentUUID, &coordinateStr, &data.PageKey, &data.Type, &data.Label, &data.Note,
+		&data.Color, &data.AuthorUUID, &data.CreatedAt, &data.UpdatedAt, &data.ExtractedText, &data.TextExtractedAt, &data.Version)
+	if err != nil {
+		return data, err
 	}
+
+	if coordinateStr.Valid {
+		coordinate := models.Coordinates{}
+		err = json.Unmarshal([]byte(coordinateStr.String), &coordinate)
+		if err != nil {
+			return data, err
+		}
+
+		data.Coordinates = &coordinate
+	}
+
+	return data, nil
 }
 
-func getSelectionListByDocumentUUIDFunction(uid uuid.UUID, callback func(data []models.Selection)) func(db *sql.DB) error {
+func getSelectionListByDocumentUUIDFunction(uid, ownerUid uuid.UUID, filter models.SelectionFilter, callback func(data []models.Selection)) func(db *sql.DB) error {
 	return func(db *sql.DB) error {
-		sqlStatement := `SELECT "Selection_UUID", "Document_UUID", "Coordinates", "Page_Key" FROM selection_table where "Document_UUID" = $1`
+		if err := checkDocumentAccess(db, uid, ownerUid, false); err != nil {
+			return err
+		}
 
-		rows, err := db.Query(sqlStatement, uid.String())
+		sqlStatement, args := selectionListQuery(uid, filter)
+		rows, err := db.Query(sqlStatement, args...)
 		if err != nil {
 			return err
 
 		}
+		defer rows.Close()
 
-		//var ss []models.Selection
 		ss := make([]models.Selection, 0)
 		for rows.Next() {
-			data := models.Selection{}
-
-			var coordinateStr sql.NullString
-			err := rows.Scan(&data.Uuid, &data.DocumentUUID, &coordinateStr, &data.PageKey)
+			data, err := scanSelection(rows)
 			if err != nil {
 				return err
 			}
 
-			if coordinateStr.Valid {
-				coordinate := models.Coordinates{}
-				err = json.Unmarshal([]byte(coordinateStr.String), &coordinate)
-				if err != nil {
-					return err
-				}
-
-				data.Coordinates = &coordinate
-			}
 			ss = append(ss, data)
 		}
 
 		callback(ss)
-		return nil
+		return rows.Err()
+	}
+}
+
+// selectionListQuery selects the selections of a document matching the filter. Spatial
+// conditions use the "Box" column and its GiST index. Selections near a point are ordered by
+// distance, all others by page number and position, top to bottom and left to right.
+func selectionListQuery(uid uuid.UUID, filter models.SelectionFilter) (string, []any) {
+	sqlStatement := `SELECT ` + selectionColumns + ` FROM selection_table where "Document_UUID" = $1`
+	args := []any{uid.String()}
+	param := func(value any) int {
+		args = append(args, value)
+		return len(args)
+	}
+	boxOf := func(c *models.Coordinates) string {
+		return fmt.Sprintf(`box(point($%d, $%d), point($%d, $%d))`, param(c.X1), param(c.Y1), param(c.X2), param(c.Y2))
 	}
+
+	if len(filter.Types) > 0 {
+		types := make([]string, len(filter.Types))
+		for i, selectionType := range filter.Types {
+			types[i] = string(selectionType)
+		}
+
+		sqlStatement += fmt.Sprintf(` AND "Type" = ANY($%d)`, param(pq.Array(types)))
+	}
+
+	if filter.PageKey != nil {
+		sqlStatement += fmt.Sprintf(` AND "Page_Key" = $%d`, param(*filter.PageKey))
+	}
+
+	if filter.Intersects != nil {
+		sqlStatement += ` AND "Box" && ` + boxOf(filter.Intersects)
+	}
+
+	if filter.Within != nil {
+		sqlStatement += ` AND "Box" <@ ` + boxOf(filter.Within)
+	}
+
+	if filter.Near != nil {
+		sqlStatement += fmt.Sprintf(` AND "Box" IS NOT NULL ORDER BY "Box" <-> point($%d, $%d), "Selection_UUID"`, param(filter.Near.X), param(filter.Near.Y))
+	} else {
+		sqlStatement += ` ORDER BY CASE WHEN "Page_Key" ~ '^[0-9]+$' THEN "Page_Key"::numeric END NULLS LAST, "Page_Key",
+			(("Box")[0])[1] DESC NULLS LAST, (("Box")[1])[0], "Selection_UUID"`
+	}
+
+	if filter.Limit > 0 {
+		sqlStatement += fmt.Sprintf(` LIMIT $%d`, param(filter.Limit))
+	}
+
+	return sqlStatement, args
 }
 
-func getSelectionBySelectionUUIDFunction(uid uuid.UUID, callback func(data []models.Selection)) func(db *sql.DB) error {
+func getSelectionBySelectionUUIDFunction(uid, ownerUid uuid.UUID, callback func(data []models.Selection)) func(db *sql.DB) error {
 	return func(db *sql.DB) error {
-		sqlStatement := `SELECT "Selection_UUID", "Document_UUID", "Coordinates", "Page_Key" FROM selection_table where "Selection_UUID" = $1`
+		sqlStatement := `SELECT ` + selectionColumns + ` FROM selection_table where "Selection_UUID" = $1 AND ` + documentAccess(`selection_table."Document_UUID"`, 2, false)
 
-		rows, err := db.Query(sqlStatement, uid.String())
+		rows, err := db.Query(sqlStatement, uid.String(), ownerUid.String())
 		if err != nil {
 			return err
 
 		}
+		defer rows.Close()
 
 		var ss []models.Selection
 		for rows.Next() {
-			data := models.Selection{}
-			var coordinateStr sql.NullString
-			err := rows.Scan(&data.Uuid, &data.DocumentUUID, &coordinateStr, &data.PageKey)
+			data, err := scanSelection(rows)
 			if err != nil {
 				return err
 			}
 
-			if coordinateStr.Valid {
-				coordinate := models.Coordinates{}
-				err = json.Unmarshal([]byte(coordinateStr.String), &coordinate)
-				if err != nil {
-					return err
-				}
-
-				data.Coordinates = &coordinate
-			}
-
 			ss = append(ss, data)
 		}
 
 		callback(ss)
+		return rows.Err()
+	}
+}
+
+func deleteSelectionBySelectionUUIDFunction(uid, ownerUid uuid.UUID, ifVersion *int) func(db *sql.DB) error {
+	return func(db *sql.DB) error {
+		sqlStatement := `DELETE FROM selection_table WHERE "Selection_UUID" = $1 AND ` + documentAccess(`selection_table."Document_UUID"`, 2, true) + ` AND ` + versionCondition(`"Version"`, 3)
+		result, err := db.Exec(sqlStatement, uid, ownerUid, ifVersion)
+		if err != nil {
+			return err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if affected == 0 {
+			return versionMismatch(db, ifVersion, selectionVersionQuery, uid, ownerUid)
+		}
+
+		return nil
+	}
+}
+
+// checkListPrecondition runs the precondition of a change of all selections of a document that
+// match the filter. The document row is locked first, which blocks selections from being added
+// to it until the transaction ends, and the listed selections are locked against changes.
+func checkListPrecondition(tx *sql.Tx, documentUid uuid.UUID, filter models.SelectionFilter, precondition models.ListPrecondition) error {
+	if precondition == nil {
+		return nil
+	}
+
+	if _, err := tx.Exec(`SELECT 1 FROM document_table WHERE "Document_UUID" = $1 FOR UPDATE`, documentUid); err != nil {
+		return err
+	}
+
+	sqlStatement, args := selectionListQuery(documentUid, filter)
+	rows, err := tx.Query(sqlStatement+` FOR UPDATE`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	current := make([]models.Selection, 0)
+	for rows.Next() {
+		selection, err := scanSelection(rows)
+		if err != nil {
+			return err
+		}
+
+		current = append(current, selection)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return precondition(current)
+}
+
+// selectionVersionQuery selects the current version of a selection the caller may change.
+var selectionVersionQuery = `SELECT "Version" FROM selection_table WHERE "Selection_UUID" = $1 AND ` + documentAccess(`selection_table."Document_UUID"`, 2, true)
+
+func deleteSelectionByDocumentUUIDFunction(uid, ownerUid uuid.UUID, precondition models.ListPrecondition) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		if err := checkDocumentAccess(tx, uid, ownerUid, true); err != nil {
+			return err
+		}
+
+		if err := checkListPrecondition(tx, uid, models.SelectionFilter{}, precondition); err != nil {
+			return err
+		}
+
+		sqlStatement := `DELETE FROM selection_table WHERE "Document_UUID" = $1`
+		_, err := tx.Exec(sqlStatement, uid)
+		if err != nil {
+			return err
+		}
+
 		return nil
 	}
 }
 
-func deleteSelectionBySelectionUUIDFunction(uid uuid.UUID) func(db *sql.DB) error {
+func setExtractedTextFunction(uid, ownerUid uuid.UUID, text string, extractedAt time.Time) func(db *sql.DB) error {
 	return func(db *sql.DB) error {
-		sqlStatement := `DELETE FROM selection_table WHERE "Selection_UUID" = $1`
-		_, err := db.Exec(sqlStatement, uid)
+		sqlStatement := `UPDATE selection_table SET "Extracted_Text" = $1, "Text_Extracted_At" = $2, "Version" = "Version" + 1 WHERE "Selection_UUID" = $3 AND ` + documentAccess(`selection_table."Document_UUID"`, 4, true)
+		result, err := db.Exec(sqlStatement, text, extractedAt, uid, ownerUid)
+		if err != nil {
+			return err
+		}
+
+		affected, err := result.RowsAffected()
 		if err != nil {
 			return err
 		}
 
+		if affected == 0 {
+			return sql.ErrNoRows
+		}
+
 		return nil
 	}
 }
 
-func deleteSelectionByDocumentUUIDFunction(uid uuid.UUID) func(db *sql.DB) error {
+func updateSelectionFunction(uid, ownerUid uuid.UUID, update models.SelectionUpdate, updatedAt time.Time, callback func(data models.Selection)) func(db *sql.DB) error {
 	return func(db *sql.DB) error {
-		sqlStatement := `DELETE FROM selection_table WHERE "Document_UUID" = $1`
-		_, err := db.Exec(sqlStatement, uid)
+		selection, err := updateSelection(db, uid, ownerUid, update, updatedAt)
 		if err != nil {
 			return err
 		}
 
+		callback(selection)
 		return nil
 	}
 }
+
+func updateSelection(db queryRower, uid, ownerUid uuid.UUID, update models.SelectionUpdate, updatedAt time.Time) (models.Selection, error) {
+	coordinates, err := coordinatesValue(update.Coordinates)
+	if err != nil {
+		return models.Selection{}, err
+	}
+
+	columns := []struct {
+		name  string
+		value any
+		isSet bool
+	}{
+		{`"Page_Key"`, update.PageKey, update.PageKey != nil},
+		{`"Coordinates"`, coordinates, update.Coordinates != nil},
+		{`"Type"`, update.Type, update.Type != nil},
+		{`"Label"`, update.Label, update.Label != nil},
+		{`"Note"`, update.Note, update.Note != nil},
+		{`"Color"`, update.Color, update.Color != nil},
+		{`"Author_UUID"`, update.AuthorUUID, update.AuthorUUID != nil},
+	}
+
+	sqlStatement := `UPDATE selection_table SET "Updated_At" = $1, "Version" = "Version" + 1`
+	args := []any{updatedAt}
+	for _, column := range columns {
+		if !column.isSet && !update.Replace {
+			continue
+		}
+
+		args = append(args, column.value)
+		sqlStatement += fmt.Sprintf(`, %s = $%d`, column.name, len(args))
+	}
+
+	args = append(args, uid, ownerUid, update.IfVersion)
+	sqlStatement += fmt.Sprintf(` WHERE "Selection_UUID" = $%d AND `, len(args)-2) + documentAccess(`selection_table."Document_UUID"`, len(args)-1, true) +
+		` AND ` + versionCondition(`"Version"`, len(args)) + ` RETURNING ` + selectionColumns
+
+	selection, err := scanSelection(db.QueryRow(sqlStatement, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return selection, versionMismatch(db, update.IfVersion, selectionVersionQuery, uid, ownerUid)
+	}
+
+	return selection, err
+}
+
+// copySelections inserts all selections with a single COPY, which fails as a whole.
+func copySelections(tx *sql.Tx, selections []models.Selection) error {
+	if len(selections) == 0 {
+		return nil
+	}
+
+	statement, err := tx.Prepare(pq.CopyIn("selection_table", selectionInsertColumns...))
+	if err != nil {
+		return err
+	}
+	defer statement.Close()
+
+	for i, selection := range selections {
+		values, err := selectionValues(selection)
+		if err != nil {
+			return fmt.Errorf("selection %d: %w", i, err)
+		}
+
+		if _, err := statement.Exec(values...); err != nil {
+			return fmt.Errorf("selection %d: %w", i, err)
+		}
+	}
+
+	if _, err := statement.Exec(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// eachItem runs item for every index inside the transaction. In atomic mode the first failure
+// aborts the transaction and no item errors are returned. In per item mode each item runs in its
+// own savepoint, so a failing item is rolled back alone and its error is reported at its index.
+func eachItem(tx *sql.Tx, count int, mode models.BulkMode, item func(i int) error) ([]error, error) {
+	if mode != models.BulkModePerItem {
+		for i := 0; i < count; i++ {
+			if err := item(i); err != nil {
+				return nil, fmt.Errorf("selection %d: %w", i, err)
+			}
+		}
+
+		return nil, nil
+	}
+
+	errs := make([]error, count)
+	for i := 0; i < count; i++ {
+		if _, err := tx.Exec(`SAVEPOINT bulk_item`); err != nil {
+			return nil, err
+		}
+
+		if err := item(i); err != nil {
+			errs[i] = err
+			if _, err := tx.Exec(`ROLLBACK TO SAVEPOINT bulk_item`); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if _, err := tx.Exec(`RELEASE SAVEPOINT bulk_item`); err != nil {
+			return nil, err
+		}
+	}
+
+	return errs, nil
+}
@@ -0,0 +1,242 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"pdf_service_api/models"
+
+	"github.com/google/uuid"
+)
+
+type selectionTemplateRepository struct {
+	databaseManager DatabaseHandler
+}
+
+func NewSelectionTemplateRepository(db DatabaseHandler) models.SelectionTemplateRepository {
+	return selectionTemplateRepository{databaseManager: db}
+}
+
+// WithLogger returns a copy of the repository that logs its database calls with the logger.
+func (s selectionTemplateRepository) WithLogger(logger *slog.Logger) models.SelectionTemplateRepository {
+	s.databaseManager.Logger = logger
+	return s
+}
+
+func (s selectionTemplateRepository) AddTemplate(template models.SelectionTemplate) (int, error) {
+	version := 0
+	err := s.databaseManager.WithTransaction(func(tx *sql.Tx) error {
+		var err error
+		version, err = insertTemplate(tx, template)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+func (s selectionTemplateRepository) GetTemplates(ownerUid uuid.UUID, name *string) ([]models.SelectionTemplate, error) {
+	templates := make([]models.SelectionTemplate, 0)
+	callbackFunction := func(data []models.SelectionTemplate) {
+		templates = data
+	}
+
+	if err := s.databaseManager.WithConnection(getTemplatesFunction(ownerUid, name, callbackFunction)); err != nil {
+		return templates, err
+	}
+
+	return templates, nil
+}
+
+func (s selectionTemplateRepository) GetTemplate(uid, ownerUid uuid.UUID) (models.SelectionTemplate, error) {
+	template := models.SelectionTemplate{}
+	callbackFunction := func(data models.SelectionTemplate) {
+		template = data
+	}
+
+	if err := s.databaseManager.WithConnection(getTemplateFunction(uid, ownerUid, callbackFunction)); err != nil {
+		return models.SelectionTemplate{}, err
+	}
+
+	return template, nil
+}
+
+func (s selectionTemplateRepository) DeleteTemplate(uid, ownerUid uuid.UUID) error {
+	err := s.databaseManager.WithConnection(func(db *sql.DB) error {
+		result, err := db.Exec(`DELETE FROM selectiontemplate_table WHERE "Template_UUID" = $1 AND "Owner_UUID" = $2`, uid, ownerUid)
+		if err != nil {
+			return err
+		}
+
+		if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+			return fmt.Errorf("template %s not found: %w", uid, sql.ErrNoRows)
+		}
+
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// insertTemplate stores the template as the next version of its name. Saving the same name
+// concurrently is serialized by a lock on the owner and name, held until the transaction ends.
+func insertTemplate(tx *sql.Tx, template models.SelectionTemplate) (int, error) {
+	if template.Uuid == uuid.Nil {
+		return 0, errors.New("template uuid cannot be nil")
+	}
+
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext($1))`, template.OwnerUUID.String()+"/"+template.Name); err != nil {
+		return 0, err
+	}
+
+	var version int
+	err := tx.QueryRow(`INSERT INTO selectiontemplate_table ("Template_UUID", "Owner_UUID", "Name", "Version", "Source_Document_UUID", "Created_At")
+		SELECT $1, $2, $3, coalesce(max("Version"), 0) + 1, $4, $5 FROM selectiontemplate_table WHERE "Owner_UUID" = $2 AND "Name" = $3
+		RETURNING "Version"`, template.Uuid, template.OwnerUUID, template.Name, template.SourceDocumentUUID, template.CreatedAt).Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(template.Selections) == 0 {
+		return version, nil
+	}
+
+	statement, err := tx.Prepare(`INSERT INTO selectiontemplateentry_table ("Template_UUID", "Position", "Page_Key", "Page_Geometry", "Coordinates", "Type", "Label", "Note", "Color")
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9)`)
+	if err != nil {
+		return 0, err
+	}
+	defer statement.Close()
+
+	for i, selection := range template.Selections {
+		geometry, err := pageGeometryValue(selection.PageGeometry)
+		if err != nil {
+			return 0, err
+		}
+
+		coordinates, err := coordinatesValue(selection.Coordinates)
+		if err != nil {
+			return 0, err
+		}
+
+		if _, err := statement.Exec(template.Uuid, i, selection.PageKey, geometry, coordinates, selection.Type, selection.Label, selection.Note, selection.Color); err != nil {
+			return 0, err
+		}
+	}
+
+	return version, nil
+}
+
+// pageGeometryValue encodes the geometry of a page for the json column, unknown geometry is stored as null.
+func pageGeometryValue(geometry *models.PageGeometry) (any, error) {
+	if geometry == nil {
+		return nil, nil
+	}
+
+	bytes, err := json.Marshal(geometry)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(bytes), nil
+}
+
+// templateColumns are the columns read by scanTemplate, in order.
+const templateColumns = `"Template_UUID", "Owner_UUID", "Name", "Version", "Source_Document_UUID", "Created_At"`
+
+func scanTemplate(row rowScanner) (models.SelectionTemplate, error) {
+	template := models.SelectionTemplate{}
+	err := row.Scan(&template.Uuid, &template.OwnerUUID, &template.Name, &template.Version, &template.SourceDocumentUUID, &template.CreatedAt)
+	return template, err
+}
+
+func getTemplatesFunction(ownerUid uuid.UUID, name *string, callback func(data []models.SelectionTemplate)) func(db *sql.DB) error {
+	return func(db *sql.DB) error {
+		sqlStatement := `SELECT ` + templateColumns + ` FROM selectiontemplate_table WHERE "Owner_UUID" = $1`
+		args := []any{ownerUid}
+
+		if name != nil {
+			sqlStatement += ` AND "Name" = $2`
+			args = append(args, *name)
+		}
+
+		rows, err := db.Query(sqlStatement+` ORDER BY "Name", "Version" DESC`, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		templates := make([]models.SelectionTemplate, 0)
+		for rows.Next() {
+			template, err := scanTemplate(rows)
+			if err != nil {
+				return err
+			}
+
+			templates = append(templates, template)
+		}
+
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		callback(templates)
+		return nil
+	}
+}
+
+func getTemplateFunction(uid, ownerUid uuid.UUID, callback func(data models.SelectionTemplate)) func(db *sql.DB) error {
+	return func(db *sql.DB) error {
+		row := db.QueryRow(`SELECT `+templateColumns+` FROM selectiontemplate_table WHERE "Template_UUID" = $1 AND "Owner_UUID" = $2`, uid, ownerUid)
+		template, err := scanTemplate(row)
+		if err != nil {
+			return err
+		}
+
+		rows, err := db.Query(`SELECT "Page_Key", "Page_Geometry", "Coordinates", "Type", "Label", "Note", "Color"
+			FROM selectiontemplateentry_table WHERE "Template_UUID" = $1 ORDER BY "Position"`, uid)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		template.Selections = make([]models.TemplateSelection, 0)
+		for rows.Next() {
+			selection := models.TemplateSelection{}
+			var geometry, coordinates []byte
+			if err := rows.Scan(&selection.PageKey, &geometry, &coordinates, &selection.Type, &selection.Label, &selection.Note, &selection.Color); err != nil {
+				return err
+			}
+
+			if geometry != nil {
+				selection.PageGeometry = &models.PageGeometry{}
+				if err := json.Unmarshal(geometry, selection.PageGeometry); err != nil {
+					return err
+				}
+			}
+
+			if coordinates != nil {
+				selection.Coordinates = &models.Coordinates{}
+				if err := json.Unmarshal(coordinates, selection.Coordinates); err != nil {
+					return err
+				}
+			}
+
+			template.Selections = append(template.Selections, selection)
+		}
+
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		callback(template)
+		return nil
+	}
+}
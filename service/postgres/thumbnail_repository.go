@@ -0,0 +1,73 @@
+package postgres
+
+import (
+	"database/sql"
+	"log/slog"
+	"pdf_service_api/models"
+)
+
+type thumbnailRepository struct {
+	databaseManager DatabaseHandler
+}
+
+func NewThumbnailRepository(db DatabaseHandler) models.ThumbnailRepository {
+	return thumbnailRepository{databaseManager: db}
+}
+
+// WithLogger returns a copy of the repository that logs its database calls with the logger.
+func (r thumbnailRepository) WithLogger(logger *slog.Logger) models.ThumbnailRepository {
+	r.databaseManager.Logger = logger
+	return r
+}
+
+func (r thumbnailRepository) GetThumbnail(thumbnail models.Thumbnail) (models.Thumbnail, error) {
+	stored := models.Thumbnail{}
+	err := r.databaseManager.WithConnection(getThumbnailFunction(thumbnail, func(data models.Thumbnail) {
+		stored = data
+	}))
+	if err != nil {
+		return models.Thumbnail{}, err
+	}
+
+	return stored, nil
+}
+
+func (r thumbnailRepository) SaveThumbnail(thumbnail models.Thumbnail) error {
+	err := r.databaseManager.WithConnection(saveThumbnailFunction(thumbnail))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func getThumbnailFunction(thumbnail models.Thumbnail, callback func(data models.Thumbnail)) func(db *sql.DB) error {
+	return func(db *sql.DB) error {
+		sqlStatement := `SELECT "Document_UUID", "Page_Key", "Width", "Height", "Fit", "Mime_Type", "Source_ETag", "Data" FROM pagethumbnail_table WHERE "Document_UUID" = $1 and "Page_Key" = $2 and "Width" = $3 and "Height" = $4 and "Fit" = $5 and "Mime_Type" = $6`
+
+		row := db.QueryRow(sqlStatement, thumbnail.DocumentUUID, thumbnail.PageKey, thumbnail.Width, thumbnail.Height, thumbnail.Fit, thumbnail.MimeType)
+
+		stored := models.Thumbnail{}
+		err := row.Scan(&stored.DocumentUUID, &stored.PageKey, &stored.Width, &stored.Height, &stored.Fit, &stored.MimeType, &stored.SourceETag, &stored.Data)
+		if err != nil {
+			return err
+		}
+
+		callback(stored)
+		return nil
+	}
+}
+
+func saveThumbnailFunction(thumbnail models.Thumbnail) func(db *sql.DB) error {
+	return func(db *sql.DB) error {
+		sqlStatement := `INSERT INTO pagethumbnail_table ("Document_UUID", "Page_Key", "Width", "Height", "Fit", "Mime_Type", "Source_ETag", "Data") values ($1, $2, $3, $4, $5, $6, $7, $8)
+			ON CONFLICT ("Document_UUID", "Page_Key", "Width", "Height", "Fit", "Mime_Type") DO UPDATE SET "Source_ETag" = excluded."Source_ETag", "Data" = excluded."Data", "Time_Created" = now()`
+
+		_, err := db.Exec(sqlStatement, thumbnail.DocumentUUID, thumbnail.PageKey, thumbnail.Width, thumbnail.Height, thumbnail.Fit, thumbnail.MimeType, thumbnail.SourceETag, thumbnail.Data)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}
+}